@@ -2,14 +2,18 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"log"
+	"log/slog"
 	"os"
 	"path/filepath"
 
 	"github.com/anthropics/m/internal/api"
 	"github.com/anthropics/m/internal/config"
+	"github.com/anthropics/m/internal/server"
 	"github.com/anthropics/m/internal/store"
+	"github.com/anthropics/m/internal/tracing"
 )
 
 func main() {
@@ -21,14 +25,26 @@ func main() {
 		log.Fatalf("failed to load config: %v", err)
 	}
 
+	logger, err := api.NewLogger(os.Stderr, cfg.Logging.Level, cfg.Logging.Format)
+	if err != nil {
+		log.Fatalf("failed to configure logging: %v", err)
+	}
+	slog.SetDefault(logger)
+
+	shutdownTracing, err := tracing.Setup(context.Background(), server.TracingConfig(cfg.Tracing, "m-server"))
+	if err != nil {
+		log.Fatalf("failed to configure tracing: %v", err)
+	}
+	defer server.FlushTracing(shutdownTracing)
+
 	// Validate required fields
 	if cfg.Server.APIKey == "" || cfg.Server.APIKey == "your-api-key-here" {
-		log.Printf("warning: API key not configured, set M_API_KEY environment variable")
+		slog.Warn("API key not configured, set M_API_KEY environment variable")
 	}
 
 	// Log claude binary location for debugging
 	claudeBin := cfg.Claude.FindClaudeBinary()
-	log.Printf("using claude binary: %s", claudeBin)
+	slog.Info("using claude binary", "path", claudeBin)
 
 	// Ensure data directory exists
 	dbDir := filepath.Dir(cfg.Storage.Path)
@@ -37,7 +53,7 @@ func main() {
 	}
 
 	// Initialize store
-	s, err := store.New(cfg.Storage.Path)
+	s, err := store.Open(cfg.Storage.Driver, cfg.Storage.Source())
 	if err != nil {
 		log.Fatalf("failed to initialize store: %v", err)
 	}
@@ -49,12 +65,7 @@ func main() {
 	}
 
 	// Create and run server
-	srv := api.New(api.Config{
-		Port:           cfg.Server.Port,
-		APIKey:         cfg.Server.APIKey,
-		WorkspacesPath: cfg.Workspaces.Path,
-		DemoMode:       cfg.Server.DemoMode,
-	}, s)
+	srv := api.New(server.APIConfig(cfg, claudeBin), s)
 
 	if err := srv.Run(); err != nil {
 		log.Fatalf("server error: %v", err)
@@ -0,0 +1,203 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"text/tabwriter"
+	"time"
+
+	"github.com/anthropics/m/internal/config"
+	"github.com/anthropics/m/internal/migrate"
+	"github.com/anthropics/m/internal/session"
+	"github.com/anthropics/m/internal/store"
+	"github.com/spf13/cobra"
+)
+
+var dbCmd = &cobra.Command{
+	Use:   "db",
+	Short: "Manage the M database",
+	Long:  `Inspect and maintain the M server database.`,
+}
+
+var dbMigrateCmd = &cobra.Command{
+	Use:   "migrate",
+	Short: "Apply database schema migrations",
+	Long: `Apply pending schema migrations to the server database (storage.path, or
+storage.dsn with the postgres driver).
+
+The server applies all pending migrations on startup; this command lets you
+inspect the schema version or upgrade step by step. Downgrades are not
+supported.
+
+Examples:
+  m db migrate              # apply all pending migrations
+  m db migrate --status     # list migrations and when they were applied
+  m db migrate --to 5       # apply migrations up to version 5`,
+	Args: cobra.NoArgs,
+	RunE: runDBMigrate,
+}
+
+var dbBackupCmd = &cobra.Command{
+	Use:   "backup <path>",
+	Short: "Back up the database while the server runs",
+	Long: `Write a consistent copy of the SQLite server database (storage.path) to a
+new file, using SQLite's online backup API. The server can keep running and
+writing while the copy is made. The copy is integrity-checked before it is
+moved into place.
+
+PostgreSQL databases are backed up with pg_dump instead.
+
+Examples:
+  m db backup ./backups/m-before-upgrade.db`,
+	Args: cobra.ExactArgs(1),
+	RunE: runDBBackup,
+}
+
+var dbRestoreCmd = &cobra.Command{
+	Use:   "restore <path>",
+	Short: "Replace the database with a backup",
+	Long: `Replace the SQLite server database (storage.path) with a backup made by
+m db backup or a scheduled backup. The backup must pass an integrity check
+and must not come from a newer version of M.
+
+The server must be stopped first: restore locks the database before
+replacing it, and refuses to run while the server or any other process has
+it open. The replaced database is kept next to it as
+<storage.path>.before-restore.
+
+Examples:
+  m db restore ./data/backups/m-20260101-030000.db`,
+	Args: cobra.ExactArgs(1),
+	RunE: runDBRestore,
+}
+
+var (
+	dbConfigPath string
+	dbSessionDB  string
+	migrateTo    int
+	migrateShow  bool
+)
+
+func init() {
+	dbCmd.PersistentFlags().StringVarP(&dbConfigPath, "config", "c", "", "path to config file (default: ~/.m/config.yaml)")
+	dbMigrateCmd.Flags().BoolVar(&migrateShow, "status", false, "show migration status instead of migrating")
+	dbMigrateCmd.Flags().IntVar(&migrateTo, "to", 0, "migrate up to this version (default: latest)")
+	dbMigrateCmd.Flags().StringVar(&dbSessionDB, "session-db", "", "also migrate this session database")
+	dbCmd.AddCommand(dbMigrateCmd)
+	dbCmd.AddCommand(dbBackupCmd)
+	dbCmd.AddCommand(dbRestoreCmd)
+}
+
+// loadDBConfig loads the config file given with --config.
+func loadDBConfig() (*config.Config, error) {
+	cfgPath := dbConfigPath
+	if cfgPath == "" {
+		cfgPath = defaultConfigPath()
+	}
+	return config.Load(cfgPath)
+}
+
+func runDBMigrate(cmd *cobra.Command, args []string) error {
+	cfg, err := loadDBConfig()
+	if err != nil {
+		return err
+	}
+
+	type database struct {
+		label   string // Shown in output; never a DSN, which may hold a password
+		migrate func(target int) error
+		status  func() ([]migrate.Status, error)
+	}
+	driver, source := cfg.Storage.Driver, cfg.Storage.Source()
+	server := database{
+		label:   "server database " + source,
+		migrate: func(target int) error { return store.Migrate(driver, source, target) },
+		status:  func() ([]migrate.Status, error) { return store.MigrationStatus(driver, source) },
+	}
+	if driver == store.DriverPostgres {
+		server.label = "server database (postgres)"
+	}
+	dbs := []database{server}
+	if dbSessionDB != "" {
+		dbs = append(dbs, database{
+			label:   "session database " + dbSessionDB,
+			migrate: func(target int) error { return session.Migrate(dbSessionDB, target) },
+			status:  func() ([]migrate.Status, error) { return session.MigrationStatus(dbSessionDB) },
+		})
+	}
+
+	out := cmd.OutOrStdout()
+	for _, db := range dbs {
+		if !migrateShow {
+			if err := db.migrate(migrateTo); err != nil {
+				return fmt.Errorf("%s: %w", db.label, err)
+			}
+		}
+		statuses, err := db.status()
+		if err != nil {
+			return fmt.Errorf("%s: %w", db.label, err)
+		}
+		fmt.Fprintln(out, db.label)
+		printMigrationStatus(out, statuses)
+	}
+	return nil
+}
+
+func printMigrationStatus(w io.Writer, statuses []migrate.Status) {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "  VERSION\tNAME\tAPPLIED")
+	for _, s := range statuses {
+		applied := "pending"
+		if s.Applied() {
+			applied = s.AppliedAt.Local().Format(time.DateTime)
+		}
+		fmt.Fprintf(tw, "  %d\t%s\t%s\n", s.Version, s.Name, applied)
+	}
+	tw.Flush()
+}
+
+func runDBBackup(cmd *cobra.Command, args []string) error {
+	cfg, err := loadDBConfig()
+	if err != nil {
+		return err
+	}
+	if cfg.Storage.Driver == store.DriverPostgres {
+		return store.ErrBackupUnsupported
+	}
+
+	if err := store.BackupFile(cfg.Storage.Path, args[0]); err != nil {
+		return err
+	}
+	fmt.Fprintf(cmd.OutOrStdout(), "backed up %s to %s\n", cfg.Storage.Path, args[0])
+	return nil
+}
+
+func runDBRestore(cmd *cobra.Command, args []string) error {
+	cfg, err := loadDBConfig()
+	if err != nil {
+		return err
+	}
+	if cfg.Storage.Driver == store.DriverPostgres {
+		return errors.New("restore is only supported for SQLite; restore PostgreSQL with pg_restore")
+	}
+
+	// A running server answers on its hook socket. Restore also fails to
+	// lock a database that a server using another socket has open.
+	if conn, err := net.Dial("unix", cfg.SocketPath()); err == nil {
+		conn.Close()
+		return fmt.Errorf("the server is running (%s answers); stop it before restoring", cfg.SocketPath())
+	}
+
+	previous, err := store.Restore(args[0], cfg.Storage.Path)
+	if err != nil {
+		return err
+	}
+	out := cmd.OutOrStdout()
+	fmt.Fprintf(out, "restored %s from %s\n", cfg.Storage.Path, args[0])
+	if previous != "" {
+		fmt.Fprintf(out, "previous database kept at %s\n", previous)
+	}
+	return nil
+}
@@ -13,4 +13,6 @@ var rootCmd = &cobra.Command{
 func init() {
 	rootCmd.AddCommand(serveCmd)
 	rootCmd.AddCommand(configCmd)
+	rootCmd.AddCommand(dbCmd)
+	rootCmd.AddCommand(searchCmd)
 }
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/anthropics/m/internal/config"
+	"github.com/anthropics/m/internal/store"
+	"github.com/spf13/cobra"
+)
+
+var searchCmd = &cobra.Command{
+	Use:   "search <words...>",
+	Short: "Search runs, output and interactions",
+	Long: `Search run prompts, agent output, tool calls and approval and input
+interactions in the server database (storage.path, or storage.dsn with the
+postgres driver). Results list every match newest first, with its run, repo
+and the text around the matched words.
+
+Examples:
+  m search billing module              # runs that touched the billing module
+  m search migration --kind interaction # where a migration was approved
+  m search timeout --repo api --limit 50`,
+	Args: cobra.MinimumNArgs(1),
+	RunE: runSearch,
+}
+
+var (
+	searchConfigPath string
+	searchRepo       string
+	searchKinds      []string
+	searchLimit      int
+)
+
+func init() {
+	searchCmd.Flags().StringVarP(&searchConfigPath, "config", "c", "", "path to config file (default: ~/.m/config.yaml)")
+	searchCmd.Flags().StringVar(&searchRepo, "repo", "", "only search this repo (name or ID)")
+	searchCmd.Flags().StringSliceVar(&searchKinds, "kind", nil, "only these kinds: prompt, output, tool_call, interaction")
+	searchCmd.Flags().IntVar(&searchLimit, "limit", 20, "maximum number of results")
+}
+
+func runSearch(cmd *cobra.Command, args []string) error {
+	cfgPath := searchConfigPath
+	if cfgPath == "" {
+		cfgPath = defaultConfigPath()
+	}
+	cfg, err := config.Load(cfgPath)
+	if err != nil {
+		return err
+	}
+
+	filter := store.SearchFilter{
+		Query: strings.Join(args, " "),
+		Page:  store.Page{Limit: min(searchLimit, store.MaxPageLimit)},
+	}
+	for _, k := range searchKinds {
+		kind := store.SearchKind(k)
+		if !slices.Contains(store.SearchKinds, kind) {
+			return fmt.Errorf("unknown kind %q", k)
+		}
+		filter.Kinds = append(filter.Kinds, kind)
+	}
+
+	s, err := store.Open(cfg.Storage.Driver, cfg.Storage.Source())
+	if err != nil {
+		return err
+	}
+	defer s.Close()
+
+	if searchRepo != "" {
+		repo, err := s.GetRepoByName(searchRepo)
+		if errors.Is(err, store.ErrNotFound) {
+			repo, err = s.GetRepo(searchRepo)
+		}
+		if errors.Is(err, store.ErrNotFound) {
+			return fmt.Errorf("repo %q not found", searchRepo)
+		}
+		if err != nil {
+			return err
+		}
+		filter.RepoID = repo.ID
+	}
+
+	results, _, err := s.Search(filter)
+	if err != nil {
+		return err
+	}
+	out := cmd.OutOrStdout()
+	if len(results) == 0 {
+		fmt.Fprintln(out, "no matches")
+		return nil
+	}
+	printSearchResults(out, results, isTerminal(out))
+	return nil
+}
+
+// printSearchResults writes each result as a header line and an indented
+// snippet. Matched words are shown in bold when bold is set.
+func printSearchResults(w io.Writer, results []*store.SearchResult, bold bool) {
+	for i, r := range results {
+		if i > 0 {
+			fmt.Fprintln(w)
+		}
+		where := string(r.Kind)
+		if r.Seq > 0 {
+			where += fmt.Sprintf(" #%d", r.Seq)
+		}
+		fmt.Fprintf(w, "%s  %s  run %s (%s)  %s\n",
+			r.CreatedAt.Local().Format(time.DateTime), r.RepoName, r.Run.ID, r.Run.State, where)
+
+		var b strings.Builder
+		for _, p := range r.Snippet {
+			if p.Match && bold {
+				b.WriteString("\x1b[1m" + p.Text + "\x1b[0m")
+			} else {
+				b.WriteString(p.Text)
+			}
+		}
+		// Output snippets span lines; keep each result's snippet on one.
+		fmt.Fprintf(w, "    %s\n", strings.Join(strings.Fields(b.String()), " "))
+	}
+}
+
+// isTerminal reports whether w is a terminal that should get ANSI styling.
+func isTerminal(w io.Writer) bool {
+	f, ok := w.(*os.File)
+	if !ok || os.Getenv("NO_COLOR") != "" {
+		return false
+	}
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
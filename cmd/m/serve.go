@@ -1,13 +1,17 @@
 package main
 
 import (
+	"context"
 	"log"
+	"log/slog"
 	"os"
 	"path/filepath"
 
 	"github.com/anthropics/m/internal/api"
 	"github.com/anthropics/m/internal/config"
+	"github.com/anthropics/m/internal/server"
 	"github.com/anthropics/m/internal/store"
+	"github.com/anthropics/m/internal/tracing"
 	"github.com/spf13/cobra"
 )
 
@@ -36,14 +40,26 @@ func runServe(cmd *cobra.Command, args []string) error {
 		return err
 	}
 
+	logger, err := api.NewLogger(os.Stderr, cfg.Logging.Level, cfg.Logging.Format)
+	if err != nil {
+		return err
+	}
+	slog.SetDefault(logger)
+
+	shutdownTracing, err := tracing.Setup(context.Background(), server.TracingConfig(cfg.Tracing, "m"))
+	if err != nil {
+		return err
+	}
+	defer server.FlushTracing(shutdownTracing)
+
 	// Validate required fields
 	if cfg.Server.APIKey == "" || cfg.Server.APIKey == "your-api-key-here" {
-		log.Printf("warning: API key not configured, set M_API_KEY or use 'm config set server/api_key <key>'")
+		slog.Warn("API key not configured, set M_API_KEY or use 'm config set server/api_key <key>'")
 	}
 
 	// Log claude binary location for debugging
 	claudeBin := cfg.Claude.FindClaudeBinary()
-	log.Printf("using claude binary: %s", claudeBin)
+	slog.Info("using claude binary", "path", claudeBin)
 
 	// Ensure data directory exists
 	dbDir := filepath.Dir(cfg.Storage.Path)
@@ -52,7 +68,7 @@ func runServe(cmd *cobra.Command, args []string) error {
 	}
 
 	// Initialize store
-	s, err := store.New(cfg.Storage.Path)
+	s, err := store.Open(cfg.Storage.Driver, cfg.Storage.Source())
 	if err != nil {
 		log.Fatalf("failed to initialize store: %v", err)
 	}
@@ -64,13 +80,7 @@ func runServe(cmd *cobra.Command, args []string) error {
 	}
 
 	// Create and run server
-	srv := api.New(api.Config{
-		Port:           cfg.Server.Port,
-		APIKey:         cfg.Server.APIKey,
-		WorkspacesPath: cfg.Workspaces.Path,
-		DemoMode:       cfg.Server.DemoMode,
-	}, s)
-
-	log.Printf("Starting server on port %d", cfg.Server.Port)
+	srv := api.New(server.APIConfig(cfg, claudeBin), s)
+
 	return srv.Run()
 }
@@ -6,7 +6,7 @@ set -euo pipefail
 
 # === Configuration (set by M when spawning agent) ===
 : "${M_RUN_ID:?M_RUN_ID not set}"
-: "${M_SERVER_URL:?M_SERVER_URL not set}"
+: "${M_SERVER_SOCKET:?M_SERVER_SOCKET not set}"
 : "${M_API_KEY:?M_API_KEY not set}"
 : "${M_APPROVAL_TOOLS:=Edit Write Bash NotebookEdit}"
 : "${M_INPUT_TOOLS:=AskUserQuestion}"
@@ -89,7 +89,8 @@ request_interaction() {
     http_code=$(curl -s -w "%{http_code}" \
       --connect-timeout 10 \
       --max-time "$M_HOOK_TIMEOUT" \
-      -X POST "$M_SERVER_URL/api/internal/interaction-request" \
+      --unix-socket "$M_SERVER_SOCKET" \
+      -X POST "http://localhost/api/internal/interaction-request" \
       -H "Content-Type: application/json" \
       -H "Authorization: Bearer $M_API_KEY" \
       -H "X-M-Hook-Version: 1" \
@@ -108,6 +109,9 @@ request_interaction() {
     if [[ "$http_code" == "200" ]]; then
       if echo "$response" | jq -e '.decision' >/dev/null 2>&1; then
         log_debug "Got response: $response"
+        if echo "$response" | jq -e '.updated_input' >/dev/null 2>&1; then
+          log_debug "Reviewer modified tool input for $TOOL_NAME"
+        fi
         echo "$response"
         return 0
       else
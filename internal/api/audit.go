@@ -0,0 +1,271 @@
+package api
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/anthropics/m/internal/store"
+)
+
+// Audit actions recorded by handlers.
+const (
+	auditRepoCreate       = "repo.create"
+	auditRepoUpdate       = "repo.update"
+	auditRepoDelete       = "repo.delete"
+	auditMemberSet        = "member.set"
+	auditMemberRemove     = "member.remove"
+	auditRunCreate        = "run.create"
+	auditRunCancel        = "run.cancel"
+	auditRunInput         = "run.input"
+	auditRunImport        = "run.import"
+	auditApprovalCreate   = "approval.create"
+	auditApprovalResolve  = "approval.resolve"
+	auditInputResolve     = "input.resolve"
+	auditDeviceRegister   = "device.register"
+	auditDeviceUnregister = "device.unregister"
+	auditUserCreate       = "user.create"
+	auditUserDelete       = "user.delete"
+	auditTokenCreate      = "token.create"
+	auditTokenRevoke      = "token.revoke"
+	auditAccessDenied     = "access.denied"
+)
+
+// defaultAuditExportLimit caps the number of entries in a JSONL export unless
+// a limit is given.
+const defaultAuditExportLimit = 10000
+
+// auditAction is an action noted by a handler for the current request.
+type auditAction struct {
+	action     string
+	targetType string
+	targetID   string
+	details    any
+}
+
+// auditRecord collects the actions of one request.
+type auditRecord struct {
+	actions []auditAction
+}
+
+type auditKey struct{}
+
+// audit notes an action on the current request. The audit middleware writes
+// it to the audit log, together with the actor and request metadata, once
+// the handler has returned.
+func audit(r *http.Request, action, targetType, targetID string, details any) {
+	rec, ok := r.Context().Value(auditKey{}).(*auditRecord)
+	if !ok {
+		return
+	}
+	rec.actions = append(rec.actions, auditAction{
+		action:     action,
+		targetType: targetType,
+		targetID:   targetID,
+		details:    details,
+	})
+}
+
+// AuditMiddleware writes actions noted by handlers to the audit log. Requests
+// rejected for missing scope are recorded as access.denied.
+func AuditMiddleware(st store.Backend) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			rec := &auditRecord{}
+			wrapped := &statusWriter{ResponseWriter: w, status: http.StatusOK}
+
+			next.ServeHTTP(wrapped, r.WithContext(context.WithValue(r.Context(), auditKey{}, rec)))
+
+			actions := rec.actions
+			if len(actions) == 0 && wrapped.status == http.StatusForbidden {
+				actions = []auditAction{{action: auditAccessDenied, targetType: "path", targetID: r.URL.Path}}
+			}
+
+			for _, a := range actions {
+				entry := newAuditEntry(r, wrapped.status, a)
+				if err := st.WithContext(r.Context()).CreateAuditEntry(entry); err != nil {
+					loggerFrom(r.Context()).Error("audit: write entry", "action", a.action, "target_id", a.targetID, "err", err)
+				}
+			}
+		})
+	}
+}
+
+func newAuditEntry(r *http.Request, status int, a auditAction) *store.AuditEntry {
+	entry := &store.AuditEntry{
+		Actor:      "anonymous",
+		Action:     a.action,
+		TargetType: a.targetType,
+		TargetID:   a.targetID,
+		Method:     r.Method,
+		Path:       auditPath(r.URL.Path),
+		Status:     status,
+		RemoteAddr: r.RemoteAddr,
+		UserAgent:  r.UserAgent(),
+	}
+
+	if p := PrincipalFromContext(r.Context()); p != nil {
+		entry.Actor = p.Name
+		if p.TokenID != "" {
+			entry.TokenID = &p.TokenID
+		}
+		if p.UserID != "" {
+			entry.UserID = &p.UserID
+		}
+	}
+
+	if a.details != nil {
+		if b, err := json.Marshal(a.details); err == nil {
+			d := string(b)
+			entry.Details = &d
+		}
+	}
+
+	return entry
+}
+
+// auditDeviceID identifies a push device token in the audit log without
+// recording the token itself: a prefix of its SHA-256.
+func auditDeviceID(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return "sha256:" + hex.EncodeToString(sum[:8])
+}
+
+// auditPath returns a request path for the audit log, with device tokens in
+// /api/devices/{token} replaced by their auditDeviceID.
+func auditPath(path string) string {
+	if token, ok := strings.CutPrefix(path, "/api/devices/"); ok && token != "" {
+		return "/api/devices/" + auditDeviceID(token)
+	}
+	return path
+}
+
+// auditEntryResponse represents an audit entry in API responses.
+type auditEntryResponse struct {
+	ID         int64           `json:"id"`
+	TokenID    *string         `json:"token_id,omitempty"`
+	UserID     *string         `json:"user_id,omitempty"`
+	Actor      string          `json:"actor"`
+	Action     string          `json:"action"`
+	TargetType string          `json:"target_type"`
+	TargetID   string          `json:"target_id"`
+	Method     string          `json:"method"`
+	Path       string          `json:"path"`
+	Status     int             `json:"status"`
+	RemoteAddr string          `json:"remote_addr"`
+	UserAgent  string          `json:"user_agent,omitempty"`
+	Details    json.RawMessage `json:"details,omitempty"`
+	CreatedAt  int64           `json:"created_at"`
+}
+
+func toAuditEntryResponse(e *store.AuditEntry) auditEntryResponse {
+	resp := auditEntryResponse{
+		ID:         e.ID,
+		TokenID:    e.TokenID,
+		UserID:     e.UserID,
+		Actor:      e.Actor,
+		Action:     e.Action,
+		TargetType: e.TargetType,
+		TargetID:   e.TargetID,
+		Method:     e.Method,
+		Path:       e.Path,
+		Status:     e.Status,
+		RemoteAddr: e.RemoteAddr,
+		UserAgent:  e.UserAgent,
+		CreatedAt:  e.CreatedAt.Unix(),
+	}
+	if e.Details != nil {
+		resp.Details = json.RawMessage(*e.Details)
+	}
+	return resp
+}
+
+// handleListAudit returns audit entries, newest first. Supports filtering by
+// user_id, token_id, action, target_type, target_id, since and until (Unix
+// seconds). With format=jsonl the entries are streamed as JSON lines for export.
+func (s *Server) handleListAudit(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	filter := store.AuditFilter{
+		UserID:     q.Get("user_id"),
+		TokenID:    q.Get("token_id"),
+		Action:     q.Get("action"),
+		TargetType: q.Get("target_type"),
+		TargetID:   q.Get("target_id"),
+	}
+
+	for _, p := range []struct {
+		name string
+		dst  *time.Time
+	}{{"since", &filter.Since}, {"until", &filter.Until}} {
+		if v := q.Get(p.name); v != "" {
+			sec, err := strconv.ParseInt(v, 10, 64)
+			if err != nil {
+				writeError(w, http.StatusBadRequest, "invalid_input", p.name+" must be a Unix timestamp")
+				return
+			}
+			*p.dst = time.Unix(sec, 0)
+		}
+	}
+
+	format := q.Get("format")
+	if format != "" && format != "json" && format != "jsonl" {
+		writeError(w, http.StatusBadRequest, "invalid_input", "format must be 'json' or 'jsonl'")
+		return
+	}
+	if format == "jsonl" {
+		filter.Limit = defaultAuditExportLimit
+	}
+	if v := q.Get("limit"); v != "" {
+		limit, err := strconv.Atoi(v)
+		if err != nil || limit <= 0 {
+			writeError(w, http.StatusBadRequest, "invalid_input", "limit must be a positive integer")
+			return
+		}
+		filter.Limit = limit
+	}
+
+	entries, err := s.storeFor(r).ListAuditEntries(filter)
+	if err != nil {
+		loggerFrom(r.Context()).Error("list-audit", "err", err)
+		writeError(w, http.StatusInternalServerError, "internal_error", "failed to list audit log")
+		return
+	}
+
+	if format == "jsonl" {
+		w.Header().Set("Content-Type", "application/x-ndjson")
+		w.Header().Set("Content-Disposition", `attachment; filename="audit.jsonl"`)
+		w.WriteHeader(http.StatusOK)
+		enc := json.NewEncoder(w)
+		for _, e := range entries {
+			enc.Encode(toAuditEntryResponse(e))
+		}
+		return
+	}
+
+	resp := make([]auditEntryResponse, len(entries))
+	for i, e := range entries {
+		resp[i] = toAuditEntryResponse(e)
+	}
+
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// auditResolved notes the resolution of an approval or input request.
+func auditResolved(r *http.Request, interaction *store.Interaction, approved bool, reason *string, modified bool) {
+	action := auditApprovalResolve
+	if interaction.Type == store.InteractionTypeInput {
+		action = auditInputResolve
+	}
+	audit(r, action, "interaction", interaction.ID, map[string]any{
+		"run_id":   interaction.RunID,
+		"tool":     interaction.Tool,
+		"approved": approved,
+		"reason":   reason,
+		"modified": modified,
+	})
+}
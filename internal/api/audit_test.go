@@ -0,0 +1,95 @@
+package api
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestAuditLog(t *testing.T) {
+	srv, cleanup := setupTestServer(t)
+	defer cleanup()
+
+	w := doRequest(srv, "POST", "/api/repos", map[string]string{"name": "audited"}, "Bearer test-key")
+	var repo repoResponse
+	json.NewDecoder(w.Body).Decode(&repo)
+
+	reader := "Bearer " + createTestToken(t, srv, "read")
+	if w := doRequest(srv, "DELETE", "/api/repos/"+repo.ID, nil, reader); w.Code != http.StatusForbidden {
+		t.Fatalf("delete with read token: got status %d, want %d", w.Code, http.StatusForbidden)
+	}
+
+	// Reads are not audited
+	doRequest(srv, "GET", "/api/repos", nil, reader)
+
+	w = doRequest(srv, "GET", "/api/audit?target_type=repo", nil, "Bearer test-key")
+	if w.Code != http.StatusOK {
+		t.Fatalf("list audit: got status %d", w.Code)
+	}
+	var entries []auditEntryResponse
+	json.NewDecoder(w.Body).Decode(&entries)
+	if len(entries) != 1 || entries[0].Action != auditRepoCreate || entries[0].TargetID != repo.ID {
+		t.Fatalf("repo entries = %+v", entries)
+	}
+	if entries[0].Actor != "api_key" || entries[0].Status != http.StatusCreated {
+		t.Errorf("entry actor = %q, status = %d", entries[0].Actor, entries[0].Status)
+	}
+
+	w = doRequest(srv, "GET", "/api/audit?action=access.denied", nil, "Bearer test-key")
+	json.NewDecoder(w.Body).Decode(&entries)
+	if len(entries) != 1 || entries[0].TokenID == nil || entries[0].Path != "/api/repos/"+repo.ID {
+		t.Errorf("denied entries = %+v", entries)
+	}
+
+	// Export as JSON lines
+	w = doRequest(srv, "GET", "/api/audit?format=jsonl", nil, "Bearer test-key")
+	if ct := w.Header().Get("Content-Type"); ct != "application/x-ndjson" {
+		t.Errorf("content type = %q", ct)
+	}
+	lines := 0
+	scanner := bufio.NewScanner(w.Body)
+	for scanner.Scan() {
+		var e auditEntryResponse
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			t.Fatalf("invalid JSONL line %q: %v", scanner.Text(), err)
+		}
+		lines++
+	}
+	// repo.create, user.create, token.create, access.denied
+	if lines != 4 {
+		t.Errorf("exported %d lines, want 4", lines)
+	}
+
+	if w := doRequest(srv, "GET", "/api/audit?since=yesterday", nil, "Bearer test-key"); w.Code != http.StatusBadRequest {
+		t.Errorf("invalid since: got status %d, want %d", w.Code, http.StatusBadRequest)
+	}
+}
+
+func TestAuditLog_DeviceTokens(t *testing.T) {
+	srv, cleanup := setupTestServer(t)
+	defer cleanup()
+
+	token := "apns-device-token-0123456789"
+	body := map[string]string{"token": token, "platform": "ios"}
+	if w := doRequest(srv, "POST", "/api/devices", body, "Bearer test-key"); w.Code != http.StatusCreated {
+		t.Fatalf("register: got status %d: %s", w.Code, w.Body.String())
+	}
+	if w := doRequest(srv, "DELETE", "/api/devices/"+token, nil, "Bearer test-key"); w.Code != http.StatusNoContent {
+		t.Fatalf("unregister: got status %d: %s", w.Code, w.Body.String())
+	}
+
+	w := doRequest(srv, "GET", "/api/audit?target_type=device", nil, "Bearer test-key")
+	var entries []auditEntryResponse
+	json.NewDecoder(w.Body).Decode(&entries)
+	if len(entries) != 2 {
+		t.Fatalf("device entries = %+v, want register and unregister", entries)
+	}
+	// Entries for one device share an ID, but the token is not recorded.
+	for _, e := range entries {
+		if e.TargetID != auditDeviceID(token) || strings.Contains(e.Path, token) {
+			t.Errorf("%s entry records target %q, path %q", e.Action, e.TargetID, e.Path)
+		}
+	}
+}
@@ -0,0 +1,78 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/anthropics/m/internal/store"
+)
+
+// hookTokenTTL bounds how long a per-run hook token is valid. Hook tokens are
+// also rejected as soon as their run is no longer active.
+const hookTokenTTL = 24 * time.Hour
+
+// Principal is the authenticated caller of a request.
+type Principal struct {
+	TokenID string        // Empty for the configured API key
+	UserID  string        // Empty for the API key and hook tokens
+	RunID   string        // Set for per-run hook tokens
+	Name    string        // Token name, for logs
+	Scopes  []store.Scope // Granted scopes
+}
+
+// HasScope returns true if the principal was granted the scope. Admin grants
+// every scope.
+func (p *Principal) HasScope(scope store.Scope) bool {
+	for _, s := range p.Scopes {
+		if s == scope || s == store.ScopeAdmin {
+			return true
+		}
+	}
+	return false
+}
+
+// limitKey identifies the principal's credential for rate limiting.
+func (p *Principal) limitKey() string {
+	if p.TokenID == "" {
+		return "api_key"
+	}
+	return p.TokenID
+}
+
+type principalKey struct{}
+
+func withPrincipal(ctx context.Context, p *Principal) context.Context {
+	return context.WithValue(ctx, principalKey{}, p)
+}
+
+// PrincipalFromContext returns the authenticated principal, or nil if the
+// request was not authenticated.
+func PrincipalFromContext(ctx context.Context) *Principal {
+	p, _ := ctx.Value(principalKey{}).(*Principal)
+	return p
+}
+
+// requireScope wraps a handler so it is only reachable with the given scope.
+func requireScope(scope store.Scope, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		p := PrincipalFromContext(r.Context())
+		if p == nil || !p.HasScope(scope) {
+			writeError(w, http.StatusForbidden, "forbidden", "token lacks required scope: "+string(scope))
+			return
+		}
+		next(w, r)
+	}
+}
+
+// IssueHookToken creates a short-lived token for the hook of a single run. The
+// token only grants the hook scope and is only accepted for that run's
+// interaction requests. Each run's agent is started with one, and it is revoked
+// when the run finishes.
+func (s *Server) IssueHookToken(runID string) (string, error) {
+	_, plaintext, err := s.store.CreateHookToken(runID, time.Now().Add(hookTokenTTL))
+	if err != nil {
+		return "", err
+	}
+	return plaintext, nil
+}
@@ -0,0 +1,113 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/anthropics/m/internal/store"
+)
+
+// BackupConfig schedules database backups.
+type BackupConfig struct {
+	Dir      string        // Backup directory; empty disables scheduled backups
+	Interval time.Duration // Time between backups
+	Keep     int           // Newest backups kept; 0 keeps all
+}
+
+// Scheduled backups are named m-<UTC time>.db, so they sort by age.
+const (
+	backupPrefix     = "m-"
+	backupSuffix     = ".db"
+	backupTimeFormat = "20060102-150405"
+)
+
+// runBackups backs the database up into backup.Dir every backup.Interval,
+// counted from the newest backup already there so that restarts do not
+// postpone backups, until stop is closed. A failed backup is retried after
+// another interval.
+func (s *Server) runBackups(stop <-chan struct{}) {
+	timer := time.NewTimer(s.nextBackup(time.Now()))
+	defer timer.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-timer.C:
+		}
+		if err := s.backupNow(time.Now()); errors.Is(err, store.ErrBackupUnsupported) {
+			slog.Warn("scheduled backups disabled", "err", err)
+			return
+		} else if err != nil {
+			slog.Error("scheduled backup failed", "err", err)
+		}
+		timer.Reset(s.backup.Interval)
+	}
+}
+
+// nextBackup returns how long after now the next scheduled backup is due.
+func (s *Server) nextBackup(now time.Time) time.Duration {
+	backups, err := listBackups(s.backup.Dir)
+	if err != nil || len(backups) == 0 {
+		return 0
+	}
+	newest := backups[len(backups)-1]
+	taken, err := time.Parse(backupTimeFormat, strings.TrimSuffix(strings.TrimPrefix(newest, backupPrefix), backupSuffix))
+	if err != nil {
+		return 0
+	}
+	return max(0, taken.Add(s.backup.Interval).Sub(now))
+}
+
+// backupNow writes a backup stamped with now and deletes the oldest backups
+// beyond backup.Keep.
+func (s *Server) backupNow(now time.Time) error {
+	if err := os.MkdirAll(s.backup.Dir, 0755); err != nil {
+		return fmt.Errorf("create backup directory: %w", err)
+	}
+	name := backupPrefix + now.UTC().Format(backupTimeFormat) + backupSuffix
+	if err := s.store.Backup(filepath.Join(s.backup.Dir, name)); err != nil {
+		return err
+	}
+	slog.Info("database backed up", "file", name, "dir", s.backup.Dir)
+
+	if s.backup.Keep <= 0 {
+		return nil
+	}
+	backups, err := listBackups(s.backup.Dir)
+	if err != nil {
+		return err
+	}
+	for len(backups) > s.backup.Keep {
+		if err := os.Remove(filepath.Join(s.backup.Dir, backups[0])); err != nil {
+			return fmt.Errorf("remove old backup: %w", err)
+		}
+		slog.Info("old backup removed", "file", backups[0])
+		backups = backups[1:]
+	}
+	return nil
+}
+
+// listBackups returns the names of the scheduled backups in dir, oldest
+// first.
+func listBackups(dir string) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	for _, e := range entries {
+		name := e.Name()
+		if e.Type().IsRegular() && strings.HasPrefix(name, backupPrefix) && strings.HasSuffix(name, backupSuffix) {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names, nil
+}
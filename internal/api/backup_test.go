@@ -0,0 +1,48 @@
+package api
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/anthropics/m/internal/store"
+)
+
+func TestBackups_ScheduleAndRotation(t *testing.T) {
+	s, err := store.New(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("failed to create store: %v", err)
+	}
+	defer s.Close()
+	dir := filepath.Join(t.TempDir(), "backups")
+	srv := New(Config{Port: 8080, APIKey: "test-key", Backup: BackupConfig{Dir: dir, Interval: 24 * time.Hour, Keep: 2}}, s)
+
+	start := time.Date(2026, 1, 1, 3, 0, 0, 0, time.UTC)
+	if d := srv.nextBackup(start); d != 0 {
+		t.Errorf("nextBackup without backups = %v, want now", d)
+	}
+
+	for day := range 3 {
+		if err := srv.backupNow(start.AddDate(0, 0, day)); err != nil {
+			t.Fatalf("backupNow: %v", err)
+		}
+	}
+	backups, err := listBackups(dir)
+	if err != nil {
+		t.Fatalf("listBackups: %v", err)
+	}
+	want := []string{"m-20260102-030000.db", "m-20260103-030000.db"}
+	if !reflect.DeepEqual(backups, want) {
+		t.Errorf("backups = %v, want %v", backups, want)
+	}
+
+	// The next backup is due an interval after the newest one, even across
+	// restarts.
+	if d := srv.nextBackup(start.AddDate(0, 0, 2).Add(time.Hour)); d != 23*time.Hour {
+		t.Errorf("nextBackup = %v, want 23h", d)
+	}
+	if d := srv.nextBackup(start.AddDate(0, 0, 5)); d != 0 {
+		t.Errorf("nextBackup when overdue = %v, want now", d)
+	}
+}
@@ -117,6 +117,16 @@ func CreateDemoScenario() []testutil.MockEvent {
 			Data:  "Demo task completed successfully!\n",
 		},
 
+		// Token usage of the session
+		{
+			Type: "usage",
+			Data: testutil.UsageData{
+				InputTokens:  1200,
+				OutputTokens: 350,
+				CostUSD:      0.0123,
+			},
+		},
+
 		// Exit
 		{
 			Type:  "exit",
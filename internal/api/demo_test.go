@@ -4,6 +4,8 @@ import (
 	"encoding/json"
 	"net/http"
 	"net/http/httptest"
+	"os/exec"
+	"reflect"
 	"strings"
 	"testing"
 	"time"
@@ -131,3 +133,153 @@ func TestDemoScenario(t *testing.T) {
 		t.Errorf("demo scenario delays too long (%v), should be under 30s for demos", totalDelay)
 	}
 }
+
+func TestSuperviseAgent_RecordsMetadata(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not installed")
+	}
+	s := testutil.NewTestStore(t)
+	srv := New(Config{Port: 8080, APIKey: "test-key", WorkspacesPath: t.TempDir()}, s)
+	repo, _ := s.CreateRepo("app", nil)
+
+	tests := []struct {
+		name      string
+		exit      testutil.ExitData
+		wantState store.RunState
+		wantError string
+	}{
+		{"success", testutil.ExitData{Code: 0}, store.RunStateCompleted, ""},
+		{"failure", testutil.ExitData{Code: 3, Error: "tests failed\nsee log"}, store.RunStateFailed, "tests failed"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path, err := srv.workspace.Create(tt.name, nil)
+			if err != nil {
+				t.Fatalf("create workspace: %v", err)
+			}
+			cmd := exec.Command("git", "-c", "user.name=m", "-c", "user.email=m@example.com", "init", "-q")
+			cmd.Dir = path
+			if out, err := cmd.CombinedOutput(); err != nil {
+				t.Fatalf("git init: %v\n%s", err, out)
+			}
+			cmd = exec.Command("git", "-c", "user.name=m", "-c", "user.email=m@example.com", "commit", "-q", "--allow-empty", "-m", "initial")
+			cmd.Dir = path
+			if out, err := cmd.CombinedOutput(); err != nil {
+				t.Fatalf("git commit: %v\n%s", err, out)
+			}
+			sha, _ := srv.workspace.HeadSHA(tt.name)
+			run, _ := s.CreateRunWithID(tt.name, repo.ID, "prompt", path)
+
+			agent := testutil.NewMockAgent([]testutil.MockEvent{
+				{Type: "stdout", Data: "working\n"},
+				{Type: "usage", Data: testutil.UsageData{InputTokens: 100, OutputTokens: 20, CostUSD: 0.5}},
+				{Type: "usage", Data: testutil.UsageData{InputTokens: 50, OutputTokens: 5, CostUSD: 0.25}},
+				{Type: "exit", Data: tt.exit},
+			})
+			agent.ModelName = "test-model"
+			srv.superviseAgent(run.ID, runConfig{AgentType: "mock"}, agent)
+
+			got, err := s.GetRun(run.ID)
+			if err != nil {
+				t.Fatalf("GetRun: %v", err)
+			}
+			if got.State != tt.wantState || got.ExitCode == nil || *got.ExitCode != tt.exit.Code {
+				t.Errorf("state %s, exit code %v; want %s, %d", got.State, got.ExitCode, tt.wantState, tt.exit.Code)
+			}
+			if (got.Error == nil) != (tt.wantError == "") || (got.Error != nil && *got.Error != tt.wantError) {
+				t.Errorf("error = %v, want %q", got.Error, tt.wantError)
+			}
+			if got.Agent == nil || *got.Agent != "mock" || got.Model == nil || *got.Model != "test-model" {
+				t.Errorf("agent %v, model %v", got.Agent, got.Model)
+			}
+			if got.BaseSHA == nil || *got.BaseSHA != sha || got.FinalSHA == nil || *got.FinalSHA != sha {
+				t.Errorf("base %v, final %v; want %s", got.BaseSHA, got.FinalSHA, sha)
+			}
+			if want := (store.RunUsage{InputTokens: 150, OutputTokens: 25, CostUSD: 0.75}); got.Usage != want {
+				t.Errorf("usage = %+v, want %+v", got.Usage, want)
+			}
+			if got.StartedAt == nil || got.FinishedAt == nil || got.FinishedAt.Before(*got.StartedAt) {
+				t.Errorf("started %v, finished %v", got.StartedAt, got.FinishedAt)
+			}
+		})
+	}
+}
+
+func TestSuperviseAgent_RunConfig(t *testing.T) {
+	s := testutil.NewTestStore(t)
+	srv := New(Config{Port: 8080, APIKey: "test-key", WorkspacesPath: t.TempDir(), SocketPath: "m.sock"}, s)
+	repo, _ := s.CreateRepo("app", nil)
+	t.Setenv("M_TEST_TOKEN", "s3cret")
+
+	exit := testutil.MockEvent{Type: "exit", Data: testutil.ExitData{Code: 0}}
+	slow := testutil.MockEvent{Type: "stdout", Delay: 5 * time.Second, Data: "never\n"}
+	usage := testutil.MockEvent{Type: "usage", Data: testutil.UsageData{CostUSD: 0.6}}
+	approval := testutil.MockEvent{Type: "request_approval", Data: testutil.ApprovalRequestData{Type: "command", Tool: "Read"}}
+
+	tests := []struct {
+		name      string
+		cfg       runConfig
+		events    []testutil.MockEvent
+		wantState store.RunState
+		wantError string
+	}{
+		{"cost limit", runConfig{MaxCostUSD: 1}, []testutil.MockEvent{usage, usage, slow, exit}, store.RunStateFailed, "run exceeded its cost limit of $1.00"},
+		{"time limit", runConfig{Timeout: 50 * time.Millisecond}, []testutil.MockEvent{slow, exit}, store.RunStateFailed, "run exceeded its time limit of 50ms"},
+		{"unset secret", runConfig{Secrets: map[string]string{"TOKEN": "M_TEST_UNSET"}, Allowed: []string{"M_TEST_UNSET"}}, []testutil.MockEvent{exit}, store.RunStateFailed, "secret TOKEN: server variable M_TEST_UNSET is not set"},
+		{"tool without approval", runConfig{ApprovalTools: []string{"Write"}}, []testutil.MockEvent{approval, exit}, store.RunStateCompleted, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			run, _ := s.CreateRun(repo.ID, "prompt", t.TempDir())
+			agent := testutil.NewMockAgent(tt.events)
+
+			done := make(chan struct{})
+			go func() {
+				srv.superviseAgent(run.ID, tt.cfg, agent)
+				close(done)
+			}()
+			select {
+			case <-done:
+			case <-time.After(3 * time.Second):
+				t.Fatal("agent was not stopped")
+			}
+
+			got, _ := s.GetRun(run.ID)
+			if got.State != tt.wantState {
+				t.Errorf("state = %s, want %s", got.State, tt.wantState)
+			}
+			var gotErr string
+			if got.Error != nil {
+				gotErr = *got.Error
+			}
+			if gotErr != tt.wantError {
+				t.Errorf("error = %q, want %q", gotErr, tt.wantError)
+			}
+			if interactions, _ := s.ListInteractions(run.ID, nil); len(interactions) != 0 {
+				t.Errorf("created %d interactions, want none", len(interactions))
+			}
+		})
+	}
+
+	// The agent starts with the run's environment and system prompt, and the
+	// variables its hook needs.
+	run, _ := s.CreateRun(repo.ID, "prompt", t.TempDir())
+	agent := testutil.NewMockAgent([]testutil.MockEvent{exit})
+	srv.superviseAgent(run.ID, runConfig{
+		SystemPrompt: "Keep changes small.",
+		Env:          map[string]string{"CI": "1"},
+		Secrets:      map[string]string{"TOKEN": "M_TEST_TOKEN"},
+		Allowed:      []string{"M_TEST_TOKEN"},
+	}, agent)
+	env := map[string]string{}
+	for _, kv := range agent.Env {
+		k, v, _ := strings.Cut(kv, "=")
+		env[k] = v
+	}
+	token := env["M_API_KEY"]
+	delete(env, "M_API_KEY")
+	want := map[string]string{"CI": "1", "TOKEN": "s3cret", "M_RUN_ID": run.ID, "M_SERVER_SOCKET": "m.sock"}
+	if !reflect.DeepEqual(env, want) || !strings.HasPrefix(token, "m_") || agent.SystemPrompt != "Keep changes small." {
+		t.Errorf("agent started with env %v, system prompt %q", agent.Env, agent.SystemPrompt)
+	}
+}
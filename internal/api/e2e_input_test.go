@@ -51,7 +51,7 @@ func TestE2E_InputFlow_WithEvents(t *testing.T) {
 		req.Header.Set("X-M-Request-ID", reqID)
 
 		w := httptest.NewRecorder()
-		srv.httpServer.Handler.ServeHTTP(w, req)
+		srv.socketServer.Handler.ServeHTTP(w, req)
 		respCh <- w
 	}()
 
@@ -97,7 +97,7 @@ func TestE2E_RunLifecycle_RunningToWaitingApproval(t *testing.T) {
 		req.Header.Set("X-M-Hook-Version", "1")
 		req.Header.Set("X-M-Request-ID", reqID)
 		w := httptest.NewRecorder()
-		srv.httpServer.Handler.ServeHTTP(w, req)
+		srv.socketServer.Handler.ServeHTTP(w, req)
 	}()
 
 	// Wait for state to change
@@ -153,7 +153,7 @@ func TestE2E_RunLifecycle_RunningToWaitingInput(t *testing.T) {
 		req.Header.Set("X-M-Hook-Version", "1")
 		req.Header.Set("X-M-Request-ID", reqID)
 		w := httptest.NewRecorder()
-		srv.httpServer.Handler.ServeHTTP(w, req)
+		srv.socketServer.Handler.ServeHTTP(w, req)
 	}()
 
 	// Wait for state to change
@@ -200,7 +200,7 @@ func TestE2E_RunLifecycle_WaitingApprovalToRunning(t *testing.T) {
 		req.Header.Set("X-M-Hook-Version", "1")
 		req.Header.Set("X-M-Request-ID", reqID)
 		w := httptest.NewRecorder()
-		srv.httpServer.Handler.ServeHTTP(w, req)
+		srv.socketServer.Handler.ServeHTTP(w, req)
 		respChan <- w
 	}()
 
@@ -279,7 +279,7 @@ func TestE2E_RunLifecycle_WaitingInputToRunning(t *testing.T) {
 		req.Header.Set("X-M-Hook-Version", "1")
 		req.Header.Set("X-M-Request-ID", reqID)
 		w := httptest.NewRecorder()
-		srv.httpServer.Handler.ServeHTTP(w, req)
+		srv.socketServer.Handler.ServeHTTP(w, req)
 		respChan <- w
 	}()
 
@@ -533,7 +533,7 @@ func TestE2E_RunLifecycle_RejectApprovalToFailed(t *testing.T) {
 		req.Header.Set("X-M-Hook-Version", "1")
 		req.Header.Set("X-M-Request-ID", reqID)
 		w := httptest.NewRecorder()
-		srv.httpServer.Handler.ServeHTTP(w, req)
+		srv.socketServer.Handler.ServeHTTP(w, req)
 		respChan <- w
 	}()
 
@@ -847,7 +847,7 @@ func TestE2E_RunLifecycle_InvalidStateTransitions(t *testing.T) {
 		req.Header.Set("X-M-Hook-Version", "1")
 		req.Header.Set("X-M-Request-ID", reqID)
 		w := httptest.NewRecorder()
-		srv.httpServer.Handler.ServeHTTP(w, req)
+		srv.socketServer.Handler.ServeHTTP(w, req)
 
 		if w.Code == http.StatusNotImplemented {
 			t.Skip("endpoint not implemented")
@@ -12,6 +12,7 @@ import (
 	"time"
 
 	"github.com/anthropics/m/internal/store"
+	"github.com/anthropics/m/internal/testutil"
 	"github.com/gorilla/websocket"
 )
 
@@ -1241,7 +1242,7 @@ func TestE2E_Internal_InteractionRequest_HeaderValidation(t *testing.T) {
 			}
 
 			w := httptest.NewRecorder()
-			srv.httpServer.Handler.ServeHTTP(w, req)
+			srv.socketServer.Handler.ServeHTTP(w, req)
 
 			// Skip if not implemented
 			if w.Code == http.StatusNotImplemented {
@@ -1328,7 +1329,7 @@ func TestE2E_Internal_InteractionRequest_BodyValidation(t *testing.T) {
 			req.Header.Set("X-M-Request-ID", "test-req-id")
 
 			w := httptest.NewRecorder()
-			srv.httpServer.Handler.ServeHTTP(w, req)
+			srv.socketServer.Handler.ServeHTTP(w, req)
 
 			// Skip if not implemented
 			if w.Code == http.StatusNotImplemented {
@@ -1392,7 +1393,7 @@ func TestE2E_Internal_InteractionRequest_ApprovalTools(t *testing.T) {
 			done := make(chan struct{})
 			go func() {
 				defer close(done)
-				srv.httpServer.Handler.ServeHTTP(w, req)
+				srv.socketServer.Handler.ServeHTTP(w, req)
 			}()
 
 			// Wait a bit for the interaction to be created
@@ -1485,7 +1486,7 @@ func TestE2E_Internal_InteractionRequest_InputTools(t *testing.T) {
 			done := make(chan struct{})
 			go func() {
 				defer close(done)
-				srv.httpServer.Handler.ServeHTTP(w, req)
+				srv.socketServer.Handler.ServeHTTP(w, req)
 			}()
 
 			// Wait a bit for the interaction to be created
@@ -1572,7 +1573,7 @@ func TestE2E_Internal_InteractionRequest_Idempotency(t *testing.T) {
 		req1.Header.Set("Authorization", "Bearer test-api-key")
 		req1.Header.Set("X-M-Hook-Version", "1")
 		req1.Header.Set("X-M-Request-ID", reqID)
-		srv.httpServer.Handler.ServeHTTP(w1, req1)
+		srv.socketServer.Handler.ServeHTTP(w1, req1)
 	}()
 
 	// Wait for the interaction to be created
@@ -1620,7 +1621,7 @@ func TestE2E_Internal_InteractionRequest_Idempotency(t *testing.T) {
 	req2.Header.Set("X-M-Request-ID", reqID)
 
 	w2 := httptest.NewRecorder()
-	srv.httpServer.Handler.ServeHTTP(w2, req2)
+	srv.socketServer.Handler.ServeHTTP(w2, req2)
 
 	// Should return 409 Conflict for duplicate request
 	if w2.Code != http.StatusConflict {
@@ -1670,7 +1671,7 @@ func TestE2E_Internal_InteractionRequest_ResponseFormat_Approval(t *testing.T) {
 		req.Header.Set("Authorization", "Bearer test-api-key")
 		req.Header.Set("X-M-Hook-Version", "1")
 		req.Header.Set("X-M-Request-ID", reqID)
-		srv.httpServer.Handler.ServeHTTP(w, req)
+		srv.socketServer.Handler.ServeHTTP(w, req)
 	}()
 
 	// Wait for interaction to be created
@@ -1754,7 +1755,7 @@ func TestE2E_Internal_InteractionRequest_ResponseFormat_Input(t *testing.T) {
 		req.Header.Set("Authorization", "Bearer test-api-key")
 		req.Header.Set("X-M-Hook-Version", "1")
 		req.Header.Set("X-M-Request-ID", reqID)
-		srv.httpServer.Handler.ServeHTTP(w, req)
+		srv.socketServer.Handler.ServeHTTP(w, req)
 	}()
 
 	// Wait for interaction to be created
@@ -1850,7 +1851,7 @@ func TestE2E_Internal_InteractionRequest_RunStateTransition(t *testing.T) {
 			req.Header.Set("Authorization", "Bearer test-api-key")
 			req.Header.Set("X-M-Hook-Version", "1")
 			req.Header.Set("X-M-Request-ID", reqID)
-			srv.httpServer.Handler.ServeHTTP(w, req)
+			srv.socketServer.Handler.ServeHTTP(w, req)
 		}()
 
 		// Wait for state to change
@@ -1889,7 +1890,7 @@ func TestE2E_Internal_InteractionRequest_RunStateTransition(t *testing.T) {
 			req.Header.Set("Authorization", "Bearer test-api-key")
 			req.Header.Set("X-M-Hook-Version", "1")
 			req.Header.Set("X-M-Request-ID", reqID)
-			srv.httpServer.Handler.ServeHTTP(w, req)
+			srv.socketServer.Handler.ServeHTTP(w, req)
 		}()
 
 		// Wait for state to change
@@ -1941,7 +1942,7 @@ func TestE2E_Internal_InteractionRequest_InvalidRunState(t *testing.T) {
 			req.Header.Set("X-M-Request-ID", reqID)
 
 			w := httptest.NewRecorder()
-			srv.httpServer.Handler.ServeHTTP(w, req)
+			srv.socketServer.Handler.ServeHTTP(w, req)
 
 			// Skip if not implemented
 			if w.Code == http.StatusNotImplemented {
@@ -1989,7 +1990,7 @@ func TestE2E_Internal_InteractionRequest_CreatesInteractionRecord(t *testing.T)
 		req.Header.Set("Authorization", "Bearer test-api-key")
 		req.Header.Set("X-M-Hook-Version", "1")
 		req.Header.Set("X-M-Request-ID", reqID)
-		srv.httpServer.Handler.ServeHTTP(w, req)
+		srv.socketServer.Handler.ServeHTTP(w, req)
 	}()
 
 	// Wait for interaction to be created
@@ -2062,7 +2063,7 @@ func TestE2E_Internal_InteractionRequest_ApprovalFlow_Approved(t *testing.T) {
 		req.Header.Set("X-M-Request-ID", reqID)
 
 		w := httptest.NewRecorder()
-		srv.httpServer.Handler.ServeHTTP(w, req)
+		srv.socketServer.Handler.ServeHTTP(w, req)
 		respCh <- w
 	}()
 
@@ -2150,7 +2151,7 @@ func TestE2E_Internal_InteractionRequest_ApprovalFlow_Rejected(t *testing.T) {
 		req.Header.Set("X-M-Request-ID", reqID)
 
 		w := httptest.NewRecorder()
-		srv.httpServer.Handler.ServeHTTP(w, req)
+		srv.socketServer.Handler.ServeHTTP(w, req)
 		respCh <- w
 	}()
 
@@ -2248,7 +2249,7 @@ func TestE2E_Internal_InteractionRequest_InputFlow(t *testing.T) {
 		req.Header.Set("X-M-Request-ID", reqID)
 
 		w := httptest.NewRecorder()
-		srv.httpServer.Handler.ServeHTTP(w, req)
+		srv.socketServer.Handler.ServeHTTP(w, req)
 		respCh <- w
 	}()
 
@@ -2385,6 +2386,81 @@ func TestE2E_Internal_InteractionRequest_ReturnsToRunningOnRejection(t *testing.
 	}
 }
 
+func TestE2E_Internal_HookTokenFromRunEnv(t *testing.T) {
+	// The token a run's agent is started with reaches the hook route for that
+	// run only, and only while the run is active
+	srv, s, cleanup := testServer(t)
+	defer cleanup()
+
+	repo, _ := s.CreateRepo("test-repo", nil)
+	repo.Settings.ApprovalTools = []string{"Write"}
+	if err := s.UpdateRepo(repo); err != nil {
+		t.Fatalf("UpdateRepo: %v", err)
+	}
+	run, _ := s.CreateRun(repo.ID, "Test prompt", t.TempDir())
+	otherRepo, _ := s.CreateRepo("other-repo", nil)
+	other, _ := s.CreateRun(otherRepo.ID, "Test prompt", t.TempDir())
+
+	agent := testutil.NewMockAgent([]testutil.MockEvent{
+		{Type: "stdout", Delay: 5 * time.Second, Data: "never\n"},
+	})
+	done := make(chan struct{})
+	go func() {
+		srv.superviseAgent(run.ID, srv.runConfigFor(repo), agent)
+		close(done)
+	}()
+	for deadline := time.Now().Add(3 * time.Second); !agent.IsRunning(); time.Sleep(10 * time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatal("agent was not started")
+		}
+	}
+
+	env := map[string]string{}
+	for _, kv := range agent.Env {
+		k, v, _ := strings.Cut(kv, "=")
+		env[k] = v
+	}
+	if env["M_RUN_ID"] != run.ID || env["M_API_KEY"] == "" {
+		t.Fatalf("agent env = %v, want the run ID and a hook token", agent.Env)
+	}
+
+	hook := func(runID string) int {
+		return doSocketRequest(srv, "POST", "/api/internal/interaction-request", map[string]interface{}{
+			"run_id":     runID,
+			"type":       "approval",
+			"tool":       "Bash",
+			"request_id": "req-" + randomSuffix(),
+		}, "Bearer "+env["M_API_KEY"]).Code
+	}
+
+	if code := hook(env["M_RUN_ID"]); code != http.StatusOK {
+		t.Errorf("own run: got status %d, want %d", code, http.StatusOK)
+	}
+	if code := hook(other.ID); code != http.StatusForbidden {
+		t.Errorf("other run: got status %d, want %d", code, http.StatusForbidden)
+	}
+	if w := request(t, srv, "GET", "/api/repos", nil, "Bearer "+env["M_API_KEY"]); w.Code != http.StatusForbidden {
+		t.Errorf("REST API: got status %d, want %d", w.Code, http.StatusForbidden)
+	}
+
+	agent.Cancel()
+	select {
+	case <-done:
+	case <-time.After(3 * time.Second):
+		t.Fatal("run did not finish")
+	}
+	if code := hook(env["M_RUN_ID"]); code != http.StatusUnauthorized {
+		t.Errorf("finished run: got status %d, want %d", code, http.StatusUnauthorized)
+	}
+	// The token was revoked, not just outlived by its run
+	if err := s.UpdateRunState(run.ID, store.RunStateRunning); err != nil {
+		t.Fatalf("UpdateRunState: %v", err)
+	}
+	if token, err := s.AuthenticateToken(env["M_API_KEY"]); err != store.ErrInvalidToken {
+		t.Errorf("AuthenticateToken after the run = %v, %v; want ErrInvalidToken", token, err)
+	}
+}
+
 // Helper function to check if string contains substring
 func contains(s, substr string) bool {
 	return len(s) >= len(substr) && (s == substr || len(substr) == 0 ||
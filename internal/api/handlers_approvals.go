@@ -0,0 +1,195 @@
+package api
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/anthropics/m/internal/store"
+)
+
+// maxBulkResolve caps the number of interactions resolved in one request.
+const maxBulkResolve = 500
+
+// bulkResolveFilter selects pending approvals to resolve.
+type bulkResolveFilter struct {
+	RunID string `json:"run_id,omitempty"`
+	Tool  string `json:"tool,omitempty"`
+}
+
+// bulkResolveRequest is the request body for resolving several approvals at once.
+// Exactly one of IDs or Filter must be set.
+type bulkResolveRequest struct {
+	IDs      []string           `json:"ids,omitempty"`
+	Filter   *bulkResolveFilter `json:"filter,omitempty"`
+	Approved bool               `json:"approved"`
+	Reason   *string            `json:"reason,omitempty"`
+}
+
+// Per-item outcomes of a bulk resolve.
+const (
+	bulkStatusResolved     = "resolved"
+	bulkStatusConflict     = "conflict"
+	bulkStatusNotFound     = "not_found"
+	bulkStatusInvalidInput = "invalid_input"
+	bulkStatusForbidden    = "forbidden"
+)
+
+// bulkResolveResult is the outcome for a single interaction.
+type bulkResolveResult struct {
+	ID          string                     `json:"id"`
+	Status      string                     `json:"status"`
+	Interaction *interactionDetailResponse `json:"interaction,omitempty"`
+}
+
+// bulkResolveResponse is the response for a bulk resolve.
+type bulkResolveResponse struct {
+	Resolved int                 `json:"resolved"`
+	Failed   int                 `json:"failed"`
+	Results  []bulkResolveResult `json:"results"`
+}
+
+// handleBulkResolveApprovals resolves several pending approvals with one decision.
+// All updates happen in a single transaction; items that are missing or already
+// resolved are reported per item rather than failing the request.
+func (s *Server) handleBulkResolveApprovals(w http.ResponseWriter, r *http.Request) {
+	var req bulkResolveRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid_input", "invalid JSON body")
+		return
+	}
+
+	if len(req.IDs) == 0 && req.Filter == nil {
+		writeError(w, http.StatusBadRequest, "invalid_input", "ids or filter is required")
+		return
+	}
+	if len(req.IDs) > 0 && req.Filter != nil {
+		writeError(w, http.StatusBadRequest, "invalid_input", "ids and filter are mutually exclusive")
+		return
+	}
+	if req.Filter != nil && req.Filter.RunID == "" && req.Filter.Tool == "" {
+		writeError(w, http.StatusBadRequest, "invalid_input", "filter requires run_id or tool")
+		return
+	}
+	if len(req.IDs) > maxBulkResolve {
+		writeError(w, http.StatusBadRequest, "invalid_input", "too many ids")
+		return
+	}
+
+	decision := store.InteractionDecisionBlock
+	if req.Approved {
+		decision = store.InteractionDecisionAllow
+	}
+
+	// Repo roles of a restricted caller; nil means every repo is accessible.
+	// Loaded up front because store methods cannot be called inside InTx.
+	var roles map[string]store.RepoRole
+	if userID := repoRestricted(r); userID != "" {
+		var err error
+		roles, err = s.storeFor(r).ListRepoRolesForUser(userID)
+		if err != nil {
+			loggerFrom(r.Context()).Error("bulk-resolve: list repo roles", "err", err)
+			writeError(w, http.StatusInternalServerError, "internal_error", "failed to resolve approvals")
+			return
+		}
+	}
+
+	var results []bulkResolveResult
+	var resolved []*store.Interaction
+
+	err := s.storeFor(r).InTx(func(tx *sql.Tx) error {
+		ids := req.IDs
+		if req.Filter != nil {
+			pending, err := s.storeFor(r).ListPendingInteractionsTx(tx, store.InteractionTypeApproval, req.Filter.RunID, req.Filter.Tool)
+			if err != nil {
+				return err
+			}
+			if len(pending) > maxBulkResolve {
+				pending = pending[:maxBulkResolve]
+			}
+			ids = make([]string, len(pending))
+			for i, p := range pending {
+				ids[i] = p.ID
+			}
+		}
+
+		seen := make(map[string]bool, len(ids))
+		for _, id := range ids {
+			if seen[id] {
+				continue
+			}
+			seen[id] = true
+
+			existing, err := s.storeFor(r).GetInteractionTx(tx, id)
+			switch {
+			case errors.Is(err, store.ErrNotFound):
+				results = append(results, bulkResolveResult{ID: id, Status: bulkStatusNotFound})
+				continue
+			case err != nil:
+				return err
+			}
+
+			if roles != nil {
+				run, err := s.storeFor(r).GetRunTx(tx, existing.RunID)
+				if err != nil {
+					return err
+				}
+				role, member := roles[run.RepoID]
+				if !member {
+					// Approvals outside the caller's repos are invisible
+					if req.Filter == nil {
+						results = append(results, bulkResolveResult{ID: id, Status: bulkStatusNotFound})
+					}
+					continue
+				}
+				if !role.Allows(store.RepoRoleApprover) {
+					results = append(results, bulkResolveResult{ID: id, Status: bulkStatusForbidden})
+					continue
+				}
+			}
+
+			// Input requests need an answer, not a decision
+			if existing.Type != store.InteractionTypeApproval {
+				results = append(results, bulkResolveResult{ID: id, Status: bulkStatusInvalidInput})
+				continue
+			}
+
+			interaction, err := s.storeFor(r).ResolveInteractionTx(tx, id, decision, req.Reason, nil)
+			if errors.Is(err, store.ErrNotPending) {
+				results = append(results, bulkResolveResult{ID: id, Status: bulkStatusConflict})
+				continue
+			}
+			if err != nil {
+				return err
+			}
+
+			resolved = append(resolved, interaction)
+			detail := toInteractionDetailResponse(interaction)
+			results = append(results, bulkResolveResult{ID: id, Status: bulkStatusResolved, Interaction: &detail})
+		}
+		return nil
+	})
+	if err != nil {
+		loggerFrom(r.Context()).Error("bulk-resolve", "err", err)
+		writeError(w, http.StatusInternalServerError, "internal_error", "failed to resolve approvals")
+		return
+	}
+
+	// Audit and notify waiting hooks once the transaction has committed
+	for _, interaction := range resolved {
+		auditResolved(r, interaction, req.Approved, req.Reason, false)
+		s.interactionResolved(interaction)
+	}
+
+	resp := bulkResolveResponse{
+		Resolved: len(resolved),
+		Failed:   len(results) - len(resolved),
+		Results:  results,
+	}
+	if resp.Results == nil {
+		resp.Results = []bulkResolveResult{}
+	}
+
+	writeJSON(w, http.StatusOK, resp)
+}
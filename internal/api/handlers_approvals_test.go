@@ -3,7 +3,12 @@ package api
 import (
 	"encoding/json"
 	"net/http"
+	"net/http/httptest"
 	"testing"
+	"time"
+
+	"github.com/anthropics/m/internal/store"
+	"github.com/anthropics/m/internal/testutil"
 )
 
 func TestListApprovals(t *testing.T) {
@@ -332,3 +337,249 @@ func TestApprovalsUnauthorized(t *testing.T) {
 		})
 	}
 }
+
+func TestResolveApprovalWithUpdatedInput(t *testing.T) {
+	srv, cleanup := setupTestServer(t)
+	defer cleanup()
+
+	repo, _ := srv.store.CreateRepo("test-repo", nil)
+	run, _ := srv.store.CreateRun(repo.ID, "test prompt", "/workspace")
+
+	// Hook requests approval and blocks until resolved
+	hookBody := map[string]any{
+		"run_id":     run.ID,
+		"type":       "approval",
+		"tool":       "Bash",
+		"request_id": "req-modify-1",
+		"payload":    map[string]string{"command": "rm -rf /"},
+	}
+	var hookResp *httptest.ResponseRecorder
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		hookResp = doSocketRequest(srv, "POST", "/api/internal/interaction-request", hookBody, "Bearer test-key")
+	}()
+
+	var interactionID string
+	testutil.WaitFor(t, 2*time.Second, func() bool {
+		pending, _ := srv.store.ListPendingInteractions()
+		if len(pending) == 1 {
+			interactionID = pending[0].ID
+			return true
+		}
+		return false
+	})
+
+	// updated_input is rejected when not approving
+	w := doRequest(srv, "POST", "/api/approvals/"+interactionID+"/resolve", map[string]any{
+		"approved":      false,
+		"updated_input": map[string]string{"command": "ls"},
+	}, "Bearer test-key")
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("reject with updated_input: got %d, want %d", w.Code, http.StatusBadRequest)
+	}
+
+	// updated_input must be an object
+	w = doRequest(srv, "POST", "/api/approvals/"+interactionID+"/resolve", map[string]any{
+		"approved":      true,
+		"updated_input": "ls",
+	}, "Bearer test-key")
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("non-object updated_input: got %d, want %d", w.Code, http.StatusBadRequest)
+	}
+
+	// Approve with modifications
+	w = doRequest(srv, "POST", "/api/approvals/"+interactionID+"/resolve", map[string]any{
+		"approved":      true,
+		"updated_input": map[string]string{"command": "rm -rf ./build"},
+	}, "Bearer test-key")
+	if w.Code != http.StatusOK {
+		t.Fatalf("resolve: got %d: %s", w.Code, w.Body.String())
+	}
+	var resolved interactionDetailResponse
+	json.NewDecoder(w.Body).Decode(&resolved)
+	if string(resolved.UpdatedInput) != `{"command":"rm -rf ./build"}` {
+		t.Errorf("updated_input = %s", resolved.UpdatedInput)
+	}
+	if string(resolved.Payload) != `{"command":"rm -rf /"}` {
+		t.Errorf("payload = %s", resolved.Payload)
+	}
+
+	// Hook receives the modified input
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("hook request did not complete")
+	}
+	var hook interactionResponse
+	if err := json.Unmarshal(hookResp.Body.Bytes(), &hook); err != nil {
+		t.Fatalf("decode hook response: %v", err)
+	}
+	if hook.Decision != "allow" {
+		t.Errorf("decision = %q, want allow", hook.Decision)
+	}
+	if string(hook.UpdatedInput) != `{"command":"rm -rf ./build"}` {
+		t.Errorf("hook updated_input = %s", hook.UpdatedInput)
+	}
+
+	// Both inputs are recorded on the approval_resolved event
+	events, _ := srv.store.ListEventsByRun(run.ID)
+	var found bool
+	for _, e := range events {
+		if e.Type != "approval_resolved" {
+			continue
+		}
+		found = true
+		var data approvalResolvedData
+		if err := json.Unmarshal([]byte(*e.Data), &data); err != nil {
+			t.Fatalf("decode event data: %v", err)
+		}
+		if !data.Approved || data.ApprovalID != interactionID {
+			t.Errorf("unexpected event data: %s", *e.Data)
+		}
+		if string(data.OriginalInput) != `{"command":"rm -rf /"}` {
+			t.Errorf("original_input = %s", data.OriginalInput)
+		}
+		if string(data.UpdatedInput) != `{"command":"rm -rf ./build"}` {
+			t.Errorf("updated_input = %s", data.UpdatedInput)
+		}
+	}
+	if !found {
+		t.Error("approval_resolved event not created")
+	}
+}
+
+func TestResolveInputRejectsUpdatedInput(t *testing.T) {
+	srv, cleanup := setupTestServer(t)
+	defer cleanup()
+
+	repo, _ := srv.store.CreateRepo("test-repo", nil)
+	run, _ := srv.store.CreateRun(repo.ID, "test prompt", "/workspace")
+	interaction, _ := srv.store.CreateInteraction("req-input-1", run.ID, store.InteractionTypeInput, "AskUserQuestion", nil)
+
+	w := doRequest(srv, "POST", "/api/approvals/"+interaction.ID+"/resolve", map[string]any{
+		"approved":      true,
+		"updated_input": map[string]string{"question": "changed"},
+	}, "Bearer test-key")
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("got %d, want %d", w.Code, http.StatusBadRequest)
+	}
+}
+
+func TestBulkResolveApprovals(t *testing.T) {
+	srv, cleanup := setupTestServer(t)
+	defer cleanup()
+
+	repo, _ := srv.store.CreateRepo("test-repo", nil)
+	run, _ := srv.store.CreateRun(repo.ID, "test prompt", "/workspace")
+
+	a1, _ := srv.store.CreateInteraction("req-1", run.ID, store.InteractionTypeApproval, "Bash", nil)
+	a2, _ := srv.store.CreateInteraction("req-2", run.ID, store.InteractionTypeApproval, "Edit", nil)
+	done, _ := srv.store.CreateInteraction("req-3", run.ID, store.InteractionTypeApproval, "Bash", nil)
+	input, _ := srv.store.CreateInteraction("req-4", run.ID, store.InteractionTypeInput, "AskUserQuestion", nil)
+	srv.store.ResolveInteraction(done.ID, store.InteractionDecisionAllow, nil, nil)
+
+	// A hook is waiting on a1
+	notifyCh := srv.interactionNotifier.Subscribe(a1.ID)
+	defer srv.interactionNotifier.Unsubscribe(a1.ID)
+
+	w := doRequest(srv, "POST", "/api/approvals/resolve", map[string]any{
+		"ids":      []string{a1.ID, a2.ID, done.ID, input.ID, "missing"},
+		"approved": true,
+	}, "Bearer test-key")
+	if w.Code != http.StatusOK {
+		t.Fatalf("got status %d: %s", w.Code, w.Body.String())
+	}
+
+	var resp bulkResolveResponse
+	if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if resp.Resolved != 2 || resp.Failed != 3 {
+		t.Errorf("resolved=%d failed=%d, want 2 and 3", resp.Resolved, resp.Failed)
+	}
+
+	want := map[string]string{
+		a1.ID:     bulkStatusResolved,
+		a2.ID:     bulkStatusResolved,
+		done.ID:   bulkStatusConflict,
+		input.ID:  bulkStatusInvalidInput,
+		"missing": bulkStatusNotFound,
+	}
+	for _, res := range resp.Results {
+		if want[res.ID] != res.Status {
+			t.Errorf("%s: status %q, want %q", res.ID, res.Status, want[res.ID])
+		}
+	}
+
+	select {
+	case <-notifyCh:
+	case <-time.After(time.Second):
+		t.Error("waiting hook was not notified")
+	}
+
+	got, _ := srv.store.GetInteraction(input.ID)
+	if got.State != store.InteractionStatePending {
+		t.Errorf("input interaction state = %q, want pending", got.State)
+	}
+}
+
+func TestBulkResolveApprovalsFilter(t *testing.T) {
+	srv, cleanup := setupTestServer(t)
+	defer cleanup()
+
+	repo1, _ := srv.store.CreateRepo("repo-1", nil)
+	repo2, _ := srv.store.CreateRepo("repo-2", nil)
+	run1, _ := srv.store.CreateRun(repo1.ID, "prompt", "/workspace/1")
+	run2, _ := srv.store.CreateRun(repo2.ID, "prompt", "/workspace/2")
+
+	srv.store.CreateInteraction("req-1", run1.ID, store.InteractionTypeApproval, "Bash", nil)
+	srv.store.CreateInteraction("req-2", run1.ID, store.InteractionTypeApproval, "Edit", nil)
+	srv.store.CreateInteraction("req-3", run2.ID, store.InteractionTypeApproval, "Bash", nil)
+
+	w := doRequest(srv, "POST", "/api/approvals/resolve", map[string]any{
+		"filter":   map[string]string{"run_id": run1.ID, "tool": "Bash"},
+		"approved": false,
+		"reason":   "not today",
+	}, "Bearer test-key")
+	if w.Code != http.StatusOK {
+		t.Fatalf("got status %d: %s", w.Code, w.Body.String())
+	}
+	var resp bulkResolveResponse
+	json.NewDecoder(w.Body).Decode(&resp)
+	if resp.Resolved != 1 {
+		t.Fatalf("resolved = %d, want 1", resp.Resolved)
+	}
+	if d := resp.Results[0].Interaction.Decision; d == nil || *d != "block" {
+		t.Errorf("decision = %v, want block", d)
+	}
+
+	pending, _ := srv.store.ListPendingInteractions()
+	if len(pending) != 2 {
+		t.Errorf("pending = %d, want 2", len(pending))
+	}
+}
+
+func TestBulkResolveApprovalsValidation(t *testing.T) {
+	srv, cleanup := setupTestServer(t)
+	defer cleanup()
+
+	tests := []struct {
+		name string
+		body any
+	}{
+		{"empty", map[string]any{"approved": true}},
+		{"ids and filter", map[string]any{"ids": []string{"a"}, "filter": map[string]string{"tool": "Bash"}, "approved": true}},
+		{"empty filter", map[string]any{"filter": map[string]string{}, "approved": true}},
+		{"invalid json", "not json"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := doRequest(srv, "POST", "/api/approvals/resolve", tt.body, "Bearer test-key")
+			if w.Code != http.StatusBadRequest {
+				t.Errorf("got status %d, want %d", w.Code, http.StatusBadRequest)
+			}
+		})
+	}
+}
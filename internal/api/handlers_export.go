@@ -0,0 +1,598 @@
+package api
+
+import (
+	"archive/tar"
+	"cmp"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/anthropics/m/internal/run"
+	"github.com/anthropics/m/internal/store"
+	"github.com/google/uuid"
+)
+
+// bundleVersion is the version of the run bundle format written by export.
+// Import accepts bundles up to this version; bump it for changes that older
+// servers cannot read.
+const bundleVersion = 1
+
+// maxBundleSize bounds the size of an uploaded bundle.
+const maxBundleSize = 512 << 20
+
+// Entries of a run bundle, a gzip-compressed tar archive. bundle.json comes
+// first; the workspace is either a diff or its files under workspace/.
+const (
+	bundleManifest  = "bundle.json"
+	bundleDiff      = "workspace.diff"
+	bundleFilesDir  = "workspace/"
+	bundleDiffMode  = "diff"
+	bundleFilesMode = "files"
+)
+
+// runBundle is the manifest of a run bundle. It carries the records with
+// their original IDs and Unix timestamps.
+type runBundle struct {
+	Version      int                 `json:"version"`
+	ExportedAt   int64               `json:"exported_at"`
+	Workspace    string              `json:"workspace,omitempty"` // "diff", "files" or empty
+	Repo         bundleRepo          `json:"repo"`
+	Run          bundleRun           `json:"run"`
+	Events       []bundleEvent       `json:"events"`
+	Interactions []bundleInteraction `json:"interactions"`
+}
+
+type bundleRepo struct {
+	ID        string  `json:"id"`
+	Name      string  `json:"name"`
+	GitURL    *string `json:"git_url,omitempty"`
+	CreatedAt int64   `json:"created_at"`
+}
+
+type bundleRun struct {
+	ID         string      `json:"id"`
+	Prompt     string      `json:"prompt"`
+	State      string      `json:"state"`
+	CreatedAt  int64       `json:"created_at"`
+	UpdatedAt  int64       `json:"updated_at"`
+	StartedAt  *int64      `json:"started_at,omitempty"`
+	FinishedAt *int64      `json:"finished_at,omitempty"`
+	ExitCode   *int        `json:"exit_code,omitempty"`
+	Error      *string     `json:"error,omitempty"`
+	Agent      *string     `json:"agent,omitempty"`
+	Model      *string     `json:"model,omitempty"`
+	BaseSHA    *string     `json:"base_sha,omitempty"`
+	FinalSHA   *string     `json:"final_sha,omitempty"`
+	Usage      bundleUsage `json:"usage"`
+}
+
+type bundleUsage struct {
+	InputTokens  int64   `json:"input_tokens"`
+	OutputTokens int64   `json:"output_tokens"`
+	CostUSD      float64 `json:"cost_usd"`
+}
+
+type bundleEvent struct {
+	ID        string  `json:"id"`
+	Seq       int64   `json:"seq"`
+	Type      string  `json:"type"`
+	Data      *string `json:"data,omitempty"`
+	CreatedAt int64   `json:"created_at"`
+}
+
+type bundleInteraction struct {
+	ID           string  `json:"id"`
+	RequestID    string  `json:"request_id"`
+	Type         string  `json:"type"`
+	Tool         string  `json:"tool"`
+	Payload      *string `json:"payload,omitempty"`
+	State        string  `json:"state"`
+	Decision     *string `json:"decision,omitempty"`
+	Message      *string `json:"message,omitempty"`
+	Response     *string `json:"response,omitempty"`
+	UpdatedInput *string `json:"updated_input,omitempty"`
+	CreatedAt    int64   `json:"created_at"`
+	ResolvedAt   *int64  `json:"resolved_at,omitempty"`
+}
+
+// handleExportRun writes a run as a bundle: its repo, the run, all of its
+// events (archived output included) and interactions, and with workspace=diff
+// or workspace=files the changes or files of its workspace.
+func (s *Server) handleExportRun(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+
+	exported, err := s.storeFor(r).GetRun(id)
+	if errors.Is(err, store.ErrNotFound) {
+		writeError(w, http.StatusNotFound, "not_found", "run not found")
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "internal_error", "failed to get run")
+		return
+	}
+
+	if !s.authorizeRun(w, r, exported, store.RepoRoleViewer) {
+		return
+	}
+
+	mode := r.URL.Query().Get("workspace")
+	if mode != "" && mode != "none" && mode != bundleDiffMode && mode != bundleFilesMode {
+		writeError(w, http.StatusBadRequest, "invalid_input", "workspace must be none, diff or files")
+		return
+	}
+	if mode == "none" {
+		mode = ""
+	}
+
+	bundle, err := s.buildBundle(r, exported)
+	if err != nil {
+		loggerFrom(r.Context()).Error("export run", "err", err)
+		writeError(w, http.StatusInternalServerError, "internal_error", "failed to export run")
+		return
+	}
+	bundle.Workspace = mode
+
+	// Check the workspace before the response starts, so that problems can
+	// still be reported.
+	var diff []byte
+	switch mode {
+	case bundleDiffMode:
+		diff, err = s.workspace.Diff(exported.ID)
+		if errors.Is(err, run.ErrNotGitWorkspace) {
+			writeError(w, http.StatusConflict, "invalid_state", "workspace is not a git repository; export workspace=files instead")
+			return
+		}
+	case bundleFilesMode:
+		if !s.workspace.Exists(exported.ID) {
+			err = os.ErrNotExist
+		}
+	}
+	if errors.Is(err, os.ErrNotExist) {
+		writeError(w, http.StatusNotFound, "not_found", "workspace not found")
+		return
+	}
+	if err != nil {
+		loggerFrom(r.Context()).Error("export workspace", "err", err)
+		writeError(w, http.StatusInternalServerError, "internal_error", "failed to export workspace")
+		return
+	}
+
+	manifest, err := json.MarshalIndent(bundle, "", "  ")
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "internal_error", "failed to export run")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/gzip")
+	w.Header().Set("Content-Disposition", `attachment; filename="run-`+exported.ID+`.tar.gz"`)
+	gz := gzip.NewWriter(w)
+	tw := tar.NewWriter(gz)
+	now := time.Now()
+	err = writeTarFile(tw, bundleManifest, manifest, now)
+	if err == nil && diff != nil {
+		err = writeTarFile(tw, bundleDiff, diff, now)
+	}
+	if err == nil && mode == bundleFilesMode {
+		err = s.workspace.Archive(exported.ID, tw, bundleFilesDir)
+	}
+	if err == nil {
+		err = tw.Close()
+	}
+	if err == nil {
+		err = gz.Close()
+	}
+	if err != nil {
+		// The response has started; the client gets a truncated archive.
+		loggerFrom(r.Context()).Error("write bundle", "err", err)
+	}
+}
+
+// buildBundle collects the records of a run for export.
+func (s *Server) buildBundle(r *http.Request, run *store.Run) (*runBundle, error) {
+	st := s.storeFor(r)
+	repo, err := st.GetRepo(run.RepoID)
+	if err != nil {
+		return nil, fmt.Errorf("get repo: %w", err)
+	}
+	events, err := st.ListEventsByRun(run.ID)
+	if err != nil {
+		return nil, fmt.Errorf("list events: %w", err)
+	}
+	interactions, err := st.ListInteractions(run.ID, nil)
+	if err != nil {
+		return nil, fmt.Errorf("list interactions: %w", err)
+	}
+
+	bundle := &runBundle{
+		Version:    bundleVersion,
+		ExportedAt: time.Now().Unix(),
+		Repo: bundleRepo{
+			ID:        repo.ID,
+			Name:      repo.Name,
+			GitURL:    repo.GitURL,
+			CreatedAt: repo.CreatedAt.Unix(),
+		},
+		Run: bundleRun{
+			ID:         run.ID,
+			Prompt:     run.Prompt,
+			State:      string(run.State),
+			CreatedAt:  run.CreatedAt.Unix(),
+			UpdatedAt:  run.UpdatedAt.Unix(),
+			StartedAt:  unixPtr(run.StartedAt),
+			FinishedAt: unixPtr(run.FinishedAt),
+			ExitCode:   run.ExitCode,
+			Error:      run.Error,
+			Agent:      run.Agent,
+			Model:      run.Model,
+			BaseSHA:    run.BaseSHA,
+			FinalSHA:   run.FinalSHA,
+			Usage: bundleUsage{
+				InputTokens:  run.Usage.InputTokens,
+				OutputTokens: run.Usage.OutputTokens,
+				CostUSD:      run.Usage.CostUSD,
+			},
+		},
+		Events:       make([]bundleEvent, len(events)),
+		Interactions: make([]bundleInteraction, len(interactions)),
+	}
+	for i, e := range events {
+		bundle.Events[i] = bundleEvent{
+			ID:        e.ID,
+			Seq:       e.Seq,
+			Type:      e.Type,
+			Data:      e.Data,
+			CreatedAt: e.CreatedAt.Unix(),
+		}
+	}
+	for i, in := range interactions {
+		bi := bundleInteraction{
+			ID:           in.ID,
+			RequestID:    in.RequestID,
+			Type:         string(in.Type),
+			Tool:         in.Tool,
+			Payload:      in.Payload,
+			State:        string(in.State),
+			Decision:     in.Decision,
+			Message:      in.Message,
+			Response:     in.Response,
+			UpdatedInput: in.UpdatedInput,
+			CreatedAt:    in.CreatedAt.Unix(),
+		}
+		if in.ResolvedAt != nil {
+			t := in.ResolvedAt.Unix()
+			bi.ResolvedAt = &t
+		}
+		bundle.Interactions[i] = bi
+	}
+	return bundle, nil
+}
+
+func writeTarFile(tw *tar.Writer, name string, data []byte, modTime time.Time) error {
+	if err := tw.WriteHeader(&tar.Header{Name: name, Mode: 0644, Size: int64(len(data)), ModTime: modTime}); err != nil {
+		return err
+	}
+	_, err := tw.Write(data)
+	return err
+}
+
+// handleImportRun recreates the run in an uploaded bundle under new IDs. The
+// run goes into the repo given by repo_id, or else the repo with the
+// bundle's repo name, which is created from the bundle for admins. Events
+// keep their seqs and timestamps, and IDs of the run's records in event data
+// are rewritten to the new IDs. A run exported while active is imported as
+// cancelled.
+func (s *Server) handleImportRun(w http.ResponseWriter, r *http.Request) {
+	gz, err := gzip.NewReader(http.MaxBytesReader(w, r.Body, maxBundleSize))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid_input", "bundle is not a gzip-compressed tar archive")
+		return
+	}
+	tr := tar.NewReader(gz)
+
+	hdr, err := tr.Next()
+	if err != nil || hdr.Name != bundleManifest {
+		writeError(w, http.StatusBadRequest, "invalid_input", "bundle must start with "+bundleManifest)
+		return
+	}
+	var bundle runBundle
+	if err := json.NewDecoder(tr).Decode(&bundle); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid_input", "invalid "+bundleManifest)
+		return
+	}
+	if msg := validateBundle(&bundle); msg != "" {
+		writeError(w, http.StatusBadRequest, "invalid_input", msg)
+		return
+	}
+
+	repo, ok := s.importRepo(w, r, &bundle)
+	if !ok {
+		return
+	}
+	if !s.authorizeRepo(w, r, repo.ID, store.RepoRoleOperator) {
+		return
+	}
+
+	runID := generateRunID()
+	workspacePath, err := s.workspace.Create(runID, nil)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "internal_error", "failed to create workspace")
+		return
+	}
+	if status, msg := s.extractWorkspace(runID, tr); status != 0 {
+		_ = s.workspace.Cleanup(runID)
+		writeError(w, status, "invalid_input", msg)
+		return
+	}
+
+	imported, events, interactions := remapBundle(&bundle, runID, repo.ID, workspacePath)
+	if err := s.storeFor(r).ImportRun(imported, events, interactions); err != nil {
+		_ = s.workspace.Cleanup(runID)
+		loggerFrom(r.Context()).Error("import run", "err", err)
+		writeError(w, http.StatusInternalServerError, "internal_error", "failed to import run")
+		return
+	}
+
+	addLogAttrs(r.Context(), "run_id", runID)
+	audit(r, auditRunImport, "run", runID, map[string]string{"repo_id": repo.ID, "source_run_id": bundle.Run.ID})
+	writeJSON(w, http.StatusCreated, toRunResponse(imported))
+}
+
+// validateBundle checks a bundle manifest and returns what is wrong with it,
+// or "" if it can be imported.
+func validateBundle(b *runBundle) string {
+	switch {
+	case b.Version == 0:
+		return "bundle has no version"
+	case b.Version > bundleVersion:
+		return fmt.Sprintf("bundle version %d is newer than this server supports (%d)", b.Version, bundleVersion)
+	case b.Repo.Name == "":
+		return "bundle repo has no name"
+	case b.Run.ID == "":
+		return "bundle run has no id"
+	case !store.RunState(b.Run.State).IsValid():
+		return "unknown run state " + strconv.Quote(b.Run.State)
+	}
+
+	seqs := make(map[int64]bool, len(b.Events))
+	for _, e := range b.Events {
+		if e.ID == "" || e.Type == "" || e.Seq <= 0 {
+			return "events need an id, a type and a positive seq"
+		}
+		if seqs[e.Seq] {
+			return fmt.Sprintf("duplicate event seq %d", e.Seq)
+		}
+		seqs[e.Seq] = true
+	}
+	for _, in := range b.Interactions {
+		if in.ID == "" {
+			return "interactions need an id"
+		}
+		if t := store.InteractionType(in.Type); t != store.InteractionTypeApproval && t != store.InteractionTypeInput {
+			return fmt.Sprintf("unknown interaction type %q", in.Type)
+		}
+		if st := store.InteractionState(in.State); st != store.InteractionStatePending && st != store.InteractionStateResolved {
+			return fmt.Sprintf("unknown interaction state %q", in.State)
+		}
+	}
+	return ""
+}
+
+// importRepo finds the repo to import a bundle into, creating it from the
+// bundle for admins. On failure it writes the response and returns false.
+func (s *Server) importRepo(w http.ResponseWriter, r *http.Request, b *runBundle) (*store.Repo, bool) {
+	st := s.storeFor(r)
+	var repo *store.Repo
+	var err error
+	if id := r.URL.Query().Get("repo_id"); id != "" {
+		repo, err = st.GetRepo(id)
+	} else {
+		repo, err = st.GetRepoByName(b.Repo.Name)
+		if errors.Is(err, store.ErrNotFound) && PrincipalFromContext(r.Context()).HasScope(store.ScopeAdmin) {
+			repo, err = st.CreateRepo(b.Repo.Name, b.Repo.GitURL)
+			if err == nil {
+				audit(r, auditRepoCreate, "repo", repo.ID, map[string]string{"name": repo.Name})
+			}
+		}
+	}
+	if errors.Is(err, store.ErrNotFound) {
+		writeError(w, http.StatusNotFound, "not_found", "repo not found; create "+strconv.Quote(b.Repo.Name)+" or pass repo_id")
+		return nil, false
+	}
+	if errors.Is(err, store.ErrAmbiguousName) {
+		writeError(w, http.StatusConflict, "conflict", "more than one repo is named "+strconv.Quote(b.Repo.Name)+"; pass repo_id")
+		return nil, false
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "internal_error", "failed to get repo")
+		return nil, false
+	}
+	return repo, true
+}
+
+// extractWorkspace writes the workspace entries following the manifest into
+// the new run's workspace. Entries it does not know are skipped, and entries
+// inside a .git directory are rejected. It returns a status and message for a
+// bad bundle, or 0.
+func (s *Server) extractWorkspace(runID string, tr *tar.Reader) (int, string) {
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return 0, ""
+		}
+		var maxErr *http.MaxBytesError
+		if errors.As(err, &maxErr) {
+			return http.StatusRequestEntityTooLarge, fmt.Sprintf("bundle is larger than %d bytes", maxBundleSize)
+		}
+		if err != nil {
+			return http.StatusBadRequest, "bundle is not a valid tar archive"
+		}
+		if hdr.Typeflag != tar.TypeReg {
+			continue
+		}
+
+		var name string
+		switch {
+		case hdr.Name == bundleDiff:
+			name = bundleDiff
+		case strings.HasPrefix(hdr.Name, bundleFilesDir):
+			name = strings.TrimPrefix(hdr.Name, bundleFilesDir)
+		default:
+			continue
+		}
+		if run.IsGitPath(name) {
+			return http.StatusBadRequest, fmt.Sprintf("bundle entry %q is inside .git", hdr.Name)
+		}
+		if err := s.workspace.WriteFile(runID, name, hdr.FileInfo().Mode(), tr); err != nil {
+			return http.StatusBadRequest, fmt.Sprintf("cannot extract %q: %v", hdr.Name, err)
+		}
+	}
+}
+
+// remapBundle turns a bundle's records into store records for a run with
+// the given ID, under new IDs. Old IDs in event data are replaced by the new
+// ones, so that events still point at the run and its interactions. A run
+// exported while active becomes cancelled, and requests still waiting for an
+// answer are resolved as blocked.
+func remapBundle(b *runBundle, runID, repoID, workspacePath string) (*store.Run, []*store.Event, []*store.Interaction) {
+	imported := &store.Run{
+		ID:            runID,
+		RepoID:        repoID,
+		Prompt:        b.Run.Prompt,
+		State:         store.RunState(b.Run.State),
+		WorkspacePath: workspacePath,
+		CreatedAt:     time.Unix(b.Run.CreatedAt, 0),
+		UpdatedAt:     time.Unix(b.Run.UpdatedAt, 0),
+		ExitCode:      b.Run.ExitCode,
+		Error:         b.Run.Error,
+		Agent:         b.Run.Agent,
+		Model:         b.Run.Model,
+		BaseSHA:       b.Run.BaseSHA,
+		FinalSHA:      b.Run.FinalSHA,
+		Usage: store.RunUsage{
+			InputTokens:  b.Run.Usage.InputTokens,
+			OutputTokens: b.Run.Usage.OutputTokens,
+			CostUSD:      b.Run.Usage.CostUSD,
+		},
+	}
+	if b.Run.StartedAt != nil {
+		t := time.Unix(*b.Run.StartedAt, 0)
+		imported.StartedAt = &t
+	}
+	if b.Run.FinishedAt != nil {
+		t := time.Unix(*b.Run.FinishedAt, 0)
+		imported.FinishedAt = &t
+	}
+	if imported.IsActive() {
+		imported.State = store.RunStateCancelled
+		imported.UpdatedAt = time.Unix(time.Now().Unix(), 0)
+		imported.FinishedAt = &imported.UpdatedAt
+	}
+
+	ids := map[string]string{b.Run.ID: runID}
+	interactions := make([]*store.Interaction, len(b.Interactions))
+	for i, in := range b.Interactions {
+		newID := uuid.New().String()
+		ids[in.ID] = newID
+		if in.RequestID != "" {
+			ids[in.RequestID] = newID
+		}
+		interaction := &store.Interaction{
+			ID:           newID,
+			RequestID:    newID,
+			RunID:        runID,
+			Type:         store.InteractionType(in.Type),
+			Tool:         in.Tool,
+			Payload:      in.Payload,
+			State:        store.InteractionState(in.State),
+			Decision:     in.Decision,
+			Message:      in.Message,
+			Response:     in.Response,
+			UpdatedInput: in.UpdatedInput,
+			CreatedAt:    time.Unix(in.CreatedAt, 0),
+		}
+		if in.ResolvedAt != nil {
+			t := time.Unix(*in.ResolvedAt, 0)
+			interaction.ResolvedAt = &t
+		}
+		if interaction.State != store.InteractionStateResolved {
+			// Imported runs are finished, so nobody is waiting for an
+			// answer; an open request would let resolving it resume the run.
+			block, msg := string(store.InteractionDecisionBlock), "run was cancelled on import"
+			interaction.State = store.InteractionStateResolved
+			interaction.Decision, interaction.Message = &block, &msg
+			interaction.ResolvedAt = &imported.UpdatedAt
+		}
+		interactions[i] = interaction
+	}
+
+	events := make([]*store.Event, len(b.Events))
+	for i, e := range b.Events {
+		newID := uuid.New().String()
+		ids[e.ID] = newID
+		events[i] = &store.Event{
+			ID:        newID,
+			RunID:     runID,
+			Seq:       e.Seq,
+			Type:      e.Type,
+			Data:      e.Data,
+			CreatedAt: time.Unix(e.CreatedAt, 0),
+		}
+	}
+	slices.SortFunc(events, func(a, b *store.Event) int { return cmp.Compare(a.Seq, b.Seq) })
+
+	for _, e := range events {
+		e.Data = remapIDs(e.Data, ids)
+	}
+	return imported, events, interactions
+}
+
+// remapIDs replaces the JSON string values in data that equal an old ID by
+// the new one. Data that is not JSON or holds none of the IDs is returned
+// as is.
+func remapIDs(data *string, ids map[string]string) *string {
+	if data == nil {
+		return nil
+	}
+	var v any
+	if err := json.Unmarshal([]byte(*data), &v); err != nil {
+		return data
+	}
+	changed := false
+	var walk func(v any) any
+	walk = func(v any) any {
+		switch v := v.(type) {
+		case string:
+			if id, ok := ids[v]; ok {
+				changed = true
+				return id
+			}
+		case map[string]any:
+			for k, e := range v {
+				v[k] = walk(e)
+			}
+		case []any:
+			for i, e := range v {
+				v[i] = walk(e)
+			}
+		}
+		return v
+	}
+	v = walk(v)
+	if !changed {
+		return data
+	}
+	out, err := json.Marshal(v)
+	if err != nil {
+		return data
+	}
+	remapped := string(out)
+	return &remapped
+}
@@ -0,0 +1,268 @@
+package api
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/anthropics/m/internal/store"
+)
+
+// setupBundleServer returns a server with its own database and workspaces
+// directory.
+func setupBundleServer(t *testing.T) *Server {
+	t.Helper()
+	s, err := store.New(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("failed to create store: %v", err)
+	}
+	t.Cleanup(func() { s.Close() })
+	return New(Config{Port: 8080, APIKey: "test-key", WorkspacesPath: t.TempDir()}, s)
+}
+
+func importBundle(srv *Server, query string, bundle []byte, auth string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest("POST", "/api/runs/import"+query, bytes.NewReader(bundle))
+	req.Header.Set("Authorization", auth)
+	req.Header.Set("Content-Type", "application/gzip")
+	w := httptest.NewRecorder()
+	srv.httpServer.Handler.ServeHTTP(w, req)
+	return w
+}
+
+// makeBundle packs a manifest, followed by files given as name and content
+// pairs, into a bundle archive.
+func makeBundle(t *testing.T, manifest any, files ...string) []byte {
+	t.Helper()
+	data, err := json.Marshal(manifest)
+	if err != nil {
+		t.Fatalf("marshal manifest: %v", err)
+	}
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gz)
+	tw.WriteHeader(&tar.Header{Name: bundleManifest, Mode: 0644, Size: int64(len(data))})
+	tw.Write(data)
+	for i := 0; i+1 < len(files); i += 2 {
+		tw.WriteHeader(&tar.Header{Name: files[i], Mode: 0644, Size: int64(len(files[i+1]))})
+		tw.Write([]byte(files[i+1]))
+	}
+	tw.Close()
+	gz.Close()
+	return buf.Bytes()
+}
+
+func TestExportImportRun(t *testing.T) {
+	src := setupBundleServer(t)
+	repo, _ := src.store.CreateRepo("app", nil)
+	workspace, err := src.workspace.Create("source-run", nil)
+	if err != nil {
+		t.Fatalf("create workspace: %v", err)
+	}
+	os.WriteFile(filepath.Join(workspace, "README.md"), []byte("# app\n"), 0644)
+	run, err := src.store.CreateRunWithID("source-run", repo.ID, "Fix the flaky test", workspace)
+	if err != nil {
+		t.Fatalf("CreateRunWithID: %v", err)
+	}
+	out := `{"text":"running tests"}`
+	src.store.CreateEvent(run.ID, "stdout", &out)
+	payload := `{"command":"go test ./..."}`
+	interaction, _ := src.store.CreateInteraction("req-1", run.ID, store.InteractionTypeApproval, "Bash", &payload)
+	request := `{"interaction_id":"` + interaction.ID + `","run_id":"` + run.ID + `"}`
+	src.store.CreateEvent(run.ID, "approval_request", &request)
+	src.store.ResolveInteraction(interaction.ID, store.InteractionDecisionAllow, nil, nil)
+	src.store.StartRun(run.ID, store.RunStart{Agent: "claude", Model: "sonnet", BaseSHA: "abc123"})
+	src.store.AddRunUsage(run.ID, store.RunUsage{InputTokens: 900, OutputTokens: 100, CostUSD: 0.02})
+	exitCode := 0
+	src.store.FinishRun(run.ID, store.RunEnd{State: store.RunStateCompleted, ExitCode: &exitCode, FinalSHA: "def456"})
+
+	w := doRequest(src, "GET", "/api/runs/"+run.ID+"/export?workspace=files", nil, "Bearer test-key")
+	if w.Code != http.StatusOK {
+		t.Fatalf("export: status %d: %s", w.Code, w.Body.String())
+	}
+	if got := w.Header().Get("Content-Type"); got != "application/gzip" {
+		t.Errorf("Content-Type = %q", got)
+	}
+	bundle := w.Body.Bytes()
+
+	dst := setupBundleServer(t)
+	for i := range 2 {
+		// Importing twice yields two independent copies.
+		w = importBundle(dst, "", bundle, "Bearer test-key")
+		if w.Code != http.StatusCreated {
+			t.Fatalf("import %d: status %d: %s", i, w.Code, w.Body.String())
+		}
+	}
+	var imported runResponse
+	json.NewDecoder(w.Body).Decode(&imported)
+	if imported.ID == run.ID || imported.State != "completed" || imported.Prompt != run.Prompt || imported.CreatedAt != run.CreatedAt.Unix() {
+		t.Errorf("imported run = %+v", imported)
+	}
+	if imported.Agent == nil || *imported.Agent != "claude" || imported.BaseSHA == nil || *imported.BaseSHA != "abc123" ||
+		imported.FinalSHA == nil || *imported.FinalSHA != "def456" || imported.ExitCode == nil ||
+		imported.FinishedAt == nil || imported.Usage.InputTokens != 900 || imported.Usage.CostUSD != 0.02 {
+		t.Errorf("imported run metadata = %+v", imported)
+	}
+	if repo, err := dst.store.GetRepo(imported.RepoID); err != nil || repo.Name != "app" {
+		t.Errorf("imported into repo %v, %v; want app", repo, err)
+	}
+	if runs, _ := dst.store.ListRunsByRepo(imported.RepoID); len(runs) != 2 {
+		t.Errorf("repo has %d runs, want 2", len(runs))
+	}
+
+	events, _ := dst.store.ListEventsByRun(imported.ID)
+	if len(events) != 2 || events[0].Seq != 1 || events[0].Type != "stdout" || events[1].Seq != 2 {
+		t.Fatalf("imported events = %+v", events)
+	}
+	interactions, _ := dst.store.ListInteractions(imported.ID, nil)
+	if len(interactions) != 1 || interactions[0].State != store.InteractionStateResolved || *interactions[0].Payload != payload {
+		t.Fatalf("imported interactions = %+v", interactions)
+	}
+	var data map[string]string
+	json.Unmarshal([]byte(*events[1].Data), &data)
+	if data["interaction_id"] != interactions[0].ID || data["run_id"] != imported.ID {
+		t.Errorf("approval_request data = %s, want new IDs", *events[1].Data)
+	}
+
+	readme, err := os.ReadFile(filepath.Join(imported.WorkspacePath, "README.md"))
+	if err != nil || string(readme) != "# app\n" {
+		t.Errorf("imported workspace README = %q, %v", readme, err)
+	}
+}
+
+func TestExportRun_Errors(t *testing.T) {
+	srv := setupBundleServer(t)
+	repo, _ := srv.store.CreateRepo("app", nil)
+	run, _ := srv.store.CreateRun(repo.ID, "prompt", srv.workspace.Path("missing"))
+
+	tests := []struct {
+		name string
+		path string
+		want int
+	}{
+		{"unknown run", "/api/runs/nope/export", http.StatusNotFound},
+		{"bad workspace mode", "/api/runs/" + run.ID + "/export?workspace=all", http.StatusBadRequest},
+		{"no workspace", "/api/runs/" + run.ID + "/export?workspace=files", http.StatusNotFound},
+		{"active run without workspace", "/api/runs/" + run.ID + "/export", http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := doRequest(srv, "GET", tt.path, nil, "Bearer test-key")
+			if w.Code != tt.want {
+				t.Errorf("status %d, want %d: %s", w.Code, tt.want, w.Body.String())
+			}
+		})
+	}
+
+	srv.workspace.Create(run.ID, nil)
+	w := doRequest(srv, "GET", "/api/runs/"+run.ID+"/export?workspace=diff", nil, "Bearer test-key")
+	if w.Code != http.StatusConflict {
+		t.Errorf("diff of a workspace without git: status %d, want 409", w.Code)
+	}
+}
+
+func TestImportRun_Errors(t *testing.T) {
+	srv := setupBundleServer(t)
+	user, _ := srv.store.CreateUser("alice")
+	_, token, _ := srv.store.CreateToken(user.ID, "laptop", []store.Scope{store.ScopeSteer}, nil)
+
+	valid := runBundle{
+		Version: bundleVersion,
+		Repo:    bundleRepo{ID: "r", Name: "app"},
+		Run:     bundleRun{ID: "run", State: "running"},
+	}
+	newer := valid
+	newer.Version = bundleVersion + 1
+	dupSeq := valid
+	dupSeq.Events = []bundleEvent{{ID: "a", Seq: 1, Type: "stdout"}, {ID: "b", Seq: 1, Type: "stdout"}}
+
+	tests := []struct {
+		name   string
+		bundle []byte
+		auth   string
+		want   int
+		errMsg string
+	}{
+		{"not gzip", []byte("{}"), "Bearer test-key", http.StatusBadRequest, "gzip"},
+		{"no version", makeBundle(t, map[string]any{"repo": valid.Repo}), "Bearer test-key", http.StatusBadRequest, "no version"},
+		{"newer version", makeBundle(t, newer), "Bearer test-key", http.StatusBadRequest, "newer"},
+		{"duplicate seq", makeBundle(t, dupSeq), "Bearer test-key", http.StatusBadRequest, "duplicate event seq"},
+		{"missing repo without admin", makeBundle(t, valid), "Bearer " + token, http.StatusNotFound, "repo not found"},
+		{"git directory", makeBundle(t, valid, bundleFilesDir+".git/config", "[core]\n\tfsmonitor = touch pwned\n"), "Bearer test-key", http.StatusBadRequest, ".git"},
+		{"nested git directory", makeBundle(t, valid, bundleFilesDir+"vendor/lib/.GIT/hooks/post-checkout", "#!/bin/sh\n"), "Bearer test-key", http.StatusBadRequest, ".git"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := importBundle(srv, "", tt.bundle, tt.auth)
+			if w.Code != tt.want || !strings.Contains(w.Body.String(), tt.errMsg) {
+				t.Errorf("status %d %s, want %d %q", w.Code, w.Body.String(), tt.want, tt.errMsg)
+			}
+		})
+	}
+
+	// A run exported while active arrives cancelled, into the given repo,
+	// with its open approval blocked.
+	other, _ := srv.store.CreateRepo("other", nil)
+	waiting := valid
+	waiting.Run.State = "waiting_approval"
+	waiting.Interactions = []bundleInteraction{{ID: "i", RequestID: "req", Type: "approval", Tool: "Bash", State: "pending"}}
+	w := importBundle(srv, "?repo_id="+other.ID, makeBundle(t, waiting), "Bearer test-key")
+	if w.Code != http.StatusCreated {
+		t.Fatalf("import: status %d: %s", w.Code, w.Body.String())
+	}
+	var imported runResponse
+	json.NewDecoder(w.Body).Decode(&imported)
+	if imported.RepoID != other.ID || imported.State != "cancelled" {
+		t.Errorf("imported run = %+v", imported)
+	}
+	interactions, _ := srv.store.ListInteractions(imported.ID, nil)
+	if len(interactions) != 1 || interactions[0].State != store.InteractionStateResolved ||
+		interactions[0].Decision == nil || *interactions[0].Decision != "block" || interactions[0].ResolvedAt == nil {
+		t.Fatalf("imported interactions = %+v", interactions)
+	}
+	w = doRequest(srv, "GET", "/api/approvals/pending", nil, "Bearer test-key")
+	if strings.Contains(w.Body.String(), interactions[0].ID) {
+		t.Errorf("imported approval is pending: %s", w.Body.String())
+	}
+	w = doRequest(srv, "POST", "/api/approvals/"+interactions[0].ID+"/resolve", map[string]bool{"approved": true}, "Bearer test-key")
+	if run, _ := srv.store.GetRun(imported.ID); run.State != store.RunStateCancelled {
+		t.Errorf("resolving the imported approval (status %d) moved the run to %s", w.Code, run.State)
+	}
+
+	// A bundle that writes outside the workspace is rejected and leaves
+	// nothing behind.
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gz)
+	manifest, _ := json.Marshal(valid)
+	tw.WriteHeader(&tar.Header{Name: bundleManifest, Mode: 0644, Size: int64(len(manifest))})
+	tw.Write(manifest)
+	tw.WriteHeader(&tar.Header{Name: "workspace/../../escape", Mode: 0644, Size: 1})
+	tw.Write([]byte("x"))
+	tw.Close()
+	gz.Close()
+	w = importBundle(srv, "?repo_id="+other.ID, buf.Bytes(), "Bearer test-key")
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("escaping bundle: status %d: %s", w.Code, w.Body.String())
+	}
+	if runs, _ := srv.store.ListRunsByRepo(other.ID); len(runs) != 1 {
+		t.Errorf("repo has %d runs after rejected import, want 1", len(runs))
+	}
+
+	// A name shared by repos created before names were unique picks none
+	// of them.
+	srv.store.CreateRepo("shared", nil)
+	srv.store.CreateRepo("shared", nil)
+	shared := valid
+	shared.Repo.Name = "shared"
+	w = importBundle(srv, "", makeBundle(t, shared), "Bearer test-key")
+	if w.Code != http.StatusConflict || !strings.Contains(w.Body.String(), "repo_id") {
+		t.Errorf("ambiguous repo name: status %d: %s", w.Code, w.Body.String())
+	}
+}
@@ -5,12 +5,14 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
-	"log"
+	"log/slog"
 	"net/http"
 	"sync"
 	"time"
 
 	"github.com/anthropics/m/internal/store"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
 // InteractionNotifier manages notification channels for waiting interaction requests.
@@ -73,9 +75,10 @@ type interactionRequestBody struct {
 
 // interactionResponse is the response for interaction requests.
 type interactionResponse struct {
-	Decision string  `json:"decision"`          // "allow" or "block"
-	Message  *string `json:"message,omitempty"` // Rejection message
-	Response *string `json:"response,omitempty"` // User input response
+	Decision     string          `json:"decision"`                // "allow" or "block"
+	Message      *string         `json:"message,omitempty"`       // Rejection message
+	Response     *string         `json:"response,omitempty"`      // User input response
+	UpdatedInput json.RawMessage `json:"updated_input,omitempty"` // Tool input modified by the reviewer
 }
 
 const (
@@ -120,6 +123,14 @@ func (s *Server) handleInteractionRequest(w http.ResponseWriter, r *http.Request
 		return
 	}
 
+	// Per-run hook tokens may only request interactions for their own run
+	if p := PrincipalFromContext(r.Context()); p != nil && p.RunID != "" && p.RunID != req.RunID {
+		writeError(w, http.StatusForbidden, "forbidden", "token is not valid for this run")
+		return
+	}
+
+	addLogAttrs(r.Context(), "run_id", req.RunID)
+
 	// Use header request ID if provided, otherwise use body request ID
 	requestID := requestIDHeader
 	if requestID == "" {
@@ -127,13 +138,13 @@ func (s *Server) handleInteractionRequest(w http.ResponseWriter, r *http.Request
 	}
 
 	// Verify run exists and is active
-	run, err := s.store.GetRun(req.RunID)
+	run, err := s.storeFor(r).GetRun(req.RunID)
 	if errors.Is(err, store.ErrNotFound) {
 		writeError(w, http.StatusNotFound, "not_found", "run not found")
 		return
 	}
 	if err != nil {
-		log.Printf("interaction-request: get run: %v", err)
+		loggerFrom(r.Context()).Error("interaction-request: get run", "err", err)
 		writeError(w, http.StatusInternalServerError, "internal_error", "failed to get run")
 		return
 	}
@@ -143,6 +154,18 @@ func (s *Server) handleInteractionRequest(w http.ResponseWriter, r *http.Request
 		return
 	}
 
+	// Tools the run's configuration does not ask about go ahead
+	cfg, err := s.runConfigOf(s.storeFor(r), run)
+	if err != nil {
+		loggerFrom(r.Context()).Error("interaction-request: get repo", "err", err)
+		writeError(w, http.StatusInternalServerError, "internal_error", "failed to get repo")
+		return
+	}
+	if !cfg.interactive(req.Type, req.Tool) {
+		writeJSON(w, http.StatusOK, interactionResponse{Decision: string(store.InteractionDecisionAllow)})
+		return
+	}
+
 	// Convert payload to string pointer
 	var payloadStr *string
 	if len(req.Payload) > 0 && string(req.Payload) != "null" {
@@ -152,14 +175,14 @@ func (s *Server) handleInteractionRequest(w http.ResponseWriter, r *http.Request
 
 	// Create or get existing interaction
 	interactionType := store.InteractionType(req.Type)
-	interaction, err := s.store.CreateInteraction(requestID, req.RunID, interactionType, req.Tool, payloadStr)
+	interaction, err := s.storeFor(r).CreateInteraction(requestID, req.RunID, interactionType, req.Tool, payloadStr)
 
 	isNewInteraction := false
 	if errors.Is(err, store.ErrDuplicateRequest) {
 		// Duplicate request - check if already resolved
-		existing, err := s.store.GetInteractionByRequestID(requestID)
+		existing, err := s.storeFor(r).GetInteractionByRequestID(requestID)
 		if err != nil {
-			log.Printf("interaction-request: get existing interaction: %v", err)
+			loggerFrom(r.Context()).Error("interaction-request: get existing interaction", "err", err)
 			writeError(w, http.StatusInternalServerError, "internal_error", "failed to get interaction")
 			return
 		}
@@ -174,12 +197,13 @@ func (s *Server) handleInteractionRequest(w http.ResponseWriter, r *http.Request
 		// Still pending - use existing interaction for long-poll
 		interaction = existing
 	} else if err != nil {
-		log.Printf("interaction-request: create interaction: %v", err)
+		loggerFrom(r.Context()).Error("interaction-request: create interaction", "err", err)
 		writeError(w, http.StatusInternalServerError, "internal_error", "failed to create interaction")
 		return
 	} else {
 		isNewInteraction = true
 	}
+	addLogAttrs(r.Context(), "interaction_id", interaction.ID)
 
 	// Emit input_requested event for new input interactions
 	if isNewInteraction && interactionType == store.InteractionTypeInput {
@@ -195,8 +219,8 @@ func (s *Server) handleInteractionRequest(w http.ResponseWriter, r *http.Request
 		}
 
 		eventData := fmt.Sprintf(`{"question":%s}`, jsonString(question))
-		if _, err := s.store.CreateEvent(req.RunID, "input_requested", &eventData); err != nil {
-			log.Printf("interaction-request: failed to create input_requested event: %v", err)
+		if _, err := s.output.createEvent(s.storeFor(r), req.RunID, "input_requested", &eventData); err != nil {
+			loggerFrom(r.Context()).Error("interaction-request: create input_requested event", "err", err)
 			// Don't fail the request, just log
 		}
 	}
@@ -209,14 +233,26 @@ func (s *Server) handleInteractionRequest(w http.ResponseWriter, r *http.Request
 		newState = store.RunStateWaitingInput
 	}
 
-	if err := s.store.UpdateRunState(req.RunID, newState); err != nil {
-		log.Printf("interaction-request: update run state: %v", err)
+	if err := s.storeFor(r).UpdateRunState(req.RunID, newState); err != nil {
+		loggerFrom(r.Context()).Error("interaction-request: update run state", "err", err)
 		// Don't fail the request, just log
 	}
+	s.recordRunState(req.RunID, newState)
 
 	// Broadcast state change
 	s.hub.BroadcastState(req.RunID, newState)
 
+	// The wait is recorded on the run's trace, linked to this request
+	_, waitSpan := tracer.Start(s.runs.Context(r.Context(), req.RunID), "interaction.wait",
+		trace.WithLinks(trace.LinkFromContext(r.Context())),
+		trace.WithAttributes(
+			attribute.String("interaction.id", interaction.ID),
+			attribute.String("interaction.type", req.Type),
+			attribute.String("interaction.tool", req.Tool),
+		),
+	)
+	defer waitSpan.End()
+
 	// Long-poll: wait for resolution
 	ctx, cancel := context.WithTimeout(r.Context(), defaultLongPollTimeout)
 	defer cancel()
@@ -232,19 +268,21 @@ func (s *Server) handleInteractionRequest(w http.ResponseWriter, r *http.Request
 		select {
 		case <-ctx.Done():
 			// Timeout or client disconnected
+			waitSpan.SetAttributes(attribute.String("interaction.outcome", "timeout"))
 			writeError(w, http.StatusGatewayTimeout, "timeout", "request timed out waiting for resolution")
 			return
 
 		case <-notifyCh:
 			// Notified of resolution - fetch result
-			resolved, err := s.store.GetInteraction(interaction.ID)
+			resolved, err := s.storeFor(r).GetInteraction(interaction.ID)
 			if err != nil {
-				log.Printf("interaction-request: get resolved interaction: %v", err)
+				loggerFrom(r.Context()).Error("interaction-request: get resolved interaction", "err", err)
 				writeError(w, http.StatusInternalServerError, "internal_error", "failed to get interaction")
 				return
 			}
 
 			if resolved.State == store.InteractionStateResolved {
+				waitSpan.SetAttributes(attribute.String("interaction.outcome", "resolved"))
 				resp := buildInteractionResponse(resolved)
 				writeJSON(w, http.StatusOK, resp)
 				return
@@ -252,13 +290,14 @@ func (s *Server) handleInteractionRequest(w http.ResponseWriter, r *http.Request
 			// Not actually resolved, continue waiting
 
 		case <-ticker.C:
-			// Periodic poll as backup
+			// Periodic poll as backup, untraced to keep the trace readable
 			current, err := s.store.GetInteraction(interaction.ID)
 			if err != nil {
 				continue
 			}
 
 			if current.State == store.InteractionStateResolved {
+				waitSpan.SetAttributes(attribute.String("interaction.outcome", "resolved"))
 				resp := buildInteractionResponse(current)
 				writeJSON(w, http.StatusOK, resp)
 				return
@@ -277,6 +316,9 @@ func buildInteractionResponse(interaction *store.Interaction) interactionRespons
 	}
 	resp.Message = interaction.Message
 	resp.Response = interaction.Response
+	if interaction.UpdatedInput != nil {
+		resp.UpdatedInput = json.RawMessage(*interaction.UpdatedInput)
+	}
 
 	return resp
 }
@@ -284,7 +326,24 @@ func buildInteractionResponse(interaction *store.Interaction) interactionRespons
 // ResolveInteraction resolves an interaction and notifies waiting requests.
 // This is called by the approval/input handlers.
 func (s *Server) ResolveInteraction(id string, decision store.InteractionDecision, message, response *string) error {
-	if err := s.store.ResolveInteraction(id, decision, message, response); err != nil {
+	return s.ResolveInteractionWithInput(id, decision, message, response, nil)
+}
+
+// approvalResolvedData is the data payload of an approval_resolved event.
+// OriginalInput and UpdatedInput are only set when the reviewer modified the
+// tool input, so the audit trail shows both versions.
+type approvalResolvedData struct {
+	ApprovalID    string          `json:"approval_id"`
+	Approved      bool            `json:"approved"`
+	Reason        *string         `json:"reason"`
+	OriginalInput json.RawMessage `json:"original_input,omitempty"`
+	UpdatedInput  json.RawMessage `json:"updated_input,omitempty"`
+}
+
+// ResolveInteractionWithInput resolves an interaction, optionally replacing the
+// tool input the agent will run with, and notifies waiting requests.
+func (s *Server) ResolveInteractionWithInput(id string, decision store.InteractionDecision, message, response, updatedInput *string) error {
+	if err := s.store.ResolveInteractionWithInput(id, decision, message, response, updatedInput); err != nil {
 		return err
 	}
 
@@ -294,28 +353,60 @@ func (s *Server) ResolveInteraction(id string, decision store.InteractionDecisio
 		return err
 	}
 
+	s.interactionResolved(interaction)
+	return nil
+}
+
+// interactionResolved applies the side effects of a resolved interaction: the
+// run returns to running, resolution events are recorded and the waiting hook
+// request is notified.
+func (s *Server) interactionResolved(interaction *store.Interaction) {
+	observeResolution(interaction)
+	logger := slog.With("run_id", interaction.RunID, "interaction_id", interaction.ID)
+
 	// Update run state back to running
 	if err := s.store.UpdateRunState(interaction.RunID, store.RunStateRunning); err != nil {
-		log.Printf("resolve-interaction: update run state: %v", err)
+		logger.Error("resolve-interaction: update run state", "err", err)
 		// Don't fail, just log
 	}
+	s.recordRunState(interaction.RunID, store.RunStateRunning)
 
 	// Broadcast state change
 	s.hub.BroadcastState(interaction.RunID, store.RunStateRunning)
 
+	// Emit approval_resolved event for approval interactions
+	if interaction.Type == store.InteractionTypeApproval {
+		data := approvalResolvedData{
+			ApprovalID: interaction.ID,
+			Approved:   interaction.Decision != nil && *interaction.Decision == string(store.InteractionDecisionAllow),
+			Reason:     interaction.Message,
+		}
+		if interaction.UpdatedInput != nil {
+			if interaction.Payload != nil {
+				data.OriginalInput = json.RawMessage(*interaction.Payload)
+			}
+			data.UpdatedInput = json.RawMessage(*interaction.UpdatedInput)
+		}
+		if b, err := json.Marshal(data); err == nil {
+			eventData := string(b)
+			if _, err := s.output.createEvent(s.store, interaction.RunID, "approval_resolved", &eventData); err != nil {
+				logger.Error("resolve-interaction: create approval_resolved event", "err", err)
+				// Don't fail, just log
+			}
+		}
+	}
+
 	// Emit input_received event for input interactions
-	if interaction.Type == store.InteractionTypeInput && response != nil {
-		eventData := fmt.Sprintf(`{"text":%s}`, jsonString(*response))
-		if _, err := s.store.CreateEvent(interaction.RunID, "input_received", &eventData); err != nil {
-			log.Printf("resolve-interaction: failed to create input_received event: %v", err)
+	if interaction.Type == store.InteractionTypeInput && interaction.Response != nil {
+		eventData := fmt.Sprintf(`{"text":%s}`, jsonString(*interaction.Response))
+		if _, err := s.output.createEvent(s.store, interaction.RunID, "input_received", &eventData); err != nil {
+			logger.Error("resolve-interaction: create input_received event", "err", err)
 			// Don't fail, just log
 		}
 	}
 
 	// Notify waiting request
-	s.interactionNotifier.Notify(id)
-
-	return nil
+	s.interactionNotifier.Notify(interaction.ID)
 }
 
 // jsonString escapes a string for use in JSON.
@@ -0,0 +1,221 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/anthropics/m/internal/store"
+)
+
+// repoRestricted returns the user whose repo memberships limit the request,
+// or "" if the caller may access every repo. Only user tokens without the
+// admin scope are restricted; the server API key and hook tokens are not.
+func repoRestricted(r *http.Request) string {
+	p := PrincipalFromContext(r.Context())
+	if p == nil || p.UserID == "" || p.HasScope(store.ScopeAdmin) {
+		return ""
+	}
+	return p.UserID
+}
+
+// checkRepoRole reports whether the caller can see the repo and whether they
+// hold the required role on it.
+func (s *Server) checkRepoRole(r *http.Request, repoID string, required store.RepoRole) (visible, allowed bool, err error) {
+	userID := repoRestricted(r)
+	if userID == "" {
+		return true, true, nil
+	}
+
+	member, err := s.storeFor(r).GetRepoMember(repoID, userID)
+	if errors.Is(err, store.ErrNotFound) {
+		return false, false, nil
+	}
+	if err != nil {
+		return false, false, err
+	}
+	return true, member.Role.Allows(required), nil
+}
+
+// authorizeRepo checks the caller's role on a repo and writes an error
+// response if it is insufficient. Repos the caller is not a member of are
+// reported as not found.
+func (s *Server) authorizeRepo(w http.ResponseWriter, r *http.Request, repoID string, required store.RepoRole) bool {
+	addLogAttrs(r.Context(), "repo_id", repoID)
+	return s.authorize(w, r, repoID, required, "repo not found")
+}
+
+// authorizeRun checks the caller's role on the repo of a run and writes an
+// error response if it is insufficient.
+func (s *Server) authorizeRun(w http.ResponseWriter, r *http.Request, run *store.Run, required store.RepoRole) bool {
+	addLogAttrs(r.Context(), "run_id", run.ID)
+	return s.authorize(w, r, run.RepoID, required, "run not found")
+}
+
+func (s *Server) authorize(w http.ResponseWriter, r *http.Request, repoID string, required store.RepoRole, notFound string) bool {
+	visible, allowed, err := s.checkRepoRole(r, repoID, required)
+	if err != nil {
+		loggerFrom(r.Context()).Error("authorize", "err", err)
+		writeError(w, http.StatusInternalServerError, "internal_error", "failed to check repo role")
+		return false
+	}
+	if !visible {
+		writeError(w, http.StatusNotFound, "not_found", notFound)
+		return false
+	}
+	if !allowed {
+		writeError(w, http.StatusForbidden, "forbidden", "requires "+string(required)+" role on repo")
+		return false
+	}
+	return true
+}
+
+// authorizeInteraction checks the caller's role on the repo of an
+// interaction's run.
+func (s *Server) authorizeInteraction(w http.ResponseWriter, r *http.Request, interaction *store.Interaction, required store.RepoRole) bool {
+	addLogAttrs(r.Context(), "run_id", interaction.RunID, "interaction_id", interaction.ID)
+	if repoRestricted(r) == "" {
+		return true
+	}
+
+	run, err := s.storeFor(r).GetRun(interaction.RunID)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "internal_error", "failed to get run")
+		return false
+	}
+	return s.authorize(w, r, run.RepoID, required, "approval not found")
+}
+
+// memberResponse represents a repo membership in API responses.
+type memberResponse struct {
+	RepoID    string `json:"repo_id"`
+	UserID    string `json:"user_id"`
+	Role      string `json:"role"`
+	CreatedAt int64  `json:"created_at"`
+}
+
+func toMemberResponse(m *store.RepoMember) memberResponse {
+	return memberResponse{
+		RepoID:    m.RepoID,
+		UserID:    m.UserID,
+		Role:      string(m.Role),
+		CreatedAt: m.CreatedAt.Unix(),
+	}
+}
+
+// handleListMembers returns the members of a repo.
+func (s *Server) handleListMembers(w http.ResponseWriter, r *http.Request) {
+	repoID := r.PathValue("id")
+
+	if _, err := s.storeFor(r).GetRepo(repoID); err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			writeError(w, http.StatusNotFound, "not_found", "repo not found")
+			return
+		}
+		writeError(w, http.StatusInternalServerError, "internal_error", "failed to get repo")
+		return
+	}
+
+	if !s.authorizeRepo(w, r, repoID, store.RepoRoleViewer) {
+		return
+	}
+
+	members, err := s.storeFor(r).ListRepoMembers(repoID)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "internal_error", "failed to list members")
+		return
+	}
+
+	resp := make([]memberResponse, len(members))
+	for i, member := range members {
+		resp[i] = toMemberResponse(member)
+	}
+
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// setMemberRequest is the request body for adding or updating a member.
+type setMemberRequest struct {
+	Role string `json:"role"`
+}
+
+// handleSetMember adds a user to a repo or changes their role.
+func (s *Server) handleSetMember(w http.ResponseWriter, r *http.Request) {
+	repoID := r.PathValue("id")
+	userID := r.PathValue("user_id")
+
+	var req setMemberRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid_input", "invalid JSON body")
+		return
+	}
+
+	role := store.RepoRole(req.Role)
+	if !role.IsValid() {
+		writeError(w, http.StatusBadRequest, "invalid_input", "role must be 'viewer', 'operator', 'approver' or 'owner'")
+		return
+	}
+
+	if _, err := s.storeFor(r).GetRepo(repoID); err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			writeError(w, http.StatusNotFound, "not_found", "repo not found")
+			return
+		}
+		writeError(w, http.StatusInternalServerError, "internal_error", "failed to get repo")
+		return
+	}
+
+	if !s.authorizeRepo(w, r, repoID, store.RepoRoleOwner) {
+		return
+	}
+
+	if _, err := s.storeFor(r).GetUser(userID); err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			writeError(w, http.StatusNotFound, "not_found", "user not found")
+			return
+		}
+		writeError(w, http.StatusInternalServerError, "internal_error", "failed to get user")
+		return
+	}
+
+	member, err := s.storeFor(r).SetRepoMember(repoID, userID, role)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "internal_error", "failed to set member")
+		return
+	}
+
+	audit(r, auditMemberSet, "repo", repoID, map[string]string{"user_id": userID, "role": string(role)})
+	writeJSON(w, http.StatusOK, toMemberResponse(member))
+}
+
+// handleRemoveMember removes a user from a repo.
+func (s *Server) handleRemoveMember(w http.ResponseWriter, r *http.Request) {
+	repoID := r.PathValue("id")
+	userID := r.PathValue("user_id")
+
+	if _, err := s.storeFor(r).GetRepo(repoID); err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			writeError(w, http.StatusNotFound, "not_found", "repo not found")
+			return
+		}
+		writeError(w, http.StatusInternalServerError, "internal_error", "failed to get repo")
+		return
+	}
+
+	if !s.authorizeRepo(w, r, repoID, store.RepoRoleOwner) {
+		return
+	}
+
+	err := s.storeFor(r).RemoveRepoMember(repoID, userID)
+	if errors.Is(err, store.ErrNotFound) {
+		writeError(w, http.StatusNotFound, "not_found", "member not found")
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "internal_error", "failed to remove member")
+		return
+	}
+
+	audit(r, auditMemberRemove, "repo", repoID, map[string]string{"user_id": userID})
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,140 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/anthropics/m/internal/store"
+)
+
+func TestRepoRoles(t *testing.T) {
+	srv, cleanup := setupTestServer(t)
+	defer cleanup()
+
+	user, _ := srv.store.CreateUser("alice")
+	_, plaintext, err := srv.store.CreateToken(user.ID, "laptop", []store.Scope{store.ScopeRead, store.ScopeSteer, store.ScopeApprove}, nil)
+	if err != nil {
+		t.Fatalf("CreateToken: %v", err)
+	}
+	alice := "Bearer " + plaintext
+
+	infra, _ := srv.store.CreateRepo("production-infra", nil)
+	app, _ := srv.store.CreateRepo("app", nil)
+	infraRun, _ := srv.store.CreateRun(infra.ID, "prompt", "/workspace")
+	appRun, _ := srv.store.CreateRun(app.ID, "prompt", "/workspace")
+	infraApproval, _ := srv.store.CreateInteraction("req-1", infraRun.ID, store.InteractionTypeApproval, "Bash", nil)
+	appApproval, _ := srv.store.CreateInteraction("req-2", appRun.ID, store.InteractionTypeApproval, "Bash", nil)
+
+	// Owner grants alice viewer on infra and approver on app
+	w := doRequest(srv, "PUT", "/api/repos/"+infra.ID+"/members/"+user.ID, map[string]string{"role": "viewer"}, "Bearer test-key")
+	if w.Code != http.StatusOK {
+		t.Fatalf("set member: got status %d: %s", w.Code, w.Body.String())
+	}
+	doRequest(srv, "PUT", "/api/repos/"+app.ID+"/members/"+user.ID, map[string]string{"role": "approver"}, "Bearer test-key")
+	owned, _ := srv.store.CreateRepo("side-project", nil)
+	doRequest(srv, "PUT", "/api/repos/"+owned.ID+"/members/"+user.ID, map[string]string{"role": "owner"}, "Bearer test-key")
+
+	tests := []struct {
+		name       string
+		method     string
+		path       string
+		body       any
+		wantStatus int
+	}{
+		{"viewer can read run", "GET", "/api/runs/" + infraRun.ID, nil, http.StatusOK},
+		{"viewer cannot cancel", "POST", "/api/runs/" + infraRun.ID + "/cancel", nil, http.StatusForbidden},
+		{"viewer cannot approve", "POST", "/api/approvals/" + infraApproval.ID + "/resolve", map[string]bool{"approved": true}, http.StatusForbidden},
+		{"viewer cannot manage members", "PUT", "/api/repos/" + infra.ID + "/members/" + user.ID, map[string]string{"role": "owner"}, http.StatusForbidden},
+		{"approver can approve", "POST", "/api/approvals/" + appApproval.ID + "/resolve", map[string]bool{"approved": true}, http.StatusOK},
+		{"approver cannot delete repo", "DELETE", "/api/repos/" + app.ID, nil, http.StatusForbidden},
+		{"approver cannot change settings", "PATCH", "/api/repos/" + app.ID, map[string]any{"settings": map[string]any{}}, http.StatusForbidden},
+		{"owner without admin scope cannot delete repo", "DELETE", "/api/repos/" + owned.ID, nil, http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := doRequest(srv, tt.method, tt.path, tt.body, alice)
+			if w.Code != tt.wantStatus {
+				t.Errorf("got status %d, want %d: %s", w.Code, tt.wantStatus, w.Body.String())
+			}
+		})
+	}
+
+	// Repos without membership are hidden
+	if _, err := srv.store.SetRepoMember(app.ID, user.ID, store.RepoRoleViewer); err != nil {
+		t.Fatalf("SetRepoMember: %v", err)
+	}
+	for _, repo := range []*store.Repo{infra, owned} {
+		if err := srv.store.RemoveRepoMember(repo.ID, user.ID); err != nil {
+			t.Fatalf("RemoveRepoMember: %v", err)
+		}
+	}
+
+	w = doRequest(srv, "GET", "/api/repos", nil, alice)
+	var repos []repoResponse
+	json.NewDecoder(w.Body).Decode(&repos)
+	if len(repos) != 1 || repos[0].ID != app.ID {
+		t.Errorf("visible repos = %+v", repos)
+	}
+
+	if w := doRequest(srv, "GET", "/api/runs/"+infraRun.ID, nil, alice); w.Code != http.StatusNotFound {
+		t.Errorf("hidden run: got status %d, want %d", w.Code, http.StatusNotFound)
+	}
+
+	w = doRequest(srv, "GET", "/api/approvals/pending", nil, alice)
+	var pending []interactionListResponse
+	json.NewDecoder(w.Body).Decode(&pending)
+	if len(pending) != 0 {
+		t.Errorf("got %d pending, want 0 (app approval resolved, infra hidden)", len(pending))
+	}
+
+	// The API key sees everything
+	w = doRequest(srv, "GET", "/api/approvals/pending", nil, "Bearer test-key")
+	json.NewDecoder(w.Body).Decode(&pending)
+	if len(pending) != 1 || pending[0].ID != infraApproval.ID {
+		t.Errorf("admin pending = %+v", pending)
+	}
+}
+
+func TestBulkResolveRespectsRepoRoles(t *testing.T) {
+	srv, cleanup := setupTestServer(t)
+	defer cleanup()
+
+	user, _ := srv.store.CreateUser("bob")
+	_, plaintext, _ := srv.store.CreateToken(user.ID, "cli", []store.Scope{store.ScopeApprove}, nil)
+
+	mine, _ := srv.store.CreateRepo("mine", nil)
+	viewOnly, _ := srv.store.CreateRepo("view-only", nil)
+	other, _ := srv.store.CreateRepo("other", nil)
+	srv.store.SetRepoMember(mine.ID, user.ID, store.RepoRoleApprover)
+	srv.store.SetRepoMember(viewOnly.ID, user.ID, store.RepoRoleViewer)
+
+	var ids []string
+	for i, repo := range []*store.Repo{mine, viewOnly, other} {
+		run, _ := srv.store.CreateRun(repo.ID, "prompt", "/workspace")
+		interaction, _ := srv.store.CreateInteraction("req-"+string(rune('a'+i)), run.ID, store.InteractionTypeApproval, "Bash", nil)
+		ids = append(ids, interaction.ID)
+	}
+
+	w := doRequest(srv, "POST", "/api/approvals/resolve", map[string]any{"ids": ids, "approved": true}, "Bearer "+plaintext)
+	if w.Code != http.StatusOK {
+		t.Fatalf("got status %d: %s", w.Code, w.Body.String())
+	}
+	var resp bulkResolveResponse
+	json.NewDecoder(w.Body).Decode(&resp)
+
+	want := []string{bulkStatusResolved, bulkStatusForbidden, bulkStatusNotFound}
+	for i, result := range resp.Results {
+		if result.Status != want[i] {
+			t.Errorf("result %d status = %s, want %s", i, result.Status, want[i])
+		}
+	}
+
+	// Filter mode skips approvals outside the caller's repos
+	w = doRequest(srv, "POST", "/api/approvals/resolve", map[string]any{"filter": map[string]string{"tool": "Bash"}, "approved": true}, "Bearer "+plaintext)
+	json.NewDecoder(w.Body).Decode(&resp)
+	if len(resp.Results) != 1 || resp.Results[0].Status != bulkStatusForbidden {
+		t.Errorf("filter results = %+v", resp.Results)
+	}
+}
@@ -4,16 +4,19 @@ import (
 	"encoding/json"
 	"errors"
 	"net/http"
+	"strconv"
+	"strings"
 
 	"github.com/anthropics/m/internal/store"
 )
 
 // repoResponse represents a repo in API responses.
 type repoResponse struct {
-	ID        string  `json:"id"`
-	Name      string  `json:"name"`
-	GitURL    *string `json:"git_url,omitempty"`
-	CreatedAt int64   `json:"created_at"`
+	ID        string             `json:"id"`
+	Name      string             `json:"name"`
+	GitURL    *string            `json:"git_url,omitempty"`
+	Settings  store.RepoSettings `json:"settings"`
+	CreatedAt int64              `json:"created_at"`
 }
 
 func toRepoResponse(r *store.Repo) repoResponse {
@@ -21,15 +24,22 @@ func toRepoResponse(r *store.Repo) repoResponse {
 		ID:        r.ID,
 		Name:      r.Name,
 		GitURL:    r.GitURL,
+		Settings:  r.Settings,
 		CreatedAt: r.CreatedAt.Unix(),
 	}
 }
 
-// handleListRepos returns all repositories.
+// handleListRepos returns one page of the repositories visible to the
+// caller. Supports sort (created_at or name), order, limit and cursor.
 func (s *Server) handleListRepos(w http.ResponseWriter, r *http.Request) {
-	repos, err := s.store.ListRepos()
+	page, ok := parsePage(w, r.URL.Query())
+	if !ok {
+		return
+	}
+
+	repos, next, err := s.storeFor(r).ListReposPage(store.RepoFilter{UserID: repoRestricted(r), Page: page})
 	if err != nil {
-		writeError(w, http.StatusInternalServerError, "internal_error", "failed to list repos")
+		writeListError(w, r, "list-repos", err)
 		return
 	}
 
@@ -38,7 +48,7 @@ func (s *Server) handleListRepos(w http.ResponseWriter, r *http.Request) {
 		resp[i] = toRepoResponse(repo)
 	}
 
-	writeJSON(w, http.StatusOK, resp)
+	writePage(w, resp, next)
 }
 
 // createRepoRequest is the request body for creating a repo.
@@ -60,12 +70,17 @@ func (s *Server) handleCreateRepo(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	repo, err := s.store.CreateRepo(req.Name, req.GitURL)
+	if !s.repoNameFree(w, r, req.Name, "") {
+		return
+	}
+
+	repo, err := s.storeFor(r).CreateRepo(req.Name, req.GitURL)
 	if err != nil {
 		writeError(w, http.StatusInternalServerError, "internal_error", "failed to create repo")
 		return
 	}
 
+	audit(r, auditRepoCreate, "repo", repo.ID, map[string]string{"name": repo.Name})
 	writeJSON(w, http.StatusCreated, toRepoResponse(repo))
 }
 
@@ -77,7 +92,42 @@ func (s *Server) handleGetRepo(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	repo, err := s.store.GetRepo(id)
+	repo, err := s.storeFor(r).GetRepo(id)
+	if errors.Is(err, store.ErrNotFound) {
+		writeError(w, http.StatusNotFound, "not_found", "repo not found")
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "internal_error", "failed to get repo")
+		return
+	}
+
+	if !s.authorizeRepo(w, r, repo.ID, store.RepoRoleViewer) {
+		return
+	}
+
+	writeJSON(w, http.StatusOK, toRepoResponse(repo))
+}
+
+// updateRepoRequest is the request body for updating a repo. Fields left
+// out are unchanged.
+type updateRepoRequest struct {
+	Name     *string             `json:"name"`
+	GitURL   *string             `json:"git_url"`  // Empty clears it
+	Settings *store.RepoSettings `json:"settings"` // Replaces the whole document
+}
+
+// handleUpdateRepo changes a repository's name, git URL or settings. It
+// needs the owner role, since settings choose what the repo's agents may do
+// and which server secrets they receive.
+func (s *Server) handleUpdateRepo(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	if id == "" {
+		writeError(w, http.StatusBadRequest, "invalid_input", "id is required")
+		return
+	}
+
+	repo, err := s.storeFor(r).GetRepo(id)
 	if errors.Is(err, store.ErrNotFound) {
 		writeError(w, http.StatusNotFound, "not_found", "repo not found")
 		return
@@ -87,9 +137,80 @@ func (s *Server) handleGetRepo(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if !s.authorizeRepo(w, r, repo.ID, store.RepoRoleOwner) {
+		return
+	}
+
+	var req updateRepoRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid_input", "invalid JSON body")
+		return
+	}
+
+	var fields []string
+	if req.Name != nil {
+		if *req.Name == "" {
+			writeError(w, http.StatusBadRequest, "invalid_input", "name must not be empty")
+			return
+		}
+		if !s.repoNameFree(w, r, *req.Name, repo.ID) {
+			return
+		}
+		repo.Name = *req.Name
+		fields = append(fields, "name")
+	}
+	if req.GitURL != nil {
+		repo.GitURL = req.GitURL
+		if *req.GitURL == "" {
+			repo.GitURL = nil
+		}
+		fields = append(fields, "git_url")
+	}
+	if req.Settings != nil {
+		if msg := validateRepoSettings(req.Settings, s.agent.Secrets); msg != "" {
+			writeError(w, http.StatusBadRequest, "invalid_input", msg)
+			return
+		}
+		repo.Settings = *req.Settings
+		fields = append(fields, "settings")
+	}
+	if len(fields) == 0 {
+		writeError(w, http.StatusBadRequest, "invalid_input", "nothing to update")
+		return
+	}
+
+	err = s.storeFor(r).UpdateRepo(repo)
+	if errors.Is(err, store.ErrNotFound) {
+		writeError(w, http.StatusNotFound, "not_found", "repo not found")
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "internal_error", "failed to update repo")
+		return
+	}
+
+	audit(r, auditRepoUpdate, "repo", repo.ID, map[string]string{"fields": strings.Join(fields, ",")})
 	writeJSON(w, http.StatusOK, toRepoResponse(repo))
 }
 
+// repoNameFree reports whether no repo other than id is named name, so that
+// bundles can be imported by repo name. Otherwise it writes the response.
+func (s *Server) repoNameFree(w http.ResponseWriter, r *http.Request, name, id string) bool {
+	existing, err := s.storeFor(r).GetRepoByName(name)
+	switch {
+	case errors.Is(err, store.ErrNotFound):
+		return true
+	case errors.Is(err, store.ErrAmbiguousName):
+	case err != nil:
+		writeError(w, http.StatusInternalServerError, "internal_error", "failed to get repo")
+		return false
+	case existing.ID == id:
+		return true
+	}
+	writeError(w, http.StatusConflict, "conflict", "a repo named "+strconv.Quote(name)+" already exists")
+	return false
+}
+
 // handleDeleteRepo deletes a repository by ID.
 func (s *Server) handleDeleteRepo(w http.ResponseWriter, r *http.Request) {
 	id := r.PathValue("id")
@@ -98,7 +219,11 @@ func (s *Server) handleDeleteRepo(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	err := s.store.DeleteRepo(id)
+	if !s.authorizeRepo(w, r, id, store.RepoRoleOwner) {
+		return
+	}
+
+	err := s.storeFor(r).DeleteRepo(id)
 	if errors.Is(err, store.ErrNotFound) {
 		writeError(w, http.StatusNotFound, "not_found", "repo not found")
 		return
@@ -108,6 +233,7 @@ func (s *Server) handleDeleteRepo(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	audit(r, auditRepoDelete, "repo", id, nil)
 	w.WriteHeader(http.StatusNoContent)
 }
 
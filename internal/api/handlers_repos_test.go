@@ -6,6 +6,7 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"os"
+	"strings"
 	"testing"
 
 	"github.com/anthropics/m/internal/store"
@@ -27,6 +28,15 @@ func setupTestServer(t *testing.T) (*Server, func()) {
 }
 
 func doRequest(srv *Server, method, path string, body any, auth string) *httptest.ResponseRecorder {
+	return serveRequest(srv.httpServer.Handler, method, path, body, auth)
+}
+
+// doSocketRequest sends a request to the handler behind the hook socket.
+func doSocketRequest(srv *Server, method, path string, body any, auth string) *httptest.ResponseRecorder {
+	return serveRequest(srv.socketServer.Handler, method, path, body, auth)
+}
+
+func serveRequest(h http.Handler, method, path string, body any, auth string) *httptest.ResponseRecorder {
 	var reqBody *bytes.Buffer
 	if body != nil {
 		b, _ := json.Marshal(body)
@@ -42,7 +52,7 @@ func doRequest(srv *Server, method, path string, body any, auth string) *httptes
 	req.Header.Set("Content-Type", "application/json")
 
 	w := httptest.NewRecorder()
-	srv.httpServer.Handler.ServeHTTP(w, req)
+	h.ServeHTTP(w, req)
 	return w
 }
 
@@ -85,6 +95,12 @@ func TestCreateRepo(t *testing.T) {
 			body:       map[string]string{"name": "test-repo2", "git_url": "https://github.com/test/repo"},
 			wantStatus: http.StatusCreated,
 		},
+		{
+			name:       "duplicate name",
+			body:       map[string]string{"name": "test-repo"},
+			wantStatus: http.StatusConflict,
+			wantCode:   "conflict",
+		},
 		{
 			name:       "missing name",
 			body:       map[string]string{},
@@ -188,6 +204,76 @@ func TestDeleteRepo(t *testing.T) {
 	}
 }
 
+func TestUpdateRepo(t *testing.T) {
+	srv, cleanup := setupTestServer(t)
+	defer cleanup()
+
+	srv.agent.Secrets = []string{"M_APP_NPM_TOKEN"}
+	gitURL := "https://github.com/test/repo"
+	repo, _ := srv.store.CreateRepo("app", &gitURL)
+	srv.store.CreateRepo("api", nil)
+
+	settings := map[string]any{
+		"default_branch": "develop",
+		"approval_tools": []string{"Bash"},
+		"system_prompt":  "Keep changes small.",
+		"env":            map[string]string{"CI": "1"},
+		"secrets":        map[string]string{"NPM_TOKEN": "M_APP_NPM_TOKEN"},
+		"limits":         map[string]any{"timeout_seconds": 900, "max_cost_usd": 5},
+	}
+	w := doRequest(srv, "PATCH", "/api/repos/"+repo.ID, map[string]any{"name": "web", "settings": settings}, "Bearer test-key")
+	if w.Code != http.StatusOK {
+		t.Fatalf("PATCH: status %d: %s", w.Code, w.Body.String())
+	}
+	var updated repoResponse
+	json.NewDecoder(w.Body).Decode(&updated)
+	if updated.Name != "web" || updated.GitURL == nil || *updated.GitURL != gitURL {
+		t.Errorf("updated repo = %+v", updated)
+	}
+	got, _ := srv.store.GetRepo(repo.ID)
+	if got.Settings.DefaultBranch != "develop" || len(got.Settings.ApprovalTools) != 1 || got.Settings.InputTools != nil ||
+		got.Settings.Secrets["NPM_TOKEN"] != "M_APP_NPM_TOKEN" || got.Settings.Limits.TimeoutSeconds != 900 {
+		t.Errorf("stored settings = %+v", got.Settings)
+	}
+
+	// Leaving settings out keeps them; an empty git_url clears it.
+	w = doRequest(srv, "PATCH", "/api/repos/"+repo.ID, map[string]any{"git_url": ""}, "Bearer test-key")
+	if w.Code != http.StatusOK {
+		t.Fatalf("PATCH git_url: status %d: %s", w.Code, w.Body.String())
+	}
+	got, _ = srv.store.GetRepo(repo.ID)
+	if got.GitURL != nil || got.Name != "web" || got.Settings.DefaultBranch != "develop" {
+		t.Errorf("after clearing git_url = %+v", got)
+	}
+
+	tests := []struct {
+		name   string
+		path   string
+		body   any
+		want   int
+		errMsg string
+	}{
+		{"unknown repo", "/api/repos/nope", map[string]any{"name": "x"}, http.StatusNotFound, "repo not found"},
+		{"empty body", "/api/repos/" + repo.ID, map[string]any{}, http.StatusBadRequest, "nothing to update"},
+		{"empty name", "/api/repos/" + repo.ID, map[string]any{"name": ""}, http.StatusBadRequest, "name"},
+		{"taken name", "/api/repos/" + repo.ID, map[string]any{"name": "api"}, http.StatusConflict, "already exists"},
+		{"option as branch", "/api/repos/" + repo.ID, map[string]any{"settings": map[string]any{"default_branch": "--upload-pack=x"}}, http.StatusBadRequest, "default_branch"},
+		{"bad env name", "/api/repos/" + repo.ID, map[string]any{"settings": map[string]any{"env": map[string]string{"A-B": "1"}}}, http.StatusBadRequest, "env"},
+		{"bad secret reference", "/api/repos/" + repo.ID, map[string]any{"settings": map[string]any{"secrets": map[string]string{"TOKEN": "$(id)"}}}, http.StatusBadRequest, "secrets"},
+		{"hook variable", "/api/repos/" + repo.ID, map[string]any{"settings": map[string]any{"env": map[string]string{"M_RUN_ID": "other"}}}, http.StatusBadRequest, "set by M"},
+		{"secret not allowed", "/api/repos/" + repo.ID, map[string]any{"settings": map[string]any{"secrets": map[string]string{"KEY": "M_API_KEY"}}}, http.StatusBadRequest, "not in agent.secrets"},
+		{"negative limit", "/api/repos/" + repo.ID, map[string]any{"settings": map[string]any{"limits": map[string]any{"max_cost_usd": -1}}}, http.StatusBadRequest, "limits"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := doRequest(srv, "PATCH", tt.path, tt.body, "Bearer test-key")
+			if w.Code != tt.want || !strings.Contains(w.Body.String(), tt.errMsg) {
+				t.Errorf("status %d %s, want %d %q", w.Code, w.Body.String(), tt.want, tt.errMsg)
+			}
+		})
+	}
+}
+
 func TestReposCRUDFlow(t *testing.T) {
 	srv, cleanup := setupTestServer(t)
 	defer cleanup()
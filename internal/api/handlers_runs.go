@@ -4,13 +4,21 @@ import (
 	"context"
 	"encoding/json"
 	"errors"
-	"log"
+	"fmt"
+	"log/slog"
 	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
 	"time"
 
+	"github.com/anthropics/m/internal/run"
 	"github.com/anthropics/m/internal/store"
 	"github.com/anthropics/m/internal/testutil"
 	"github.com/google/uuid"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
 )
 
 // generateRunID generates a unique run ID.
@@ -18,15 +26,33 @@ func generateRunID() string {
 	return uuid.New().String()
 }
 
-// runResponse represents a run in API responses.
+// runResponse represents a run in API responses. Metadata the runner has
+// not recorded yet is omitted.
 type runResponse struct {
-	ID            string `json:"id"`
-	RepoID        string `json:"repo_id"`
-	Prompt        string `json:"prompt"`
-	State         string `json:"state"`
-	WorkspacePath string `json:"workspace_path"`
-	CreatedAt     int64  `json:"created_at"`
-	UpdatedAt     int64  `json:"updated_at"`
+	ID            string           `json:"id"`
+	RepoID        string           `json:"repo_id"`
+	Prompt        string           `json:"prompt"`
+	State         string           `json:"state"`
+	WorkspacePath string           `json:"workspace_path"`
+	CreatedAt     int64            `json:"created_at"`
+	UpdatedAt     int64            `json:"updated_at"`
+	StartedAt     *int64           `json:"started_at,omitempty"`
+	FinishedAt    *int64           `json:"finished_at,omitempty"`
+	ExitCode      *int             `json:"exit_code,omitempty"`
+	Error         *string          `json:"error,omitempty"`
+	Agent         *string          `json:"agent,omitempty"`
+	Model         *string          `json:"model,omitempty"`
+	BaseSHA       *string          `json:"base_sha,omitempty"`
+	FinalSHA      *string          `json:"final_sha,omitempty"`
+	Usage         runUsageResponse `json:"usage"`
+}
+
+// runUsageResponse is a run's token usage and cost, summed over its model
+// calls.
+type runUsageResponse struct {
+	InputTokens  int64   `json:"input_tokens"`
+	OutputTokens int64   `json:"output_tokens"`
+	CostUSD      float64 `json:"cost_usd"`
 }
 
 func toRunResponse(r *store.Run) runResponse {
@@ -38,10 +64,26 @@ func toRunResponse(r *store.Run) runResponse {
 		WorkspacePath: r.WorkspacePath,
 		CreatedAt:     r.CreatedAt.Unix(),
 		UpdatedAt:     r.UpdatedAt.Unix(),
+		StartedAt:     unixPtr(r.StartedAt),
+		FinishedAt:    unixPtr(r.FinishedAt),
+		ExitCode:      r.ExitCode,
+		Error:         r.Error,
+		Agent:         r.Agent,
+		Model:         r.Model,
+		BaseSHA:       r.BaseSHA,
+		FinalSHA:      r.FinalSHA,
+		Usage: runUsageResponse{
+			InputTokens:  r.Usage.InputTokens,
+			OutputTokens: r.Usage.OutputTokens,
+			CostUSD:      r.Usage.CostUSD,
+		},
 	}
 }
 
-// handleListRuns returns all runs for a repository (newest first).
+// handleListRuns returns one page of runs for a repository, newest first by
+// default. Supports filtering by state (comma-separated), created_after and
+// created_before (Unix seconds) and prompt (substring), plus sort
+// (created_at or updated_at), order, limit and cursor.
 func (s *Server) handleListRuns(w http.ResponseWriter, r *http.Request) {
 	repoID := r.PathValue("repo_id")
 	if repoID == "" {
@@ -50,7 +92,7 @@ func (s *Server) handleListRuns(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Verify repo exists
-	_, err := s.store.GetRepo(repoID)
+	_, err := s.storeFor(r).GetRepo(repoID)
 	if errors.Is(err, store.ErrNotFound) {
 		writeError(w, http.StatusNotFound, "not_found", "repo not found")
 		return
@@ -60,9 +102,19 @@ func (s *Server) handleListRuns(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	runs, err := s.store.ListRunsByRepo(repoID)
+	if !s.authorizeRepo(w, r, repoID, store.RepoRoleViewer) {
+		return
+	}
+
+	filter, ok := parseRunFilter(w, r.URL.Query())
+	if !ok {
+		return
+	}
+	filter.RepoID = repoID
+
+	runs, next, err := s.storeFor(r).ListRunsPage(filter)
 	if err != nil {
-		writeError(w, http.StatusInternalServerError, "internal_error", "failed to list runs")
+		writeListError(w, r, "list-runs", err)
 		return
 	}
 
@@ -71,7 +123,95 @@ func (s *Server) handleListRuns(w http.ResponseWriter, r *http.Request) {
 		resp[i] = toRunResponse(run)
 	}
 
-	writeJSON(w, http.StatusOK, resp)
+	writePage(w, resp, next)
+}
+
+// handleListAllRuns returns one page of runs across the repositories visible
+// to the caller. It takes the same parameters as handleListRuns, plus an
+// optional repo_id.
+func (s *Server) handleListAllRuns(w http.ResponseWriter, r *http.Request) {
+	filter, ok := parseRunFilter(w, r.URL.Query())
+	if !ok {
+		return
+	}
+	filter.UserID = repoRestricted(r)
+	filter.RepoID = r.URL.Query().Get("repo_id")
+
+	runs, next, err := s.storeFor(r).ListRunsPage(filter)
+	if err != nil {
+		writeListError(w, r, "list-runs", err)
+		return
+	}
+
+	resp := make([]runResponse, len(runs))
+	for i, run := range runs {
+		resp[i] = toRunResponse(run)
+	}
+
+	writePage(w, resp, next)
+}
+
+// parseRunFilter reads run list filters and paging from query parameters. On
+// failure it writes a 400 and returns false.
+func parseRunFilter(w http.ResponseWriter, q url.Values) (store.RunFilter, bool) {
+	filter := store.RunFilter{PromptContains: q.Get("prompt")}
+	for _, v := range splitList(q.Get("state")) {
+		state := store.RunState(v)
+		if !state.IsValid() {
+			writeError(w, http.StatusBadRequest, "invalid_input", "unknown run state "+strconv.Quote(v))
+			return filter, false
+		}
+		filter.States = append(filter.States, state)
+	}
+	if !parseUnixParam(w, q, "created_after", &filter.CreatedAfter) ||
+		!parseUnixParam(w, q, "created_before", &filter.CreatedBefore) {
+		return filter, false
+	}
+
+	var ok bool
+	filter.Page, ok = parsePage(w, q)
+	return filter, ok
+}
+
+// handleListEvents returns one page of a run's events, oldest first by
+// default. Supports filtering by type (comma-separated), plus order, limit
+// and cursor.
+func (s *Server) handleListEvents(w http.ResponseWriter, r *http.Request) {
+	runID := r.PathValue("id")
+
+	run, err := s.storeFor(r).GetRun(runID)
+	if errors.Is(err, store.ErrNotFound) {
+		writeError(w, http.StatusNotFound, "not_found", "run not found")
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "internal_error", "failed to get run")
+		return
+	}
+
+	if !s.authorizeRun(w, r, run, store.RepoRoleViewer) {
+		return
+	}
+
+	q := r.URL.Query()
+	filter := store.EventFilter{RunID: runID, Types: splitList(q.Get("type"))}
+	var ok bool
+	if filter.Page, ok = parsePage(w, q); !ok {
+		return
+	}
+
+	events, next, err := s.storeFor(r).ListEventsPage(filter)
+	if err != nil {
+		writeListError(w, r, "list-events", err)
+		return
+	}
+
+	resp := make([]*EventDTO, len(events))
+	for i, event := range events {
+		resp[i] = eventToDTO(event)
+	}
+
+	writePage(w, resp, next)
 }
 
 // createRunRequest is the request body for creating a run.
@@ -88,7 +228,7 @@ func (s *Server) handleCreateRun(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Verify repo exists and get git URL
-	repo, err := s.store.GetRepo(repoID)
+	repo, err := s.storeFor(r).GetRepo(repoID)
 	if errors.Is(err, store.ErrNotFound) {
 		writeError(w, http.StatusNotFound, "not_found", "repo not found")
 		return
@@ -98,6 +238,10 @@ func (s *Server) handleCreateRun(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if !s.authorizeRepo(w, r, repoID, store.RepoRoleOperator) {
+		return
+	}
+
 	var req createRunRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		writeError(w, http.StatusBadRequest, "invalid_input", "invalid JSON body")
@@ -113,32 +257,46 @@ func (s *Server) handleCreateRun(w http.ResponseWriter, r *http.Request) {
 	// The store will generate the actual ID, but we need to create workspace first
 	tempRunID := generateRunID()
 
+	// The run's trace starts here and covers its whole lifetime
+	runCtx := s.runs.Start(r.Context(), tempRunID, repoID)
+
 	// Create workspace directory (optionally with git clone)
-	workspacePath, err := s.workspace.Create(tempRunID, repo.GitURL)
+	_, span := tracer.Start(runCtx, "run.workspace_create", trace.WithAttributes(attribute.Bool("git.clone", repo.GitURL != nil)))
+	workspacePath, err := s.workspace.CreateFrom(tempRunID, repo.GitURL, repo.Settings.DefaultBranch)
+	if err != nil {
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
 	if err != nil {
+		s.runs.Discard(tempRunID, "failed to create workspace")
 		writeError(w, http.StatusInternalServerError, "internal_error", "failed to create workspace")
 		return
 	}
 
-	run, err := s.store.CreateRunWithID(tempRunID, repoID, req.Prompt, workspacePath)
+	run, err := s.storeFor(r).CreateRunWithID(tempRunID, repoID, req.Prompt, workspacePath)
 	if errors.Is(err, store.ErrActiveRunExists) {
 		// Clean up workspace on conflict
 		_ = s.workspace.Cleanup(tempRunID)
+		s.runs.Discard(tempRunID, "repo already has an active run")
 		writeError(w, http.StatusConflict, "conflict", "repo already has an active run")
 		return
 	}
 	if err != nil {
 		// Clean up workspace on error
 		_ = s.workspace.Cleanup(tempRunID)
+		s.runs.Discard(tempRunID, "failed to create run")
 		writeError(w, http.StatusInternalServerError, "internal_error", "failed to create run")
 		return
 	}
 
+	addLogAttrs(r.Context(), "run_id", run.ID)
+
 	// If demo mode is enabled, start the mock agent
 	if s.demoMode {
-		go s.executeDemoRun(run.ID)
+		go s.executeDemoRun(run.ID, s.runConfigFor(repo))
 	}
 
+	audit(r, auditRunCreate, "run", run.ID, map[string]string{"repo_id": repoID})
 	writeJSON(w, http.StatusCreated, toRunResponse(run))
 }
 
@@ -150,7 +308,7 @@ func (s *Server) handleGetRun(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	run, err := s.store.GetRun(id)
+	run, err := s.storeFor(r).GetRun(id)
 	if errors.Is(err, store.ErrNotFound) {
 		writeError(w, http.StatusNotFound, "not_found", "run not found")
 		return
@@ -160,6 +318,10 @@ func (s *Server) handleGetRun(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if !s.authorizeRun(w, r, run, store.RepoRoleViewer) {
+		return
+	}
+
 	writeJSON(w, http.StatusOK, toRunResponse(run))
 }
 
@@ -171,7 +333,7 @@ func (s *Server) handleCancelRun(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	run, err := s.store.GetRun(id)
+	run, err := s.storeFor(r).GetRun(id)
 	if errors.Is(err, store.ErrNotFound) {
 		writeError(w, http.StatusNotFound, "not_found", "run not found")
 		return
@@ -181,6 +343,10 @@ func (s *Server) handleCancelRun(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if !s.authorizeRun(w, r, run, store.RepoRoleOperator) {
+		return
+	}
+
 	// Can only cancel active runs
 	if !run.IsActive() {
 		writeError(w, http.StatusConflict, "invalid_state", "run is not in an active state")
@@ -189,13 +355,16 @@ func (s *Server) handleCancelRun(w http.ResponseWriter, r *http.Request) {
 
 	// Update state to cancelled
 	// Note: In a full implementation, this would also signal the agent process
-	if err := s.store.UpdateRunState(id, store.RunStateCancelled); err != nil {
+	if err := s.storeFor(r).UpdateRunState(id, store.RunStateCancelled); err != nil {
 		writeError(w, http.StatusInternalServerError, "internal_error", "failed to cancel run")
 		return
 	}
+	s.recordRunState(id, store.RunStateCancelled)
+
+	audit(r, auditRunCancel, "run", id, nil)
 
 	// Fetch updated run
-	run, err = s.store.GetRun(id)
+	run, err = s.storeFor(r).GetRun(id)
 	if err != nil {
 		writeError(w, http.StatusInternalServerError, "internal_error", "failed to get updated run")
 		return
@@ -204,15 +373,38 @@ func (s *Server) handleCancelRun(w http.ResponseWriter, r *http.Request) {
 	writeJSON(w, http.StatusOK, toRunResponse(run))
 }
 
-// executeDemoRun runs a mock agent for demo purposes.
-func (s *Server) executeDemoRun(runID string) {
-	ctx := context.Background()
+// demoAgent and demoModel identify runs executed by the demo agent.
+const (
+	demoAgent = "demo"
+	demoModel = "demo-scripted"
+)
+
+// executeDemoRun runs a mock agent for demo purposes, in place of the agent
+// type the run is configured with.
+func (s *Server) executeDemoRun(runID string, cfg runConfig) {
+	agent := testutil.NewMockAgent(CreateDemoScenario())
+	agent.ModelName = demoModel
+	cfg.AgentType = demoAgent
+	s.superviseAgent(runID, cfg, agent)
+}
+
+// superviseAgent runs agent for the run until it exits: it starts the agent
+// with the run's configuration, records the run's metadata, turns the agent's
+// output and approval requests into events and interactions, stops the agent
+// when it exceeds the run's limits, and finishes the run from the agent's exit
+// status.
+func (s *Server) superviseAgent(runID string, cfg runConfig, agent run.Agent) {
+	ctx := s.runs.Context(context.Background(), runID)
+	st := s.store.WithContext(ctx)
+	logger := slog.With("run_id", runID)
 
 	// Update run state to running
-	if err := s.store.UpdateRunState(runID, store.RunStateRunning); err != nil {
-		log.Printf("failed to update run state to running: %v", err)
+	if err := st.UpdateRunState(runID, store.RunStateRunning); err != nil {
+		logger.Error("agent run: update run state", "err", err)
 		return
 	}
+	logger.Info("agent run: started", "agent", cfg.AgentType)
+	s.runConfigs.set(runID, cfg)
 
 	// Broadcast run started event
 	s.broadcastRunEvent(runID, map[string]interface{}{
@@ -221,113 +413,259 @@ func (s *Server) executeDemoRun(runID string) {
 		"timestamp": time.Now().Unix(),
 	})
 
-	// Create mock agent with demo scenario
-	agent := testutil.NewMockAgent(CreateDemoScenario())
-	if err := agent.Start(ctx); err != nil {
-		log.Printf("failed to start demo agent: %v", err)
-		_ = s.store.UpdateRunState(runID, store.RunStateFailed)
+	// The hook reaches the server over its socket with a token for this run
+	token, err := s.IssueHookToken(runID)
+	if err != nil {
+		logger.Error("agent run: issue hook token", "err", err)
+		s.finishRun(st, runID, store.RunEnd{State: store.RunStateFailed, Error: "failed to issue hook token"})
 		return
 	}
+	env, err := cfg.environ(map[string]string{
+		"M_API_KEY":       token,
+		"M_RUN_ID":        runID,
+		"M_SERVER_SOCKET": s.socketPath,
+	})
+	if err != nil {
+		logger.Error("agent run: resolve environment", "err", err)
+		s.finishRun(st, runID, store.RunEnd{State: store.RunStateFailed, Error: err.Error()})
+		return
+	}
+
+	_, span := tracer.Start(ctx, "run.agent_start", trace.WithAttributes(attribute.String("agent.type", cfg.AgentType)))
+	err = agent.Start(ctx, run.StartOptions{Env: env, SystemPrompt: cfg.SystemPrompt})
+	span.End()
+	if err != nil {
+		logger.Error("agent run: start agent", "err", err)
+		s.finishRun(st, runID, store.RunEnd{State: store.RunStateFailed, Error: "agent failed to start: " + err.Error()})
+		return
+	}
+	baseSHA, _ := s.workspace.HeadSHA(runID)
+	if err := st.StartRun(runID, store.RunStart{Agent: cfg.AgentType, Model: agent.Model(), BaseSHA: baseSHA}); err != nil {
+		logger.Error("agent run: record start", "err", err)
+	}
+
+	// limitErr is why the agent was stopped for exceeding a limit
+	var limitErr string
+	stop := func(reason string) {
+		if limitErr == "" {
+			limitErr = reason
+			logger.Info("agent run: stopping agent", "reason", reason)
+			agent.Cancel()
+		}
+	}
+	var deadline <-chan time.Time
+	if cfg.Timeout > 0 {
+		timer := time.NewTimer(cfg.Timeout)
+		defer timer.Stop()
+		deadline = timer.C
+	}
+
+	var cost float64
+	addUsage := func(u run.Usage) {
+		usage := store.RunUsage{InputTokens: u.InputTokens, OutputTokens: u.OutputTokens, CostUSD: u.CostUSD}
+		if err := st.AddRunUsage(runID, usage); err != nil {
+			logger.Error("agent run: add usage", "err", err)
+		}
+		cost += u.CostUSD
+		if cfg.MaxCostUSD > 0 && cost > cfg.MaxCostUSD {
+			stop(fmt.Sprintf("run exceeded its cost limit of $%.2f", cfg.MaxCostUSD))
+		}
+	}
 
 	// Process agent events
 	for {
 		select {
 		case msg, ok := <-agent.Stdout():
 			if !ok {
-				// Agent finished
-				_ = s.store.UpdateRunState(runID, store.RunStateCompleted)
-				s.broadcastRunEvent(runID, map[string]interface{}{
-					"type":      "run_completed",
-					"run_id":    runID,
-					"timestamp": time.Now().Unix(),
-				})
+				// Agent finished; usage it reported last may still be queued
+				s.output.close(runID)
+				for drained := false; !drained; {
+					select {
+					case u := <-agent.Usage():
+						addUsage(u)
+					default:
+						drained = true
+					}
+				}
+				end := agentEnd(agent)
+				if limitErr != "" {
+					end = store.RunEnd{State: store.RunStateFailed, Error: limitErr}
+				}
+				s.finishRun(st, runID, end)
 				return
 			}
 
-			// Broadcast stdout event
-			s.broadcastRunEvent(runID, map[string]interface{}{
-				"type":      "agent_output",
-				"run_id":    runID,
-				"stream":    "stdout",
-				"data":      msg,
-				"timestamp": time.Now().Unix(),
-			})
+			s.output.write(runID, "stdout", msg)
 
 		case msg, ok := <-agent.Stderr():
 			if !ok {
 				continue
 			}
 
-			// Broadcast stderr event
-			s.broadcastRunEvent(runID, map[string]interface{}{
-				"type":      "agent_output",
-				"run_id":    runID,
-				"stream":    "stderr",
-				"data":      msg,
-				"timestamp": time.Now().Unix(),
-			})
+			s.output.write(runID, "stderr", msg)
+
+		case u := <-agent.Usage():
+			addUsage(u)
+
+		case <-deadline:
+			deadline = nil
+			stop(fmt.Sprintf("run exceeded its time limit of %s", cfg.Timeout))
 
 		case req, ok := <-agent.ApprovalRequests():
 			if !ok {
 				continue
 			}
 
+			// Tools the run does not ask about go ahead
+			if !cfg.interactive(string(store.InteractionTypeApproval), req.Tool) {
+				agent.Respond(run.InteractionResponse{Approved: true})
+				continue
+			}
+
+			// Output before the request is written before it
+			s.output.flush(runID)
+
 			// Update run state to waiting for approval
-			_ = s.store.UpdateRunState(runID, store.RunStateWaitingApproval)
+			_ = st.UpdateRunState(runID, store.RunStateWaitingApproval)
 
 			// Create interaction in store
 			payloadJSON, _ := json.Marshal(req.Payload)
 			payloadStr := string(payloadJSON)
-			interaction, err := s.store.CreateInteraction(req.ID, runID, store.InteractionTypeApproval, req.Tool, &payloadStr)
+			interaction, err := st.CreateInteraction(req.ID, runID, store.InteractionTypeApproval, req.Tool, &payloadStr)
 			if err != nil {
-				log.Printf("failed to create interaction: %v", err)
+				logger.Error("agent run: create interaction", "err", err)
 				agent.Cancel()
-				_ = s.store.UpdateRunState(runID, store.RunStateFailed)
+				s.output.close(runID)
+				s.finishRun(st, runID, store.RunEnd{State: store.RunStateFailed, Error: "failed to record approval request"})
 				return
 			}
 
 			// Broadcast approval request event
 			s.broadcastRunEvent(runID, map[string]interface{}{
-				"type":          "approval_request",
-				"run_id":        runID,
+				"type":           "approval_request",
+				"run_id":         runID,
 				"interaction_id": interaction.ID,
-				"approval_type": req.Type,
-				"tool":          req.Tool,
-				"timestamp":     time.Now().Unix(),
+				"approval_type":  req.Type,
+				"tool":           req.Tool,
+				"timestamp":      time.Now().Unix(),
 			})
 
+			logger.Info("agent run: approval requested", "interaction_id", interaction.ID, "tool", req.Tool)
+
 			// Wait for interaction to be resolved
 			go s.waitForInteractionResolution(runID, interaction.ID, agent)
 		}
 	}
 }
 
+// agentEnd describes how a run ends given its agent's exit status. An agent
+// that stopped without exiting was stopped by M, which set the run's state.
+func agentEnd(agent run.Agent) store.RunEnd {
+	exit, ok := agent.Exit()
+	switch {
+	case !ok:
+		return store.RunEnd{State: store.RunStateFailed, Error: "agent stopped without exiting"}
+	case exit.Code != 0:
+		msg := exit.Error
+		if msg == "" {
+			msg = fmt.Sprintf("agent exited with code %d", exit.Code)
+		}
+		return store.RunEnd{State: store.RunStateFailed, ExitCode: &exit.Code, Error: firstLine(msg)}
+	default:
+		return store.RunEnd{State: store.RunStateCompleted, ExitCode: &exit.Code}
+	}
+}
+
+// finishRun records how a run ended, with the workspace's final commit, and
+// drops the run's configuration and revokes its hook token. A run that already reached a terminal state,
+// such as one cancelled while its agent ran, keeps that state and gets no
+// error.
+func (s *Server) finishRun(st store.Backend, runID string, end store.RunEnd) {
+	logger := slog.With("run_id", runID)
+	s.runConfigs.remove(runID)
+	if err := st.RevokeRunTokens(runID); err != nil {
+		logger.Error("agent run: revoke hook token", "err", err)
+	}
+	end.FinalSHA, _ = s.workspace.HeadSHA(runID)
+
+	run, err := st.GetRun(runID)
+	if err != nil {
+		logger.Error("agent run: get run", "err", err)
+		return
+	}
+	if !run.IsActive() {
+		end.State, end.Error = run.State, ""
+	}
+	if err := st.FinishRun(runID, end); err != nil {
+		logger.Error("agent run: finish run", "err", err)
+		return
+	}
+	if !run.IsActive() {
+		return
+	}
+
+	s.recordRunState(runID, end.State)
+	logger.Info("agent run: finished", "state", end.State, "error", end.Error)
+	event := map[string]interface{}{
+		"type":      "run_completed",
+		"run_id":    runID,
+		"timestamp": time.Now().Unix(),
+	}
+	if end.ExitCode != nil {
+		event["exit_code"] = *end.ExitCode
+	}
+	if end.State == store.RunStateFailed {
+		event["type"] = "run_failed"
+		event["error"] = end.Error
+	}
+	s.broadcastRunEvent(runID, event)
+}
+
+// firstLine returns the first non-empty line of s, for one-line error
+// summaries.
+func firstLine(s string) string {
+	for _, line := range strings.Split(s, "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			return line
+		}
+	}
+	return ""
+}
+
 // waitForInteractionResolution polls for interaction resolution and responds to the agent.
-func (s *Server) waitForInteractionResolution(runID, interactionID string, agent *testutil.MockAgent) {
+func (s *Server) waitForInteractionResolution(runID, interactionID string, agent run.Agent) {
+	logger := slog.With("run_id", runID, "interaction_id", interactionID)
+	_, span := tracer.Start(s.runs.Context(context.Background(), runID), "interaction.wait",
+		trace.WithAttributes(attribute.String("interaction.id", interactionID)))
+	defer span.End()
+
 	ticker := time.NewTicker(500 * time.Millisecond)
 	defer ticker.Stop()
 
 	for range ticker.C {
 		interaction, err := s.store.GetInteraction(interactionID)
 		if err != nil {
-			log.Printf("failed to get interaction: %v", err)
+			logger.Error("demo run: get interaction", "err", err)
 			continue
 		}
 
 		if interaction.State == store.InteractionStateResolved {
-			// Respond to agent
+			// Update the run's state before the agent reacts, so that a
+			// rejection's cancellation is in place when the agent stops
 			approved := interaction.Decision != nil && *interaction.Decision == string(store.InteractionDecisionAllow)
-			agent.Respond(testutil.InteractionResponse{
-				Approved: approved,
-				Reason:   getReasonOrResponse(interaction),
-			})
-
-			// Update run state back to running if approved
+			span.SetAttributes(attribute.Bool("interaction.approved", approved))
 			if approved {
 				_ = s.store.UpdateRunState(runID, store.RunStateRunning)
 			} else {
 				_ = s.store.UpdateRunState(runID, store.RunStateCancelled)
+				s.recordRunState(runID, store.RunStateCancelled)
 			}
+
+			// Respond to agent
+			agent.Respond(run.InteractionResponse{
+				Approved: approved,
+				Reason:   getReasonOrResponse(interaction),
+			})
 			return
 		}
 	}
@@ -378,7 +716,7 @@ func (s *Server) handleSendInput(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	run, err := s.store.GetRun(id)
+	run, err := s.storeFor(r).GetRun(id)
 	if errors.Is(err, store.ErrNotFound) {
 		writeError(w, http.StatusNotFound, "not_found", "run not found")
 		return
@@ -388,6 +726,10 @@ func (s *Server) handleSendInput(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if !s.authorizeRun(w, r, run, store.RepoRoleOperator) {
+		return
+	}
+
 	// Can only send input when waiting for input
 	if run.State != store.RunStateWaitingInput {
 		writeError(w, http.StatusConflict, "invalid_state", "run is not waiting for input")
@@ -396,13 +738,15 @@ func (s *Server) handleSendInput(w http.ResponseWriter, r *http.Request) {
 
 	// Update state back to running
 	// Note: In a full implementation, this would also deliver the input to the agent
-	if err := s.store.UpdateRunState(id, store.RunStateRunning); err != nil {
+	if err := s.storeFor(r).UpdateRunState(id, store.RunStateRunning); err != nil {
 		writeError(w, http.StatusInternalServerError, "internal_error", "failed to update run state")
 		return
 	}
 
+	audit(r, auditRunInput, "run", id, nil)
+
 	// Fetch updated run
-	run, err = s.store.GetRun(id)
+	run, err = s.storeFor(r).GetRun(id)
 	if err != nil {
 		writeError(w, http.StatusInternalServerError, "internal_error", "failed to get updated run")
 		return
@@ -0,0 +1,80 @@
+package api
+
+import (
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/anthropics/m/internal/store"
+)
+
+// searchResultResponse is one search match with its run and repo.
+type searchResultResponse struct {
+	Kind      string                `json:"kind"`   // prompt, output, tool_call or interaction
+	RefID     string                `json:"ref_id"` // Run, event or interaction ID
+	Seq       int64                 `json:"seq,omitempty"`
+	Run       runSummaryResponse    `json:"run"`
+	Repo      repoSummaryResponse   `json:"repo"`
+	Snippet   []snippetPartResponse `json:"snippet"`
+	CreatedAt int64                 `json:"created_at"`
+}
+
+// snippetPartResponse is a piece of a snippet; match marks matched words.
+type snippetPartResponse struct {
+	Text  string `json:"text"`
+	Match bool   `json:"match,omitempty"`
+}
+
+// handleSearch returns one page of full-text search matches over run
+// prompts, agent output, tool calls and interactions, newest first. q is
+// required; repo_id and kind (comma-separated) narrow the results.
+func (s *Server) handleSearch(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	filter := store.SearchFilter{
+		Query:  q.Get("q"),
+		UserID: repoRestricted(r),
+		RepoID: q.Get("repo_id"),
+	}
+	if strings.TrimSpace(filter.Query) == "" {
+		writeError(w, http.StatusBadRequest, "invalid_input", "q is required")
+		return
+	}
+	for _, v := range splitList(q.Get("kind")) {
+		kind := store.SearchKind(v)
+		if !slices.Contains(store.SearchKinds, kind) {
+			writeError(w, http.StatusBadRequest, "invalid_input", "unknown kind "+strconv.Quote(v))
+			return
+		}
+		filter.Kinds = append(filter.Kinds, kind)
+	}
+	var ok bool
+	if filter.Page, ok = parsePage(w, q); !ok {
+		return
+	}
+
+	results, next, err := s.storeFor(r).Search(filter)
+	if err != nil {
+		writeListError(w, r, "search", err)
+		return
+	}
+
+	resp := make([]searchResultResponse, len(results))
+	for i, res := range results {
+		snippet := make([]snippetPartResponse, len(res.Snippet))
+		for j, p := range res.Snippet {
+			snippet[j] = snippetPartResponse{Text: p.Text, Match: p.Match}
+		}
+		resp[i] = searchResultResponse{
+			Kind:      string(res.Kind),
+			RefID:     res.RefID,
+			Seq:       res.Seq,
+			Run:       runSummaryResponse{ID: res.Run.ID, Prompt: res.Run.Prompt, State: string(res.Run.State)},
+			Repo:      repoSummaryResponse{ID: res.Run.RepoID, Name: res.RepoName},
+			Snippet:   snippet,
+			CreatedAt: res.CreatedAt.Unix(),
+		}
+	}
+
+	writePage(w, resp, next)
+}
@@ -0,0 +1,101 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"testing"
+
+	"github.com/anthropics/m/internal/store"
+)
+
+func TestSearch(t *testing.T) {
+	srv, cleanup := setupTestServer(t)
+	defer cleanup()
+	app, _ := srv.store.CreateRepo("app", nil)
+	infra, _ := srv.store.CreateRepo("infra", nil)
+	user, _ := srv.store.CreateUser("alice")
+	srv.store.SetRepoMember(app.ID, user.ID, store.RepoRoleViewer)
+	_, token, err := srv.store.CreateToken(user.ID, "phone", []store.Scope{store.ScopeRead}, nil)
+	if err != nil {
+		t.Fatalf("CreateToken: %v", err)
+	}
+	member := "Bearer " + token
+
+	billing, _ := srv.store.CreateRun(app.ID, "Refactor the billing module", "/tmp")
+	data := `{"text":"billing totals updated"}`
+	output, err := srv.store.CreateEvent(billing.ID, "stdout", &data)
+	if err != nil {
+		t.Fatalf("CreateEvent: %v", err)
+	}
+	infraRun, _ := srv.store.CreateRun(infra.ID, "Move billing to the new cluster", "/tmp")
+
+	tests := []struct {
+		name  string
+		query string
+		auth  string
+		want  []string // RefIDs, in any order
+	}{
+		{"prompts and output", "q=billing", "Bearer test-key", []string{billing.ID, output.ID, infraRun.ID}},
+		{"all words", "q=billing+module", "Bearer test-key", []string{billing.ID}},
+		{"one kind", "q=billing&kind=output", "Bearer test-key", []string{output.ID}},
+		{"one repo", "q=billing&repo_id=" + infra.ID, "Bearer test-key", []string{infraRun.ID}},
+		{"member sees own repos", "q=billing", member, []string{billing.ID, output.ID}},
+		{"no match", "q=" + url.QueryEscape("nothing here"), "Bearer test-key", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := doRequest(srv, "GET", "/api/search?"+tt.query, nil, tt.auth)
+			if w.Code != http.StatusOK {
+				t.Fatalf("got status %d: %s", w.Code, w.Body.String())
+			}
+			var resp []searchResultResponse
+			if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+				t.Fatalf("decode: %v", err)
+			}
+			got := make(map[string]bool)
+			for _, r := range resp {
+				got[r.RefID] = true
+			}
+			if len(resp) != len(tt.want) {
+				t.Fatalf("got %d results %v, want %v", len(resp), got, tt.want)
+			}
+			for _, id := range tt.want {
+				if !got[id] {
+					t.Errorf("results %v missing %s", got, id)
+				}
+			}
+		})
+	}
+
+	w := doRequest(srv, "GET", "/api/search?q=totals", nil, "Bearer test-key")
+	var resp []searchResultResponse
+	if err := json.NewDecoder(w.Body).Decode(&resp); err != nil || len(resp) != 1 {
+		t.Fatalf("search totals = %s", w.Body.String())
+	}
+	got := resp[0]
+	if got.Kind != "output" || got.Seq != output.Seq || got.Run.ID != billing.ID || got.Repo.Name != "app" {
+		t.Errorf("result = %+v", got)
+	}
+	want := []snippetPartResponse{{Text: "billing "}, {Text: "totals", Match: true}, {Text: " updated"}}
+	if len(got.Snippet) != len(want) {
+		t.Fatalf("snippet = %+v, want %+v", got.Snippet, want)
+	}
+	for i := range want {
+		if got.Snippet[i] != want[i] {
+			t.Errorf("snippet = %+v, want %+v", got.Snippet, want)
+		}
+	}
+}
+
+func TestSearch_InvalidInput(t *testing.T) {
+	srv, cleanup := setupTestServer(t)
+	defer cleanup()
+
+	for _, query := range []string{"", "q=+", "q=x&kind=stdout", "q=x&sort=seq", "q=x&cursor=bad"} {
+		w := doRequest(srv, "GET", "/api/search?"+query, nil, "Bearer test-key")
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("%q: got status %d, want 400", query, w.Code)
+		}
+	}
+}
@@ -0,0 +1,164 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/anthropics/m/internal/store"
+)
+
+// Bounds on the number of recent runs in a summary.
+const (
+	defaultSummaryRecent = 10
+	maxSummaryRecent     = 50
+)
+
+// summaryResponse is an overview of the runs and interactions visible to the
+// caller, for a client's home screen.
+type summaryResponse struct {
+	RunCounts           map[string]int             `json:"run_counts"` // Every run state, including zeros
+	PendingInteractions []pendingSummaryResponse   `json:"pending_interactions"`
+	RecentRuns          []recentRunSummaryResponse `json:"recent_runs"`
+}
+
+// pendingSummaryResponse is a pending interaction with the run and repo it
+// belongs to.
+type pendingSummaryResponse struct {
+	interactionListResponse
+	Run  runSummaryResponse  `json:"run"`
+	Repo repoSummaryResponse `json:"repo"`
+}
+
+// recentRunSummaryResponse is a finished run with its repo's name.
+type recentRunSummaryResponse struct {
+	runResponse
+	RepoName string `json:"repo_name"`
+}
+
+type runSummaryResponse struct {
+	ID     string `json:"id"`
+	Prompt string `json:"prompt"`
+	State  string `json:"state"`
+}
+
+type repoSummaryResponse struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+}
+
+// handleSummary returns run counts by state, pending interactions (oldest
+// first) with their run and repo, and the most recently finished completed or
+// failed runs. recent sets how many finished runs are included.
+func (s *Server) handleSummary(w http.ResponseWriter, r *http.Request) {
+	recent := defaultSummaryRecent
+	if v := r.URL.Query().Get("recent"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 || n > maxSummaryRecent {
+			writeError(w, http.StatusBadRequest, "invalid_input",
+				"recent must be an integer between 0 and "+strconv.Itoa(maxSummaryRecent))
+			return
+		}
+		recent = n
+	}
+
+	resp, err := buildSummary(s.storeFor(r), repoRestricted(r), recent)
+	if err != nil {
+		loggerFrom(r.Context()).Error("summary", "err", err)
+		writeError(w, http.StatusInternalServerError, "internal_error", "failed to build summary")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// buildSummary collects the summary of the runs visible to userID, or of all
+// runs if userID is empty.
+func buildSummary(st store.Backend, userID string, recent int) (*summaryResponse, error) {
+	var counts map[store.RunState]int
+	var pending []*store.Interaction
+	var err error
+	if userID != "" {
+		counts, err = st.CountRunsByStateForUser(userID)
+		if err == nil {
+			pending, err = st.ListPendingInteractionsForUser(userID)
+		}
+	} else {
+		counts, err = st.CountRunsByState()
+		if err == nil {
+			pending, err = st.ListPendingInteractions()
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var finished []*store.Run
+	if recent > 0 {
+		finished, _, err = st.ListRunsPage(store.RunFilter{
+			UserID: userID,
+			States: []store.RunState{store.RunStateCompleted, store.RunStateFailed},
+			Page:   store.Page{Sort: "updated_at", Limit: recent},
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	resp := &summaryResponse{
+		RunCounts:           make(map[string]int, len(store.RunStates)),
+		PendingInteractions: make([]pendingSummaryResponse, 0, len(pending)),
+		RecentRuns:          make([]recentRunSummaryResponse, 0, len(finished)),
+	}
+	for _, state := range store.RunStates {
+		resp.RunCounts[string(state)] = counts[state]
+	}
+
+	// Pending interactions cluster on a few runs, so look each run and repo
+	// up once.
+	runs := make(map[string]*store.Run)
+	repos := make(map[string]*store.Repo)
+	getRepo := func(id string) (*store.Repo, error) {
+		if repo, ok := repos[id]; ok {
+			return repo, nil
+		}
+		repo, err := st.GetRepo(id)
+		if err != nil {
+			return nil, fmt.Errorf("get repo %s: %w", id, err)
+		}
+		repos[id] = repo
+		return repo, nil
+	}
+
+	for _, interaction := range pending {
+		run, ok := runs[interaction.RunID]
+		if !ok {
+			if run, err = st.GetRun(interaction.RunID); err != nil {
+				return nil, fmt.Errorf("get run %s: %w", interaction.RunID, err)
+			}
+			runs[run.ID] = run
+		}
+		repo, err := getRepo(run.RepoID)
+		if err != nil {
+			return nil, err
+		}
+		resp.PendingInteractions = append(resp.PendingInteractions, pendingSummaryResponse{
+			interactionListResponse: toInteractionListResponse(interaction),
+			Run:                     runSummaryResponse{ID: run.ID, Prompt: run.Prompt, State: string(run.State)},
+			Repo:                    repoSummaryResponse{ID: repo.ID, Name: repo.Name},
+		})
+	}
+
+	for _, run := range finished {
+		repo, err := getRepo(run.RepoID)
+		if err != nil {
+			return nil, err
+		}
+		resp.RecentRuns = append(resp.RecentRuns, recentRunSummaryResponse{
+			runResponse: toRunResponse(run),
+			RepoName:    repo.Name,
+		})
+	}
+
+	return resp, nil
+}
@@ -0,0 +1,144 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/anthropics/m/internal/store"
+)
+
+// setupSummaryFixture creates two repos with runs in several states, a pending
+// approval on each, and a user who is a member of only the first repo.
+func setupSummaryFixture(t *testing.T, srv *Server) (app, infra *store.Repo, member string) {
+	t.Helper()
+	app, _ = srv.store.CreateRepo("app", nil)
+	infra, _ = srv.store.CreateRepo("infra", nil)
+
+	for _, state := range []store.RunState{store.RunStateCompleted, store.RunStateFailed, store.RunStateCancelled} {
+		run, _ := srv.store.CreateRun(app.ID, "app "+string(state), "/tmp")
+		srv.store.UpdateRunState(run.ID, state)
+	}
+	appRun, _ := srv.store.CreateRun(app.ID, "app waiting", "/tmp")
+	srv.store.UpdateRunState(appRun.ID, store.RunStateWaitingApproval)
+	srv.store.CreateInteraction("req-1", appRun.ID, store.InteractionTypeApproval, "Bash", nil)
+
+	infraRun, _ := srv.store.CreateRun(infra.ID, "infra running", "/tmp")
+	srv.store.CreateInteraction("req-2", infraRun.ID, store.InteractionTypeInput, "AskUserQuestion", nil)
+
+	user, _ := srv.store.CreateUser("alice")
+	srv.store.SetRepoMember(app.ID, user.ID, store.RepoRoleViewer)
+	_, plaintext, err := srv.store.CreateToken(user.ID, "phone", []store.Scope{store.ScopeRead}, nil)
+	if err != nil {
+		t.Fatalf("CreateToken: %v", err)
+	}
+	return app, infra, "Bearer " + plaintext
+}
+
+func TestListAllRuns(t *testing.T) {
+	srv, cleanup := setupTestServer(t)
+	defer cleanup()
+	app, infra, member := setupSummaryFixture(t, srv)
+
+	tests := []struct {
+		name  string
+		query string
+		auth  string
+		want  int
+	}{
+		{"all repos", "", "Bearer test-key", 5},
+		{"active states", "?state=running,waiting_input,waiting_approval", "Bearer test-key", 2},
+		{"one repo", "?repo_id=" + infra.ID, "Bearer test-key", 1},
+		{"member sees own repos", "", member, 4},
+		{"member filtered to hidden repo", "?repo_id=" + infra.ID, member, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := doRequest(srv, "GET", "/api/runs"+tt.query, nil, tt.auth)
+			if w.Code != http.StatusOK {
+				t.Fatalf("got status %d: %s", w.Code, w.Body.String())
+			}
+			var runs []runResponse
+			json.NewDecoder(w.Body).Decode(&runs)
+			if len(runs) != tt.want {
+				t.Errorf("got %d runs, want %d", len(runs), tt.want)
+			}
+			for _, run := range runs {
+				if tt.auth == member && run.RepoID != app.ID {
+					t.Errorf("member saw run %s in repo %s", run.ID, run.RepoID)
+				}
+			}
+		})
+	}
+
+	if w := doRequest(srv, "GET", "/api/runs?state=bogus", nil, "Bearer test-key"); w.Code != http.StatusBadRequest {
+		t.Errorf("invalid state: got status %d, want 400", w.Code)
+	}
+}
+
+func TestSummary(t *testing.T) {
+	srv, cleanup := setupTestServer(t)
+	defer cleanup()
+	app, _, member := setupSummaryFixture(t, srv)
+
+	w := doRequest(srv, "GET", "/api/summary", nil, "Bearer test-key")
+	if w.Code != http.StatusOK {
+		t.Fatalf("got status %d: %s", w.Code, w.Body.String())
+	}
+	var resp summaryResponse
+	if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+
+	wantCounts := map[string]int{
+		"running": 1, "waiting_input": 0, "waiting_approval": 1,
+		"completed": 1, "failed": 1, "cancelled": 1,
+	}
+	for state, want := range wantCounts {
+		if got, ok := resp.RunCounts[state]; !ok || got != want {
+			t.Errorf("run_counts[%s] = %d (present %v), want %d", state, got, ok, want)
+		}
+	}
+
+	if len(resp.PendingInteractions) != 2 {
+		t.Fatalf("got %d pending interactions, want 2", len(resp.PendingInteractions))
+	}
+	for _, p := range resp.PendingInteractions {
+		if p.Tool == "Bash" && (p.Repo.Name != "app" || p.Run.Prompt != "app waiting" || p.Run.State != "waiting_approval") {
+			t.Errorf("pending approval = %+v, want the app run and repo", p)
+		}
+	}
+
+	if len(resp.RecentRuns) != 2 {
+		t.Fatalf("got %d recent runs, want completed and failed only", len(resp.RecentRuns))
+	}
+	for _, run := range resp.RecentRuns {
+		if run.State != "completed" && run.State != "failed" {
+			t.Errorf("recent run in state %s", run.State)
+		}
+		if run.RepoName != "app" {
+			t.Errorf("recent run repo_name = %q, want app", run.RepoName)
+		}
+	}
+
+	// Members only see runs and interactions in their repos.
+	w = doRequest(srv, "GET", "/api/summary?recent=1", nil, member)
+	if w.Code != http.StatusOK {
+		t.Fatalf("member: got status %d: %s", w.Code, w.Body.String())
+	}
+	resp = summaryResponse{}
+	json.NewDecoder(w.Body).Decode(&resp)
+	if resp.RunCounts["running"] != 0 || resp.RunCounts["waiting_approval"] != 1 {
+		t.Errorf("member run_counts = %v", resp.RunCounts)
+	}
+	if len(resp.PendingInteractions) != 1 || resp.PendingInteractions[0].Repo.ID != app.ID {
+		t.Errorf("member pending = %+v, want only the app approval", resp.PendingInteractions)
+	}
+	if len(resp.RecentRuns) != 1 {
+		t.Errorf("member got %d recent runs, want 1", len(resp.RecentRuns))
+	}
+
+	if w := doRequest(srv, "GET", "/api/summary?recent=1000", nil, "Bearer test-key"); w.Code != http.StatusBadRequest {
+		t.Errorf("recent=1000: got status %d, want 400", w.Code)
+	}
+}
@@ -0,0 +1,231 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/anthropics/m/internal/store"
+)
+
+// userResponse represents a user in API responses.
+type userResponse struct {
+	ID        string `json:"id"`
+	Name      string `json:"name"`
+	CreatedAt int64  `json:"created_at"`
+}
+
+func toUserResponse(u *store.User) userResponse {
+	return userResponse{
+		ID:        u.ID,
+		Name:      u.Name,
+		CreatedAt: u.CreatedAt.Unix(),
+	}
+}
+
+// tokenResponse represents an API token in API responses. Token is only set
+// when the token is created; it cannot be retrieved afterwards.
+type tokenResponse struct {
+	ID         string        `json:"id"`
+	UserID     *string       `json:"user_id,omitempty"`
+	Name       string        `json:"name"`
+	Prefix     string        `json:"prefix"`
+	Scopes     []store.Scope `json:"scopes"`
+	Token      string        `json:"token,omitempty"`
+	CreatedAt  int64         `json:"created_at"`
+	ExpiresAt  *int64        `json:"expires_at,omitempty"`
+	LastUsedAt *int64        `json:"last_used_at,omitempty"`
+	RevokedAt  *int64        `json:"revoked_at,omitempty"`
+}
+
+func toTokenResponse(t *store.APIToken) tokenResponse {
+	return tokenResponse{
+		ID:         t.ID,
+		UserID:     t.UserID,
+		Name:       t.Name,
+		Prefix:     t.Prefix,
+		Scopes:     t.Scopes,
+		CreatedAt:  t.CreatedAt.Unix(),
+		ExpiresAt:  unixPtr(t.ExpiresAt),
+		LastUsedAt: unixPtr(t.LastUsedAt),
+		RevokedAt:  unixPtr(t.RevokedAt),
+	}
+}
+
+func unixPtr(t *time.Time) *int64 {
+	if t == nil {
+		return nil
+	}
+	u := t.Unix()
+	return &u
+}
+
+// handleListUsers returns all users.
+func (s *Server) handleListUsers(w http.ResponseWriter, r *http.Request) {
+	users, err := s.storeFor(r).ListUsers()
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "internal_error", "failed to list users")
+		return
+	}
+
+	resp := make([]userResponse, len(users))
+	for i, user := range users {
+		resp[i] = toUserResponse(user)
+	}
+
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// createUserRequest is the request body for creating a user.
+type createUserRequest struct {
+	Name string `json:"name"`
+}
+
+// handleCreateUser creates a new user.
+func (s *Server) handleCreateUser(w http.ResponseWriter, r *http.Request) {
+	var req createUserRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid_input", "invalid JSON body")
+		return
+	}
+
+	if req.Name == "" {
+		writeError(w, http.StatusBadRequest, "invalid_input", "name is required")
+		return
+	}
+
+	user, err := s.storeFor(r).CreateUser(req.Name)
+	if errors.Is(err, store.ErrUserExists) {
+		writeError(w, http.StatusConflict, "conflict", "user already exists")
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "internal_error", "failed to create user")
+		return
+	}
+
+	audit(r, auditUserCreate, "user", user.ID, map[string]string{"name": user.Name})
+	writeJSON(w, http.StatusCreated, toUserResponse(user))
+}
+
+// handleDeleteUser deletes a user and revokes all of their tokens.
+func (s *Server) handleDeleteUser(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+
+	err := s.storeFor(r).DeleteUser(id)
+	if errors.Is(err, store.ErrNotFound) {
+		writeError(w, http.StatusNotFound, "not_found", "user not found")
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "internal_error", "failed to delete user")
+		return
+	}
+
+	audit(r, auditUserDelete, "user", id, nil)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handleListTokens returns user tokens, optionally filtered by user_id.
+// Secrets are never included.
+func (s *Server) handleListTokens(w http.ResponseWriter, r *http.Request) {
+	tokens, err := s.storeFor(r).ListTokens(r.URL.Query().Get("user_id"))
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "internal_error", "failed to list tokens")
+		return
+	}
+
+	resp := make([]tokenResponse, len(tokens))
+	for i, token := range tokens {
+		resp[i] = toTokenResponse(token)
+	}
+
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// createTokenRequest is the request body for creating a token.
+type createTokenRequest struct {
+	UserID    string        `json:"user_id"`
+	Name      string        `json:"name"`
+	Scopes    []store.Scope `json:"scopes"`
+	ExpiresIn *int64        `json:"expires_in,omitempty"` // Seconds; omit for no expiry
+}
+
+// handleCreateToken creates a token for a user. The plaintext token is only
+// returned in this response.
+func (s *Server) handleCreateToken(w http.ResponseWriter, r *http.Request) {
+	var req createTokenRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid_input", "invalid JSON body")
+		return
+	}
+
+	if req.UserID == "" {
+		writeError(w, http.StatusBadRequest, "invalid_input", "user_id is required")
+		return
+	}
+	if req.Name == "" {
+		writeError(w, http.StatusBadRequest, "invalid_input", "name is required")
+		return
+	}
+	if len(req.Scopes) == 0 {
+		writeError(w, http.StatusBadRequest, "invalid_input", "scopes is required")
+		return
+	}
+	for _, scope := range req.Scopes {
+		// Hook tokens are issued per run by the server, never by users
+		if !scope.IsValid() || scope == store.ScopeHook {
+			writeError(w, http.StatusBadRequest, "invalid_input", "invalid scope: "+string(scope))
+			return
+		}
+	}
+
+	var expiresAt *time.Time
+	if req.ExpiresIn != nil {
+		if *req.ExpiresIn <= 0 {
+			writeError(w, http.StatusBadRequest, "invalid_input", "expires_in must be positive")
+			return
+		}
+		t := time.Now().Add(time.Duration(*req.ExpiresIn) * time.Second)
+		expiresAt = &t
+	}
+
+	if _, err := s.storeFor(r).GetUser(req.UserID); err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			writeError(w, http.StatusNotFound, "not_found", "user not found")
+			return
+		}
+		writeError(w, http.StatusInternalServerError, "internal_error", "failed to get user")
+		return
+	}
+
+	token, plaintext, err := s.storeFor(r).CreateToken(req.UserID, req.Name, req.Scopes, expiresAt)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "internal_error", "failed to create token")
+		return
+	}
+
+	audit(r, auditTokenCreate, "token", token.ID, map[string]any{"user_id": req.UserID, "scopes": req.Scopes})
+	resp := toTokenResponse(token)
+	resp.Token = plaintext
+	writeJSON(w, http.StatusCreated, resp)
+}
+
+// handleRevokeToken revokes a token.
+func (s *Server) handleRevokeToken(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+
+	err := s.storeFor(r).RevokeToken(id)
+	if errors.Is(err, store.ErrNotFound) {
+		writeError(w, http.StatusNotFound, "not_found", "token not found")
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "internal_error", "failed to revoke token")
+		return
+	}
+
+	audit(r, auditTokenRevoke, "token", id, nil)
+	w.WriteHeader(http.StatusNoContent)
+}
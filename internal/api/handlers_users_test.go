@@ -0,0 +1,156 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/anthropics/m/internal/store"
+)
+
+func createTestToken(t *testing.T, srv *Server, scopes ...string) string {
+	t.Helper()
+
+	w := doRequest(srv, "POST", "/api/users", map[string]string{"name": "user-" + scopes[0]}, "Bearer test-key")
+	if w.Code != http.StatusCreated {
+		t.Fatalf("create user: got status %d: %s", w.Code, w.Body.String())
+	}
+	var user userResponse
+	json.NewDecoder(w.Body).Decode(&user)
+
+	w = doRequest(srv, "POST", "/api/tokens", map[string]any{
+		"user_id": user.ID,
+		"name":    "test",
+		"scopes":  scopes,
+	}, "Bearer test-key")
+	if w.Code != http.StatusCreated {
+		t.Fatalf("create token: got status %d: %s", w.Code, w.Body.String())
+	}
+	var token tokenResponse
+	json.NewDecoder(w.Body).Decode(&token)
+	if token.Token == "" {
+		t.Fatal("plaintext token not returned on create")
+	}
+	return token.Token
+}
+
+func TestTokenScopes(t *testing.T) {
+	srv, cleanup := setupTestServer(t)
+	defer cleanup()
+
+	reader := "Bearer " + createTestToken(t, srv, "read")
+	approver := "Bearer " + createTestToken(t, srv, "approve")
+
+	tests := []struct {
+		name       string
+		method     string
+		path       string
+		auth       string
+		wantStatus int
+	}{
+		{"read can list repos", "GET", "/api/repos", reader, http.StatusOK},
+		{"read cannot create repos", "POST", "/api/repos", reader, http.StatusForbidden},
+		{"read cannot resolve", "POST", "/api/approvals/resolve", reader, http.StatusForbidden},
+		{"read cannot manage tokens", "GET", "/api/tokens", reader, http.StatusForbidden},
+		{"approve cannot list repos", "GET", "/api/repos", approver, http.StatusForbidden},
+		{"approve can resolve", "POST", "/api/approvals/resolve", approver, http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := doRequest(srv, tt.method, tt.path, map[string]any{}, tt.auth)
+			if w.Code != tt.wantStatus {
+				t.Errorf("got status %d, want %d: %s", w.Code, tt.wantStatus, w.Body.String())
+			}
+		})
+	}
+}
+
+func TestTokenLifecycle(t *testing.T) {
+	srv, cleanup := setupTestServer(t)
+	defer cleanup()
+
+	// Hook scope cannot be granted to users
+	w := doRequest(srv, "POST", "/api/users", map[string]string{"name": "alice"}, "Bearer test-key")
+	var user userResponse
+	json.NewDecoder(w.Body).Decode(&user)
+
+	w = doRequest(srv, "POST", "/api/tokens", map[string]any{
+		"user_id": user.ID, "name": "hook", "scopes": []string{"hook"},
+	}, "Bearer test-key")
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("hook scope: got status %d, want %d", w.Code, http.StatusBadRequest)
+	}
+
+	w = doRequest(srv, "POST", "/api/tokens", map[string]any{
+		"user_id": user.ID, "name": "laptop", "scopes": []string{"read"},
+	}, "Bearer test-key")
+	if w.Code != http.StatusCreated {
+		t.Fatalf("create token: got status %d", w.Code)
+	}
+	var created tokenResponse
+	json.NewDecoder(w.Body).Decode(&created)
+
+	// Listing never returns the secret
+	w = doRequest(srv, "GET", "/api/tokens?user_id="+user.ID, nil, "Bearer test-key")
+	var tokens []tokenResponse
+	json.NewDecoder(w.Body).Decode(&tokens)
+	if len(tokens) != 1 || tokens[0].Token != "" || tokens[0].Prefix == "" {
+		t.Errorf("listed tokens = %+v", tokens)
+	}
+
+	if w := doRequest(srv, "GET", "/api/repos", nil, "Bearer "+created.Token); w.Code != http.StatusOK {
+		t.Errorf("before revoke: got status %d, want %d", w.Code, http.StatusOK)
+	}
+
+	w = doRequest(srv, "DELETE", "/api/tokens/"+created.ID, nil, "Bearer test-key")
+	if w.Code != http.StatusNoContent {
+		t.Fatalf("revoke: got status %d, want %d", w.Code, http.StatusNoContent)
+	}
+
+	if w := doRequest(srv, "GET", "/api/repos", nil, "Bearer "+created.Token); w.Code != http.StatusUnauthorized {
+		t.Errorf("after revoke: got status %d, want %d", w.Code, http.StatusUnauthorized)
+	}
+}
+
+func TestHookTokenRestrictedToRun(t *testing.T) {
+	srv, cleanup := setupTestServer(t)
+	defer cleanup()
+
+	repo, _ := srv.store.CreateRepo("test-repo", nil)
+	run, _ := srv.store.CreateRun(repo.ID, "prompt", "/workspace")
+	otherRepo, _ := srv.store.CreateRepo("other-repo", nil)
+	other, _ := srv.store.CreateRun(otherRepo.ID, "prompt", "/workspace")
+
+	token, err := srv.IssueHookToken(run.ID)
+	if err != nil {
+		t.Fatalf("IssueHookToken: %v", err)
+	}
+
+	if w := doRequest(srv, "GET", "/api/repos", nil, "Bearer "+token); w.Code != http.StatusForbidden {
+		t.Errorf("read with hook token: got status %d, want %d", w.Code, http.StatusForbidden)
+	}
+
+	w := doSocketRequest(srv, "POST", "/api/internal/interaction-request", map[string]any{
+		"run_id":     other.ID,
+		"type":       "approval",
+		"tool":       "Bash",
+		"request_id": "req-1",
+	}, "Bearer "+token)
+	if w.Code != http.StatusForbidden {
+		t.Errorf("other run: got status %d, want %d", w.Code, http.StatusForbidden)
+	}
+
+	if err := srv.store.UpdateRunState(run.ID, store.RunStateCompleted); err != nil {
+		t.Fatalf("UpdateRunState: %v", err)
+	}
+	w = doSocketRequest(srv, "POST", "/api/internal/interaction-request", map[string]any{
+		"run_id":     run.ID,
+		"type":       "approval",
+		"tool":       "Bash",
+		"request_id": "req-2",
+	}, "Bearer "+token)
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("finished run: got status %d, want %d", w.Code, http.StatusUnauthorized)
+	}
+}
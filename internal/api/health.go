@@ -0,0 +1,181 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/anthropics/m/internal/version"
+)
+
+const (
+	// readyTimeout bounds a readiness probe; checks still running are
+	// reported as failed.
+	readyTimeout = 5 * time.Second
+
+	// claudeCheckInterval bounds how often the Claude binary is executed,
+	// since starting it costs far more than the other checks.
+	claudeCheckInterval = time.Minute
+)
+
+// Check statuses.
+const (
+	checkOK      = "ok"
+	checkFail    = "fail"
+	checkSkipped = "skipped"
+)
+
+// checkResult is the outcome of one readiness check.
+type checkResult struct {
+	Status     string         `json:"status"`
+	DurationMs int64          `json:"duration_ms"`
+	Error      string         `json:"error,omitempty"`
+	Details    map[string]any `json:"details,omitempty"`
+}
+
+// readinessResponse reports each dependency check and the running build.
+type readinessResponse struct {
+	Status string                 `json:"status"` // ok or unavailable
+	Build  version.Info           `json:"build"`
+	Checks map[string]checkResult `json:"checks"`
+}
+
+// healthCheck checks one dependency. A nil details map with a nil error
+// marks the check as skipped.
+type healthCheck func(ctx context.Context) (details map[string]any, err error)
+
+// handleLive reports that the process is up and serving requests.
+func (s *Server) handleLive(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Write([]byte(`{"status":"ok"}`))
+}
+
+// handleReady checks the server's dependencies and returns 503 if any fail.
+func (s *Server) handleReady(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), readyTimeout)
+	defer cancel()
+
+	resp := readinessResponse{
+		Status: checkOK,
+		Build:  version.Get(),
+		Checks: runChecks(ctx, map[string]healthCheck{
+			"database":  s.checkDatabase,
+			"workspace": s.checkWorkspace,
+			"claude":    s.checkClaude,
+			"hub":       s.checkHub,
+		}),
+	}
+
+	status := http.StatusOK
+	for _, c := range resp.Checks {
+		if c.Status == checkFail {
+			resp.Status = "unavailable"
+			status = http.StatusServiceUnavailable
+		}
+	}
+	writeJSON(w, status, resp)
+}
+
+// runChecks runs checks concurrently until ctx is done.
+func runChecks(ctx context.Context, checks map[string]healthCheck) map[string]checkResult {
+	type named struct {
+		name   string
+		result checkResult
+	}
+	done := make(chan named, len(checks))
+	for name, check := range checks {
+		go func() {
+			start := time.Now()
+			details, err := check(ctx)
+			result := checkResult{Status: checkOK, DurationMs: time.Since(start).Milliseconds(), Details: details}
+			switch {
+			case err != nil:
+				result.Status, result.Error = checkFail, err.Error()
+			case details == nil:
+				result.Status = checkSkipped
+			}
+			done <- named{name, result}
+		}()
+	}
+
+	results := make(map[string]checkResult, len(checks))
+	for len(results) < len(checks) {
+		select {
+		case n := <-done:
+			results[n.name] = n.result
+		case <-ctx.Done():
+			for name := range checks {
+				if _, ok := results[name]; !ok {
+					results[name] = checkResult{Status: checkFail, Error: "timed out"}
+				}
+			}
+		}
+	}
+	return results
+}
+
+func (s *Server) checkDatabase(ctx context.Context) (map[string]any, error) {
+	if err := s.store.WithContext(ctx).Check(ctx); err != nil {
+		return nil, err
+	}
+	return map[string]any{}, nil
+}
+
+func (s *Server) checkWorkspace(ctx context.Context) (map[string]any, error) {
+	free, err := s.workspace.Check()
+	if err != nil {
+		return nil, err
+	}
+	details := map[string]any{"free_bytes": free, "min_free_bytes": s.minFreeBytes}
+	if free < s.minFreeBytes {
+		return details, fmt.Errorf("%d bytes free, need %d", free, s.minFreeBytes)
+	}
+	return details, nil
+}
+
+func (s *Server) checkHub(ctx context.Context) (map[string]any, error) {
+	if err := s.hub.Ping(ctx); err != nil {
+		return nil, err
+	}
+	return map[string]any{}, nil
+}
+
+// claudeCheckCache holds the last result of running the Claude binary.
+type claudeCheckCache struct {
+	mu      sync.Mutex
+	at      time.Time
+	version string
+	err     error
+}
+
+// checkClaude runs the Claude binary with --version, at most once per
+// claudeCheckInterval. It is skipped in demo mode, which does not use it.
+func (s *Server) checkClaude(ctx context.Context) (map[string]any, error) {
+	if s.demoMode || s.claudeBinary == "" {
+		return nil, nil
+	}
+
+	c := &s.claudeCheck
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if time.Since(c.at) >= claudeCheckInterval {
+		out, err := exec.CommandContext(ctx, s.claudeBinary, "--version").Output()
+		c.version, c.err = strings.TrimSpace(string(out)), err
+		if err != nil {
+			c.err = fmt.Errorf("run %s --version: %w", s.claudeBinary, err)
+		}
+		c.at = time.Now()
+	}
+
+	details := map[string]any{"path": s.claudeBinary}
+	if c.err != nil {
+		return details, c.err
+	}
+	details["version"] = c.version
+	return details, nil
+}
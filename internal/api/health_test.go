@@ -0,0 +1,130 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/anthropics/m/internal/run"
+)
+
+func decodeReadiness(t *testing.T, body []byte) readinessResponse {
+	t.Helper()
+	var resp readinessResponse
+	if err := json.Unmarshal(body, &resp); err != nil {
+		t.Fatalf("decode readiness: %v", err)
+	}
+	return resp
+}
+
+func TestHealthLive(t *testing.T) {
+	srv, cleanup := setupTestServer(t)
+	defer cleanup()
+
+	for _, path := range []string{"/health", "/health/live"} {
+		w := doRequest(srv, "GET", path, nil, "")
+		if w.Code != http.StatusOK {
+			t.Errorf("GET %s: expected 200 without auth, got %d", path, w.Code)
+		}
+	}
+}
+
+func TestHealthReady(t *testing.T) {
+	srv, cleanup := setupTestServer(t)
+	defer cleanup()
+	srv.workspace = run.NewWorkspaceManager(t.TempDir())
+
+	w := doRequest(srv, "GET", "/health/ready", nil, "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+
+	resp := decodeReadiness(t, w.Body.Bytes())
+	if resp.Status != "ok" {
+		t.Errorf("status = %q, want ok", resp.Status)
+	}
+	if resp.Build.Version != "dev" {
+		t.Errorf("build.version = %q, want dev", resp.Build.Version)
+	}
+	for name, want := range map[string]string{
+		"database":  checkOK,
+		"workspace": checkOK,
+		"hub":       checkOK,
+		"claude":    checkSkipped,
+	} {
+		if got := resp.Checks[name].Status; got != want {
+			t.Errorf("check %s = %q (%s), want %q", name, got, resp.Checks[name].Error, want)
+		}
+	}
+	if _, ok := resp.Checks["workspace"].Details["free_bytes"]; !ok {
+		t.Error("workspace check missing free_bytes")
+	}
+}
+
+func TestHealthReady_Claude(t *testing.T) {
+	srv, cleanup := setupTestServer(t)
+	defer cleanup()
+	srv.workspace = run.NewWorkspaceManager(t.TempDir())
+
+	bin := filepath.Join(t.TempDir(), "claude")
+	if err := os.WriteFile(bin, []byte("#!/bin/sh\necho '1.2.3 (Claude Code)'\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	srv.claudeBinary = bin
+
+	w := doRequest(srv, "GET", "/health/ready", nil, "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	claude := decodeReadiness(t, w.Body.Bytes()).Checks["claude"]
+	if claude.Status != checkOK || claude.Details["version"] != "1.2.3 (Claude Code)" {
+		t.Errorf("claude check = %+v", claude)
+	}
+}
+
+func TestHealthReady_Failures(t *testing.T) {
+	tests := []struct {
+		name  string
+		setup func(srv *Server)
+		check string
+	}{
+		{
+			name:  "missing claude binary",
+			setup: func(srv *Server) { srv.claudeBinary = filepath.Join(t.TempDir(), "missing") },
+			check: "claude",
+		},
+		{
+			name:  "closed database",
+			setup: func(srv *Server) { srv.store.Close() },
+			check: "database",
+		},
+		{
+			name:  "insufficient disk space",
+			setup: func(srv *Server) { srv.minFreeBytes = 1 << 62 },
+			check: "workspace",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv, cleanup := setupTestServer(t)
+			defer cleanup()
+			srv.workspace = run.NewWorkspaceManager(t.TempDir())
+			tt.setup(srv)
+
+			w := doRequest(srv, "GET", "/health/ready", nil, "")
+			if w.Code != http.StatusServiceUnavailable {
+				t.Fatalf("expected 503, got %d: %s", w.Code, w.Body.String())
+			}
+			resp := decodeReadiness(t, w.Body.Bytes())
+			if resp.Status != "unavailable" {
+				t.Errorf("status = %q, want unavailable", resp.Status)
+			}
+			if c := resp.Checks[tt.check]; c.Status != checkFail || c.Error == "" {
+				t.Errorf("check %s = %+v, want fail with error", tt.check, c)
+			}
+		})
+	}
+}
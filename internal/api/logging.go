@@ -0,0 +1,99 @@
+package api
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// headerRequestID carries the request ID. A valid incoming value is kept so
+// IDs can be correlated across proxies; otherwise one is generated.
+const headerRequestID = "X-Request-ID"
+
+// maxRequestIDLen bounds incoming request IDs accepted from clients.
+const maxRequestIDLen = 128
+
+// NewLogger creates a structured logger writing to w. Level is debug, info,
+// warn or error; format is text or json.
+func NewLogger(w io.Writer, level, format string) (*slog.Logger, error) {
+	var lvl slog.Level
+	if err := lvl.UnmarshalText([]byte(level)); err != nil {
+		return nil, fmt.Errorf("invalid log level %q", level)
+	}
+	opts := &slog.HandlerOptions{Level: lvl}
+
+	switch format {
+	case "text", "":
+		return slog.New(slog.NewTextHandler(w, opts)), nil
+	case "json":
+		return slog.New(slog.NewJSONHandler(w, opts)), nil
+	default:
+		return nil, fmt.Errorf("invalid log format %q", format)
+	}
+}
+
+type logFieldsKey struct{}
+
+// logFields are attributes attached to every log line of one request. Handlers
+// add to them as they learn which run or interaction the request concerns.
+type logFields struct {
+	mu    sync.Mutex
+	attrs []any
+}
+
+// RequestIDMiddleware assigns each request an ID, echoes it in the response
+// and attaches it to the request's log lines.
+func RequestIDMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(headerRequestID)
+		if !validRequestID(id) {
+			id = newRequestID()
+		}
+		w.Header().Set(headerRequestID, id)
+
+		fields := &logFields{attrs: []any{"request_id", id}}
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), logFieldsKey{}, fields)))
+	})
+}
+
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLen {
+		return false
+	}
+	return !strings.ContainsFunc(id, func(c rune) bool {
+		return c <= ' ' || c > '~'
+	})
+}
+
+func newRequestID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// addLogAttrs attaches key-value pairs to the rest of the request's log lines,
+// including the access log line written when it completes.
+func addLogAttrs(ctx context.Context, args ...any) {
+	if fields, ok := ctx.Value(logFieldsKey{}).(*logFields); ok {
+		fields.mu.Lock()
+		fields.attrs = append(fields.attrs, args...)
+		fields.mu.Unlock()
+	}
+}
+
+// loggerFrom returns the default logger with the request's log attributes.
+func loggerFrom(ctx context.Context) *slog.Logger {
+	fields, ok := ctx.Value(logFieldsKey{}).(*logFields)
+	if !ok {
+		return slog.Default()
+	}
+	fields.mu.Lock()
+	defer fields.mu.Unlock()
+	return slog.Default().With(fields.attrs...)
+}
@@ -0,0 +1,153 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/anthropics/m/internal/store"
+)
+
+// captureLogs sends the default logger's JSON output to a buffer for the
+// duration of the test.
+func captureLogs(t *testing.T) *bytes.Buffer {
+	t.Helper()
+	var buf bytes.Buffer
+	logger, err := NewLogger(&buf, "debug", "json")
+	if err != nil {
+		t.Fatalf("NewLogger: %v", err)
+	}
+	prev := slog.Default()
+	slog.SetDefault(logger)
+	t.Cleanup(func() { slog.SetDefault(prev) })
+	return &buf
+}
+
+// logLines decodes captured JSON log lines.
+func logLines(t *testing.T, buf *bytes.Buffer) []map[string]any {
+	t.Helper()
+	var lines []map[string]any
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		if line == "" {
+			continue
+		}
+		var m map[string]any
+		if err := json.Unmarshal([]byte(line), &m); err != nil {
+			t.Fatalf("log line is not JSON: %q", line)
+		}
+		lines = append(lines, m)
+	}
+	return lines
+}
+
+func TestRequestID(t *testing.T) {
+	srv, cleanup := setupTestServer(t)
+	defer cleanup()
+
+	// Generated when absent
+	w := doRequest(srv, "GET", "/health", nil, "")
+	generated := w.Header().Get("X-Request-ID")
+	if len(generated) != 32 {
+		t.Errorf("generated request ID = %q, want 32 hex characters", generated)
+	}
+
+	// Propagated when valid
+	req := httptest.NewRequest("GET", "/health", nil)
+	req.Header.Set("X-Request-ID", "upstream-id-123")
+	w = httptest.NewRecorder()
+	srv.httpServer.Handler.ServeHTTP(w, req)
+	if got := w.Header().Get("X-Request-ID"); got != "upstream-id-123" {
+		t.Errorf("X-Request-ID = %q, want upstream-id-123", got)
+	}
+
+	// Replaced when invalid
+	for _, bad := range []string{"has space", strings.Repeat("a", maxRequestIDLen+1), "nul\x00"} {
+		req := httptest.NewRequest("GET", "/health", nil)
+		req.Header.Set("X-Request-ID", bad)
+		w := httptest.NewRecorder()
+		srv.httpServer.Handler.ServeHTTP(w, req)
+		if got := w.Header().Get("X-Request-ID"); got == bad || got == "" {
+			t.Errorf("X-Request-ID %q was not replaced, got %q", bad, got)
+		}
+	}
+}
+
+func TestRequestLogCorrelation(t *testing.T) {
+	srv, cleanup := setupTestServer(t)
+	defer cleanup()
+	buf := captureLogs(t)
+
+	repo, _ := srv.store.CreateRepo("log-repo", nil)
+	run, _ := srv.store.CreateRun(repo.ID, "test", "/tmp/ws")
+	srv.store.UpdateRunState(run.ID, store.RunStateWaitingApproval)
+	interaction, _ := srv.store.CreateInteraction("req-1", run.ID, store.InteractionTypeApproval, "Bash", nil)
+
+	req := httptest.NewRequest("GET", "/api/runs/"+run.ID, nil)
+	req.Header.Set("Authorization", "Bearer test-key")
+	req.Header.Set("X-Request-ID", "req-get-run")
+	srv.httpServer.Handler.ServeHTTP(httptest.NewRecorder(), req)
+
+	w := doRequest(srv, "POST", "/api/approvals/"+interaction.ID+"/resolve", map[string]any{"approved": true}, "Bearer test-key")
+	if w.Code != http.StatusOK {
+		t.Fatalf("resolve: got status %d, want %d", w.Code, http.StatusOK)
+	}
+
+	var getRun, resolve map[string]any
+	for _, line := range logLines(t, buf) {
+		if line["msg"] != "request" {
+			continue
+		}
+		switch line["route"] {
+		case "/api/runs/{id}":
+			getRun = line
+		case "/api/approvals/{id}/resolve":
+			resolve = line
+		}
+	}
+
+	if getRun == nil {
+		t.Fatal("no access log line for GET /api/runs/{id}")
+	}
+	if getRun["request_id"] != "req-get-run" || getRun["run_id"] != run.ID {
+		t.Errorf("get run log line = %v, want request_id req-get-run and run_id %s", getRun, run.ID)
+	}
+	if getRun["method"] != "GET" || getRun["status"] != float64(http.StatusOK) {
+		t.Errorf("get run log line = %v, want method GET and status 200", getRun)
+	}
+
+	if resolve == nil {
+		t.Fatal("no access log line for POST /api/approvals/{id}/resolve")
+	}
+	if resolve["run_id"] != run.ID || resolve["interaction_id"] != interaction.ID {
+		t.Errorf("resolve log line = %v, want run_id %s and interaction_id %s", resolve, run.ID, interaction.ID)
+	}
+	if resolve["request_id"] != w.Header().Get("X-Request-ID") {
+		t.Errorf("resolve log request_id = %v, want %s", resolve["request_id"], w.Header().Get("X-Request-ID"))
+	}
+}
+
+func TestNewLogger(t *testing.T) {
+	for _, format := range []string{"text", "json"} {
+		var buf bytes.Buffer
+		logger, err := NewLogger(&buf, "warn", format)
+		if err != nil {
+			t.Fatalf("NewLogger(%s): %v", format, err)
+		}
+		logger.Info("hidden")
+		logger.Warn("shown", "run_id", "run-1")
+		if out := buf.String(); strings.Contains(out, "hidden") || !strings.Contains(out, "run-1") {
+			t.Errorf("%s output = %q, want only the warning", format, out)
+		}
+	}
+
+	if _, err := NewLogger(&bytes.Buffer{}, "loud", "text"); err == nil {
+		t.Error("expected error for invalid level")
+	}
+	if _, err := NewLogger(&bytes.Buffer{}, "info", "xml"); err == nil {
+		t.Error("expected error for invalid format")
+	}
+}
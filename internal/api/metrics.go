@@ -0,0 +1,192 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/anthropics/m/internal/metrics"
+	"github.com/anthropics/m/internal/store"
+)
+
+// diskUsageInterval bounds how often the workspaces directory is walked for
+// the disk usage gauge.
+const diskUsageInterval = time.Minute
+
+var (
+	httpRequests = metrics.NewCounterVec(
+		"m_http_requests_total",
+		"HTTP requests by method, route and status code.",
+		"method", "route", "code",
+	)
+	httpRequestDuration = metrics.NewHistogramVec(
+		"m_http_request_duration_seconds",
+		"HTTP request latency by method and route. Long-polls and WebSockets last until they end.",
+		metrics.DefBuckets,
+		"method", "route",
+	)
+	interactionResolution = metrics.NewHistogramVec(
+		"m_interaction_resolution_seconds",
+		"Time from an interaction being requested to being resolved.",
+		[]float64{1, 5, 15, 30, 60, 120, 300, 600, 1800, 3600},
+		"type",
+	)
+	hubDroppedClients = metrics.NewCounterVec(
+		"m_websocket_dropped_clients_total",
+		"WebSocket clients dropped because their send buffer was full.",
+	)
+)
+
+type routeKey struct{}
+
+// withRoute records the mux pattern matching each request, so metrics are
+// labelled by route rather than by raw path.
+func withRoute(mux *http.ServeMux) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			_, pattern := mux.Handler(r)
+			next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), routeKey{}, pattern)))
+		})
+	}
+}
+
+// routeFromContext returns the route of the request without its method, or
+// "unmatched" for requests that match no route.
+func routeFromContext(ctx context.Context) string {
+	pattern, _ := ctx.Value(routeKey{}).(string)
+	if _, path, ok := strings.Cut(pattern, " "); ok {
+		pattern = path
+	}
+	if pattern == "" {
+		return "unmatched"
+	}
+	return pattern
+}
+
+// observeRequest records the request count and latency.
+func observeRequest(r *http.Request, status int, elapsed time.Duration) {
+	route := routeFromContext(r.Context())
+	httpRequests.Inc(r.Method, route, strconv.Itoa(status))
+	httpRequestDuration.Observe(elapsed.Seconds(), r.Method, route)
+}
+
+// observeResolution records how long an interaction waited for a decision.
+func observeResolution(i *store.Interaction) {
+	end := time.Now()
+	if i.ResolvedAt != nil {
+		end = *i.ResolvedAt
+	}
+	interactionResolution.Observe(end.Sub(i.CreatedAt).Seconds(), string(i.Type))
+}
+
+// newMetricsRegistry returns the gauges computed from the server's state on
+// each scrape.
+func (s *Server) newMetricsRegistry() *metrics.Registry {
+	reg := metrics.NewRegistry()
+	reg.Register(
+		metrics.NewGaugeFunc("m_runs", "Runs by state.", []string{"state"}, s.collectRuns),
+		metrics.NewGaugeFunc("m_interactions_pending", "Pending interactions by type.", []string{"type"}, s.collectPending),
+		metrics.NewGaugeFunc("m_interactions_pending_oldest_seconds", "Age of the oldest pending interaction by type.", []string{"type"}, s.collectPendingAge),
+		metrics.NewGaugeFunc("m_websocket_clients", "Connected WebSocket clients by run.", []string{"run_id"}, s.collectClients),
+		metrics.NewGaugeFunc("m_workspace_disk_bytes", "Disk usage of all run workspaces.", nil, s.collectDiskUsage),
+	)
+	return reg
+}
+
+func (s *Server) collectRuns() ([]metrics.Sample, error) {
+	counts, err := s.store.CountRunsByState()
+	if err != nil {
+		return nil, err
+	}
+	samples := make([]metrics.Sample, len(store.RunStates))
+	for i, state := range store.RunStates {
+		samples[i] = metrics.Sample{Labels: []string{string(state)}, Value: float64(counts[state])}
+	}
+	return samples, nil
+}
+
+func (s *Server) collectPending() ([]metrics.Sample, error) {
+	pending, err := s.store.ListPendingInteractions()
+	if err != nil {
+		return nil, err
+	}
+	counts := make(map[store.InteractionType]int)
+	for _, i := range pending {
+		counts[i.Type]++
+	}
+	return []metrics.Sample{
+		{Labels: []string{string(store.InteractionTypeApproval)}, Value: float64(counts[store.InteractionTypeApproval])},
+		{Labels: []string{string(store.InteractionTypeInput)}, Value: float64(counts[store.InteractionTypeInput])},
+	}, nil
+}
+
+func (s *Server) collectPendingAge() ([]metrics.Sample, error) {
+	pending, err := s.store.ListPendingInteractions()
+	if err != nil {
+		return nil, err
+	}
+	oldest := make(map[store.InteractionType]float64)
+	for _, i := range pending {
+		if age := time.Since(i.CreatedAt).Seconds(); age > oldest[i.Type] {
+			oldest[i.Type] = age
+		}
+	}
+	return []metrics.Sample{
+		{Labels: []string{string(store.InteractionTypeApproval)}, Value: oldest[store.InteractionTypeApproval]},
+		{Labels: []string{string(store.InteractionTypeInput)}, Value: oldest[store.InteractionTypeInput]},
+	}, nil
+}
+
+func (s *Server) collectClients() ([]metrics.Sample, error) {
+	counts := s.hub.ClientCounts()
+	samples := make([]metrics.Sample, 0, len(counts))
+	for runID, n := range counts {
+		samples = append(samples, metrics.Sample{Labels: []string{runID}, Value: float64(n)})
+	}
+	return samples, nil
+}
+
+// diskUsageCache holds the last workspace disk usage, since walking every
+// workspace on each scrape would be expensive.
+type diskUsageCache struct {
+	mu    sync.Mutex
+	bytes int64
+	at    time.Time
+}
+
+func (s *Server) collectDiskUsage() ([]metrics.Sample, error) {
+	c := &s.diskUsage
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if time.Since(c.at) >= diskUsageInterval {
+		n, err := s.workspace.DiskUsage()
+		if err != nil {
+			return nil, err
+		}
+		c.bytes, c.at = n, time.Now()
+	}
+	return []metrics.Sample{{Value: float64(c.bytes)}}, nil
+}
+
+// handleMetrics serves process and server metrics in the Prometheus text
+// format.
+func (s *Server) handleMetrics(w http.ResponseWriter, r *http.Request) {
+	var buf bytes.Buffer
+	err := metrics.Default.Write(&buf)
+	if err == nil {
+		err = s.metrics.Write(&buf)
+	}
+	if err != nil {
+		loggerFrom(r.Context()).Error("metrics", "err", err)
+		writeError(w, http.StatusInternalServerError, "internal_error", "failed to collect metrics")
+		return
+	}
+
+	w.Header().Set("Content-Type", metrics.ContentType)
+	w.Write(buf.Bytes())
+}
@@ -0,0 +1,76 @@
+package api
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/anthropics/m/internal/metrics"
+	"github.com/anthropics/m/internal/store"
+)
+
+func TestMetrics(t *testing.T) {
+	srv, cleanup := setupTestServer(t)
+	defer cleanup()
+
+	repo, _ := srv.store.CreateRepo("metrics-repo", nil)
+	run, _ := srv.store.CreateRun(repo.ID, "test", "/tmp/ws")
+	srv.store.UpdateRunState(run.ID, store.RunStateWaitingApproval)
+	interaction, err := srv.store.CreateInteraction("req-1", run.ID, store.InteractionTypeApproval, "Bash", nil)
+	if err != nil {
+		t.Fatalf("CreateInteraction: %v", err)
+	}
+
+	doRequest(srv, "GET", "/api/repos", nil, "Bearer test-key")
+	doRequest(srv, "GET", "/api/repos/"+repo.ID, nil, "Bearer test-key")
+
+	w := doRequest(srv, "GET", "/metrics", nil, "Bearer test-key")
+	if w.Code != http.StatusOK {
+		t.Fatalf("got status %d, want %d: %s", w.Code, http.StatusOK, w.Body.String())
+	}
+	if got := w.Header().Get("Content-Type"); got != metrics.ContentType {
+		t.Errorf("Content-Type = %q, want %q", got, metrics.ContentType)
+	}
+
+	body := w.Body.String()
+	for _, want := range []string{
+		`m_http_requests_total{method="GET",route="/api/repos",code="200"}`,
+		`m_http_requests_total{method="GET",route="/api/repos/{id}",code="200"}`,
+		`m_http_request_duration_seconds_count{method="GET",route="/api/repos"}`,
+		`m_runs{state="waiting_approval"} 1`,
+		`m_runs{state="running"} 0`,
+		`m_interactions_pending{type="approval"} 1`,
+		`m_interactions_pending{type="input"} 0`,
+		`m_interactions_pending_oldest_seconds{type="approval"}`,
+		`m_workspace_disk_bytes`,
+		`m_sqlite_query_duration_seconds_count{op="query"}`,
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("metrics missing %s", want)
+		}
+	}
+
+	before := interactionResolution.Count(string(store.InteractionTypeApproval))
+	w = doRequest(srv, "POST", "/api/approvals/"+interaction.ID+"/resolve", map[string]any{"approved": true}, "Bearer test-key")
+	if w.Code != http.StatusOK {
+		t.Fatalf("resolve: got status %d, want %d", w.Code, http.StatusOK)
+	}
+	if got := interactionResolution.Count(string(store.InteractionTypeApproval)); got != before+1 {
+		t.Errorf("resolution count = %d, want %d", got, before+1)
+	}
+}
+
+func TestMetrics_RequiresAuth(t *testing.T) {
+	srv, cleanup := setupTestServer(t)
+	defer cleanup()
+
+	if w := doRequest(srv, "GET", "/metrics", nil, ""); w.Code != http.StatusUnauthorized {
+		t.Errorf("got status %d, want %d", w.Code, http.StatusUnauthorized)
+	}
+
+	// Unmatched paths share one route label instead of one per path
+	doRequest(srv, "GET", "/no/such/path", nil, "Bearer test-key")
+	if httpRequests.Value("GET", "unmatched", "404") == 0 {
+		t.Error("unmatched request not counted under route=unmatched")
+	}
+}
@@ -3,48 +3,122 @@ package api
 
 import (
 	"bufio"
+	"context"
+	"crypto/subtle"
+	"errors"
 	"fmt"
-	"log"
 	"net"
 	"net/http"
 	"strings"
 	"time"
+
+	"github.com/anthropics/m/internal/store"
 )
 
 // AuthMiddleware validates Bearer token authentication.
 // Skips auth for /health endpoint.
-func AuthMiddleware(apiKey string) func(http.Handler) http.Handler {
+//
+// The configured apiKey authenticates as an admin. Any other bearer token is
+// looked up in the store as a scoped API token. An empty apiKey disables the
+// legacy key so only store tokens are accepted.
+//
+// With a limiter, requests are rate limited per client IP before
+// authentication and per token after it, and IPs that keep failing
+// authentication are locked out with 429 until the lockout expires.
+//
+// WebSocket upgrades without an Authorization header may instead present a
+// ticket from tickets, which browsers can pass in the URL or subprotocol.
+func AuthMiddleware(apiKey string, st store.Backend, limiter *RateLimiter, tickets *TicketStore) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			// Skip auth for health check
-			if r.URL.Path == "/health" {
+			// Skip auth for health checks
+			if r.URL.Path == "/health" || strings.HasPrefix(r.URL.Path, "/health/") {
 				next.ServeHTTP(w, r)
 				return
 			}
 
-			auth := r.Header.Get("Authorization")
-			if auth == "" {
-				writeError(w, http.StatusUnauthorized, "unauthorized", "missing authorization header")
+			ip := clientIP(r)
+			if wait, locked := limiter.lockedOut(ip); locked {
+				writeRateLimited(w, wait, "too many failed authentication attempts")
 				return
 			}
+			if !limiter.check(w, r, "ip:"+ip) {
+				return
+			}
+
+			unauthorized := func(message string) {
+				limiter.recordFailure(ip)
+				writeError(w, http.StatusUnauthorized, "unauthorized", message)
+			}
+
+			var principal *Principal
+			var err error
+			auth := r.Header.Get("Authorization")
+			if ticket := wsTicketFromRequest(r); auth == "" && ticket != "" && tickets != nil {
+				principal, err = tickets.Redeem(ticket, r)
+				if err != nil {
+					unauthorized("invalid or expired ticket")
+					return
+				}
+			} else {
+				if auth == "" {
+					unauthorized("missing authorization header")
+					return
+				}
 
-			parts := strings.SplitN(auth, " ", 2)
-			if len(parts) != 2 || strings.ToLower(parts[0]) != "bearer" {
-				writeError(w, http.StatusUnauthorized, "unauthorized", "invalid authorization format")
+				parts := strings.SplitN(auth, " ", 2)
+				if len(parts) != 2 || strings.ToLower(parts[0]) != "bearer" {
+					unauthorized("invalid authorization format")
+					return
+				}
+
+				principal, err = authenticate(r.Context(), apiKey, st, parts[1])
+				if errors.Is(err, store.ErrInvalidToken) {
+					unauthorized("invalid api key")
+					return
+				}
+			}
+			if err != nil {
+				loggerFrom(r.Context()).Error("auth", "err", err)
+				writeError(w, http.StatusInternalServerError, "internal_error", "failed to authenticate")
 				return
 			}
+			limiter.recordSuccess(ip)
 
-			if parts[1] != apiKey {
-				writeError(w, http.StatusUnauthorized, "unauthorized", "invalid api key")
+			if !limiter.check(w, r, "token:"+principal.limitKey()) {
 				return
 			}
 
-			next.ServeHTTP(w, r)
+			next.ServeHTTP(w, r.WithContext(withPrincipal(r.Context(), principal)))
 		})
 	}
 }
 
-// LoggingMiddleware logs HTTP requests.
+// authenticate resolves a bearer token to a principal.
+func authenticate(ctx context.Context, apiKey string, st store.Backend, token string) (*Principal, error) {
+	if apiKey != "" && subtle.ConstantTimeCompare([]byte(token), []byte(apiKey)) == 1 {
+		return &Principal{Name: "api_key", Scopes: []store.Scope{store.ScopeAdmin}}, nil
+	}
+	if st == nil {
+		return nil, store.ErrInvalidToken
+	}
+
+	t, err := st.WithContext(ctx).AuthenticateToken(token)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &Principal{TokenID: t.ID, Name: t.Name, Scopes: t.Scopes}
+	if t.UserID != nil {
+		p.UserID = *t.UserID
+	}
+	if t.RunID != nil {
+		p.RunID = *t.RunID
+	}
+	return p, nil
+}
+
+// LoggingMiddleware logs HTTP requests and records request metrics.
 func LoggingMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		start := time.Now()
@@ -54,11 +128,14 @@ func LoggingMiddleware(next http.Handler) http.Handler {
 
 		next.ServeHTTP(wrapped, r)
 
-		log.Printf("%s %s %d %s",
-			r.Method,
-			r.URL.Path,
-			wrapped.status,
-			time.Since(start).Round(time.Millisecond),
+		elapsed := time.Since(start)
+		observeRequest(r, wrapped.status, elapsed)
+		loggerFrom(r.Context()).Info("request",
+			"method", r.Method,
+			"path", r.URL.Path,
+			"route", routeFromContext(r.Context()),
+			"status", wrapped.status,
+			"duration_ms", elapsed.Milliseconds(),
 		)
 	})
 }
@@ -68,7 +145,7 @@ func RecoveryMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		defer func() {
 			if err := recover(); err != nil {
-				log.Printf("panic recovered: %v", err)
+				loggerFrom(r.Context()).Error("panic recovered", "panic", err)
 				writeError(w, http.StatusInternalServerError, "internal_error", "internal server error")
 			}
 		}()
@@ -95,9 +172,9 @@ func (w *statusWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
 	return nil, nil, fmt.Errorf("ResponseWriter does not implement http.Hijacker")
 }
 
-// writeError writes a JSON error response.
+// writeError writes a JSON error response. Messages may quote client input.
 func writeError(w http.ResponseWriter, status int, code, message string) {
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(status)
-	w.Write([]byte(`{"error":{"code":"` + code + `","message":"` + message + `"}}`))
+	writeJSON(w, status, map[string]map[string]string{
+		"error": {"code": code, "message": message},
+	})
 }
@@ -0,0 +1,175 @@
+package api
+
+import (
+	"encoding/json"
+	"log/slog"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/anthropics/m/internal/store"
+)
+
+// OutputConfig controls how agent stdout and stderr are coalesced into
+// events.
+type OutputConfig struct {
+	FlushInterval time.Duration // Longest a line waits for more output; defaults to 50ms
+	MaxBytes      int           // Buffered output that is written at once; defaults to 8KB
+}
+
+const (
+	defaultOutputFlushInterval = 50 * time.Millisecond
+	defaultOutputMaxBytes      = 8 << 10
+)
+
+// outputIngester coalesces agent output into stdout and stderr events, with
+// one buffer per run. A buffer becomes one event, written and broadcast
+// together, when its window expires, when it reaches MaxBytes, when the
+// stream changes, or before any other event of the run is created. Output
+// therefore keeps its place in the run's seq order relative to tool and
+// interaction events.
+type outputIngester struct {
+	cfg   OutputConfig
+	store store.Backend
+	hub   *Hub
+
+	mu   sync.Mutex
+	runs map[string]*outputBuffer
+}
+
+// outputBuffer holds a run's output not yet written.
+type outputBuffer struct {
+	mu     sync.Mutex // Held while the buffer or an event of the run is written
+	runID  string
+	stream string // "stdout" or "stderr"
+	text   strings.Builder
+	timer  *time.Timer
+}
+
+func newOutputIngester(cfg OutputConfig, s store.Backend, hub *Hub) *outputIngester {
+	if cfg.FlushInterval <= 0 {
+		cfg.FlushInterval = defaultOutputFlushInterval
+	}
+	if cfg.MaxBytes <= 0 {
+		cfg.MaxBytes = defaultOutputMaxBytes
+	}
+	return &outputIngester{
+		cfg:   cfg,
+		store: s,
+		hub:   hub,
+		runs:  make(map[string]*outputBuffer),
+	}
+}
+
+// write buffers one line of a run's output. stream is "stdout" or "stderr".
+func (o *outputIngester) write(runID, stream, line string) {
+	o.mu.Lock()
+	b, ok := o.runs[runID]
+	if !ok {
+		b = &outputBuffer{runID: runID}
+		o.runs[runID] = b
+	}
+	o.mu.Unlock()
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.text.Len() > 0 && b.stream != stream {
+		o.flushLocked(b)
+	}
+	if b.text.Len() > 0 {
+		b.text.WriteByte('\n')
+	}
+	b.text.WriteString(line)
+	b.stream = stream
+
+	if b.text.Len() >= o.cfg.MaxBytes {
+		o.flushLocked(b)
+		return
+	}
+	if b.timer == nil {
+		b.timer = time.AfterFunc(o.cfg.FlushInterval, func() {
+			b.mu.Lock()
+			defer b.mu.Unlock()
+			o.flushLocked(b)
+		})
+	}
+}
+
+// createEvent writes the run's buffered output and then creates a non-output
+// event, so the event is sequenced after all output that preceded it.
+func (o *outputIngester) createEvent(st store.Backend, runID, eventType string, data *string) (*store.Event, error) {
+	o.mu.Lock()
+	b, ok := o.runs[runID]
+	o.mu.Unlock()
+	if !ok {
+		return st.CreateEvent(runID, eventType, data)
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	o.flushLocked(b)
+	return st.CreateEvent(runID, eventType, data)
+}
+
+// flush writes the run's buffered output now.
+func (o *outputIngester) flush(runID string) {
+	o.mu.Lock()
+	b, ok := o.runs[runID]
+	o.mu.Unlock()
+	if !ok {
+		return
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	o.flushLocked(b)
+}
+
+// close writes the run's buffered output and forgets the run, once its agent
+// has exited.
+func (o *outputIngester) close(runID string) {
+	o.flush(runID)
+
+	o.mu.Lock()
+	delete(o.runs, runID)
+	o.mu.Unlock()
+}
+
+// closeAll writes the buffered output of every run, on shutdown.
+func (o *outputIngester) closeAll() {
+	o.mu.Lock()
+	runIDs := make([]string, 0, len(o.runs))
+	for runID := range o.runs {
+		runIDs = append(runIDs, runID)
+	}
+	o.mu.Unlock()
+
+	for _, runID := range runIDs {
+		o.close(runID)
+	}
+}
+
+// flushLocked writes b as one event and broadcasts it. b.mu must be held.
+func (o *outputIngester) flushLocked(b *outputBuffer) {
+	if b.timer != nil {
+		b.timer.Stop()
+		b.timer = nil
+	}
+	if b.text.Len() == 0 {
+		return
+	}
+
+	data, _ := json.Marshal(struct {
+		Text string `json:"text"`
+	}{b.text.String()})
+	b.text.Reset()
+	eventData := string(data)
+
+	event, err := o.store.CreateEvent(b.runID, b.stream, &eventData)
+	if err != nil {
+		slog.Error("output: create event", "run_id", b.runID, "stream", b.stream, "err", err)
+		return
+	}
+	o.hub.BroadcastEvent(event)
+}
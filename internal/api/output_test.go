@@ -0,0 +1,144 @@
+package api
+
+import (
+	"encoding/json"
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/anthropics/m/internal/store"
+	"github.com/anthropics/m/internal/testutil"
+)
+
+// setupOutputTest returns a server whose output buffers use cfg, and a
+// running run to write output for.
+func setupOutputTest(t *testing.T, cfg OutputConfig) (*Server, *store.Store, string) {
+	t.Helper()
+	s, err := store.New(t.TempDir() + "/test.db")
+	if err != nil {
+		t.Fatalf("failed to create store: %v", err)
+	}
+	t.Cleanup(func() { s.Close() })
+	srv := New(Config{Port: 8080, APIKey: "test-key", Output: cfg}, s)
+
+	repo := testutil.CreateTestRepo(t, s, "test-repo")
+	run := testutil.CreateTestRun(t, s, repo.ID, "prompt", "/workspace")
+	return srv, s, run.ID
+}
+
+// outputEvents returns the run's events as type and text pairs.
+func outputEvents(t *testing.T, s *store.Store, runID string) [][2]string {
+	t.Helper()
+	events, err := s.ListEventsByRun(runID)
+	if err != nil {
+		t.Fatalf("ListEventsByRun: %v", err)
+	}
+	var got [][2]string
+	for i, e := range events {
+		if e.Seq != int64(i+1) {
+			t.Errorf("event %d seq = %d, want %d", i, e.Seq, i+1)
+		}
+		var data struct {
+			Text string `json:"text"`
+		}
+		if e.Data != nil {
+			json.Unmarshal([]byte(*e.Data), &data)
+		}
+		got = append(got, [2]string{e.Type, data.Text})
+	}
+	return got
+}
+
+func assertOutputEvents(t *testing.T, got, want [][2]string) {
+	t.Helper()
+	if len(got) != len(want) {
+		t.Fatalf("events = %q, want %q", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("event %d = %q, want %q", i, got[i], want[i])
+		}
+	}
+}
+
+func TestOutput_CoalescesLines(t *testing.T) {
+	srv, s, runID := setupOutputTest(t, OutputConfig{FlushInterval: time.Hour})
+
+	srv.output.write(runID, "stdout", "one")
+	srv.output.write(runID, "stdout", "two")
+	srv.output.write(runID, "stderr", "oops")
+	srv.output.write(runID, "stdout", "three")
+	testutil.AssertEventCount(t, s, runID, 2)
+
+	srv.output.close(runID)
+	assertOutputEvents(t, outputEvents(t, s, runID), [][2]string{
+		{"stdout", "one\ntwo"},
+		{"stderr", "oops"},
+		{"stdout", "three"},
+	})
+}
+
+func TestOutput_FlushesAtMaxBytes(t *testing.T) {
+	srv, s, runID := setupOutputTest(t, OutputConfig{FlushInterval: time.Hour, MaxBytes: 8})
+
+	srv.output.write(runID, "stdout", "1234")
+	testutil.AssertEventCount(t, s, runID, 0)
+	srv.output.write(runID, "stdout", "5678")
+	assertOutputEvents(t, outputEvents(t, s, runID), [][2]string{{"stdout", "1234\n5678"}})
+}
+
+func TestOutput_FlushesAfterInterval(t *testing.T) {
+	srv, s, runID := setupOutputTest(t, OutputConfig{FlushInterval: 10 * time.Millisecond})
+
+	srv.output.write(runID, "stdout", "line")
+	testutil.WaitFor(t, 2*time.Second, func() bool {
+		seq, _ := s.GetLatestEventSeq(runID)
+		return seq == 1
+	})
+	assertOutputEvents(t, outputEvents(t, s, runID), [][2]string{{"stdout", "line"}})
+}
+
+func TestOutput_OrderedBeforeOtherEvents(t *testing.T) {
+	srv, s, runID := setupOutputTest(t, OutputConfig{FlushInterval: time.Hour})
+
+	srv.output.write(runID, "stdout", "before")
+	data := `{"text":"answer"}`
+	event, err := srv.output.createEvent(s, runID, "input_received", &data)
+	if err != nil {
+		t.Fatalf("createEvent: %v", err)
+	}
+	if event.Seq != 2 {
+		t.Errorf("input_received seq = %d, want 2", event.Seq)
+	}
+	srv.output.write(runID, "stdout", "after")
+	srv.output.close(runID)
+
+	assertOutputEvents(t, outputEvents(t, s, runID), [][2]string{
+		{"stdout", "before"},
+		{"input_received", "answer"},
+		{"stdout", "after"},
+	})
+}
+
+func TestOutput_BroadcastsOneEvent(t *testing.T) {
+	srv, _, runID := setupOutputTest(t, OutputConfig{FlushInterval: time.Hour})
+
+	client := &Client{runID: runID, send: make(chan []byte, 8), logger: slog.Default()}
+	srv.hub.register <- client
+	testutil.WaitFor(t, time.Second, func() bool { return srv.hub.ClientCount(runID) == 1 })
+
+	srv.output.write(runID, "stdout", "one")
+	srv.output.write(runID, "stdout", "two")
+	srv.output.flush(runID)
+
+	var msg WSMessage
+	if err := json.Unmarshal(testutil.WaitForEvent(t, client.send, time.Second), &msg); err != nil {
+		t.Fatalf("decode broadcast: %v", err)
+	}
+	if msg.Type != "event" || msg.Event == nil || msg.Event.Type != "stdout" || msg.Event.Seq != 1 {
+		t.Errorf("broadcast = %+v, want stdout event seq 1", msg)
+	}
+	if extra := testutil.DrainChannel(client.send); len(extra) != 0 {
+		t.Errorf("got %d extra broadcasts, want 0", len(extra))
+	}
+}
@@ -0,0 +1,82 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/anthropics/m/internal/store"
+)
+
+// headerNextCursor carries the cursor of the next page of a list. It is
+// absent on the last page. List bodies stay plain JSON arrays.
+const headerNextCursor = "X-Next-Cursor"
+
+// parsePage reads the limit, cursor, sort and order query parameters. On
+// failure it writes a 400 and returns false.
+func parsePage(w http.ResponseWriter, q url.Values) (store.Page, bool) {
+	page := store.Page{
+		Cursor: q.Get("cursor"),
+		Sort:   q.Get("sort"),
+		Order:  q.Get("order"),
+	}
+	if v := q.Get("limit"); v != "" {
+		limit, err := strconv.Atoi(v)
+		if err != nil || limit <= 0 || limit > store.MaxPageLimit {
+			writeError(w, http.StatusBadRequest, "invalid_input",
+				"limit must be an integer between 1 and "+strconv.Itoa(store.MaxPageLimit))
+			return page, false
+		}
+		page.Limit = limit
+	}
+	return page, true
+}
+
+// parseUnixParam reads an optional Unix timestamp query parameter into dst.
+// On failure it writes a 400 and returns false.
+func parseUnixParam(w http.ResponseWriter, q url.Values, name string, dst *time.Time) bool {
+	v := q.Get(name)
+	if v == "" {
+		return true
+	}
+	sec, err := strconv.ParseInt(v, 10, 64)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid_input", name+" must be a Unix timestamp")
+		return false
+	}
+	*dst = time.Unix(sec, 0)
+	return true
+}
+
+// splitList splits a comma-separated query parameter, dropping empty items.
+func splitList(v string) []string {
+	var items []string
+	for _, item := range strings.Split(v, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// writeListError writes the response for an error from a paginated store
+// list, reporting bad sort and cursor parameters as 400s.
+func writeListError(w http.ResponseWriter, r *http.Request, op string, err error) {
+	if errors.Is(err, store.ErrInvalidSort) || errors.Is(err, store.ErrInvalidCursor) {
+		writeError(w, http.StatusBadRequest, "invalid_input", err.Error())
+		return
+	}
+	loggerFrom(r.Context()).Error(op, "err", err)
+	writeError(w, http.StatusInternalServerError, "internal_error", "failed to "+strings.ReplaceAll(op, "-", " "))
+}
+
+// writePage writes one page of a list, with the next page's cursor if any.
+func writePage(w http.ResponseWriter, items any, next string) {
+	if next != "" {
+		w.Header().Set(headerNextCursor, next)
+	}
+	writeJSON(w, http.StatusOK, items)
+}
@@ -0,0 +1,160 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/anthropics/m/internal/store"
+)
+
+func TestListRepos_Pagination(t *testing.T) {
+	srv, cleanup := setupTestServer(t)
+	defer cleanup()
+
+	for _, name := range []string{"charlie", "alpha", "bravo"} {
+		srv.store.CreateRepo(name, nil)
+	}
+
+	var names []string
+	path := "/api/repos?sort=name&limit=2"
+	for pages := 0; ; pages++ {
+		if pages > 2 {
+			t.Fatal("too many pages")
+		}
+		w := doRequest(srv, "GET", path, nil, "Bearer test-key")
+		if w.Code != http.StatusOK {
+			t.Fatalf("got status %d: %s", w.Code, w.Body.String())
+		}
+		var repos []repoResponse
+		if err := json.NewDecoder(w.Body).Decode(&repos); err != nil {
+			t.Fatalf("decode: %v", err)
+		}
+		for _, r := range repos {
+			names = append(names, r.Name)
+		}
+		next := w.Header().Get(headerNextCursor)
+		if next == "" {
+			break
+		}
+		path = "/api/repos?sort=name&limit=2&cursor=" + next
+	}
+
+	if len(names) != 3 || names[0] != "alpha" || names[1] != "bravo" || names[2] != "charlie" {
+		t.Errorf("names = %v, want [alpha bravo charlie]", names)
+	}
+}
+
+func TestListRuns_Filters(t *testing.T) {
+	srv, cleanup := setupTestServer(t)
+	defer cleanup()
+
+	repo, _ := srv.store.CreateRepo("test-repo", nil)
+	for _, prompt := range []string{"fix the bug", "write docs", "fix the tests"} {
+		run, _ := srv.store.CreateRun(repo.ID, prompt, "/tmp")
+		srv.store.UpdateRunState(run.ID, store.RunStateCompleted)
+	}
+	active, _ := srv.store.CreateRun(repo.ID, "fix more", "/tmp")
+
+	tests := []struct {
+		query string
+		want  int
+	}{
+		{"", 4},
+		{"?prompt=FIX", 3},
+		{"?state=running", 1},
+		{"?state=completed,failed&prompt=fix", 2},
+		{"?created_after=0&created_before=1", 0},
+	}
+	for _, tt := range tests {
+		w := doRequest(srv, "GET", "/api/repos/"+repo.ID+"/runs"+tt.query, nil, "Bearer test-key")
+		if w.Code != http.StatusOK {
+			t.Fatalf("%q: got status %d: %s", tt.query, w.Code, w.Body.String())
+		}
+		var runs []runResponse
+		json.NewDecoder(w.Body).Decode(&runs)
+		if len(runs) != tt.want {
+			t.Errorf("%q: got %d runs, want %d", tt.query, len(runs), tt.want)
+		}
+		if tt.query == "?state=running" && len(runs) == 1 && runs[0].ID != active.ID {
+			t.Errorf("state=running returned %s, want %s", runs[0].ID, active.ID)
+		}
+	}
+}
+
+func TestListRuns_InvalidParams(t *testing.T) {
+	srv, cleanup := setupTestServer(t)
+	defer cleanup()
+
+	repo, _ := srv.store.CreateRepo("test-repo", nil)
+
+	for _, query := range []string{
+		"?state=bogus",
+		"?created_after=yesterday",
+		"?limit=0",
+		"?limit=100000",
+		"?sort=prompt",
+		"?order=up",
+		"?cursor=garbage",
+	} {
+		w := doRequest(srv, "GET", "/api/repos/"+repo.ID+"/runs"+query, nil, "Bearer test-key")
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("%q: got status %d, want 400", query, w.Code)
+		}
+	}
+}
+
+func TestListApprovals_TypeFilter(t *testing.T) {
+	srv, cleanup := setupTestServer(t)
+	defer cleanup()
+
+	repo, _ := srv.store.CreateRepo("test-repo", nil)
+	run, _ := srv.store.CreateRun(repo.ID, "prompt", "/tmp")
+	srv.store.CreateInteraction("req-1", run.ID, store.InteractionTypeApproval, "Bash", nil)
+	srv.store.CreateInteraction("req-2", run.ID, store.InteractionTypeApproval, "Edit", nil)
+	input, _ := srv.store.CreateInteraction("req-3", run.ID, store.InteractionTypeInput, "AskUserQuestion", nil)
+
+	w := doRequest(srv, "GET", "/api/approvals?type=input", nil, "Bearer test-key")
+	if w.Code != http.StatusOK {
+		t.Fatalf("got status %d: %s", w.Code, w.Body.String())
+	}
+	var resp []interactionListResponse
+	json.NewDecoder(w.Body).Decode(&resp)
+	if len(resp) != 1 || resp[0].ID != input.ID {
+		t.Errorf("got %+v, want only %s", resp, input.ID)
+	}
+
+	w = doRequest(srv, "GET", "/api/approvals?type=approval&limit=1", nil, "Bearer test-key")
+	json.NewDecoder(w.Body).Decode(&resp)
+	if len(resp) != 1 || w.Header().Get(headerNextCursor) == "" {
+		t.Errorf("got %d approvals with cursor %q, want 1 and a cursor", len(resp), w.Header().Get(headerNextCursor))
+	}
+}
+
+func TestListEvents(t *testing.T) {
+	srv, cleanup := setupTestServer(t)
+	defer cleanup()
+
+	repo, _ := srv.store.CreateRepo("test-repo", nil)
+	run, _ := srv.store.CreateRun(repo.ID, "prompt", "/tmp")
+	for _, typ := range []string{"stdout", "tool_use", "stderr", "stdout"} {
+		srv.store.CreateEvent(run.ID, typ, nil)
+	}
+
+	w := doRequest(srv, "GET", "/api/runs/"+run.ID+"/events?type=stdout,stderr", nil, "Bearer test-key")
+	if w.Code != http.StatusOK {
+		t.Fatalf("got status %d: %s", w.Code, w.Body.String())
+	}
+	var events []EventDTO
+	if err := json.NewDecoder(w.Body).Decode(&events); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if len(events) != 3 || events[0].Seq != 1 || events[1].Seq != 3 || events[2].Seq != 4 {
+		t.Errorf("got %+v, want seqs 1, 3, 4", events)
+	}
+
+	w = doRequest(srv, "GET", "/api/runs/nonexistent/events", nil, "Bearer test-key")
+	if w.Code != http.StatusNotFound {
+		t.Errorf("unknown run: got status %d, want 404", w.Code)
+	}
+}
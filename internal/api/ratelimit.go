@@ -0,0 +1,268 @@
+package api
+
+import (
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Route groups that can be given their own rate limit.
+const (
+	RouteGroupRead  = "read"  // GET and HEAD requests, including WebSocket upgrades
+	RouteGroupWrite = "write" // All other methods
+	RouteGroupHook  = "hook"  // /api/internal/*
+)
+
+// rateLimitSweepInterval is how often idle buckets and expired lockouts are
+// dropped from memory.
+const rateLimitSweepInterval = time.Minute
+
+// RateLimit is a token bucket: Burst requests at once, refilled at Rate
+// requests per second.
+type RateLimit struct {
+	Rate  float64
+	Burst int
+}
+
+// LockoutConfig controls the lockout after repeated authentication failures.
+// After Threshold consecutive failures from one IP, it is locked out for Base,
+// doubling with each further failure up to Max.
+type LockoutConfig struct {
+	Threshold int
+	Base      time.Duration
+	Max       time.Duration
+}
+
+// RateLimitConfig holds request rate limits and the brute-force lockout.
+type RateLimitConfig struct {
+	Enabled bool
+	Groups  map[string]RateLimit // Keyed by route group; groups without an entry are unlimited
+	Lockout LockoutConfig        // Threshold 0 disables the lockout
+}
+
+// RateLimiter enforces per-IP and per-token rate limits and locks out IPs that
+// repeatedly fail authentication. A nil RateLimiter allows everything.
+type RateLimiter struct {
+	cfg RateLimitConfig
+	now func() time.Time
+
+	mu        sync.Mutex
+	buckets   map[string]*tokenBucket
+	failures  map[string]*authFailures
+	lastSweep time.Time
+}
+
+type tokenBucket struct {
+	limit  RateLimit
+	tokens float64
+	last   time.Time
+}
+
+type authFailures struct {
+	count       int
+	last        time.Time
+	lockedUntil time.Time
+}
+
+// rateLimitResult describes a bucket after a request was counted against it.
+type rateLimitResult struct {
+	allowed    bool
+	limit      int
+	remaining  int
+	reset      time.Duration // Until the bucket is full again
+	retryAfter time.Duration // Until the next request is allowed, if denied
+}
+
+// NewRateLimiter returns a limiter for cfg, or nil if rate limiting is
+// disabled.
+func NewRateLimiter(cfg RateLimitConfig) *RateLimiter {
+	if !cfg.Enabled {
+		return nil
+	}
+	return &RateLimiter{
+		cfg:      cfg,
+		now:      time.Now,
+		buckets:  make(map[string]*tokenBucket),
+		failures: make(map[string]*authFailures),
+	}
+}
+
+// check counts a request against the bucket for key in the request's route
+// group and sets the RateLimit-* headers. If the bucket is empty it writes a
+// 429 with Retry-After and returns false.
+func (l *RateLimiter) check(w http.ResponseWriter, r *http.Request, key string) bool {
+	if l == nil {
+		return true
+	}
+	group := routeGroup(r)
+	limit, ok := l.cfg.Groups[group]
+	if !ok || limit.Rate <= 0 || limit.Burst <= 0 {
+		return true
+	}
+
+	res := l.take(group+":"+key, limit)
+	h := w.Header()
+	h.Set("RateLimit-Limit", strconv.Itoa(res.limit))
+	h.Set("RateLimit-Remaining", strconv.Itoa(res.remaining))
+	h.Set("RateLimit-Reset", strconv.Itoa(ceilSeconds(res.reset)))
+	if !res.allowed {
+		writeRateLimited(w, res.retryAfter, "rate limit exceeded")
+		return false
+	}
+	return true
+}
+
+// take removes a token from the bucket, creating it full if needed.
+func (l *RateLimiter) take(key string, limit RateLimit) rateLimitResult {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	l.sweep(now)
+
+	b, ok := l.buckets[key]
+	if !ok || b.limit != limit {
+		b = &tokenBucket{limit: limit, tokens: float64(limit.Burst), last: now}
+		l.buckets[key] = b
+	}
+	b.tokens = math.Min(float64(limit.Burst), b.tokens+now.Sub(b.last).Seconds()*limit.Rate)
+	b.last = now
+
+	res := rateLimitResult{limit: limit.Burst}
+	if b.tokens >= 1 {
+		b.tokens--
+		res.allowed = true
+	} else {
+		res.retryAfter = secondsDuration((1 - b.tokens) / limit.Rate)
+	}
+	res.remaining = int(b.tokens)
+	res.reset = secondsDuration((float64(limit.Burst) - b.tokens) / limit.Rate)
+	return res
+}
+
+// lockedOut returns how long the IP remains locked out, if it is.
+func (l *RateLimiter) lockedOut(ip string) (time.Duration, bool) {
+	if l == nil || ip == "" || l.cfg.Lockout.Threshold <= 0 {
+		return 0, false
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	f, ok := l.failures[ip]
+	if !ok {
+		return 0, false
+	}
+	if wait := f.lockedUntil.Sub(l.now()); wait > 0 {
+		return wait, true
+	}
+	return 0, false
+}
+
+// recordFailure counts a failed authentication from the IP, locking it out
+// once the threshold is reached. The count is forgotten after Max without
+// failures.
+func (l *RateLimiter) recordFailure(ip string) {
+	if l == nil || ip == "" || l.cfg.Lockout.Threshold <= 0 {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	f, ok := l.failures[ip]
+	if !ok || now.Sub(f.last) > l.cfg.Lockout.Max {
+		f = &authFailures{}
+		l.failures[ip] = f
+	}
+	f.count++
+	f.last = now
+
+	if f.count >= l.cfg.Lockout.Threshold {
+		f.lockedUntil = now.Add(lockoutDuration(l.cfg.Lockout, f.count-l.cfg.Lockout.Threshold))
+	}
+}
+
+// recordSuccess clears the failure count of the IP.
+func (l *RateLimiter) recordSuccess(ip string) {
+	if l == nil || ip == "" {
+		return
+	}
+	l.mu.Lock()
+	delete(l.failures, ip)
+	l.mu.Unlock()
+}
+
+// sweep drops full buckets and forgotten failure counts. Callers hold l.mu.
+func (l *RateLimiter) sweep(now time.Time) {
+	if now.Sub(l.lastSweep) < rateLimitSweepInterval {
+		return
+	}
+	l.lastSweep = now
+
+	for key, b := range l.buckets {
+		if b.tokens+now.Sub(b.last).Seconds()*b.limit.Rate >= float64(b.limit.Burst) {
+			delete(l.buckets, key)
+		}
+	}
+	for ip, f := range l.failures {
+		if now.After(f.lockedUntil) && now.Sub(f.last) > l.cfg.Lockout.Max {
+			delete(l.failures, ip)
+		}
+	}
+}
+
+// lockoutDuration returns Base doubled n times, capped at Max.
+func lockoutDuration(cfg LockoutConfig, n int) time.Duration {
+	d := cfg.Base
+	for i := 0; i < n && d < cfg.Max; i++ {
+		d *= 2
+	}
+	if cfg.Max > 0 && d > cfg.Max {
+		d = cfg.Max
+	}
+	return d
+}
+
+// routeGroup returns the rate limit group of a request.
+func routeGroup(r *http.Request) string {
+	switch {
+	case strings.HasPrefix(r.URL.Path, "/api/internal/"):
+		return RouteGroupHook
+	case r.Method == http.MethodGet || r.Method == http.MethodHead:
+		return RouteGroupRead
+	default:
+		return RouteGroupWrite
+	}
+}
+
+// clientIP returns the IP of the direct peer, or "" for connections without
+// one such as the hook's Unix socket. Forwarding headers are not trusted.
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return ""
+	}
+	return host
+}
+
+// writeRateLimited writes a 429 telling the client when to retry.
+func writeRateLimited(w http.ResponseWriter, retryAfter time.Duration, message string) {
+	w.Header().Set("Retry-After", strconv.Itoa(ceilSeconds(retryAfter)))
+	writeError(w, http.StatusTooManyRequests, "rate_limited", message)
+}
+
+func secondsDuration(s float64) time.Duration {
+	return time.Duration(s * float64(time.Second))
+}
+
+// ceilSeconds rounds up to whole seconds, with a minimum of 1 for any wait.
+func ceilSeconds(d time.Duration) int {
+	if d <= 0 {
+		return 0
+	}
+	return int(math.Ceil(d.Seconds()))
+}
@@ -0,0 +1,171 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/anthropics/m/internal/store"
+)
+
+// setupRateLimitedServer returns a server with the given limits and a clock
+// the test can advance.
+func setupRateLimitedServer(t *testing.T, cfg RateLimitConfig) (*Server, *time.Time) {
+	t.Helper()
+	s, err := store.New(t.TempDir() + "/test.db")
+	if err != nil {
+		t.Fatalf("failed to create store: %v", err)
+	}
+	t.Cleanup(func() { s.Close() })
+
+	cfg.Enabled = true
+	srv := New(Config{Port: 8080, APIKey: "test-key", RateLimit: cfg}, s)
+	now := time.Unix(1700000000, 0)
+	srv.limiter.now = func() time.Time { return now }
+	return srv, &now
+}
+
+func doRequestFrom(srv *Server, method, path, remoteAddr, auth string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, nil)
+	req.RemoteAddr = remoteAddr
+	if auth != "" {
+		req.Header.Set("Authorization", auth)
+	}
+	w := httptest.NewRecorder()
+	srv.httpServer.Handler.ServeHTTP(w, req)
+	return w
+}
+
+func TestRateLimit_TokenBucket(t *testing.T) {
+	srv, now := setupRateLimitedServer(t, RateLimitConfig{
+		Groups: map[string]RateLimit{
+			RouteGroupRead:  {Rate: 1, Burst: 2},
+			RouteGroupWrite: {Rate: 1, Burst: 1},
+		},
+	})
+
+	for i, wantRemaining := range []string{"1", "0"} {
+		w := doRequestFrom(srv, "GET", "/api/repos", "192.0.2.1:1234", "Bearer test-key")
+		if w.Code != http.StatusOK {
+			t.Fatalf("request %d: got status %d, want %d", i, w.Code, http.StatusOK)
+		}
+		if got := w.Header().Get("RateLimit-Limit"); got != "2" {
+			t.Errorf("RateLimit-Limit = %q, want 2", got)
+		}
+		if got := w.Header().Get("RateLimit-Remaining"); got != wantRemaining {
+			t.Errorf("RateLimit-Remaining = %q, want %s", got, wantRemaining)
+		}
+	}
+
+	w := doRequestFrom(srv, "GET", "/api/repos", "192.0.2.1:1234", "Bearer test-key")
+	if w.Code != http.StatusTooManyRequests {
+		t.Fatalf("got status %d, want %d", w.Code, http.StatusTooManyRequests)
+	}
+	if got := w.Header().Get("Retry-After"); got != "1" {
+		t.Errorf("Retry-After = %q, want 1", got)
+	}
+	if got := w.Header().Get("RateLimit-Reset"); got != "2" {
+		t.Errorf("RateLimit-Reset = %q, want 2", got)
+	}
+
+	// Groups have separate buckets
+	if w := doRequestFrom(srv, "POST", "/api/repos", "192.0.2.1:1234", "Bearer test-key"); w.Code == http.StatusTooManyRequests {
+		t.Error("write request limited by read bucket")
+	}
+
+	// Health checks are never limited
+	if w := doRequestFrom(srv, "GET", "/health", "192.0.2.1:1234", ""); w.Code != http.StatusOK {
+		t.Errorf("health: got status %d, want %d", w.Code, http.StatusOK)
+	}
+
+	// The bucket refills over time
+	*now = now.Add(time.Second)
+	if w := doRequestFrom(srv, "GET", "/api/repos", "192.0.2.1:1234", "Bearer test-key"); w.Code != http.StatusOK {
+		t.Errorf("after refill: got status %d, want %d", w.Code, http.StatusOK)
+	}
+}
+
+func TestRateLimit_PerToken(t *testing.T) {
+	srv, _ := setupRateLimitedServer(t, RateLimitConfig{
+		Groups: map[string]RateLimit{RouteGroupRead: {Rate: 1, Burst: 2}},
+	})
+
+	// The same token is limited across IPs
+	doRequestFrom(srv, "GET", "/api/repos", "192.0.2.1:1234", "Bearer test-key")
+	doRequestFrom(srv, "GET", "/api/repos", "192.0.2.2:1234", "Bearer test-key")
+	if w := doRequestFrom(srv, "GET", "/api/repos", "192.0.2.3:1234", "Bearer test-key"); w.Code != http.StatusTooManyRequests {
+		t.Errorf("got status %d, want %d", w.Code, http.StatusTooManyRequests)
+	}
+
+	// A different token from a fresh IP is not
+	reader := "Bearer " + createTestToken(t, srv, "read")
+	if w := doRequestFrom(srv, "GET", "/api/repos", "192.0.2.4:1234", reader); w.Code != http.StatusOK {
+		t.Errorf("other token: got status %d, want %d", w.Code, http.StatusOK)
+	}
+}
+
+func TestRateLimit_Lockout(t *testing.T) {
+	srv, now := setupRateLimitedServer(t, RateLimitConfig{
+		Lockout: LockoutConfig{Threshold: 3, Base: time.Second, Max: 4 * time.Second},
+	})
+	const ip = "192.0.2.1:1234"
+
+	for i := 0; i < 3; i++ {
+		if w := doRequestFrom(srv, "GET", "/api/repos", ip, "Bearer wrong"); w.Code != http.StatusUnauthorized {
+			t.Fatalf("attempt %d: got status %d, want %d", i, w.Code, http.StatusUnauthorized)
+		}
+	}
+
+	// Locked out, even with the right key
+	w := doRequestFrom(srv, "GET", "/api/repos", ip, "Bearer test-key")
+	if w.Code != http.StatusTooManyRequests {
+		t.Fatalf("locked out: got status %d, want %d", w.Code, http.StatusTooManyRequests)
+	}
+	if got := w.Header().Get("Retry-After"); got != "1" {
+		t.Errorf("Retry-After = %q, want 1", got)
+	}
+
+	// Other IPs are unaffected
+	if w := doRequestFrom(srv, "GET", "/api/repos", "192.0.2.2:1234", "Bearer test-key"); w.Code != http.StatusOK {
+		t.Errorf("other IP: got status %d, want %d", w.Code, http.StatusOK)
+	}
+
+	// Each further failure doubles the lockout, up to the maximum
+	wait := time.Second
+	for _, want := range []time.Duration{2 * time.Second, 4 * time.Second, 4 * time.Second} {
+		*now = now.Add(wait)
+		doRequestFrom(srv, "GET", "/api/repos", ip, "Bearer wrong")
+		w := doRequestFrom(srv, "GET", "/api/repos", ip, "Bearer test-key")
+		if got := w.Header().Get("Retry-After"); w.Code != http.StatusTooManyRequests || got != strconv.Itoa(int(want.Seconds())) {
+			t.Errorf("got status %d Retry-After %q, want %d %v", w.Code, got, http.StatusTooManyRequests, want)
+		}
+		wait = want
+	}
+
+	// A successful login after the lockout resets the count
+	*now = now.Add(wait)
+	if w := doRequestFrom(srv, "GET", "/api/repos", ip, "Bearer test-key"); w.Code != http.StatusOK {
+		t.Fatalf("after lockout: got status %d, want %d", w.Code, http.StatusOK)
+	}
+	if w := doRequestFrom(srv, "GET", "/api/repos", ip, "Bearer wrong"); w.Code != http.StatusUnauthorized {
+		t.Errorf("after reset: got status %d, want %d", w.Code, http.StatusUnauthorized)
+	}
+}
+
+func TestRateLimit_Disabled(t *testing.T) {
+	srv, cleanup := setupTestServer(t)
+	defer cleanup()
+
+	for i := 0; i < 20; i++ {
+		doRequestFrom(srv, "GET", "/api/repos", "192.0.2.1:1234", "Bearer wrong")
+	}
+	w := doRequestFrom(srv, "GET", "/api/repos", "192.0.2.1:1234", "Bearer test-key")
+	if w.Code != http.StatusOK {
+		t.Errorf("got status %d, want %d", w.Code, http.StatusOK)
+	}
+	if w.Header().Get("RateLimit-Limit") != "" {
+		t.Error("RateLimit headers set with rate limiting disabled")
+	}
+}
@@ -0,0 +1,39 @@
+package api
+
+import (
+	"log/slog"
+	"time"
+)
+
+// outputArchiveInterval is how often the server archives old run output.
+const outputArchiveInterval = time.Hour
+
+// runOutputArchiver archives the stdout and stderr events of runs that
+// finished more than outputRetention ago, on startup and then every
+// outputArchiveInterval until stop is closed.
+func (s *Server) runOutputArchiver(stop <-chan struct{}) {
+	ticker := time.NewTicker(outputArchiveInterval)
+	defer ticker.Stop()
+
+	for {
+		s.archiveOutput(time.Now())
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// archiveOutput archives the output of runs that finished before
+// now - outputRetention.
+func (s *Server) archiveOutput(now time.Time) {
+	res, err := s.store.ArchiveOutput(now.Add(-s.outputRetention))
+	if err != nil {
+		slog.Error("archive run output", "err", err, "runs", res.Runs, "events", res.Events)
+		return
+	}
+	if res.Runs > 0 {
+		slog.Info("archived run output", "runs", res.Runs, "events", res.Events)
+	}
+}
@@ -0,0 +1,52 @@
+package api
+
+import (
+	"testing"
+	"time"
+
+	"github.com/anthropics/m/internal/store"
+	"github.com/anthropics/m/internal/testutil"
+)
+
+func TestArchiveOutput(t *testing.T) {
+	s, err := store.New(t.TempDir() + "/test.db")
+	if err != nil {
+		t.Fatalf("failed to create store: %v", err)
+	}
+	defer s.Close()
+	srv := New(Config{Port: 8080, APIKey: "test-key", OutputRetention: 24 * time.Hour}, s)
+
+	repo := testutil.CreateTestRepo(t, s, "test-repo")
+	run := testutil.CreateTestRun(t, s, repo.ID, "prompt", "/workspace")
+	srv.output.write(run.ID, "stdout", "hello")
+	srv.output.createEvent(s, run.ID, "tool_call_start", nil)
+	srv.output.write(run.ID, "stderr", "oops")
+	srv.output.close(run.ID)
+	if err := s.UpdateRunState(run.ID, store.RunStateCompleted); err != nil {
+		t.Fatalf("UpdateRunState: %v", err)
+	}
+
+	countRows := func() int {
+		var n int
+		if err := s.DB().QueryRow("SELECT COUNT(*) FROM events WHERE run_id = ?", run.ID).Scan(&n); err != nil {
+			t.Fatalf("count events: %v", err)
+		}
+		return n
+	}
+
+	// The run finished less than a day ago.
+	srv.archiveOutput(time.Now())
+	if n := countRows(); n != 3 {
+		t.Fatalf("events rows = %d, want 3 before the retention period", n)
+	}
+
+	srv.archiveOutput(time.Now().Add(25 * time.Hour))
+	if n := countRows(); n != 1 {
+		t.Errorf("events rows = %d, want only the tool event", n)
+	}
+	assertOutputEvents(t, outputEvents(t, s, run.ID), [][2]string{
+		{"stdout", "hello"},
+		{"tool_call_start", ""},
+		{"stderr", "oops"},
+	})
+}
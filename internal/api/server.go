@@ -5,39 +5,72 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
-	"log"
+	"log/slog"
 	"net/http"
 	"os"
 	"os/signal"
 	"syscall"
 	"time"
 
+	"github.com/anthropics/m/internal/metrics"
 	"github.com/anthropics/m/internal/run"
 	"github.com/anthropics/m/internal/store"
+	"github.com/anthropics/m/internal/tracing"
+	"github.com/gorilla/websocket"
 )
 
 // Server is the HTTP server for M.
 type Server struct {
 	httpServer          *http.Server
-	store               *store.Store
+	store               store.Backend
 	apiKey              string
 	hub                 *Hub
+	output              *outputIngester
 	workspace           *run.WorkspaceManager
 	interactionNotifier *InteractionNotifier
 	demoMode            bool
+	tlsConfig           TLSConfig
+	socketServer        *http.Server // Unix socket listener serving /api/internal/*
+	socketPath          string
+	limiter             *RateLimiter
+	tickets             *TicketStore
+	allowedOrigins      []string
+	upgrader            websocket.Upgrader
+	metrics             *metrics.Registry
+	diskUsage           diskUsageCache
+	runs                *tracing.Runs // Root span of each run's trace
+	claudeBinary        string        // Checked by the readiness probe
+	minFreeBytes        uint64        // Workspace free space below which the server is not ready
+	claudeCheck         claudeCheckCache
+	outputRetention     time.Duration
+	backup              BackupConfig
+	agent               AgentConfig
+	runConfigs          runConfigs // Configuration each supervised run started with
 }
 
 // Config holds server configuration.
 type Config struct {
-	Port           int
-	APIKey         string
-	WorkspacesPath string
-	DemoMode       bool
+	Port            int
+	APIKey          string
+	WorkspacesPath  string
+	DemoMode        bool
+	TLS             TLSConfig
+	SocketPath      string // Unix socket for the hook endpoint; empty disables it
+	RateLimit       RateLimitConfig
+	AllowedOrigins  []string // Extra origins allowed to open WebSockets; "*" allows any
+	ClaudeBinary    string   // Claude CLI checked by /health/ready; empty skips the check
+	MinFreeBytes    uint64   // Minimum free workspace space for /health/ready
+	Output          OutputConfig
+	OutputRetention time.Duration // Age after which finished runs' output is archived; 0 disables
+	Backup          BackupConfig
+	Agent           AgentConfig // Defaults for runs, overridden by repo settings
 }
 
 // New creates a new Server.
-func New(cfg Config, s *store.Store) *Server {
+func New(cfg Config, s store.Backend) *Server {
+	runs := tracing.NewRuns()
 	hub := NewHub()
+	hub.runs = runs
 	go hub.Run()
 
 	// Default workspaces path if not configured
@@ -50,65 +83,135 @@ func New(cfg Config, s *store.Store) *Server {
 		store:               s,
 		apiKey:              cfg.APIKey,
 		hub:                 hub,
+		output:              newOutputIngester(cfg.Output, s, hub),
 		workspace:           run.NewWorkspaceManager(workspacesPath),
 		interactionNotifier: NewInteractionNotifier(),
 		demoMode:            cfg.DemoMode,
+		tlsConfig:           cfg.TLS,
+		socketPath:          cfg.SocketPath,
+		limiter:             NewRateLimiter(cfg.RateLimit),
+		tickets:             NewTicketStore(),
+		allowedOrigins:      cfg.AllowedOrigins,
+		runs:                runs,
+		claudeBinary:        cfg.ClaudeBinary,
+		minFreeBytes:        cfg.MinFreeBytes,
+		outputRetention:     cfg.OutputRetention,
+		backup:              cfg.Backup,
+		agent:               cfg.Agent,
+	}
+	srv.metrics = srv.newMetricsRegistry()
+	srv.upgrader = websocket.Upgrader{
+		ReadBufferSize:  1024,
+		WriteBufferSize: 1024,
+		CheckOrigin:     srv.checkOrigin,
 	}
 
 	mux := http.NewServeMux()
 	srv.registerRoutes(mux)
+	srv.httpServer = newHTTPServer(fmt.Sprintf(":%d", cfg.Port), srv.withMiddleware(mux))
 
-	// Build middleware chain: recovery -> logging -> auth -> routes
+	internalMux := http.NewServeMux()
+	srv.registerInternalRoutes(internalMux)
+	srv.socketServer = newHTTPServer(cfg.SocketPath, srv.withMiddleware(internalMux))
+
+	return srv
+}
+
+// withMiddleware wraps a mux in the middleware chain:
+// request ID -> recovery -> route -> tracing -> logging -> auth -> audit -> routes
+func (s *Server) withMiddleware(mux *http.ServeMux) http.Handler {
 	var handler http.Handler = mux
-	handler = AuthMiddleware(cfg.APIKey)(handler)
+	handler = AuditMiddleware(s.store)(handler)
+	handler = AuthMiddleware(s.apiKey, s.store, s.limiter, s.tickets)(handler)
 	handler = LoggingMiddleware(handler)
+	handler = TracingMiddleware(handler)
+	handler = withRoute(mux)(handler)
 	handler = RecoveryMiddleware(handler)
+	handler = RequestIDMiddleware(handler)
+	return handler
+}
 
-	srv.httpServer = &http.Server{
-		Addr:         fmt.Sprintf(":%d", cfg.Port),
+func newHTTPServer(addr string, handler http.Handler) *http.Server {
+	return &http.Server{
+		Addr:         addr,
 		Handler:      handler,
 		ReadTimeout:  15 * time.Second,
 		WriteTimeout: 6 * time.Minute, // Long-poll timeout + buffer
 		IdleTimeout:  60 * time.Second,
 	}
-
-	return srv
 }
 
 // registerRoutes sets up the HTTP routes.
 func (s *Server) registerRoutes(mux *http.ServeMux) {
-	// Health check (no auth required - registered before auth middleware applies)
-	mux.HandleFunc("GET /health", s.handleHealth)
+	// Health checks (no auth required - skipped by the auth middleware).
+	// /health is kept as an alias of /health/live.
+	mux.HandleFunc("GET /health", s.handleLive)
+	mux.HandleFunc("GET /health/live", s.handleLive)
+	mux.HandleFunc("GET /health/ready", s.handleReady)
+
+	// Metrics
+	mux.HandleFunc("GET /metrics", requireScope(store.ScopeRead, s.handleMetrics))
 
 	// Repos
-	mux.HandleFunc("GET /api/repos", s.handleListRepos)
-	mux.HandleFunc("POST /api/repos", s.handleCreateRepo)
-	mux.HandleFunc("GET /api/repos/{id}", s.handleGetRepo)
-	mux.HandleFunc("DELETE /api/repos/{id}", s.handleDeleteRepo)
+	mux.HandleFunc("GET /api/repos", requireScope(store.ScopeRead, s.handleListRepos))
+	mux.HandleFunc("POST /api/repos", requireScope(store.ScopeAdmin, s.handleCreateRepo))
+	mux.HandleFunc("GET /api/repos/{id}", requireScope(store.ScopeRead, s.handleGetRepo))
+	mux.HandleFunc("PATCH /api/repos/{id}", requireScope(store.ScopeSteer, s.handleUpdateRepo))
+	mux.HandleFunc("DELETE /api/repos/{id}", requireScope(store.ScopeAdmin, s.handleDeleteRepo))
+
+	// Repo members
+	mux.HandleFunc("GET /api/repos/{id}/members", requireScope(store.ScopeRead, s.handleListMembers))
+	mux.HandleFunc("PUT /api/repos/{id}/members/{user_id}", requireScope(store.ScopeSteer, s.handleSetMember))
+	mux.HandleFunc("DELETE /api/repos/{id}/members/{user_id}", requireScope(store.ScopeSteer, s.handleRemoveMember))
 
 	// Runs
-	mux.HandleFunc("GET /api/repos/{repo_id}/runs", s.handleListRuns)
-	mux.HandleFunc("POST /api/repos/{repo_id}/runs", s.handleCreateRun)
-	mux.HandleFunc("GET /api/runs/{id}", s.handleGetRun)
-	mux.HandleFunc("POST /api/runs/{id}/cancel", s.handleCancelRun)
-	mux.HandleFunc("POST /api/runs/{id}/input", s.handleSendInput)
+	mux.HandleFunc("GET /api/repos/{repo_id}/runs", requireScope(store.ScopeRead, s.handleListRuns))
+	mux.HandleFunc("POST /api/repos/{repo_id}/runs", requireScope(store.ScopeSteer, s.handleCreateRun))
+	mux.HandleFunc("GET /api/runs", requireScope(store.ScopeRead, s.handleListAllRuns))
+	mux.HandleFunc("POST /api/runs/import", requireScope(store.ScopeSteer, s.handleImportRun))
+	mux.HandleFunc("GET /api/runs/{id}", requireScope(store.ScopeRead, s.handleGetRun))
+	mux.HandleFunc("POST /api/runs/{id}/cancel", requireScope(store.ScopeSteer, s.handleCancelRun))
+	mux.HandleFunc("POST /api/runs/{id}/input", requireScope(store.ScopeSteer, s.handleSendInput))
+	mux.HandleFunc("GET /api/runs/{id}/export", requireScope(store.ScopeRead, s.handleExportRun))
+
+	// Summary
+	mux.HandleFunc("GET /api/summary", requireScope(store.ScopeRead, s.handleSummary))
+
+	// Search
+	mux.HandleFunc("GET /api/search", requireScope(store.ScopeRead, s.handleSearch))
 
 	// Approvals
-	mux.HandleFunc("GET /api/approvals", s.handleListApprovals)
-	mux.HandleFunc("POST /api/approvals", s.handleCreateApproval)
-	mux.HandleFunc("GET /api/approvals/pending", s.handleListPendingApprovals)
-	mux.HandleFunc("GET /api/approvals/{id}", s.handleGetApproval)
-	mux.HandleFunc("POST /api/approvals/{id}/resolve", s.handleResolveApproval)
+	mux.HandleFunc("GET /api/approvals", requireScope(store.ScopeRead, s.handleListApprovals))
+	mux.HandleFunc("POST /api/approvals", requireScope(store.ScopeSteer, s.handleCreateApproval))
+	mux.HandleFunc("POST /api/approvals/resolve", requireScope(store.ScopeApprove, s.handleBulkResolveApprovals))
+	mux.HandleFunc("GET /api/approvals/pending", requireScope(store.ScopeRead, s.handleListPendingApprovals))
+	mux.HandleFunc("GET /api/approvals/{id}", requireScope(store.ScopeRead, s.handleGetApproval))
+	mux.HandleFunc("POST /api/approvals/{id}/resolve", requireScope(store.ScopeApprove, s.handleResolveApproval))
 
 	// Devices
-	mux.HandleFunc("POST /api/devices", s.handleRegisterDevice)
-	mux.HandleFunc("DELETE /api/devices/{token}", s.handleUnregisterDevice)
+	mux.HandleFunc("POST /api/devices", requireScope(store.ScopeRead, s.handleRegisterDevice))
+	mux.HandleFunc("DELETE /api/devices/{token}", requireScope(store.ScopeRead, s.handleUnregisterDevice))
 
-	// Internal (hook)
-	mux.HandleFunc("POST /api/internal/interaction-request", s.handleInteractionRequest)
+	// Users and tokens
+	mux.HandleFunc("GET /api/users", requireScope(store.ScopeAdmin, s.handleListUsers))
+	mux.HandleFunc("POST /api/users", requireScope(store.ScopeAdmin, s.handleCreateUser))
+	mux.HandleFunc("DELETE /api/users/{id}", requireScope(store.ScopeAdmin, s.handleDeleteUser))
+	mux.HandleFunc("GET /api/tokens", requireScope(store.ScopeAdmin, s.handleListTokens))
+	mux.HandleFunc("POST /api/tokens", requireScope(store.ScopeAdmin, s.handleCreateToken))
+	mux.HandleFunc("DELETE /api/tokens/{id}", requireScope(store.ScopeAdmin, s.handleRevokeToken))
+
+	// Audit
+	mux.HandleFunc("GET /api/audit", requireScope(store.ScopeAdmin, s.handleListAudit))
 
 	// WebSocket
-	mux.HandleFunc("GET /api/runs/{id}/events", s.handleEventsWS)
+	mux.HandleFunc("POST /api/ws-tickets", requireScope(store.ScopeRead, s.handleCreateTicket))
+	mux.HandleFunc("GET /api/runs/{id}/events", requireScope(store.ScopeRead, s.handleEventsWS))
+}
+
+// registerInternalRoutes sets up the hook routes. They are served only on the
+// Unix socket, never on the network listener.
+func (s *Server) registerInternalRoutes(mux *http.ServeMux) {
+	mux.HandleFunc("POST /api/internal/interaction-request", requireScope(store.ScopeHook, s.handleInteractionRequest))
 }
 
 // Hub returns the WebSocket hub for broadcasting events.
@@ -116,28 +219,91 @@ func (s *Server) Hub() *Hub {
 	return s.hub
 }
 
+// SocketPath returns the Unix socket hooks use to reach the server
+// (M_SERVER_SOCKET).
+func (s *Server) SocketPath() string {
+	return s.socketPath
+}
+
 // Run starts the server and blocks until shutdown.
 func (s *Server) Run() error {
 	// Channel for shutdown signals
 	shutdown := make(chan os.Signal, 1)
 	signal.Notify(shutdown, syscall.SIGINT, syscall.SIGTERM)
 
+	// Channel for certificate reload signals
+	reload := make(chan os.Signal, 1)
+
 	// Channel for server errors
-	serverErr := make(chan error, 1)
+	serverErr := make(chan error, 2)
+
+	var reloader *tlsReloader
+	if s.tlsConfig.Enabled {
+		var err error
+		reloader, err = newTLSReloader(s.tlsConfig)
+		if err != nil {
+			return err
+		}
+		s.httpServer.TLSConfig = reloader.TLSConfig()
+		slog.Info("tls certificate loaded", "fingerprint_sha256", reloader.Fingerprint())
+		signal.Notify(reload, syscall.SIGHUP)
+	}
+
+	if s.socketPath != "" {
+		ln, err := listenUnix(s.socketPath)
+		if err != nil {
+			return err
+		}
+		defer os.Remove(s.socketPath)
+
+		go func() {
+			slog.Info("starting hook listener", "socket", s.socketPath)
+			if err := s.socketServer.Serve(ln); err != nil && err != http.ErrServerClosed {
+				serverErr <- err
+			}
+		}()
+	} else {
+		slog.Warn("socket_path not configured, hooks cannot reach the server")
+	}
 
 	go func() {
-		log.Printf("starting server on %s", s.httpServer.Addr)
-		if err := s.httpServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+		var err error
+		if reloader != nil {
+			slog.Info("starting server", "addr", s.httpServer.Addr, "tls", true)
+			err = s.httpServer.ListenAndServeTLS("", "")
+		} else {
+			slog.Info("starting server", "addr", s.httpServer.Addr, "tls", false)
+			err = s.httpServer.ListenAndServe()
+		}
+		if err != nil && err != http.ErrServerClosed {
 			serverErr <- err
 		}
 	}()
 
-	// Wait for shutdown signal or server error
-	select {
-	case err := <-serverErr:
-		return fmt.Errorf("server error: %w", err)
-	case sig := <-shutdown:
-		log.Printf("received signal %v, shutting down", sig)
+	stopMaintenance := make(chan struct{})
+	defer close(stopMaintenance)
+	if s.outputRetention > 0 {
+		go s.runOutputArchiver(stopMaintenance)
+	}
+	if s.backup.Dir != "" && s.backup.Interval > 0 {
+		go s.runBackups(stopMaintenance)
+	}
+
+	// Wait for shutdown signal or server error, reloading certificates on SIGHUP
+	for done := false; !done; {
+		select {
+		case err := <-serverErr:
+			return fmt.Errorf("server error: %w", err)
+		case <-reload:
+			if err := reloader.Reload(); err != nil {
+				slog.Error("tls reload failed, keeping previous certificate", "err", err)
+				continue
+			}
+			slog.Info("tls certificate reloaded", "fingerprint_sha256", reloader.Fingerprint())
+		case sig := <-shutdown:
+			slog.Info("shutting down", "signal", sig.String())
+			done = true
+		}
 	}
 
 	// Graceful shutdown with timeout
@@ -147,18 +313,15 @@ func (s *Server) Run() error {
 	if err := s.httpServer.Shutdown(ctx); err != nil {
 		return fmt.Errorf("shutdown error: %w", err)
 	}
+	if err := s.socketServer.Shutdown(ctx); err != nil {
+		return fmt.Errorf("shutdown error: %w", err)
+	}
+	s.output.closeAll()
 
-	log.Printf("server stopped gracefully")
+	slog.Info("server stopped gracefully")
 	return nil
 }
 
-// Placeholder handlers - to be implemented
-
-func (s *Server) handleHealth(w http.ResponseWriter, r *http.Request) {
-	w.Header().Set("Content-Type", "application/json")
-	w.Write([]byte(`{"status":"ok"}`))
-}
-
 // interactionListResponse represents an interaction in list responses.
 type interactionListResponse struct {
 	ID        string          `json:"id"`
@@ -183,24 +346,41 @@ func toInteractionListResponse(i *store.Interaction) interactionListResponse {
 	return resp
 }
 
-// handleListApprovals returns all interactions with optional filtering.
+// handleListApprovals returns one page of interactions, newest first by
+// default. Supports filtering by run_id, state and type, plus order, limit
+// and cursor.
 func (s *Server) handleListApprovals(w http.ResponseWriter, r *http.Request) {
-	runID := r.URL.Query().Get("run_id")
-	stateParam := r.URL.Query().Get("state")
+	q := r.URL.Query()
+	filter := store.InteractionFilter{
+		UserID: repoRestricted(r),
+		RunID:  q.Get("run_id"),
+	}
 
-	var state *store.InteractionState
-	if stateParam != "" {
-		s := store.InteractionState(stateParam)
-		if s != store.InteractionStatePending && s != store.InteractionStateResolved {
+	if v := q.Get("state"); v != "" {
+		state := store.InteractionState(v)
+		if state != store.InteractionStatePending && state != store.InteractionStateResolved {
 			writeError(w, http.StatusBadRequest, "invalid_input", "state must be 'pending' or 'resolved'")
 			return
 		}
-		state = &s
+		filter.State = &state
+	}
+	if v := q.Get("type"); v != "" {
+		t := store.InteractionType(v)
+		if t != store.InteractionTypeApproval && t != store.InteractionTypeInput {
+			writeError(w, http.StatusBadRequest, "invalid_input", "type must be 'approval' or 'input'")
+			return
+		}
+		filter.Type = &t
+	}
+
+	var ok bool
+	if filter.Page, ok = parsePage(w, q); !ok {
+		return
 	}
 
-	interactions, err := s.store.ListInteractions(runID, state)
+	interactions, next, err := s.storeFor(r).ListInteractionsPage(filter)
 	if err != nil {
-		writeError(w, http.StatusInternalServerError, "internal_error", "failed to list approvals")
+		writeListError(w, r, "list-approvals", err)
 		return
 	}
 
@@ -209,7 +389,7 @@ func (s *Server) handleListApprovals(w http.ResponseWriter, r *http.Request) {
 		resp[i] = toInteractionListResponse(interaction)
 	}
 
-	writeJSON(w, http.StatusOK, resp)
+	writePage(w, resp, next)
 }
 
 // createApprovalRequest is the request body for creating an approval.
@@ -249,7 +429,7 @@ func (s *Server) handleCreateApproval(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Verify run exists
-	_, err := s.store.GetRun(req.RunID)
+	run, err := s.storeFor(r).GetRun(req.RunID)
 	if errors.Is(err, store.ErrNotFound) {
 		writeError(w, http.StatusNotFound, "not_found", "run not found")
 		return
@@ -259,21 +439,33 @@ func (s *Server) handleCreateApproval(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if !s.authorizeRun(w, r, run, store.RepoRoleOperator) {
+		return
+	}
+
 	// Generate a unique request ID for this approval
 	requestID := fmt.Sprintf("api-%d", time.Now().UnixNano())
 
-	interaction, err := s.store.CreateInteraction(requestID, req.RunID, interactionType, req.Tool, req.Payload)
+	interaction, err := s.storeFor(r).CreateInteraction(requestID, req.RunID, interactionType, req.Tool, req.Payload)
 	if err != nil && !errors.Is(err, store.ErrDuplicateRequest) {
 		writeError(w, http.StatusInternalServerError, "internal_error", "failed to create approval")
 		return
 	}
 
+	audit(r, auditApprovalCreate, "interaction", interaction.ID, map[string]string{"run_id": req.RunID, "tool": req.Tool})
 	writeJSON(w, http.StatusCreated, toInteractionDetailResponse(interaction))
 }
 
-// handleListPendingApprovals returns all pending interactions (approvals and inputs).
+// handleListPendingApprovals returns all pending interactions (approvals and
+// inputs) on repos visible to the caller.
 func (s *Server) handleListPendingApprovals(w http.ResponseWriter, r *http.Request) {
-	interactions, err := s.store.ListPendingInteractions()
+	var interactions []*store.Interaction
+	var err error
+	if userID := repoRestricted(r); userID != "" {
+		interactions, err = s.storeFor(r).ListPendingInteractionsForUser(userID)
+	} else {
+		interactions, err = s.storeFor(r).ListPendingInteractions()
+	}
 	if err != nil {
 		writeError(w, http.StatusInternalServerError, "internal_error", "failed to list pending approvals")
 		return
@@ -289,16 +481,17 @@ func (s *Server) handleListPendingApprovals(w http.ResponseWriter, r *http.Reque
 
 // interactionDetailResponse represents an interaction with full details.
 type interactionDetailResponse struct {
-	ID        string          `json:"id"`
-	RunID     string          `json:"run_id"`
-	Type      string          `json:"type"`
-	Tool      string          `json:"tool"`
-	State     string          `json:"state"`
-	Payload   json.RawMessage `json:"payload,omitempty"`
-	Decision  *string         `json:"decision,omitempty"`
-	Message   *string         `json:"message,omitempty"`
-	Response  *string         `json:"response,omitempty"`
-	CreatedAt int64           `json:"created_at"`
+	ID           string          `json:"id"`
+	RunID        string          `json:"run_id"`
+	Type         string          `json:"type"`
+	Tool         string          `json:"tool"`
+	State        string          `json:"state"`
+	Payload      json.RawMessage `json:"payload,omitempty"`
+	Decision     *string         `json:"decision,omitempty"`
+	Message      *string         `json:"message,omitempty"`
+	Response     *string         `json:"response,omitempty"`
+	UpdatedInput json.RawMessage `json:"updated_input,omitempty"` // Modified tool input, if approved with changes
+	CreatedAt    int64           `json:"created_at"`
 }
 
 func toInteractionDetailResponse(i *store.Interaction) interactionDetailResponse {
@@ -316,6 +509,9 @@ func toInteractionDetailResponse(i *store.Interaction) interactionDetailResponse
 	if i.Payload != nil {
 		resp.Payload = json.RawMessage(*i.Payload)
 	}
+	if i.UpdatedInput != nil {
+		resp.UpdatedInput = json.RawMessage(*i.UpdatedInput)
+	}
 	return resp
 }
 
@@ -327,7 +523,7 @@ func (s *Server) handleGetApproval(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	interaction, err := s.store.GetInteraction(id)
+	interaction, err := s.storeFor(r).GetInteraction(id)
 	if errors.Is(err, store.ErrNotFound) {
 		writeError(w, http.StatusNotFound, "not_found", "approval not found")
 		return
@@ -337,14 +533,19 @@ func (s *Server) handleGetApproval(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if !s.authorizeInteraction(w, r, interaction, store.RepoRoleViewer) {
+		return
+	}
+
 	writeJSON(w, http.StatusOK, toInteractionDetailResponse(interaction))
 }
 
 // resolveApprovalRequest is the request body for resolving an approval.
 type resolveApprovalRequest struct {
-	Approved bool    `json:"approved"`
-	Reason   *string `json:"reason,omitempty"`
-	Response *string `json:"response,omitempty"` // For input type
+	Approved     bool            `json:"approved"`
+	Reason       *string         `json:"reason,omitempty"`
+	Response     *string         `json:"response,omitempty"`      // For input type
+	UpdatedInput json.RawMessage `json:"updated_input,omitempty"` // Replacement tool input when approving with modifications
 }
 
 // handleResolveApproval resolves a pending interaction.
@@ -362,7 +563,7 @@ func (s *Server) handleResolveApproval(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Get interaction to verify it exists and is pending
-	interaction, err := s.store.GetInteraction(id)
+	interaction, err := s.storeFor(r).GetInteraction(id)
 	if errors.Is(err, store.ErrNotFound) {
 		writeError(w, http.StatusNotFound, "not_found", "approval not found")
 		return
@@ -372,11 +573,35 @@ func (s *Server) handleResolveApproval(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if !s.authorizeInteraction(w, r, interaction, store.RepoRoleApprover) {
+		return
+	}
+
 	if interaction.State != store.InteractionStatePending {
 		writeError(w, http.StatusConflict, "invalid_state", "approval is not pending")
 		return
 	}
 
+	// Validate modified tool input, if any
+	var updatedInput *string
+	if len(req.UpdatedInput) > 0 && string(req.UpdatedInput) != "null" {
+		if interaction.Type != store.InteractionTypeApproval {
+			writeError(w, http.StatusBadRequest, "invalid_input", "updated_input is only valid for approvals")
+			return
+		}
+		if !req.Approved {
+			writeError(w, http.StatusBadRequest, "invalid_input", "updated_input requires approved to be true")
+			return
+		}
+		var obj map[string]any
+		if err := json.Unmarshal(req.UpdatedInput, &obj); err != nil {
+			writeError(w, http.StatusBadRequest, "invalid_input", "updated_input must be a JSON object")
+			return
+		}
+		u := string(req.UpdatedInput)
+		updatedInput = &u
+	}
+
 	// Determine decision
 	var decision store.InteractionDecision
 	if req.Approved {
@@ -386,13 +611,15 @@ func (s *Server) handleResolveApproval(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Resolve the interaction
-	if err := s.ResolveInteraction(id, decision, req.Reason, req.Response); err != nil {
+	if err := s.ResolveInteractionWithInput(id, decision, req.Reason, req.Response, updatedInput); err != nil {
 		writeError(w, http.StatusInternalServerError, "internal_error", "failed to resolve approval")
 		return
 	}
 
+	auditResolved(r, interaction, req.Approved, req.Reason, updatedInput != nil)
+
 	// Fetch updated interaction
-	interaction, err = s.store.GetInteraction(id)
+	interaction, err = s.storeFor(r).GetInteraction(id)
 	if err != nil {
 		writeError(w, http.StatusInternalServerError, "internal_error", "failed to get updated approval")
 		return
@@ -437,12 +664,13 @@ func (s *Server) handleRegisterDevice(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	device, err := s.store.CreateDevice(req.Token, store.Platform(req.Platform))
+	device, err := s.storeFor(r).CreateDevice(req.Token, store.Platform(req.Platform))
 	if err != nil {
 		writeError(w, http.StatusInternalServerError, "internal_error", "failed to register device")
 		return
 	}
 
+	audit(r, auditDeviceRegister, "device", auditDeviceID(device.Token), map[string]string{"platform": string(device.Platform)})
 	writeJSON(w, http.StatusCreated, deviceResponse{
 		Token:     device.Token,
 		Platform:  string(device.Platform),
@@ -457,7 +685,7 @@ func (s *Server) handleUnregisterDevice(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	err := s.store.DeleteDevice(token)
+	err := s.storeFor(r).DeleteDevice(token)
 	if errors.Is(err, store.ErrNotFound) {
 		writeError(w, http.StatusNotFound, "not_found", "device not found")
 		return
@@ -467,6 +695,7 @@ func (s *Server) handleUnregisterDevice(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
+	audit(r, auditDeviceUnregister, "device", auditDeviceID(token), nil)
 	w.WriteHeader(http.StatusNoContent)
 }
 
@@ -0,0 +1,197 @@
+package api
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/anthropics/m/internal/store"
+)
+
+// AgentConfig holds the server-wide agent settings that repo settings
+// override.
+type AgentConfig struct {
+	Type          string
+	ApprovalTools []string // Tools whose calls need approval; nil means every tool
+	InputTools    []string // Tools whose calls ask for user input; nil means every tool
+	Secrets       []string // Server environment variables repo settings may reference
+}
+
+// runConfig is the agent configuration of one run: the server's AgentConfig
+// with its repo's settings merged over it.
+type runConfig struct {
+	AgentType     string
+	ApprovalTools []string // nil means every tool
+	InputTools    []string // nil means every tool
+	SystemPrompt  string
+	Env           map[string]string
+	Secrets       map[string]string // Agent variable -> server environment variable
+	Allowed       []string          // Server environment variables Secrets may name
+	Timeout       time.Duration     // 0 means no limit
+	MaxCostUSD    float64           // 0 means no limit
+}
+
+// runConfigFor merges a repo's settings over the server's agent
+// configuration.
+func (s *Server) runConfigFor(repo *store.Repo) runConfig {
+	settings := repo.Settings
+	cfg := runConfig{
+		AgentType:     s.agent.Type,
+		ApprovalTools: s.agent.ApprovalTools,
+		InputTools:    s.agent.InputTools,
+		SystemPrompt:  settings.SystemPrompt,
+		Env:           settings.Env,
+		Secrets:       settings.Secrets,
+		Allowed:       s.agent.Secrets,
+		Timeout:       time.Duration(settings.Limits.TimeoutSeconds) * time.Second,
+		MaxCostUSD:    settings.Limits.MaxCostUSD,
+	}
+	if settings.AgentType != "" {
+		cfg.AgentType = settings.AgentType
+	}
+	if settings.ApprovalTools != nil {
+		cfg.ApprovalTools = settings.ApprovalTools
+	}
+	if settings.InputTools != nil {
+		cfg.InputTools = settings.InputTools
+	}
+	return cfg
+}
+
+// runConfigs holds the configuration each supervised run started with, so
+// that repo settings changed while a run is active apply from its next run.
+type runConfigs struct {
+	mu   sync.Mutex
+	runs map[string]runConfig
+}
+
+func (c *runConfigs) set(runID string, cfg runConfig) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.runs == nil {
+		c.runs = make(map[string]runConfig)
+	}
+	c.runs[runID] = cfg
+}
+
+func (c *runConfigs) get(runID string) (runConfig, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	cfg, ok := c.runs[runID]
+	return cfg, ok
+}
+
+func (c *runConfigs) remove(runID string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.runs, runID)
+}
+
+// runConfigOf returns the configuration run started with. A run without a
+// supervised agent gets its repo's current settings.
+func (s *Server) runConfigOf(st store.Backend, run *store.Run) (runConfig, error) {
+	if cfg, ok := s.runConfigs.get(run.ID); ok {
+		return cfg, nil
+	}
+	repo, err := st.GetRepo(run.RepoID)
+	if err != nil {
+		return runConfig{}, err
+	}
+	return s.runConfigFor(repo), nil
+}
+
+// interactive reports whether a hook request of the given type ("approval"
+// or "input") for tool must wait for the user. Tools left out of the run's
+// lists go ahead without asking.
+func (c runConfig) interactive(typ, tool string) bool {
+	tools := c.ApprovalTools
+	if typ == string(store.InteractionTypeInput) {
+		tools = c.InputTools
+	}
+	return tools == nil || slices.Contains(tools, tool)
+}
+
+// hookVars are the variables M sets for the agent's hook; repo settings may
+// not set them.
+var hookVars = []string{"M_API_KEY", "M_RUN_ID", "M_SERVER_SOCKET"}
+
+// environ returns the agent's environment variables as KEY=value pairs: the
+// hook variables in hook, then the run's variables, with secrets read from the
+// server's environment. A secret whose server variable is unset is an error,
+// so that a run never starts without its credentials, and so is one the
+// server no longer allows.
+func (c runConfig) environ(hook map[string]string) ([]string, error) {
+	env := make([]string, 0, len(hook)+len(c.Env)+len(c.Secrets))
+	for k, v := range hook {
+		env = append(env, k+"="+v)
+	}
+	for k, v := range c.Env {
+		if _, ok := hook[k]; ok {
+			continue
+		}
+		env = append(env, k+"="+v)
+	}
+	for k, ref := range c.Secrets {
+		if _, ok := hook[k]; ok {
+			continue
+		}
+		if !slices.Contains(c.Allowed, ref) {
+			return nil, fmt.Errorf("secret %s: server variable %s is not allowed", k, ref)
+		}
+		v, ok := os.LookupEnv(ref)
+		if !ok {
+			return nil, fmt.Errorf("secret %s: server variable %s is not set", k, ref)
+		}
+		env = append(env, k+"="+v)
+	}
+	slices.Sort(env)
+	return env, nil
+}
+
+// envName matches environment variable names.
+var envName = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// validateRepoSettings checks a settings document from a client, returning a
+// message for the first problem found. Secrets may only name the server
+// variables in allowed, so that repo owners cannot read the server's own
+// credentials.
+func validateRepoSettings(settings *store.RepoSettings, allowed []string) string {
+	if b := settings.DefaultBranch; b != "" && (strings.HasPrefix(b, "-") || strings.ContainsAny(b, " \t\n\\~^:?*[") || strings.Contains(b, "..")) {
+		return "default_branch is not a valid branch name"
+	}
+	for _, tools := range [][]string{settings.ApprovalTools, settings.InputTools} {
+		if slices.Contains(tools, "") {
+			return "tool names must not be empty"
+		}
+	}
+	for k := range settings.Env {
+		if !envName.MatchString(k) {
+			return fmt.Sprintf("env: invalid variable name %q", k)
+		}
+		if slices.Contains(hookVars, k) {
+			return fmt.Sprintf("env: %s is set by M", k)
+		}
+	}
+	for k, ref := range settings.Secrets {
+		if !envName.MatchString(k) {
+			return fmt.Sprintf("secrets: invalid variable name %q", k)
+		}
+		if slices.Contains(hookVars, k) {
+			return fmt.Sprintf("secrets: %s is set by M", k)
+		}
+		if !slices.Contains(allowed, ref) {
+			return fmt.Sprintf("secrets: %s names server variable %q, which is not in agent.secrets", k, ref)
+		}
+		if _, ok := settings.Env[k]; ok {
+			return fmt.Sprintf("%s is set in both env and secrets", k)
+		}
+	}
+	if settings.Limits.TimeoutSeconds < 0 || settings.Limits.MaxCostUSD < 0 {
+		return "limits must not be negative"
+	}
+	return ""
+}
@@ -0,0 +1,149 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/anthropics/m/internal/store"
+	"github.com/anthropics/m/internal/testutil"
+)
+
+func TestRunConfigFor(t *testing.T) {
+	srv := &Server{agent: AgentConfig{Type: "claude", ApprovalTools: []string{"Edit", "Bash"}, InputTools: []string{"AskUserQuestion"}}}
+
+	cfg := srv.runConfigFor(&store.Repo{})
+	if cfg.AgentType != "claude" || len(cfg.ApprovalTools) != 2 || cfg.Timeout != 0 {
+		t.Errorf("without settings = %+v, want the server's", cfg)
+	}
+
+	cfg = srv.runConfigFor(&store.Repo{Settings: store.RepoSettings{
+		AgentType:     "codex",
+		ApprovalTools: []string{},
+		Limits:        store.RepoLimits{TimeoutSeconds: 60, MaxCostUSD: 1},
+	}})
+	if cfg.AgentType != "codex" || cfg.Timeout != time.Minute || cfg.MaxCostUSD != 1 {
+		t.Errorf("with settings = %+v", cfg)
+	}
+	if cfg.interactive("approval", "Bash") {
+		t.Error("Bash needs approval after the repo emptied the list")
+	}
+	if !cfg.interactive("input", "AskUserQuestion") || cfg.interactive("input", "Bash") {
+		t.Error("input tools not inherited from the server")
+	}
+	if !(runConfig{}).interactive("approval", "Anything") {
+		t.Error("without tool lists every tool should need approval")
+	}
+}
+
+func TestRunConfig_Environ(t *testing.T) {
+	t.Setenv("M_TEST_NPM_TOKEN", "s3cret")
+	cfg := runConfig{
+		Env:     map[string]string{"CI": "1"},
+		Secrets: map[string]string{"NPM_TOKEN": "M_TEST_NPM_TOKEN"},
+		Allowed: []string{"M_TEST_NPM_TOKEN", "M_TEST_UNSET_TOKEN"},
+	}
+	env, err := cfg.environ(nil)
+	if err != nil {
+		t.Fatalf("environ: %v", err)
+	}
+	if want := []string{"CI=1", "NPM_TOKEN=s3cret"}; !reflect.DeepEqual(env, want) {
+		t.Errorf("environ = %v, want %v", env, want)
+	}
+
+	// The hook's variables come from the server, not the run's settings
+	cfg.Env["M_RUN_ID"] = "other"
+	env, err = cfg.environ(map[string]string{"M_RUN_ID": "run-1"})
+	if err != nil {
+		t.Fatalf("environ with hook variables: %v", err)
+	}
+	if want := []string{"CI=1", "M_RUN_ID=run-1", "NPM_TOKEN=s3cret"}; !reflect.DeepEqual(env, want) {
+		t.Errorf("environ with hook variables = %v, want %v", env, want)
+	}
+
+	cfg.Secrets["GITHUB_TOKEN"] = "M_TEST_UNSET_TOKEN"
+	if _, err := cfg.environ(nil); err == nil {
+		t.Error("environ with an unset secret succeeded")
+	}
+
+	// A reference saved before the server dropped it from its allowlist
+	t.Setenv("M_API_KEY", "admin")
+	cfg.Secrets = map[string]string{"KEY": "M_API_KEY"}
+	if _, err := cfg.environ(nil); err == nil || !strings.Contains(err.Error(), "not allowed") {
+		t.Errorf("environ with a disallowed secret: err = %v", err)
+	}
+}
+
+func TestInteractionRequest_RepoToolLists(t *testing.T) {
+	srv, cleanup := setupTestServer(t)
+	defer cleanup()
+
+	repo, _ := srv.store.CreateRepo("app", nil)
+	repo.Settings.ApprovalTools = []string{"Bash"}
+	if err := srv.store.UpdateRepo(repo); err != nil {
+		t.Fatalf("UpdateRepo: %v", err)
+	}
+	run, _ := srv.store.CreateRun(repo.ID, "prompt", "/workspace")
+
+	// A tool left out of the repo's list is allowed without asking.
+	body := map[string]any{"run_id": run.ID, "type": "approval", "tool": "Edit", "request_id": "req-1"}
+	w := doSocketRequest(srv, "POST", "/api/internal/interaction-request", body, "Bearer test-key")
+	if w.Code != http.StatusOK {
+		t.Fatalf("status %d: %s", w.Code, w.Body.String())
+	}
+	var resp interactionResponse
+	json.NewDecoder(w.Body).Decode(&resp)
+	if resp.Decision != "allow" {
+		t.Errorf("decision = %q, want allow", resp.Decision)
+	}
+	if interactions, _ := srv.store.ListInteractions(run.ID, nil); len(interactions) != 0 {
+		t.Errorf("created %d interactions, want none", len(interactions))
+	}
+}
+
+func TestInteractionRequest_RunStartConfig(t *testing.T) {
+	srv, cleanup := setupTestServer(t)
+	defer cleanup()
+
+	repo, _ := srv.store.CreateRepo("app", nil)
+	repo.Settings.ApprovalTools = []string{"Write"}
+	if err := srv.store.UpdateRepo(repo); err != nil {
+		t.Fatalf("UpdateRepo: %v", err)
+	}
+	run, _ := srv.store.CreateRun(repo.ID, "prompt", t.TempDir())
+
+	agent := testutil.NewMockAgent([]testutil.MockEvent{{Type: "stdout", Delay: 5 * time.Second, Data: "never\n"}})
+	done := make(chan struct{})
+	go func() {
+		srv.superviseAgent(run.ID, srv.runConfigFor(repo), agent)
+		close(done)
+	}()
+	defer func() {
+		agent.Cancel()
+		<-done
+	}()
+	for deadline := time.Now().Add(3 * time.Second); !agent.IsRunning(); time.Sleep(10 * time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatal("agent was not started")
+		}
+	}
+
+	// Settings changed during the run apply from the next run.
+	repo.Settings.ApprovalTools = []string{"Bash"}
+	if err := srv.store.UpdateRepo(repo); err != nil {
+		t.Fatalf("UpdateRepo: %v", err)
+	}
+	body := map[string]any{"run_id": run.ID, "type": "approval", "tool": "Bash", "request_id": "req-1"}
+	w := doSocketRequest(srv, "POST", "/api/internal/interaction-request", body, "Bearer test-key")
+	if w.Code != http.StatusOK {
+		t.Fatalf("status %d: %s", w.Code, w.Body.String())
+	}
+	var resp interactionResponse
+	json.NewDecoder(w.Body).Decode(&resp)
+	if resp.Decision != "allow" {
+		t.Errorf("decision = %q, want allow", resp.Decision)
+	}
+}
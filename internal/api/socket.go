@@ -0,0 +1,64 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+)
+
+// socketMode restricts the hook socket to the user running the server. Agents
+// are spawned as the same user, so nothing else needs to connect.
+const socketMode = 0600
+
+// listenUnix listens on a Unix socket at path, replacing a stale socket left
+// behind by a previous server and restricting who can connect. Closing the
+// listener leaves the socket in place for the caller to remove.
+func listenUnix(path string) (net.Listener, error) {
+	dir := filepath.Dir(path)
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, fmt.Errorf("socket: create directory: %w", err)
+	}
+
+	if info, err := os.Lstat(path); err == nil {
+		if info.Mode()&os.ModeSocket == 0 {
+			return nil, fmt.Errorf("socket: %s exists and is not a socket", path)
+		}
+		// Refuse to steal the socket from a server that is still running
+		if conn, err := net.Dial("unix", path); err == nil {
+			conn.Close()
+			return nil, fmt.Errorf("socket: %s is in use by another server", path)
+		}
+		if err := os.Remove(path); err != nil {
+			return nil, fmt.Errorf("socket: remove stale socket: %w", err)
+		}
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("socket: %w", err)
+	}
+
+	// The socket is created with the process umask. Create it in a directory
+	// only this user can enter and restrict it there, so that nobody can
+	// connect before it is moved into place.
+	tmp, err := os.MkdirTemp(dir, ".s")
+	if err != nil {
+		return nil, fmt.Errorf("socket: create directory: %w", err)
+	}
+	defer os.RemoveAll(tmp)
+	tmpPath := filepath.Join(tmp, "s")
+
+	ln, err := net.Listen("unix", tmpPath)
+	if err != nil {
+		return nil, fmt.Errorf("socket: listen: %w", err)
+	}
+	ln.(*net.UnixListener).SetUnlinkOnClose(false)
+	if err := os.Chmod(tmpPath, socketMode); err != nil {
+		ln.Close()
+		return nil, fmt.Errorf("socket: set permissions: %w", err)
+	}
+	if err := os.Rename(tmpPath, path); err != nil {
+		ln.Close()
+		return nil, fmt.Errorf("socket: move into place: %w", err)
+	}
+	return ln, nil
+}
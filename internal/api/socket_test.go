@@ -0,0 +1,113 @@
+package api
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestInternalRoutesOnlyOnSocket(t *testing.T) {
+	srv, cleanup := setupTestServer(t)
+	defer cleanup()
+
+	body := map[string]any{"run_id": "missing", "type": "approval", "tool": "Bash", "request_id": "req-1"}
+
+	if w := doRequest(srv, "POST", "/api/internal/interaction-request", body, "Bearer test-key"); w.Code != http.StatusNotFound {
+		t.Errorf("public listener: got status %d, want %d", w.Code, http.StatusNotFound)
+	}
+	if w := doSocketRequest(srv, "GET", "/api/repos", nil, "Bearer test-key"); w.Code != http.StatusNotFound {
+		t.Errorf("socket serving public routes: got status %d, want %d", w.Code, http.StatusNotFound)
+	}
+
+	// The socket still requires a hook token
+	if w := doSocketRequest(srv, "POST", "/api/internal/interaction-request", body, ""); w.Code != http.StatusUnauthorized {
+		t.Errorf("no token: got status %d, want %d", w.Code, http.StatusUnauthorized)
+	}
+	reader := "Bearer " + createTestToken(t, srv, "read")
+	if w := doSocketRequest(srv, "POST", "/api/internal/interaction-request", body, reader); w.Code != http.StatusForbidden {
+		t.Errorf("user token: got status %d, want %d", w.Code, http.StatusForbidden)
+	}
+}
+
+func TestListenUnix(t *testing.T) {
+	// Keep the path short; Unix socket paths are limited to ~100 bytes
+	dir, err := os.MkdirTemp("", "m-sock")
+	if err != nil {
+		t.Fatalf("MkdirTemp: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "run", "m.sock")
+
+	ln, err := listenUnix(path)
+	if err != nil {
+		t.Fatalf("listenUnix: %v", err)
+	}
+	dir = filepath.Dir(path)
+
+	// A missing directory is created private, and nothing is left beside
+	// the socket
+	if info, err := os.Stat(dir); err != nil || info.Mode().Perm() != 0700 {
+		t.Errorf("socket directory = %v, %v; want mode 0700", info, err)
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != 1 {
+		t.Errorf("socket directory holds %d entries, want 1", len(entries))
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatalf("stat socket: %v", err)
+	}
+	if info.Mode().Perm() != socketMode {
+		t.Errorf("socket permissions = %v, want %v", info.Mode().Perm(), os.FileMode(socketMode))
+	}
+
+	// Serve a request over the socket the way the hook's curl --unix-socket does
+	httpSrv := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	})}
+	go httpSrv.Serve(ln)
+
+	client := &http.Client{Transport: &http.Transport{
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			return (&net.Dialer{}).DialContext(ctx, "unix", path)
+		},
+	}}
+	resp, err := client.Get("http://localhost/")
+	if err != nil {
+		t.Fatalf("request over socket: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNoContent {
+		t.Errorf("got status %d, want %d", resp.StatusCode, http.StatusNoContent)
+	}
+
+	// A live socket is not taken over
+	if _, err := listenUnix(path); err == nil {
+		t.Error("expected error for socket in use")
+	}
+
+	// A stale socket left by a crashed server is replaced
+	httpSrv.Close()
+	os.Remove(path)
+	stale, err := net.Listen("unix", path)
+	if err != nil {
+		t.Fatalf("recreate stale socket: %v", err)
+	}
+	stale.(*net.UnixListener).SetUnlinkOnClose(false)
+	stale.Close()
+	ln, err = listenUnix(path)
+	if err != nil {
+		t.Fatalf("listenUnix over stale socket: %v", err)
+	}
+	ln.Close()
+
+	// Regular files are never removed
+	file := filepath.Join(dir, "file")
+	os.WriteFile(file, nil, 0644)
+	if _, err := listenUnix(file); err == nil {
+		t.Error("expected error for non-socket path")
+	}
+}
@@ -0,0 +1,164 @@
+package api
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/anthropics/m/internal/store"
+	"github.com/gorilla/websocket"
+)
+
+// wsTicketTTL is how long a WebSocket ticket can be redeemed. Tickets are
+// single-use and meant to be exchanged immediately.
+const wsTicketTTL = 30 * time.Second
+
+// wsTicketProtocolPrefix marks a ticket passed as a Sec-WebSocket-Protocol
+// value, for browsers that cannot set headers on WebSocket connects.
+const wsTicketProtocolPrefix = "m.ticket."
+
+// wsTicket authorizes one WebSocket connection to one run's event stream on
+// behalf of the principal that requested it.
+type wsTicket struct {
+	principal Principal
+	runID     string
+	expiresAt time.Time
+}
+
+// TicketStore holds outstanding WebSocket tickets in memory.
+type TicketStore struct {
+	mu      sync.Mutex
+	tickets map[string]*wsTicket
+	now     func() time.Time
+}
+
+// NewTicketStore creates an empty TicketStore.
+func NewTicketStore() *TicketStore {
+	return &TicketStore{
+		tickets: make(map[string]*wsTicket),
+		now:     time.Now,
+	}
+}
+
+// Issue creates a ticket for the run's event stream. The ticket carries the
+// principal's identity but only the read scope.
+func (ts *TicketStore) Issue(p *Principal, runID string) (string, time.Time, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", time.Time{}, err
+	}
+	ticket := base64.RawURLEncoding.EncodeToString(b)
+
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+
+	now := ts.now()
+	for key, t := range ts.tickets {
+		if now.After(t.expiresAt) {
+			delete(ts.tickets, key)
+		}
+	}
+
+	principal := *p
+	principal.Scopes = []store.Scope{store.ScopeRead}
+	expiresAt := now.Add(wsTicketTTL)
+	ts.tickets[ticket] = &wsTicket{principal: principal, runID: runID, expiresAt: expiresAt}
+	return ticket, expiresAt, nil
+}
+
+// Redeem consumes a ticket for a WebSocket request. It fails if the ticket is
+// unknown, expired or for a different run's events.
+func (ts *TicketStore) Redeem(ticket string, r *http.Request) (*Principal, error) {
+	ts.mu.Lock()
+	t, ok := ts.tickets[ticket]
+	delete(ts.tickets, ticket)
+	ts.mu.Unlock()
+
+	if !ok || ts.now().After(t.expiresAt) {
+		return nil, store.ErrInvalidToken
+	}
+	if r.URL.Path != "/api/runs/"+t.runID+"/events" {
+		return nil, store.ErrInvalidToken
+	}
+	return &t.principal, nil
+}
+
+// wsTicketFromRequest returns the ticket of a WebSocket upgrade request, from
+// the ticket query parameter or a Sec-WebSocket-Protocol value.
+func wsTicketFromRequest(r *http.Request) string {
+	if !websocket.IsWebSocketUpgrade(r) {
+		return ""
+	}
+	if ticket := r.URL.Query().Get("ticket"); ticket != "" {
+		return ticket
+	}
+	for _, proto := range websocket.Subprotocols(r) {
+		if ticket, ok := strings.CutPrefix(proto, wsTicketProtocolPrefix); ok {
+			return ticket
+		}
+	}
+	return ""
+}
+
+// wsTicketProtocol returns the ticket subprotocol offered by the client, which
+// the server must echo for browsers to accept the connection.
+func wsTicketProtocol(r *http.Request) string {
+	for _, proto := range websocket.Subprotocols(r) {
+		if strings.HasPrefix(proto, wsTicketProtocolPrefix) {
+			return proto
+		}
+	}
+	return ""
+}
+
+// createTicketRequest is the request body for creating a WebSocket ticket.
+type createTicketRequest struct {
+	RunID string `json:"run_id"`
+}
+
+// ticketResponse is a newly issued WebSocket ticket.
+type ticketResponse struct {
+	Ticket    string `json:"ticket"`
+	ExpiresAt int64  `json:"expires_at"`
+}
+
+// handleCreateTicket issues a short-lived ticket for connecting to a run's
+// event stream without an Authorization header.
+func (s *Server) handleCreateTicket(w http.ResponseWriter, r *http.Request) {
+	var req createTicketRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid_input", "invalid JSON body")
+		return
+	}
+	if req.RunID == "" {
+		writeError(w, http.StatusBadRequest, "invalid_input", "run_id is required")
+		return
+	}
+
+	run, err := s.storeFor(r).GetRun(req.RunID)
+	if errors.Is(err, store.ErrNotFound) {
+		writeError(w, http.StatusNotFound, "not_found", "run not found")
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "internal_error", "failed to get run")
+		return
+	}
+
+	if !s.authorizeRun(w, r, run, store.RepoRoleViewer) {
+		return
+	}
+
+	ticket, expiresAt, err := s.tickets.Issue(PrincipalFromContext(r.Context()), run.ID)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "internal_error", "failed to create ticket")
+		return
+	}
+
+	writeJSON(w, http.StatusCreated, ticketResponse{Ticket: ticket, ExpiresAt: expiresAt.Unix()})
+}
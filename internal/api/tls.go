@@ -0,0 +1,204 @@
+package api
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// TLSConfig holds TLS settings for the public listener.
+type TLSConfig struct {
+	Enabled      bool
+	CertFile     string
+	KeyFile      string
+	SelfSigned   bool   // Generate a self-signed certificate if CertFile does not exist
+	ClientCAFile string // If set, clients must present a certificate signed by this CA (mTLS)
+}
+
+// selfSignedValidity is the lifetime of generated self-signed certificates.
+const selfSignedValidity = 365 * 24 * time.Hour
+
+// tlsReloader holds the current TLS configuration and rebuilds it from disk on
+// Reload, so certificates can be rotated without restarting the server.
+type tlsReloader struct {
+	cfg TLSConfig
+
+	mu      sync.RWMutex
+	current *tls.Config
+	leaf    *x509.Certificate
+}
+
+// newTLSReloader loads the certificate, generating a self-signed one first if
+// configured and missing.
+func newTLSReloader(cfg TLSConfig) (*tlsReloader, error) {
+	if cfg.CertFile == "" || cfg.KeyFile == "" {
+		return nil, errors.New("tls: cert_file and key_file are required")
+	}
+
+	if cfg.SelfSigned {
+		if _, err := os.Stat(cfg.CertFile); errors.Is(err, os.ErrNotExist) {
+			if err := generateSelfSignedCert(cfg.CertFile, cfg.KeyFile, selfSignedHosts()); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	r := &tlsReloader{cfg: cfg}
+	if err := r.Reload(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// Reload re-reads the certificate, key and client CA from disk. On error the
+// previous configuration stays in effect.
+func (r *tlsReloader) Reload() error {
+	cert, err := tls.LoadX509KeyPair(r.cfg.CertFile, r.cfg.KeyFile)
+	if err != nil {
+		return fmt.Errorf("tls: load key pair: %w", err)
+	}
+	leaf, err := x509.ParseCertificate(cert.Certificate[0])
+	if err != nil {
+		return fmt.Errorf("tls: parse certificate: %w", err)
+	}
+
+	// The configuration replaces the listener's for each connection, so it
+	// must offer HTTP/2 itself.
+	config := &tls.Config{
+		MinVersion:   tls.VersionTLS12,
+		Certificates: []tls.Certificate{cert},
+		NextProtos:   []string{"h2", "http/1.1"},
+	}
+
+	if r.cfg.ClientCAFile != "" {
+		pem, err := os.ReadFile(r.cfg.ClientCAFile)
+		if err != nil {
+			return fmt.Errorf("tls: read client CA: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return fmt.Errorf("tls: no certificates in %s", r.cfg.ClientCAFile)
+		}
+		config.ClientCAs = pool
+		config.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+
+	r.mu.Lock()
+	r.current = config
+	r.leaf = leaf
+	r.mu.Unlock()
+	return nil
+}
+
+// Fingerprint returns the SHA-256 fingerprint of the current certificate.
+func (r *tlsReloader) Fingerprint() string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return certFingerprint(r.leaf)
+}
+
+// TLSConfig returns a server configuration that always uses the most recently
+// loaded certificate and client CA.
+func (r *tlsReloader) TLSConfig() *tls.Config {
+	return &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		GetConfigForClient: func(*tls.ClientHelloInfo) (*tls.Config, error) {
+			r.mu.RLock()
+			defer r.mu.RUnlock()
+			return r.current, nil
+		},
+	}
+}
+
+// certFingerprint formats the SHA-256 of a certificate as colon-separated hex,
+// the form used for certificate pinning.
+func certFingerprint(cert *x509.Certificate) string {
+	sum := sha256.Sum256(cert.Raw)
+	parts := make([]string, len(sum))
+	for i, b := range sum {
+		parts[i] = fmt.Sprintf("%02X", b)
+	}
+	return strings.Join(parts, ":")
+}
+
+// selfSignedHosts returns the names a generated certificate is valid for.
+func selfSignedHosts() []string {
+	hosts := []string{"localhost", "127.0.0.1", "::1"}
+	if hostname, err := os.Hostname(); err == nil && hostname != "" {
+		hosts = append(hosts, hostname)
+	}
+	return hosts
+}
+
+// generateSelfSignedCert writes a new self-signed ECDSA certificate and key.
+// The certificate can also act as its own CA, so it may be used as a
+// client_ca_file when pinning a single client.
+func generateSelfSignedCert(certFile, keyFile string, hosts []string) error {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return fmt.Errorf("tls: generate key: %w", err)
+	}
+
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return fmt.Errorf("tls: generate serial: %w", err)
+	}
+
+	now := time.Now()
+	template := &x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{Organization: []string{"M"}, CommonName: hosts[0]},
+		NotBefore:             now.Add(-time.Hour),
+		NotAfter:              now.Add(selfSignedValidity),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	for _, h := range hosts {
+		if ip := net.ParseIP(h); ip != nil {
+			template.IPAddresses = append(template.IPAddresses, ip)
+		} else {
+			template.DNSNames = append(template.DNSNames, h)
+		}
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		return fmt.Errorf("tls: create certificate: %w", err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return fmt.Errorf("tls: marshal key: %w", err)
+	}
+
+	if err := writePEM(keyFile, "EC PRIVATE KEY", keyDER, 0600); err != nil {
+		return err
+	}
+	return writePEM(certFile, "CERTIFICATE", der, 0644)
+}
+
+func writePEM(path, blockType string, der []byte, perm os.FileMode) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("tls: create directory: %w", err)
+	}
+	data := pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der})
+	if err := os.WriteFile(path, data, perm); err != nil {
+		return fmt.Errorf("tls: write %s: %w", path, err)
+	}
+	return nil
+}
@@ -0,0 +1,185 @@
+package api
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestTLSReloader_SelfSigned(t *testing.T) {
+	dir := t.TempDir()
+	cfg := TLSConfig{
+		Enabled:    true,
+		CertFile:   filepath.Join(dir, "tls", "server.crt"),
+		KeyFile:    filepath.Join(dir, "tls", "server.key"),
+		SelfSigned: true,
+	}
+
+	reloader, err := newTLSReloader(cfg)
+	if err != nil {
+		t.Fatalf("newTLSReloader: %v", err)
+	}
+
+	info, err := os.Stat(cfg.KeyFile)
+	if err != nil {
+		t.Fatalf("key not written: %v", err)
+	}
+	if info.Mode().Perm() != 0600 {
+		t.Errorf("key permissions = %v, want 0600", info.Mode().Perm())
+	}
+
+	first := reloader.Fingerprint()
+	if len(first) != 95 {
+		t.Errorf("fingerprint %q is not colon-separated SHA-256", first)
+	}
+
+	// An existing certificate is reused
+	again, err := newTLSReloader(cfg)
+	if err != nil {
+		t.Fatalf("newTLSReloader: %v", err)
+	}
+	if again.Fingerprint() != first {
+		t.Error("existing certificate was regenerated")
+	}
+
+	// Reload picks up a rotated certificate
+	if err := generateSelfSignedCert(cfg.CertFile, cfg.KeyFile, []string{"localhost"}); err != nil {
+		t.Fatalf("generateSelfSignedCert: %v", err)
+	}
+	if err := reloader.Reload(); err != nil {
+		t.Fatalf("Reload: %v", err)
+	}
+	if reloader.Fingerprint() == first {
+		t.Error("fingerprint unchanged after reload")
+	}
+
+	// A failed reload keeps the previous certificate
+	rotated := reloader.Fingerprint()
+	os.WriteFile(cfg.CertFile, []byte("garbage"), 0644)
+	if err := reloader.Reload(); err == nil {
+		t.Error("expected reload error for invalid certificate")
+	}
+	if reloader.Fingerprint() != rotated {
+		t.Error("fingerprint changed after failed reload")
+	}
+}
+
+func TestTLSReloader_MutualTLS(t *testing.T) {
+	dir := t.TempDir()
+	serverCert := filepath.Join(dir, "server.crt")
+	serverKey := filepath.Join(dir, "server.key")
+	clientCert := filepath.Join(dir, "client.crt")
+	clientKey := filepath.Join(dir, "client.key")
+
+	if err := generateSelfSignedCert(serverCert, serverKey, []string{"127.0.0.1"}); err != nil {
+		t.Fatalf("server cert: %v", err)
+	}
+	if err := generateSelfSignedCert(clientCert, clientKey, []string{"client"}); err != nil {
+		t.Fatalf("client cert: %v", err)
+	}
+
+	reloader, err := newTLSReloader(TLSConfig{
+		Enabled:      true,
+		CertFile:     serverCert,
+		KeyFile:      serverKey,
+		ClientCAFile: clientCert,
+	})
+	if err != nil {
+		t.Fatalf("newTLSReloader: %v", err)
+	}
+
+	ts := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	ts.TLS = reloader.TLSConfig()
+	ts.StartTLS()
+	defer ts.Close()
+
+	serverPEM, _ := os.ReadFile(serverCert)
+	roots := x509.NewCertPool()
+	roots.AppendCertsFromPEM(serverPEM)
+
+	newClient := func(certs ...tls.Certificate) *http.Client {
+		return &http.Client{Transport: &http.Transport{
+			TLSClientConfig: &tls.Config{RootCAs: roots, Certificates: certs},
+		}}
+	}
+
+	if _, err := newClient().Get(ts.URL); err == nil {
+		t.Error("expected handshake failure without client certificate")
+	}
+
+	cert, err := tls.LoadX509KeyPair(clientCert, clientKey)
+	if err != nil {
+		t.Fatalf("load client cert: %v", err)
+	}
+	resp, err := newClient(cert).Get(ts.URL)
+	if err != nil {
+		t.Fatalf("request with client certificate: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("got status %d, want %d", resp.StatusCode, http.StatusOK)
+	}
+}
+
+func TestTLSReloader_MissingFiles(t *testing.T) {
+	if _, err := newTLSReloader(TLSConfig{Enabled: true}); err == nil {
+		t.Error("expected error without cert_file and key_file")
+	}
+
+	dir := t.TempDir()
+	_, err := newTLSReloader(TLSConfig{
+		Enabled:  true,
+		CertFile: filepath.Join(dir, "missing.crt"),
+		KeyFile:  filepath.Join(dir, "missing.key"),
+	})
+	if err == nil {
+		t.Error("expected error for missing certificate without self_signed")
+	}
+}
+
+func TestTLSReloader_HTTP2(t *testing.T) {
+	dir := t.TempDir()
+	certFile := filepath.Join(dir, "server.crt")
+	if err := generateSelfSignedCert(certFile, filepath.Join(dir, "server.key"), []string{"127.0.0.1"}); err != nil {
+		t.Fatalf("server cert: %v", err)
+	}
+	reloader, err := newTLSReloader(TLSConfig{Enabled: true, CertFile: certFile, KeyFile: filepath.Join(dir, "server.key")})
+	if err != nil {
+		t.Fatalf("newTLSReloader: %v", err)
+	}
+
+	// Served like the public listener, which negotiates HTTP/2 through ALPN
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	srv := &http.Server{
+		Handler:   http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}),
+		TLSConfig: reloader.TLSConfig(),
+	}
+	go srv.ServeTLS(ln, "", "")
+	defer srv.Close()
+
+	serverPEM, _ := os.ReadFile(certFile)
+	roots := x509.NewCertPool()
+	roots.AppendCertsFromPEM(serverPEM)
+	client := &http.Client{Transport: &http.Transport{
+		TLSClientConfig:   &tls.Config{RootCAs: roots},
+		ForceAttemptHTTP2: true,
+	}}
+	resp, err := client.Get("https://" + ln.Addr().String())
+	if err != nil {
+		t.Fatalf("request: %v", err)
+	}
+	resp.Body.Close()
+	if resp.ProtoMajor != 2 {
+		t.Errorf("protocol = %s, want HTTP/2", resp.Proto)
+	}
+}
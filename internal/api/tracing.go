@@ -0,0 +1,68 @@
+package api
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/anthropics/m/internal/store"
+	"github.com/anthropics/m/internal/tracing"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+var tracer = tracing.Tracer("github.com/anthropics/m/internal/api")
+
+// TracingMiddleware starts a server span for each request, continuing the
+// caller's trace when the request carries a traceparent header. The trace ID
+// is added to the request's log lines.
+func TracingMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := otel.GetTextMapPropagator().Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+		route := routeFromContext(ctx)
+		ctx, span := tracer.Start(ctx, r.Method+" "+route,
+			trace.WithSpanKind(trace.SpanKindServer),
+			trace.WithAttributes(
+				attribute.String("http.request.method", r.Method),
+				attribute.String("http.route", route),
+				attribute.String("url.path", r.URL.Path),
+			),
+		)
+		defer span.End()
+
+		if sc := span.SpanContext(); sc.IsValid() {
+			addLogAttrs(ctx, "trace_id", sc.TraceID().String())
+		}
+
+		wrapped := &statusWriter{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(wrapped, r.WithContext(ctx))
+
+		span.SetAttributes(attribute.Int("http.response.status_code", wrapped.status))
+		if wrapped.status >= 500 {
+			span.SetStatus(codes.Error, http.StatusText(wrapped.status))
+		}
+	})
+}
+
+// storeFor returns the store with method spans parented to the request's span.
+func (s *Server) storeFor(r *http.Request) store.Backend {
+	return s.store.WithContext(r.Context())
+}
+
+// startChildSpan starts a span under the span in ctx. Without a parent it
+// returns a no-op span, so background work does not produce orphan traces.
+func startChildSpan(ctx context.Context, name string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	if !trace.SpanContextFromContext(ctx).IsValid() {
+		return ctx, trace.SpanFromContext(ctx)
+	}
+	return tracer.Start(ctx, name, trace.WithAttributes(attrs...))
+}
+
+// recordRunState notes a run state change on the run's trace, ending the
+// trace when the run finishes.
+func (s *Server) recordRunState(runID string, state store.RunState) {
+	terminal := state == store.RunStateCompleted || state == store.RunStateFailed || state == store.RunStateCancelled
+	s.runs.State(runID, string(state), terminal)
+}
@@ -0,0 +1,104 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/anthropics/m/internal/run"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// recordedSpans installs a recording tracer provider once for the package's
+// tests; package-level tracers bind to the first provider installed.
+var recordedSpans = sync.OnceValue(func() *tracetest.SpanRecorder {
+	rec := tracetest.NewSpanRecorder()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(rec)))
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	return rec
+})
+
+// spansInTrace returns the ended spans of one trace by name.
+func spansInTrace(rec *tracetest.SpanRecorder, traceID trace.TraceID) map[string]sdktrace.ReadOnlySpan {
+	spans := make(map[string]sdktrace.ReadOnlySpan)
+	for _, s := range rec.Ended() {
+		if s.SpanContext().TraceID() == traceID {
+			spans[s.Name()] = s
+		}
+	}
+	return spans
+}
+
+func TestTracing_RunTrace(t *testing.T) {
+	rec := recordedSpans()
+	srv, cleanup := setupTestServer(t)
+	defer cleanup()
+	srv.workspace = run.NewWorkspaceManager(t.TempDir())
+
+	repo, _ := srv.store.CreateRepo("trace-repo", nil)
+
+	const traceparent = "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+	req := httptest.NewRequest("POST", "/api/repos/"+repo.ID+"/runs", strings.NewReader(`{"prompt":"hi"}`))
+	req.Header.Set("Authorization", "Bearer test-key")
+	req.Header.Set("traceparent", traceparent)
+	w := httptest.NewRecorder()
+	srv.httpServer.Handler.ServeHTTP(w, req)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("create run: got status %d: %s", w.Code, w.Body.String())
+	}
+	var created runResponse
+	json.NewDecoder(w.Body).Decode(&created)
+
+	if w := doRequest(srv, "POST", "/api/runs/"+created.ID+"/cancel", nil, "Bearer test-key"); w.Code != http.StatusOK {
+		t.Fatalf("cancel run: got status %d", w.Code)
+	}
+
+	// The create request continues the caller's trace
+	callerTrace, _ := trace.TraceIDFromHex("4bf92f3577b34da6a3ce929d0e0e4736")
+	reqSpans := spansInTrace(rec, callerTrace)
+	httpSpan, ok := reqSpans["POST /api/repos/{repo_id}/runs"]
+	if !ok {
+		t.Fatalf("no server span in caller's trace; got %v", keys(reqSpans))
+	}
+	if httpSpan.Parent().SpanID().String() != "00f067aa0ba902b7" {
+		t.Errorf("server span parent = %s, want the caller's span", httpSpan.Parent().SpanID())
+	}
+	if _, ok := reqSpans["store.CreateRunWithID"]; !ok {
+		t.Errorf("no store span under the request; got %v", keys(reqSpans))
+	}
+
+	// The run has its own trace, linked to the request that created it
+	var runSpan sdktrace.ReadOnlySpan
+	for _, s := range rec.Ended() {
+		for _, a := range s.Attributes() {
+			if s.Name() == "run" && a.Key == "run.id" && a.Value.AsString() == created.ID {
+				runSpan = s
+			}
+		}
+	}
+	if runSpan == nil {
+		t.Fatal("run span not ended after cancel")
+	}
+	if len(runSpan.Links()) != 1 || runSpan.Links()[0].SpanContext.SpanID() != httpSpan.SpanContext().SpanID() {
+		t.Errorf("run span links = %v, want the create request", runSpan.Links())
+	}
+	runSpans := spansInTrace(rec, runSpan.SpanContext().TraceID())
+	if ws, ok := runSpans["run.workspace_create"]; !ok || ws.Parent().SpanID() != runSpan.SpanContext().SpanID() {
+		t.Errorf("workspace span missing from run trace; got %v", keys(runSpans))
+	}
+}
+
+func keys[V any](m map[string]V) []string {
+	out := make([]string, 0, len(m))
+	for k := range m {
+		out = append(out, k)
+	}
+	return out
+}
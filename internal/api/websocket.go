@@ -1,25 +1,23 @@
 package api
 
 import (
+	"context"
 	"encoding/json"
-	"log"
+	"errors"
+	"log/slog"
 	"net/http"
+	"net/url"
 	"strconv"
+	"strings"
 	"sync"
 	"time"
 
 	"github.com/anthropics/m/internal/store"
+	"github.com/anthropics/m/internal/tracing"
 	"github.com/gorilla/websocket"
+	"go.opentelemetry.io/otel/attribute"
 )
 
-var upgrader = websocket.Upgrader{
-	ReadBufferSize:  1024,
-	WriteBufferSize: 1024,
-	CheckOrigin: func(r *http.Request) bool {
-		return true // Allow all origins for now
-	},
-}
-
 const (
 	writeWait      = 10 * time.Second
 	pongWait       = 60 * time.Second
@@ -54,6 +52,7 @@ type Client struct {
 	conn   *websocket.Conn
 	send   chan []byte
 	runID  string
+	logger *slog.Logger
 }
 
 // Hub maintains the set of active clients per run.
@@ -63,6 +62,8 @@ type Hub struct {
 	register   chan *Client
 	unregister chan *Client
 	broadcast  chan *BroadcastMessage
+	ping       chan chan struct{}
+	runs       *tracing.Runs // Parents broadcast spans on the run's trace; may be nil
 }
 
 // BroadcastMessage carries an event to broadcast to a run's clients.
@@ -78,6 +79,7 @@ func NewHub() *Hub {
 		register:   make(chan *Client),
 		unregister: make(chan *Client),
 		broadcast:  make(chan *BroadcastMessage, 256),
+		ping:       make(chan chan struct{}),
 	}
 }
 
@@ -92,6 +94,7 @@ func (h *Hub) Run() {
 			}
 			h.clients[client.runID][client] = true
 			h.mu.Unlock()
+			client.logger.Debug("websocket: client connected")
 
 		case client := <-h.unregister:
 			h.mu.Lock()
@@ -102,6 +105,7 @@ func (h *Hub) Run() {
 					if len(clients) == 0 {
 						delete(h.clients, client.runID)
 					}
+					client.logger.Debug("websocket: client disconnected")
 				}
 			}
 			h.mu.Unlock()
@@ -109,21 +113,52 @@ func (h *Hub) Run() {
 		case msg := <-h.broadcast:
 			h.mu.RLock()
 			clients := h.clients[msg.RunID]
+			_, span := startChildSpan(h.runContext(msg.RunID), "hub.broadcast",
+				attribute.String("run.id", msg.RunID),
+				attribute.Int("clients", len(clients)),
+			)
 			for client := range clients {
 				select {
 				case client.send <- msg.Message:
 				default:
 					// Buffer full, drop client
+					hubDroppedClients.Inc()
+					client.logger.Warn("websocket: send buffer full, dropping client")
 					go func(c *Client) {
 						h.unregister <- c
 					}(client)
 				}
 			}
 			h.mu.RUnlock()
+			span.End()
+
+		case reply := <-h.ping:
+			close(reply)
 		}
 	}
 }
 
+// Ping reports whether the hub's loop is running by passing a message
+// through it.
+func (h *Hub) Ping(ctx context.Context) error {
+	reply := make(chan struct{})
+	select {
+	case h.ping <- reply:
+	case <-ctx.Done():
+		return errors.New("hub loop not responding")
+	}
+	<-reply
+	return nil
+}
+
+// runContext returns a context carrying the run's trace span, if known.
+func (h *Hub) runContext(runID string) context.Context {
+	if h.runs == nil {
+		return context.Background()
+	}
+	return h.runs.Context(context.Background(), runID)
+}
+
 // BroadcastEvent sends an event to all clients watching a run.
 func (h *Hub) BroadcastEvent(event *store.Event) {
 	dto := eventToDTO(event)
@@ -133,7 +168,7 @@ func (h *Hub) BroadcastEvent(event *store.Event) {
 	}
 	data, err := json.Marshal(msg)
 	if err != nil {
-		log.Printf("websocket: marshal event: %v", err)
+		slog.Error("websocket: marshal event", "run_id", event.RunID, "err", err)
 		return
 	}
 
@@ -151,7 +186,7 @@ func (h *Hub) BroadcastState(runID string, state store.RunState) {
 	}
 	data, err := json.Marshal(msg)
 	if err != nil {
-		log.Printf("websocket: marshal state: %v", err)
+		slog.Error("websocket: marshal state", "run_id", runID, "err", err)
 		return
 	}
 
@@ -168,6 +203,18 @@ func (h *Hub) ClientCount(runID string) int {
 	return len(h.clients[runID])
 }
 
+// ClientCounts returns the number of connected clients for each run that has
+// any.
+func (h *Hub) ClientCounts() map[string]int {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	counts := make(map[string]int, len(h.clients))
+	for runID, clients := range h.clients {
+		counts[runID] = len(clients)
+	}
+	return counts
+}
+
 func eventToDTO(e *store.Event) *EventDTO {
 	dto := &EventDTO{
 		ID:        e.ID,
@@ -183,26 +230,63 @@ func eventToDTO(e *store.Event) *EventDTO {
 	return dto
 }
 
-// handleEventsWS handles WebSocket connections for event streaming.
+// checkOrigin allows WebSocket connections without an Origin header (native
+// clients), from the server's own origin, and from the configured origins.
+func (s *Server) checkOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+	u, err := url.Parse(origin)
+	if err != nil {
+		return false
+	}
+	if strings.EqualFold(u.Host, r.Host) {
+		return true
+	}
+	for _, allowed := range s.allowedOrigins {
+		if allowed == "*" || strings.EqualFold(strings.TrimSuffix(allowed, "/"), origin) {
+			return true
+		}
+	}
+	return false
+}
+
+// handleEventsWS handles WebSocket connections for event streaming. Plain
+// GET requests get a page of the run's events instead.
 func (s *Server) handleEventsWS(w http.ResponseWriter, r *http.Request) {
+	if !websocket.IsWebSocketUpgrade(r) {
+		s.handleListEvents(w, r)
+		return
+	}
+
 	runID := r.PathValue("id")
 	if runID == "" {
 		writeError(w, http.StatusBadRequest, "invalid_input", "missing run id")
 		return
 	}
 
+	if !s.checkOrigin(r) {
+		writeError(w, http.StatusForbidden, "forbidden", "origin not allowed")
+		return
+	}
+
 	// Validate run exists
-	run, err := s.store.GetRun(runID)
+	run, err := s.storeFor(r).GetRun(runID)
 	if err == store.ErrNotFound {
 		writeError(w, http.StatusNotFound, "not_found", "run not found")
 		return
 	}
 	if err != nil {
-		log.Printf("websocket: get run: %v", err)
+		loggerFrom(r.Context()).Error("websocket: get run", "run_id", runID, "err", err)
 		writeError(w, http.StatusInternalServerError, "internal_error", "internal error")
 		return
 	}
 
+	if !s.authorizeRun(w, r, run, store.RepoRoleViewer) {
+		return
+	}
+
 	// Parse from_seq query parameter
 	var fromSeq int64
 	if fromSeqStr := r.URL.Query().Get("from_seq"); fromSeqStr != "" {
@@ -213,26 +297,31 @@ func (s *Server) handleEventsWS(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
-	// Upgrade to WebSocket
-	conn, err := upgrader.Upgrade(w, r, nil)
+	// Upgrade to WebSocket, echoing a ticket subprotocol as browsers require
+	var respHeader http.Header
+	if proto := wsTicketProtocol(r); proto != "" {
+		respHeader = http.Header{"Sec-Websocket-Protocol": {proto}}
+	}
+	conn, err := s.upgrader.Upgrade(w, r, respHeader)
 	if err != nil {
-		log.Printf("websocket: upgrade: %v", err)
+		loggerFrom(r.Context()).Error("websocket: upgrade", "err", err)
 		return
 	}
 
 	client := &Client{
-		hub:   s.hub,
-		conn:  conn,
-		send:  make(chan []byte, 256),
-		runID: runID,
+		hub:    s.hub,
+		conn:   conn,
+		send:   make(chan []byte, 256),
+		runID:  runID,
+		logger: loggerFrom(r.Context()),
 	}
 
 	s.hub.register <- client
 
 	// Send replay events
-	events, err := s.store.ListEventsByRunSince(runID, fromSeq)
+	events, err := s.storeFor(r).ListEventsByRunSince(runID, fromSeq)
 	if err != nil {
-		log.Printf("websocket: list events: %v", err)
+		client.logger.Error("websocket: list events", "err", err)
 		conn.Close()
 		return
 	}
@@ -245,7 +334,7 @@ func (s *Server) handleEventsWS(w http.ResponseWriter, r *http.Request) {
 		}
 		data, err := json.Marshal(msg)
 		if err != nil {
-			log.Printf("websocket: marshal replay event: %v", err)
+			client.logger.Error("websocket: marshal replay event", "err", err)
 			continue
 		}
 		client.send <- data
@@ -286,7 +375,7 @@ func (c *Client) readPump() {
 		_, message, err := c.conn.ReadMessage()
 		if err != nil {
 			if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseAbnormalClosure) {
-				log.Printf("websocket: read error: %v", err)
+				c.logger.Warn("websocket: read error", "err", err)
 			}
 			break
 		}
@@ -484,3 +484,119 @@ func TestEventsWSDisconnect(t *testing.T) {
 		t.Errorf("expected 0 clients after disconnect, got %d", count)
 	}
 }
+
+func TestEventsWSTicket(t *testing.T) {
+	srv, cleanup := setupTestServer(t)
+	defer cleanup()
+
+	repo, _ := srv.store.CreateRepo("test-repo", nil)
+	run, _ := srv.store.CreateRun(repo.ID, "test prompt", "/tmp/workspace")
+	otherRepo, _ := srv.store.CreateRepo("other-repo", nil)
+	other, _ := srv.store.CreateRun(otherRepo.ID, "test prompt", "/tmp/workspace")
+
+	ts := httptest.NewServer(srv.httpServer.Handler)
+	defer ts.Close()
+	wsURL := "ws" + strings.TrimPrefix(ts.URL, "http") + "/api/runs/" + run.ID + "/events"
+
+	issue := func() string {
+		t.Helper()
+		w := doRequest(srv, "POST", "/api/ws-tickets", map[string]string{"run_id": run.ID}, "Bearer test-key")
+		if w.Code != http.StatusCreated {
+			t.Fatalf("create ticket: got status %d: %s", w.Code, w.Body.String())
+		}
+		var resp ticketResponse
+		json.NewDecoder(w.Body).Decode(&resp)
+		return resp.Ticket
+	}
+
+	// Query parameter
+	ticket := issue()
+	conn, resp, err := websocket.DefaultDialer.Dial(wsURL+"?ticket="+ticket, nil)
+	if err != nil {
+		t.Fatalf("connect with ticket: %v (response: %v)", err, resp)
+	}
+	conn.Close()
+
+	// Tickets are single-use
+	if _, resp, err := websocket.DefaultDialer.Dial(wsURL+"?ticket="+ticket, nil); err == nil || resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("reused ticket: expected 401, got %v", resp)
+	}
+
+	// Subprotocol, which must be echoed back
+	dialer := websocket.Dialer{Subprotocols: []string{wsTicketProtocolPrefix + issue()}}
+	conn, resp, err = dialer.Dial(wsURL, nil)
+	if err != nil {
+		t.Fatalf("connect with ticket subprotocol: %v (response: %v)", err, resp)
+	}
+	if conn.Subprotocol() != dialer.Subprotocols[0] {
+		t.Errorf("subprotocol = %q, want %q", conn.Subprotocol(), dialer.Subprotocols[0])
+	}
+	conn.Close()
+
+	// Tickets are bound to their run
+	otherURL := "ws" + strings.TrimPrefix(ts.URL, "http") + "/api/runs/" + other.ID + "/events"
+	if _, resp, err := websocket.DefaultDialer.Dial(otherURL+"?ticket="+issue(), nil); err == nil || resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("other run: expected 401, got %v", resp)
+	}
+
+	// Tickets only work for WebSocket upgrades
+	if w := doRequest(srv, "GET", "/api/runs/"+run.ID+"?ticket="+issue(), nil, ""); w.Code != http.StatusUnauthorized {
+		t.Errorf("REST with ticket: got status %d, want %d", w.Code, http.StatusUnauthorized)
+	}
+
+	// Expired tickets are rejected
+	ticket = issue()
+	srv.tickets.now = func() time.Time { return time.Now().Add(wsTicketTTL + time.Second) }
+	if _, resp, err := websocket.DefaultDialer.Dial(wsURL+"?ticket="+ticket, nil); err == nil || resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("expired ticket: expected 401, got %v", resp)
+	}
+}
+
+func TestEventsWSOrigin(t *testing.T) {
+	srv, cleanup := setupTestServer(t)
+	defer cleanup()
+	srv.allowedOrigins = []string{"https://dashboard.example.com"}
+
+	repo, _ := srv.store.CreateRepo("test-repo", nil)
+	run, _ := srv.store.CreateRun(repo.ID, "test prompt", "/tmp/workspace")
+
+	ts := httptest.NewServer(srv.httpServer.Handler)
+	defer ts.Close()
+	wsURL := "ws" + strings.TrimPrefix(ts.URL, "http") + "/api/runs/" + run.ID + "/events"
+
+	tests := []struct {
+		name   string
+		origin string
+		wantOK bool
+	}{
+		{"no origin", "", true},
+		{"same origin", ts.URL, true},
+		{"allowed origin", "https://dashboard.example.com", true},
+		{"other origin", "https://evil.example.com", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			header := http.Header{}
+			header.Set("Authorization", "Bearer test-key")
+			if tt.origin != "" {
+				header.Set("Origin", tt.origin)
+			}
+			conn, resp, err := websocket.DefaultDialer.Dial(wsURL, header)
+			if tt.wantOK {
+				if err != nil {
+					t.Fatalf("connect: %v (response: %v)", err, resp)
+				}
+				conn.Close()
+				return
+			}
+			if err == nil {
+				conn.Close()
+				t.Fatal("expected connection to be rejected")
+			}
+			if resp.StatusCode != http.StatusForbidden {
+				t.Errorf("got status %d, want %d", resp.StatusCode, http.StatusForbidden)
+			}
+		})
+	}
+}
@@ -3,7 +3,9 @@ package config
 
 import (
 	"os"
+	"path/filepath"
 	"strconv"
+	"strings"
 
 	"gopkg.in/yaml.v3"
 )
@@ -16,23 +18,84 @@ type Config struct {
 	Claude     ClaudeConfig     `yaml:"claude"`
 	Agent      AgentConfig      `yaml:"agent"`
 	Push       PushConfig       `yaml:"push"`
+	Logging    LoggingConfig    `yaml:"logging"`
+	Tracing    TracingConfig    `yaml:"tracing"`
 }
 
 // ServerConfig holds HTTP server settings.
 type ServerConfig struct {
-	Port     int    `yaml:"port"`
-	APIKey   string `yaml:"api_key"`
-	DemoMode bool   `yaml:"demo_mode"`
+	Port           int             `yaml:"port"`
+	APIKey         string          `yaml:"api_key"`
+	DemoMode       bool            `yaml:"demo_mode"`
+	TLS            TLSConfig       `yaml:"tls"`
+	SocketPath     string          `yaml:"socket_path"` // Unix socket for hooks; defaults to m.sock next to the database
+	RateLimit      RateLimitConfig `yaml:"rate_limit"`
+	AllowedOrigins []string        `yaml:"allowed_origins"` // Browser origins allowed to open WebSockets
+}
+
+// TLSConfig holds TLS settings for the HTTP server.
+type TLSConfig struct {
+	Enabled      bool   `yaml:"enabled"`
+	CertFile     string `yaml:"cert_file"`
+	KeyFile      string `yaml:"key_file"`
+	SelfSigned   bool   `yaml:"self_signed"`    // Generate a self-signed cert if cert_file does not exist
+	ClientCAFile string `yaml:"client_ca_file"` // Require client certs signed by this CA (mTLS)
+}
+
+// RateLimitConfig holds request rate limits and the brute-force lockout.
+type RateLimitConfig struct {
+	Enabled bool                 `yaml:"enabled"`
+	Groups  map[string]RateLimit `yaml:"groups"` // Keyed by route group: read, write, hook
+	Lockout LockoutConfig        `yaml:"lockout"`
+}
+
+// RateLimit is a token bucket refilled at Rate requests per second.
+type RateLimit struct {
+	Rate  float64 `yaml:"rate"`
+	Burst int     `yaml:"burst"`
+}
+
+// LockoutConfig controls the lockout after repeated authentication failures.
+type LockoutConfig struct {
+	Threshold   int `yaml:"threshold"`    // Failures before the first lockout; 0 disables
+	BaseSeconds int `yaml:"base_seconds"` // First lockout, doubled on each further failure
+	MaxSeconds  int `yaml:"max_seconds"`  // Longest lockout
 }
 
 // StorageConfig holds database settings.
 type StorageConfig struct {
-	Path string `yaml:"path"`
+	Driver string `yaml:"driver"` // "sqlite" or "postgres"
+	Path   string `yaml:"path"`   // SQLite database file; its directory also holds the hook socket and TLS files
+	DSN    string `yaml:"dsn"`    // PostgreSQL connection string
+
+	// OutputRetentionDays is how long the stdout and stderr events of
+	// finished runs stay in the events table before they are archived;
+	// 0 keeps them there.
+	OutputRetentionDays int `yaml:"output_retention_days"`
+
+	Backup BackupConfig `yaml:"backup"`
+}
+
+// BackupConfig schedules SQLite database backups.
+type BackupConfig struct {
+	Dir           string `yaml:"dir"`            // Backup directory; empty disables scheduled backups
+	IntervalHours int    `yaml:"interval_hours"` // Time between backups
+	Keep          int    `yaml:"keep"`           // Newest backups kept; 0 keeps all
+}
+
+// Source returns the data source for the configured driver: the DSN for
+// PostgreSQL and the file path for SQLite.
+func (c *StorageConfig) Source() string {
+	if c.Driver == "postgres" {
+		return c.DSN
+	}
+	return c.Path
 }
 
 // WorkspacesConfig holds workspace directory settings.
 type WorkspacesConfig struct {
-	Path string `yaml:"path"`
+	Path      string `yaml:"path"`
+	MinFreeMB int    `yaml:"min_free_mb"` // Free space below which /health/ready fails
 }
 
 // ClaudeConfig holds Claude CLI wrapper settings.
@@ -42,10 +105,18 @@ type ClaudeConfig struct {
 
 // AgentConfig holds agent behavior settings.
 type AgentConfig struct {
-	Type          string   `yaml:"type"`
-	ApprovalTools []string `yaml:"approval_tools"`
-	InputTools    []string `yaml:"input_tools"`
-	HookTimeout   int      `yaml:"hook_timeout"`
+	Type          string       `yaml:"type"`
+	ApprovalTools []string     `yaml:"approval_tools"`
+	InputTools    []string     `yaml:"input_tools"`
+	HookTimeout   int          `yaml:"hook_timeout"`
+	Output        OutputConfig `yaml:"output"`
+	Secrets       []string     `yaml:"secrets"` // Server environment variables repo settings may pass to agents
+}
+
+// OutputConfig controls how agent output is coalesced into events.
+type OutputConfig struct {
+	FlushMS  int `yaml:"flush_ms"`  // Longest a line waits for more output
+	MaxBytes int `yaml:"max_bytes"` // Buffered output written at once
 }
 
 // PushConfig holds push notification settings.
@@ -56,6 +127,21 @@ type PushConfig struct {
 	APNsTeamID  string `yaml:"apns_team_id"`
 }
 
+// LoggingConfig holds server log settings.
+type LoggingConfig struct {
+	Level  string `yaml:"level"`  // debug, info, warn or error
+	Format string `yaml:"format"` // text or json
+}
+
+// TracingConfig holds OpenTelemetry trace export settings.
+type TracingConfig struct {
+	Exporter    string  `yaml:"exporter"`     // none, otlp or file
+	Endpoint    string  `yaml:"endpoint"`     // OTLP/HTTP host:port
+	Insecure    bool    `yaml:"insecure"`     // Plain HTTP to the OTLP endpoint
+	File        string  `yaml:"file"`         // Output for the file exporter
+	SampleRatio float64 `yaml:"sample_ratio"` // Fraction of traces kept
+}
+
 // Load reads configuration from a YAML file and applies environment overrides.
 func Load(path string) (*Config, error) {
 	cfg := &Config{}
@@ -75,13 +161,32 @@ func Load(path string) (*Config, error) {
 // setDefaults applies default values to the config.
 func setDefaults(cfg *Config) {
 	cfg.Server.Port = 8080
+	cfg.Server.RateLimit = RateLimitConfig{
+		Enabled: true,
+		Groups: map[string]RateLimit{
+			"read":  {Rate: 20, Burst: 100},
+			"write": {Rate: 5, Burst: 30},
+			"hook":  {Rate: 10, Burst: 50},
+		},
+		Lockout: LockoutConfig{Threshold: 5, BaseSeconds: 1, MaxSeconds: 900},
+	}
+	cfg.Storage.Driver = "sqlite"
 	cfg.Storage.Path = "./data/m.db"
+	cfg.Storage.Backup.IntervalHours = 24
+	cfg.Storage.Backup.Keep = 7
 	cfg.Workspaces.Path = "./workspaces"
+	cfg.Workspaces.MinFreeMB = 1024
 	cfg.Claude.BinaryPath = "" // Empty means search PATH
 	cfg.Agent.Type = "claude"
 	cfg.Agent.HookTimeout = 300
+	cfg.Agent.Output.FlushMS = 50
+	cfg.Agent.Output.MaxBytes = 8192
 	cfg.Agent.ApprovalTools = []string{"Edit", "Write", "Bash", "NotebookEdit"}
 	cfg.Agent.InputTools = []string{"AskUserQuestion"}
+	cfg.Logging.Level = "info"
+	cfg.Logging.Format = "text"
+	cfg.Tracing.Exporter = "none"
+	cfg.Tracing.SampleRatio = 1
 }
 
 // applyEnvOverrides applies environment variable overrides.
@@ -94,9 +199,15 @@ func applyEnvOverrides(cfg *Config) {
 	if v := os.Getenv("M_API_KEY"); v != "" {
 		cfg.Server.APIKey = v
 	}
+	if v := os.Getenv("M_DB_DRIVER"); v != "" {
+		cfg.Storage.Driver = v
+	}
 	if v := os.Getenv("M_DB_PATH"); v != "" {
 		cfg.Storage.Path = v
 	}
+	if v := os.Getenv("M_DB_DSN"); v != "" {
+		cfg.Storage.DSN = v
+	}
 	if v := os.Getenv("M_WORKSPACES_PATH"); v != "" {
 		cfg.Workspaces.Path = v
 	}
@@ -106,6 +217,58 @@ func applyEnvOverrides(cfg *Config) {
 	if v := os.Getenv("M_CLAUDE_BINARY"); v != "" {
 		cfg.Claude.BinaryPath = v
 	}
+	if v := os.Getenv("M_ALLOWED_ORIGINS"); v != "" {
+		cfg.Server.AllowedOrigins = strings.Split(v, ",")
+	}
+	if v := os.Getenv("M_SOCKET_PATH"); v != "" {
+		cfg.Server.SocketPath = v
+	}
+	if v := os.Getenv("M_TLS_CERT_FILE"); v != "" {
+		cfg.Server.TLS.CertFile = v
+	}
+	if v := os.Getenv("M_TLS_KEY_FILE"); v != "" {
+		cfg.Server.TLS.KeyFile = v
+	}
+	if v := os.Getenv("M_LOG_LEVEL"); v != "" {
+		cfg.Logging.Level = v
+	}
+	if v := os.Getenv("M_LOG_FORMAT"); v != "" {
+		cfg.Logging.Format = v
+	}
+	if v := os.Getenv("M_TRACING_EXPORTER"); v != "" {
+		cfg.Tracing.Exporter = v
+	}
+	if v := os.Getenv("M_TRACING_ENDPOINT"); v != "" {
+		cfg.Tracing.Endpoint = v
+	}
+	if v := os.Getenv("M_TRACING_FILE"); v != "" {
+		cfg.Tracing.File = v
+	}
+}
+
+// TLSFiles returns the certificate and key paths, defaulting to files next to
+// the database when a self-signed certificate is requested without paths.
+func (c *Config) TLSFiles() (certFile, keyFile string) {
+	certFile, keyFile = c.Server.TLS.CertFile, c.Server.TLS.KeyFile
+	if c.Server.TLS.SelfSigned {
+		dir := filepath.Dir(c.Storage.Path)
+		if certFile == "" {
+			certFile = filepath.Join(dir, "server.crt")
+		}
+		if keyFile == "" {
+			keyFile = filepath.Join(dir, "server.key")
+		}
+	}
+	return certFile, keyFile
+}
+
+// SocketPath returns the hook socket path, defaulting to m.sock next to the
+// database.
+func (c *Config) SocketPath() string {
+	if c.Server.SocketPath != "" {
+		return c.Server.SocketPath
+	}
+	return filepath.Join(filepath.Dir(c.Storage.Path), "m.sock")
 }
 
 // FindClaudeBinary returns the path to the claude binary.
@@ -16,15 +16,33 @@ func TestLoadDefaults(t *testing.T) {
 	if cfg.Server.Port != 8080 {
 		t.Errorf("Server.Port = %d, want 8080", cfg.Server.Port)
 	}
+	if cfg.Storage.Driver != "sqlite" {
+		t.Errorf("Storage.Driver = %s, want sqlite", cfg.Storage.Driver)
+	}
 	if cfg.Storage.Path != "./data/m.db" {
 		t.Errorf("Storage.Path = %s, want ./data/m.db", cfg.Storage.Path)
 	}
+	if cfg.Storage.Source() != "./data/m.db" {
+		t.Errorf("Storage.Source() = %s, want ./data/m.db", cfg.Storage.Source())
+	}
 	if cfg.Workspaces.Path != "./workspaces" {
 		t.Errorf("Workspaces.Path = %s, want ./workspaces", cfg.Workspaces.Path)
 	}
+	if cfg.Workspaces.MinFreeMB != 1024 {
+		t.Errorf("Workspaces.MinFreeMB = %d, want 1024", cfg.Workspaces.MinFreeMB)
+	}
+	if cfg.Storage.Backup.Dir != "" || cfg.Storage.Backup.IntervalHours != 24 || cfg.Storage.Backup.Keep != 7 {
+		t.Errorf("Storage.Backup = %+v, want disabled, 24h, keep 7", cfg.Storage.Backup)
+	}
+	if cfg.Agent.Output.FlushMS != 50 || cfg.Agent.Output.MaxBytes != 8192 {
+		t.Errorf("Agent.Output = %+v, want 50ms/8192 bytes", cfg.Agent.Output)
+	}
 	if cfg.Claude.BinaryPath != "" {
 		t.Errorf("Claude.BinaryPath = %s, want empty", cfg.Claude.BinaryPath)
 	}
+	if cfg.Logging.Level != "info" || cfg.Logging.Format != "text" {
+		t.Errorf("Logging = %+v, want info/text", cfg.Logging)
+	}
 }
 
 func TestLoadFromFile(t *testing.T) {
@@ -66,15 +84,55 @@ claude:
 	}
 }
 
+func TestLoadRateLimit(t *testing.T) {
+	tmpDir := t.TempDir()
+	cfgPath := filepath.Join(tmpDir, "config.yaml")
+
+	content := `
+server:
+  rate_limit:
+    groups:
+      write: { rate: 1, burst: 2 }
+    lockout:
+      threshold: 10
+`
+	if err := os.WriteFile(cfgPath, []byte(content), 0644); err != nil {
+		t.Fatalf("failed to write config file: %v", err)
+	}
+
+	cfg, err := Load(cfgPath)
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+
+	rl := cfg.Server.RateLimit
+	if !rl.Enabled {
+		t.Error("RateLimit.Enabled = false, want true")
+	}
+	if got := rl.Groups["write"]; got != (RateLimit{Rate: 1, Burst: 2}) {
+		t.Errorf("Groups[write] = %+v, want {Rate:1 Burst:2}", got)
+	}
+	if got := rl.Groups["read"]; got != (RateLimit{Rate: 20, Burst: 100}) {
+		t.Errorf("Groups[read] = %+v, want default", got)
+	}
+	if rl.Lockout.Threshold != 10 || rl.Lockout.MaxSeconds != 900 {
+		t.Errorf("Lockout = %+v, want threshold 10 with default max", rl.Lockout)
+	}
+}
+
 func TestEnvOverrides(t *testing.T) {
 	// Set env vars
 	os.Setenv("M_PORT", "3000")
 	os.Setenv("M_API_KEY", "env-key")
 	os.Setenv("M_CLAUDE_BINARY", "/env/claude")
+	os.Setenv("M_LOG_LEVEL", "debug")
+	os.Setenv("M_LOG_FORMAT", "json")
 	defer func() {
 		os.Unsetenv("M_PORT")
 		os.Unsetenv("M_API_KEY")
 		os.Unsetenv("M_CLAUDE_BINARY")
+		os.Unsetenv("M_LOG_LEVEL")
+		os.Unsetenv("M_LOG_FORMAT")
 	}()
 
 	cfg, err := Load("/nonexistent/config.yaml")
@@ -91,6 +149,9 @@ func TestEnvOverrides(t *testing.T) {
 	if cfg.Claude.BinaryPath != "/env/claude" {
 		t.Errorf("Claude.BinaryPath = %s, want /env/claude", cfg.Claude.BinaryPath)
 	}
+	if cfg.Logging.Level != "debug" || cfg.Logging.Format != "json" {
+		t.Errorf("Logging = %+v, want debug/json", cfg.Logging)
+	}
 }
 
 func TestFindClaudeBinary(t *testing.T) {
@@ -111,3 +172,34 @@ func TestFindClaudeBinary(t *testing.T) {
 		}
 	})
 }
+
+func TestLoadPostgresStorage(t *testing.T) {
+	tmpDir := t.TempDir()
+	cfgPath := filepath.Join(tmpDir, "config.yaml")
+
+	content := `
+storage:
+  driver: postgres
+  dsn: "postgres://m@localhost/m"
+`
+	if err := os.WriteFile(cfgPath, []byte(content), 0644); err != nil {
+		t.Fatalf("failed to write config file: %v", err)
+	}
+
+	cfg, err := Load(cfgPath)
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if cfg.Storage.Source() != "postgres://m@localhost/m" {
+		t.Errorf("Storage.Source() = %s, want the DSN", cfg.Storage.Source())
+	}
+
+	t.Setenv("M_DB_DSN", "postgres://m@db/m")
+	cfg, err = Load(cfgPath)
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if cfg.Storage.DSN != "postgres://m@db/m" {
+		t.Errorf("Storage.DSN = %s, want postgres://m@db/m", cfg.Storage.DSN)
+	}
+}
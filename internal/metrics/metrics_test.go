@@ -0,0 +1,74 @@
+package metrics
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestRegistryWrite(t *testing.T) {
+	reg := NewRegistry()
+
+	c := &CounterVec{desc: desc{"test_requests_total", "Requests.", []string{"code"}}, values: make(map[string]*counterValue)}
+	c.Inc("200")
+	c.Add(2, "200")
+	c.Inc(`5"00`)
+
+	h := &HistogramVec{desc: desc{"test_latency_seconds", "Latency.", nil}, buckets: []float64{0.1, 1}, values: make(map[string]*histogramValue)}
+	h.Observe(0.05)
+	h.Observe(0.5)
+	h.Observe(5)
+
+	g := NewGaugeFunc("test_items", "Items\nby kind.", []string{"kind"}, func() ([]Sample, error) {
+		return []Sample{{Labels: []string{"a"}, Value: 3}}, nil
+	})
+
+	reg.Register(c, h, g)
+
+	var buf bytes.Buffer
+	if err := reg.Write(&buf); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+
+	want := `# HELP test_requests_total Requests.
+# TYPE test_requests_total counter
+test_requests_total{code="200"} 3
+test_requests_total{code="5\"00"} 1
+# HELP test_latency_seconds Latency.
+# TYPE test_latency_seconds histogram
+test_latency_seconds_bucket{le="0.1"} 1
+test_latency_seconds_bucket{le="1"} 2
+test_latency_seconds_bucket{le="+Inf"} 3
+test_latency_seconds_sum 5.55
+test_latency_seconds_count 3
+# HELP test_items Items\nby kind.
+# TYPE test_items gauge
+test_items{kind="a"} 3
+`
+	if got := buf.String(); got != want {
+		t.Errorf("output mismatch\ngot:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestGaugeFuncError(t *testing.T) {
+	reg := NewRegistry()
+	reg.Register(NewGaugeFunc("test_broken", "Broken.", nil, func() ([]Sample, error) {
+		return nil, errors.New("boom")
+	}))
+
+	err := reg.Write(&bytes.Buffer{})
+	if err == nil || !strings.Contains(err.Error(), "test_broken") {
+		t.Errorf("expected error naming the metric, got %v", err)
+	}
+}
+
+func TestLabelCountMismatch(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Error("expected panic for wrong number of label values")
+		}
+	}()
+	c := &CounterVec{desc: desc{"test_total", "Test.", []string{"a", "b"}}, values: make(map[string]*counterValue)}
+	c.Inc("only-one")
+}
@@ -0,0 +1,262 @@
+// Package migrate applies numbered schema migrations to SQLite and PostgreSQL
+// databases and records the applied versions in a schema_migrations table.
+package migrate
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// ErrNewerSchema is returned when a database has migrations applied that the
+// running binary does not know, typically after a downgrade.
+var ErrNewerSchema = errors.New("database schema is newer than this binary")
+
+// Dialect is the SQL dialect of a database being migrated.
+type Dialect int
+
+const (
+	SQLite Dialect = iota
+	Postgres
+)
+
+// Migration is one schema change. Versions start at 1 and increase by one.
+type Migration struct {
+	Version int
+	Name    string
+	Up      func(tx *sql.Tx) error
+
+	// DisableForeignKeys turns off foreign key enforcement while the
+	// migration runs, as SQLite requires for rebuilding a table to change
+	// its constraints. Foreign keys are checked before the migration commits.
+	// SQLite only; PostgreSQL alters constraints in place.
+	DisableForeignKeys bool
+}
+
+// Exec returns an Up function that executes SQL statements.
+func Exec(statements string) func(*sql.Tx) error {
+	return func(tx *sql.Tx) error {
+		_, err := tx.Exec(statements)
+		return err
+	}
+}
+
+// Status reports whether one migration has been applied.
+type Status struct {
+	Version   int
+	Name      string
+	AppliedAt time.Time // Zero if pending
+}
+
+// Applied returns true if the migration has been applied.
+func (s Status) Applied() bool {
+	return !s.AppliedAt.IsZero()
+}
+
+// createTable creates schema_migrations; applied_at is a Unix timestamp.
+func (d Dialect) createTable() string {
+	timestamp := "INTEGER"
+	if d == Postgres {
+		timestamp = "BIGINT"
+	}
+	return `CREATE TABLE IF NOT EXISTS schema_migrations (
+	version INTEGER PRIMARY KEY,
+	name TEXT NOT NULL,
+	applied_at ` + timestamp + ` NOT NULL
+)`
+}
+
+// Up applies pending migrations in order, up to and including version target;
+// a target of 0 applies all of them. Each migration runs in its own
+// transaction together with its schema_migrations row, so a failed migration
+// leaves the database at the previous version.
+func Up(db *sql.DB, dialect Dialect, migrations []Migration, target int) error {
+	if err := validate(dialect, migrations); err != nil {
+		return err
+	}
+	latest := len(migrations)
+	if target == 0 {
+		target = latest
+	}
+	if target < 0 || target > latest {
+		return fmt.Errorf("unknown target version %d (latest is %d)", target, latest)
+	}
+
+	ctx := context.Background()
+	// A single connection keeps PRAGMA foreign_keys changes scoped to it.
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return fmt.Errorf("get connection: %w", err)
+	}
+	defer conn.Close()
+
+	if _, err := conn.ExecContext(ctx, dialect.createTable()); err != nil {
+		return fmt.Errorf("create schema_migrations: %w", err)
+	}
+
+	current, err := version(ctx, conn, dialect)
+	if err != nil {
+		return err
+	}
+	if current > latest {
+		return fmt.Errorf("%w: at version %d, latest known is %d", ErrNewerSchema, current, latest)
+	}
+	if target < current {
+		return fmt.Errorf("database is at version %d; downgrading to %d is not supported", current, target)
+	}
+
+	for _, m := range migrations[current:target] {
+		if err := apply(ctx, conn, dialect, m); err != nil {
+			return fmt.Errorf("migration %d (%s): %w", m.Version, m.Name, err)
+		}
+	}
+	return nil
+}
+
+func apply(ctx context.Context, conn *sql.Conn, dialect Dialect, m Migration) (err error) {
+	if m.DisableForeignKeys {
+		// foreign_keys cannot change inside a transaction.
+		if _, err := conn.ExecContext(ctx, "PRAGMA foreign_keys = OFF"); err != nil {
+			return err
+		}
+		defer func() {
+			if _, perr := conn.ExecContext(ctx, "PRAGMA foreign_keys = ON"); err == nil {
+				err = perr
+			}
+		}()
+	}
+
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := m.Up(tx); err != nil {
+		return err
+	}
+	if m.DisableForeignKeys {
+		var table string
+		var rowid sql.NullInt64
+		var parent string
+		var fkid int
+		err := tx.QueryRow("PRAGMA foreign_key_check").Scan(&table, &rowid, &parent, &fkid)
+		if err == nil {
+			return fmt.Errorf("foreign key violation in %s referencing %s", table, parent)
+		}
+		if !errors.Is(err, sql.ErrNoRows) {
+			return fmt.Errorf("foreign key check: %w", err)
+		}
+	}
+	if _, err := tx.Exec(
+		dialect.bind("INSERT INTO schema_migrations (version, name, applied_at) VALUES (?, ?, ?)"),
+		m.Version, m.Name, time.Now().Unix(),
+	); err != nil {
+		return fmt.Errorf("record version: %w", err)
+	}
+	return tx.Commit()
+}
+
+// Version returns the highest applied migration version, or 0 for a database
+// without migrations.
+func Version(db *sql.DB, dialect Dialect) (int, error) {
+	ctx := context.Background()
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("get connection: %w", err)
+	}
+	defer conn.Close()
+	return version(ctx, conn, dialect)
+}
+
+func version(ctx context.Context, conn *sql.Conn, dialect Dialect) (int, error) {
+	var v sql.NullInt64
+	err := conn.QueryRowContext(ctx, "SELECT MAX(version) FROM schema_migrations").Scan(&v)
+	if err != nil {
+		if isNoTable(ctx, conn, dialect) {
+			return 0, nil
+		}
+		return 0, fmt.Errorf("read schema version: %w", err)
+	}
+	return int(v.Int64), nil
+}
+
+// isNoTable reports whether schema_migrations is missing.
+func isNoTable(ctx context.Context, conn *sql.Conn, dialect Dialect) bool {
+	query := "SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = 'schema_migrations'"
+	if dialect == Postgres {
+		query = "SELECT COUNT(*) FROM information_schema.tables WHERE table_schema = current_schema() AND table_name = 'schema_migrations'"
+	}
+	var n int
+	err := conn.QueryRowContext(ctx, query).Scan(&n)
+	return err == nil && n == 0
+}
+
+// List reports each known migration and when it was applied.
+func List(db *sql.DB, dialect Dialect, migrations []Migration) ([]Status, error) {
+	if err := validate(dialect, migrations); err != nil {
+		return nil, err
+	}
+	applied := make(map[int]time.Time)
+
+	rows, err := db.Query("SELECT version, applied_at FROM schema_migrations")
+	if err == nil {
+		defer rows.Close()
+		for rows.Next() {
+			var v int
+			var at int64
+			if err := rows.Scan(&v, &at); err != nil {
+				return nil, fmt.Errorf("scan schema_migrations: %w", err)
+			}
+			applied[v] = time.Unix(at, 0)
+		}
+		if err := rows.Err(); err != nil {
+			return nil, err
+		}
+	} else if v, verr := Version(db, dialect); verr != nil || v != 0 {
+		return nil, fmt.Errorf("query schema_migrations: %w", err)
+	}
+
+	statuses := make([]Status, len(migrations))
+	for i, m := range migrations {
+		statuses[i] = Status{Version: m.Version, Name: m.Name, AppliedAt: applied[m.Version]}
+	}
+	return statuses, nil
+}
+
+// validate checks that versions run 1, 2, 3, ... in order.
+func validate(dialect Dialect, migrations []Migration) error {
+	for i, m := range migrations {
+		if m.Version != i+1 {
+			return fmt.Errorf("migration %q has version %d, want %d", m.Name, m.Version, i+1)
+		}
+		if m.Up == nil {
+			return fmt.Errorf("migration %d (%s) has no Up", m.Version, m.Name)
+		}
+		if m.DisableForeignKeys && dialect != SQLite {
+			return fmt.Errorf("migration %d (%s) disables foreign keys, which only SQLite supports", m.Version, m.Name)
+		}
+	}
+	return nil
+}
+
+// bind rewrites ? placeholders into the dialect's form.
+func (d Dialect) bind(query string) string {
+	if d != Postgres {
+		return query
+	}
+	var b strings.Builder
+	n := 0
+	for _, r := range query {
+		if r == '?' {
+			n++
+			fmt.Fprintf(&b, "$%d", n)
+			continue
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
@@ -0,0 +1,214 @@
+package migrate
+
+import (
+	"database/sql"
+	"errors"
+	"path/filepath"
+	"testing"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+func openTestDB(t *testing.T) *sql.DB {
+	t.Helper()
+	db, err := sql.Open("sqlite3", filepath.Join(t.TempDir(), "test.db")+"?_foreign_keys=on")
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+var testMigrations = []Migration{
+	{Version: 1, Name: "parents", Up: Exec(`CREATE TABLE parents (id INTEGER PRIMARY KEY)`)},
+	{Version: 2, Name: "children", Up: Exec(`
+		CREATE TABLE children (id INTEGER PRIMARY KEY, parent_id INTEGER REFERENCES parents(id));
+	`)},
+	{Version: 3, Name: "child_names", Up: Exec(`ALTER TABLE children ADD COLUMN name TEXT`)},
+}
+
+func tableExists(t *testing.T, db *sql.DB, name string) bool {
+	t.Helper()
+	var n int
+	err := db.QueryRow("SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = ?", name).Scan(&n)
+	if err != nil {
+		t.Fatalf("query sqlite_master: %v", err)
+	}
+	return n > 0
+}
+
+func TestUp(t *testing.T) {
+	db := openTestDB(t)
+
+	if err := Up(db, SQLite, testMigrations, 0); err != nil {
+		t.Fatalf("Up: %v", err)
+	}
+	v, err := Version(db, SQLite)
+	if err != nil {
+		t.Fatalf("Version: %v", err)
+	}
+	if v != 3 {
+		t.Errorf("version = %d, want 3", v)
+	}
+
+	// Already up to date
+	if err := Up(db, SQLite, testMigrations, 0); err != nil {
+		t.Fatalf("Up again: %v", err)
+	}
+}
+
+func TestUp_Target(t *testing.T) {
+	db := openTestDB(t)
+
+	if err := Up(db, SQLite, testMigrations, 2); err != nil {
+		t.Fatalf("Up to 2: %v", err)
+	}
+	statuses, err := List(db, SQLite, testMigrations)
+	if err != nil {
+		t.Fatalf("List: %v", err)
+	}
+	for _, s := range statuses {
+		if want := s.Version <= 2; s.Applied() != want {
+			t.Errorf("migration %d applied = %v, want %v", s.Version, s.Applied(), want)
+		}
+	}
+
+	if err := Up(db, SQLite, testMigrations, 1); err == nil {
+		t.Error("expected error migrating down")
+	}
+	if err := Up(db, SQLite, testMigrations, 4); err == nil {
+		t.Error("expected error for unknown target")
+	}
+	if err := Up(db, SQLite, testMigrations, 3); err != nil {
+		t.Fatalf("Up to 3: %v", err)
+	}
+}
+
+func TestUp_NewerSchema(t *testing.T) {
+	db := openTestDB(t)
+
+	if err := Up(db, SQLite, testMigrations, 0); err != nil {
+		t.Fatalf("Up: %v", err)
+	}
+	err := Up(db, SQLite, testMigrations[:2], 0)
+	if !errors.Is(err, ErrNewerSchema) {
+		t.Errorf("err = %v, want ErrNewerSchema", err)
+	}
+}
+
+func TestUp_FailureRollsBack(t *testing.T) {
+	db := openTestDB(t)
+
+	migrations := append(testMigrations[:2:2], Migration{
+		Version: 3,
+		Name:    "broken",
+		Up: Exec(`
+			CREATE TABLE partial (id INTEGER PRIMARY KEY);
+			INSERT INTO missing VALUES (1);
+		`),
+	})
+	if err := Up(db, SQLite, migrations, 0); err == nil {
+		t.Fatal("expected error from broken migration")
+	}
+
+	v, err := Version(db, SQLite)
+	if err != nil {
+		t.Fatalf("Version: %v", err)
+	}
+	if v != 2 {
+		t.Errorf("version = %d, want 2", v)
+	}
+	if tableExists(t, db, "partial") {
+		t.Error("failed migration was not rolled back")
+	}
+}
+
+func TestUp_DisableForeignKeys(t *testing.T) {
+	db := openTestDB(t)
+
+	if err := Up(db, SQLite, testMigrations, 0); err != nil {
+		t.Fatalf("Up: %v", err)
+	}
+	if _, err := db.Exec(`INSERT INTO parents (id) VALUES (1); INSERT INTO children (id, parent_id) VALUES (1, 1)`); err != nil {
+		t.Fatalf("insert: %v", err)
+	}
+
+	// Rebuilding a referenced table fails with foreign keys enforced.
+	rebuild := Exec(`
+		CREATE TABLE parents_new (id INTEGER PRIMARY KEY, name TEXT NOT NULL DEFAULT '');
+		INSERT INTO parents_new (id) SELECT id FROM parents;
+		DROP TABLE parents;
+		ALTER TABLE parents_new RENAME TO parents;
+	`)
+	migrations := append(testMigrations[:3:3], Migration{
+		Version: 4, Name: "rebuild_parents", Up: rebuild, DisableForeignKeys: true,
+	})
+	if err := Up(db, SQLite, migrations, 0); err != nil {
+		t.Fatalf("Up rebuild: %v", err)
+	}
+
+	var fk int
+	if err := db.QueryRow("PRAGMA foreign_keys").Scan(&fk); err != nil {
+		t.Fatalf("foreign_keys: %v", err)
+	}
+	if fk != 1 {
+		t.Error("foreign keys not re-enabled")
+	}
+
+	// A migration that leaves dangling references is rejected.
+	migrations = append(migrations, Migration{
+		Version: 5, Name: "orphan", DisableForeignKeys: true,
+		Up: Exec(`DELETE FROM parents`),
+	})
+	if err := Up(db, SQLite, migrations, 0); err == nil {
+		t.Fatal("expected foreign key violation")
+	}
+	var n int
+	if err := db.QueryRow("SELECT COUNT(*) FROM parents").Scan(&n); err != nil {
+		t.Fatalf("count: %v", err)
+	}
+	if n != 1 {
+		t.Errorf("parents = %d, want 1 after rollback", n)
+	}
+}
+
+func TestList_Unmigrated(t *testing.T) {
+	db := openTestDB(t)
+
+	statuses, err := List(db, SQLite, testMigrations)
+	if err != nil {
+		t.Fatalf("List: %v", err)
+	}
+	if len(statuses) != 3 {
+		t.Fatalf("got %d statuses, want 3", len(statuses))
+	}
+	for _, s := range statuses {
+		if s.Applied() {
+			t.Errorf("migration %d reported applied", s.Version)
+		}
+	}
+}
+
+func TestValidate(t *testing.T) {
+	bad := []Migration{testMigrations[0], testMigrations[2]}
+	if err := Up(openTestDB(t), SQLite, bad, 0); err == nil {
+		t.Error("expected error for gap in versions")
+	}
+}
+
+func TestValidate_DisableForeignKeysPostgres(t *testing.T) {
+	migrations := []Migration{{Version: 1, Name: "rebuild", Up: Exec(""), DisableForeignKeys: true}}
+	if err := validate(Postgres, migrations); err == nil {
+		t.Error("expected error disabling foreign keys on PostgreSQL")
+	}
+}
+
+func TestDialectBind(t *testing.T) {
+	query := "INSERT INTO t (a, b) VALUES (?, ?)"
+	if got := SQLite.bind(query); got != query {
+		t.Errorf("SQLite.bind = %q", got)
+	}
+	if got, want := Postgres.bind(query), "INSERT INTO t (a, b) VALUES ($1, $2)"; got != want {
+		t.Errorf("Postgres.bind = %q, want %q", got, want)
+	}
+}
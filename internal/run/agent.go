@@ -0,0 +1,67 @@
+package run
+
+import "context"
+
+// Agent is a coding agent process as the server supervises it: the server
+// starts it, reads its output, usage and approval requests, answers the
+// requests, and stops it when the run is cancelled or exceeds a limit.
+type Agent interface {
+	// Start starts the agent. Stdout and Stderr are closed when it stops.
+	Start(ctx context.Context, opts StartOptions) error
+
+	// Model returns the model the agent reports running with.
+	Model() string
+
+	Stdout() <-chan string
+	Stderr() <-chan string
+
+	// Usage returns a channel of the agent's model call usage. Usage
+	// reported before the agent exits is buffered until read.
+	Usage() <-chan Usage
+
+	// Exit returns the status of an agent that exited by itself. ok is false
+	// while the agent runs, and if it was cancelled or stopped on a
+	// rejection.
+	Exit() (exit Exit, ok bool)
+
+	// ApprovalRequests returns a channel of tool calls waiting for approval.
+	// The agent waits for Respond before it goes on.
+	ApprovalRequests() <-chan ApprovalRequest
+	Respond(resp InteractionResponse)
+
+	// Cancel stops the agent.
+	Cancel()
+}
+
+// StartOptions are what an agent process is started with.
+type StartOptions struct {
+	Env          []string // KEY=value environment variables
+	SystemPrompt string   // Appended to the agent's system prompt
+}
+
+// Usage is the tokens and cost of one model call.
+type Usage struct {
+	InputTokens  int64
+	OutputTokens int64
+	CostUSD      float64
+}
+
+// Exit is the status an agent exited with.
+type Exit struct {
+	Code  int
+	Error string
+}
+
+// ApprovalRequest is a tool call the agent needs approved.
+type ApprovalRequest struct {
+	ID      string
+	Type    string // "diff", "command", "generic"
+	Tool    string
+	Payload map[string]interface{}
+}
+
+// InteractionResponse is the response to an approval or input request.
+type InteractionResponse struct {
+	Approved bool   // For approvals
+	Reason   string // Rejection reason or input text
+}
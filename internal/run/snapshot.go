@@ -0,0 +1,177 @@
+package run
+
+import (
+	"archive/tar"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// ErrNotGitWorkspace is returned by Diff for a workspace that is not a git
+// clone.
+var ErrNotGitWorkspace = errors.New("workspace is not a git repository")
+
+// Diff returns the changes in a run's workspace against the HEAD commit of
+// its clone as a git binary patch, untracked files included. The workspace's
+// index is left untouched.
+func (w *WorkspaceManager) Diff(runID string) ([]byte, error) {
+	dir := w.Path(runID)
+	if _, err := os.Stat(filepath.Join(dir, ".git")); errors.Is(err, os.ErrNotExist) {
+		return nil, ErrNotGitWorkspace
+	} else if err != nil {
+		return nil, err
+	}
+
+	diff, err := gitOutput(dir, "diff", "--binary", "HEAD")
+	if err != nil {
+		return nil, err
+	}
+	untracked, err := gitOutput(dir, "ls-files", "-z", "--others", "--exclude-standard")
+	if err != nil {
+		return nil, err
+	}
+	for _, name := range strings.Split(string(untracked), "\x00") {
+		if name == "" {
+			continue
+		}
+		// --no-index exits with status 1 when the files differ, which
+		// against /dev/null they always do.
+		cmd := exec.Command("git", "diff", "--binary", "--no-index", "--", os.DevNull, name)
+		cmd.Dir = dir
+		out, err := cmd.Output()
+		var exit *exec.ExitError
+		if err != nil && !(errors.As(err, &exit) && exit.ExitCode() == 1) {
+			return nil, fmt.Errorf("git diff %s: %w", name, err)
+		}
+		diff = append(diff, out...)
+	}
+	return diff, nil
+}
+
+// HeadSHA returns the commit checked out in a run's workspace, or
+// ErrNotGitWorkspace if the workspace is not a git clone.
+func (w *WorkspaceManager) HeadSHA(runID string) (string, error) {
+	dir := w.Path(runID)
+	if _, err := os.Stat(filepath.Join(dir, ".git")); errors.Is(err, os.ErrNotExist) {
+		return "", ErrNotGitWorkspace
+	} else if err != nil {
+		return "", err
+	}
+	out, err := gitOutput(dir, "rev-parse", "HEAD")
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+// gitOutput runs a git command in dir and returns its standard output.
+func gitOutput(dir string, args ...string) ([]byte, error) {
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("git %s: %w: %s", args[0], err, strings.TrimSpace(stderr.String()))
+	}
+	return out, nil
+}
+
+// Archive writes the directories and regular files of a run's workspace to
+// tw, named prefix followed by their slash-separated path in the workspace.
+// The .git directory and symlinks are left out.
+func (w *WorkspaceManager) Archive(runID string, tw *tar.Writer, prefix string) error {
+	root := w.Path(runID)
+	return filepath.WalkDir(root, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if p == root {
+			return nil
+		}
+		if d.IsDir() && d.Name() == ".git" {
+			return filepath.SkipDir
+		}
+		if !d.IsDir() && !d.Type().IsRegular() {
+			return nil
+		}
+
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		hdr, err := tar.FileInfoHeader(info, "")
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(root, p)
+		if err != nil {
+			return err
+		}
+		hdr.Name = prefix + filepath.ToSlash(rel)
+		if d.IsDir() {
+			hdr.Name += "/"
+		}
+		hdr.Uname, hdr.Gname = "", ""
+		if err := tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+
+		f, err := os.Open(p)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		_, err = io.Copy(tw, f)
+		return err
+	})
+}
+
+// WriteFile creates the file at the slash-separated path name in a run's
+// workspace from r, creating parent directories as needed. Names that would
+// leave the workspace or write into a .git directory are rejected: git runs
+// in workspaces, and a planted config or hook would run commands.
+func (w *WorkspaceManager) WriteFile(runID, name string, mode fs.FileMode, r io.Reader) error {
+	name = path.Clean(name)
+	if !filepath.IsLocal(filepath.FromSlash(name)) {
+		return fmt.Errorf("invalid workspace path %q", name)
+	}
+	if IsGitPath(name) {
+		return fmt.Errorf("workspace path %q is inside .git", name)
+	}
+	dest := filepath.Join(w.Path(runID), filepath.FromSlash(name))
+	if err := os.MkdirAll(filepath.Dir(dest), 0755); err != nil {
+		return err
+	}
+
+	f, err := os.OpenFile(dest, os.O_WRONLY|os.O_CREATE|os.O_EXCL, mode.Perm()|0600)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(f, r); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// IsGitPath reports whether the slash-separated path name has a .git
+// component, compared without case for case-insensitive filesystems.
+func IsGitPath(name string) bool {
+	for _, part := range strings.Split(name, "/") {
+		if strings.EqualFold(part, ".git") {
+			return true
+		}
+	}
+	return false
+}
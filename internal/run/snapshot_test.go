@@ -0,0 +1,114 @@
+package run
+
+import (
+	"archive/tar"
+	"bytes"
+	"errors"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestWorkspaceManager_Diff(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not installed")
+	}
+	wm := NewWorkspaceManager(t.TempDir())
+	path, err := wm.Create("run", nil)
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	if _, err := wm.Diff("run"); !errors.Is(err, ErrNotGitWorkspace) {
+		t.Errorf("Diff without git err = %v, want ErrNotGitWorkspace", err)
+	}
+	if _, err := wm.HeadSHA("run"); !errors.Is(err, ErrNotGitWorkspace) {
+		t.Errorf("HeadSHA without git err = %v, want ErrNotGitWorkspace", err)
+	}
+
+	git := func(args ...string) {
+		cmd := exec.Command("git", append([]string{"-c", "user.name=m", "-c", "user.email=m@example.com"}, args...)...)
+		cmd.Dir = path
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("git %v: %v\n%s", args, err, out)
+		}
+	}
+	git("init", "-q")
+	os.WriteFile(filepath.Join(path, "main.go"), []byte("package main\n"), 0644)
+	git("add", "main.go")
+	git("commit", "-q", "-m", "initial")
+
+	os.WriteFile(filepath.Join(path, "main.go"), []byte("package main\n\nfunc main() {}\n"), 0644)
+	os.WriteFile(filepath.Join(path, "notes.txt"), []byte("new file\n"), 0644)
+
+	sha, err := wm.HeadSHA("run")
+	if err != nil || len(sha) != 40 {
+		t.Errorf("HeadSHA = %q, %v; want a commit", sha, err)
+	}
+
+	diff, err := wm.Diff("run")
+	if err != nil {
+		t.Fatalf("Diff: %v", err)
+	}
+	for _, want := range []string{"+func main() {}", "+++ b/notes.txt", "+new file"} {
+		if !strings.Contains(string(diff), want) {
+			t.Errorf("diff lacks %q:\n%s", want, diff)
+		}
+	}
+}
+
+func TestWorkspaceManager_ArchiveAndWriteFile(t *testing.T) {
+	wm := NewWorkspaceManager(t.TempDir())
+	path, _ := wm.Create("src", nil)
+	os.MkdirAll(filepath.Join(path, ".git"), 0755)
+	os.WriteFile(filepath.Join(path, ".git", "HEAD"), []byte("ref"), 0644)
+	os.MkdirAll(filepath.Join(path, "cmd"), 0755)
+	os.WriteFile(filepath.Join(path, "cmd", "main.go"), []byte("package main\n"), 0755)
+	os.Symlink("/etc/passwd", filepath.Join(path, "link"))
+
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	if err := wm.Archive("src", tw, "workspace/"); err != nil {
+		t.Fatalf("Archive: %v", err)
+	}
+	tw.Close()
+
+	if _, err := wm.Create("dst", nil); err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	var names []string
+	tr := tar.NewReader(&buf)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("read archive: %v", err)
+		}
+		names = append(names, hdr.Name)
+		if hdr.Typeflag == tar.TypeReg {
+			if err := wm.WriteFile("dst", strings.TrimPrefix(hdr.Name, "workspace/"), hdr.FileInfo().Mode(), tr); err != nil {
+				t.Fatalf("WriteFile: %v", err)
+			}
+		}
+	}
+	if got := strings.Join(names, " "); got != "workspace/cmd/ workspace/cmd/main.go" {
+		t.Errorf("archived %s", got)
+	}
+	data, err := os.ReadFile(filepath.Join(wm.Path("dst"), "cmd", "main.go"))
+	if err != nil || string(data) != "package main\n" {
+		t.Errorf("extracted file = %q, %v", data, err)
+	}
+
+	for _, name := range []string{"../escape", "/etc/passwd", "cmd/../../escape", ".git/config", "sub/.Git/hooks/pre-commit"} {
+		if err := wm.WriteFile("dst", name, 0644, strings.NewReader("x")); err == nil {
+			t.Errorf("WriteFile(%q) succeeded", name)
+		}
+	}
+	if err := wm.WriteFile("dst", "cmd/main.go", 0644, strings.NewReader("x")); err == nil {
+		t.Error("WriteFile overwrote an existing file")
+	}
+}
@@ -22,6 +22,12 @@ func NewWorkspaceManager(basePath string) *WorkspaceManager {
 // If gitURL is provided, it clones the repository into the workspace.
 // Returns the absolute path to the created workspace.
 func (w *WorkspaceManager) Create(runID string, gitURL *string) (string, error) {
+	return w.CreateFrom(runID, gitURL, "")
+}
+
+// CreateFrom is like Create, but clones branch instead of the remote's
+// default branch when it is not empty.
+func (w *WorkspaceManager) CreateFrom(runID string, gitURL *string, branch string) (string, error) {
 	workspacePath := filepath.Join(w.basePath, runID)
 
 	// Create workspace directory
@@ -31,7 +37,7 @@ func (w *WorkspaceManager) Create(runID string, gitURL *string) (string, error)
 
 	// Clone repository if git URL is provided
 	if gitURL != nil && *gitURL != "" {
-		if err := w.gitClone(*gitURL, workspacePath); err != nil {
+		if err := w.gitClone(*gitURL, branch, workspacePath); err != nil {
 			// Clean up on failure
 			_ = os.RemoveAll(workspacePath)
 			return "", fmt.Errorf("git clone: %w", err)
@@ -41,9 +47,14 @@ func (w *WorkspaceManager) Create(runID string, gitURL *string) (string, error)
 	return workspacePath, nil
 }
 
-// gitClone clones a git repository to the specified path.
-func (w *WorkspaceManager) gitClone(url, destPath string) error {
-	cmd := exec.Command("git", "clone", url, destPath)
+// gitClone clones a git repository to the specified path, checking out
+// branch if it is not empty.
+func (w *WorkspaceManager) gitClone(url, branch, destPath string) error {
+	args := []string{"clone"}
+	if branch != "" {
+		args = append(args, "--branch", branch)
+	}
+	cmd := exec.Command("git", append(args, "--", url, destPath)...)
 	cmd.Stdout = os.Stdout
 	cmd.Stderr = os.Stderr
 	return cmd.Run()
@@ -68,3 +79,49 @@ func (w *WorkspaceManager) Exists(runID string) bool {
 	_, err := os.Stat(workspacePath)
 	return err == nil
 }
+
+// Check verifies that the workspaces directory is writable and returns the
+// space available on its filesystem.
+func (w *WorkspaceManager) Check() (freeBytes uint64, err error) {
+	if err := os.MkdirAll(w.basePath, 0755); err != nil {
+		return 0, fmt.Errorf("create workspaces directory: %w", err)
+	}
+
+	f, err := os.CreateTemp(w.basePath, ".health-*")
+	if err != nil {
+		return 0, fmt.Errorf("workspaces directory not writable: %w", err)
+	}
+	_, err = f.Write([]byte("ok"))
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	os.Remove(f.Name())
+	if err != nil {
+		return 0, fmt.Errorf("write to workspaces directory: %w", err)
+	}
+
+	return freeSpace(w.basePath)
+}
+
+// DiskUsage returns the total size in bytes of all files under the workspaces
+// directory. A missing directory counts as empty.
+func (w *WorkspaceManager) DiskUsage() (int64, error) {
+	var total int64
+	err := filepath.WalkDir(w.basePath, func(path string, d os.DirEntry, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		if d.Type().IsRegular() {
+			info, err := d.Info()
+			if err != nil {
+				return nil // Removed while walking
+			}
+			total += info.Size()
+		}
+		return nil
+	})
+	return total, err
+}
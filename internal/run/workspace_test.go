@@ -2,6 +2,7 @@ package run
 
 import (
 	"os"
+	"os/exec"
 	"path/filepath"
 	"testing"
 )
@@ -56,6 +57,43 @@ func TestWorkspaceManager_CreateWithGitClone(t *testing.T) {
 	}
 }
 
+func TestWorkspaceManager_CreateFromBranch(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not installed")
+	}
+	origin := t.TempDir()
+	git := func(args ...string) {
+		cmd := exec.Command("git", append([]string{"-c", "user.name=m", "-c", "user.email=m@example.com"}, args...)...)
+		cmd.Dir = origin
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("git %v: %v\n%s", args, err, out)
+		}
+	}
+	git("init", "-q")
+	git("commit", "-q", "--allow-empty", "-m", "initial")
+	git("checkout", "-q", "-b", "release")
+	os.WriteFile(filepath.Join(origin, "VERSION"), []byte("1.0\n"), 0644)
+	git("add", "VERSION")
+	git("commit", "-q", "-m", "release")
+	git("checkout", "-q", "-")
+
+	wm := NewWorkspaceManager(t.TempDir())
+	path, err := wm.CreateFrom("run", &origin, "release")
+	if err != nil {
+		t.Fatalf("CreateFrom: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(path, "VERSION")); err != nil {
+		t.Errorf("release branch not checked out: %v", err)
+	}
+
+	if _, err := wm.CreateFrom("missing", &origin, "no-such-branch"); err == nil {
+		t.Error("CreateFrom with an unknown branch succeeded")
+	}
+	if wm.Exists("missing") {
+		t.Error("failed clone left its workspace behind")
+	}
+}
+
 func TestWorkspaceManager_Cleanup(t *testing.T) {
 	basePath := t.TempDir()
 	wm := NewWorkspaceManager(basePath)
@@ -142,3 +180,56 @@ func TestWorkspaceManager_CreateNested(t *testing.T) {
 		t.Errorf("nested workspace not created: %v", err)
 	}
 }
+
+func TestWorkspaceManager_DiskUsage(t *testing.T) {
+	basePath := filepath.Join(t.TempDir(), "workspaces")
+	wm := NewWorkspaceManager(basePath)
+
+	// A missing base directory is empty
+	if n, err := wm.DiskUsage(); err != nil || n != 0 {
+		t.Fatalf("DiskUsage before create = %d, %v; want 0, nil", n, err)
+	}
+
+	path, err := wm.Create("test-usage", nil)
+	if err != nil {
+		t.Fatalf("Create failed: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(path, "a.txt"), make([]byte, 100), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(filepath.Join(path, "sub"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(path, "sub", "b.txt"), make([]byte, 50), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	n, err := wm.DiskUsage()
+	if err != nil {
+		t.Fatalf("DiskUsage failed: %v", err)
+	}
+	if n != 150 {
+		t.Errorf("DiskUsage = %d, want 150", n)
+	}
+}
+
+func TestWorkspaceManager_Check(t *testing.T) {
+	basePath := filepath.Join(t.TempDir(), "workspaces")
+	wm := NewWorkspaceManager(basePath)
+
+	free, err := wm.Check()
+	if err != nil {
+		t.Fatalf("Check failed: %v", err)
+	}
+	if free == 0 {
+		t.Error("expected non-zero free space")
+	}
+
+	entries, err := os.ReadDir(basePath)
+	if err != nil {
+		t.Fatalf("base directory not created: %v", err)
+	}
+	if len(entries) != 0 {
+		t.Errorf("Check left %d files behind", len(entries))
+	}
+}
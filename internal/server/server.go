@@ -0,0 +1,92 @@
+// Package server turns M's configuration file into the settings of the API
+// server and its tracing, for the commands that run the server.
+package server
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/anthropics/m/internal/api"
+	"github.com/anthropics/m/internal/config"
+	"github.com/anthropics/m/internal/tracing"
+)
+
+// APIConfig returns the API server's configuration. claudeBinary is the
+// Claude CLI the readiness probe checks.
+func APIConfig(cfg *config.Config, claudeBinary string) api.Config {
+	certFile, keyFile := cfg.TLSFiles()
+	return api.Config{
+		Port:           cfg.Server.Port,
+		APIKey:         cfg.Server.APIKey,
+		WorkspacesPath: cfg.Workspaces.Path,
+		DemoMode:       cfg.Server.DemoMode,
+		TLS: api.TLSConfig{
+			Enabled:      cfg.Server.TLS.Enabled,
+			CertFile:     certFile,
+			KeyFile:      keyFile,
+			SelfSigned:   cfg.Server.TLS.SelfSigned,
+			ClientCAFile: cfg.Server.TLS.ClientCAFile,
+		},
+		SocketPath:     cfg.SocketPath(),
+		RateLimit:      rateLimitConfig(cfg.Server.RateLimit),
+		AllowedOrigins: cfg.Server.AllowedOrigins,
+		ClaudeBinary:   claudeBinary,
+		MinFreeBytes:   uint64(cfg.Workspaces.MinFreeMB) << 20,
+		Output: api.OutputConfig{
+			FlushInterval: time.Duration(cfg.Agent.Output.FlushMS) * time.Millisecond,
+			MaxBytes:      cfg.Agent.Output.MaxBytes,
+		},
+		OutputRetention: time.Duration(cfg.Storage.OutputRetentionDays) * 24 * time.Hour,
+		Backup: api.BackupConfig{
+			Dir:      cfg.Storage.Backup.Dir,
+			Interval: time.Duration(cfg.Storage.Backup.IntervalHours) * time.Hour,
+			Keep:     cfg.Storage.Backup.Keep,
+		},
+		Agent: api.AgentConfig{
+			Type:          cfg.Agent.Type,
+			ApprovalTools: cfg.Agent.ApprovalTools,
+			InputTools:    cfg.Agent.InputTools,
+			Secrets:       cfg.Agent.Secrets,
+		},
+	}
+}
+
+// rateLimitConfig converts the configured rate limits for the API server.
+func rateLimitConfig(cfg config.RateLimitConfig) api.RateLimitConfig {
+	groups := make(map[string]api.RateLimit, len(cfg.Groups))
+	for name, g := range cfg.Groups {
+		groups[name] = api.RateLimit{Rate: g.Rate, Burst: g.Burst}
+	}
+	return api.RateLimitConfig{
+		Enabled: cfg.Enabled,
+		Groups:  groups,
+		Lockout: api.LockoutConfig{
+			Threshold: cfg.Lockout.Threshold,
+			Base:      time.Duration(cfg.Lockout.BaseSeconds) * time.Second,
+			Max:       time.Duration(cfg.Lockout.MaxSeconds) * time.Second,
+		},
+	}
+}
+
+// TracingConfig converts the configured trace exporter settings. Spans are
+// reported as coming from serviceName, the command running the server.
+func TracingConfig(cfg config.TracingConfig, serviceName string) tracing.Config {
+	return tracing.Config{
+		Exporter:    cfg.Exporter,
+		Endpoint:    cfg.Endpoint,
+		Insecure:    cfg.Insecure,
+		File:        cfg.File,
+		SampleRatio: cfg.SampleRatio,
+		ServiceName: serviceName,
+	}
+}
+
+// FlushTracing exports buffered spans before the process exits.
+func FlushTracing(shutdown func(context.Context) error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := shutdown(ctx); err != nil {
+		slog.Error("flush traces", "err", err)
+	}
+}
@@ -0,0 +1,39 @@
+package server
+
+import (
+	"testing"
+	"time"
+
+	"github.com/anthropics/m/internal/api"
+	"github.com/anthropics/m/internal/config"
+)
+
+func TestAPIConfig(t *testing.T) {
+	cfg, err := config.Load("/nonexistent/config.yaml")
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	cfg.Server.RateLimit.Lockout.BaseSeconds = 30
+	cfg.Storage.Backup.Dir = "/backups"
+
+	got := APIConfig(cfg, "/usr/bin/claude")
+	if got.Port != 8080 || got.WorkspacesPath != "./workspaces" || got.ClaudeBinary != "/usr/bin/claude" || got.SocketPath != cfg.SocketPath() {
+		t.Errorf("server settings = %+v", got)
+	}
+	if got.MinFreeBytes != 1024<<20 || got.Output.FlushInterval != 50*time.Millisecond {
+		t.Errorf("min free %d, flush interval %s", got.MinFreeBytes, got.Output.FlushInterval)
+	}
+	if want := (api.BackupConfig{Dir: "/backups", Interval: 24 * time.Hour, Keep: 7}); got.Backup != want {
+		t.Errorf("Backup = %+v, want %+v", got.Backup, want)
+	}
+	if got.RateLimit.Lockout.Base != 30*time.Second || len(got.RateLimit.Groups) != len(cfg.Server.RateLimit.Groups) {
+		t.Errorf("RateLimit = %+v", got.RateLimit)
+	}
+}
+
+func TestTracingConfig(t *testing.T) {
+	got := TracingConfig(config.TracingConfig{Exporter: "otlp", Endpoint: "collector:4317", SampleRatio: 0.5}, "m")
+	if got.ServiceName != "m" || got.Exporter != "otlp" || got.Endpoint != "collector:4317" || got.SampleRatio != 0.5 {
+		t.Errorf("TracingConfig = %+v", got)
+	}
+}
@@ -8,6 +8,7 @@ import (
 	"sync"
 	"time"
 
+	"github.com/anthropics/m/internal/migrate"
 	"github.com/google/uuid"
 	_ "github.com/mattn/go-sqlite3"
 )
@@ -19,8 +20,23 @@ type SQLiteStorage struct {
 }
 
 // NewSQLiteStorage creates a new SQLite storage with the given database path.
-// It initializes the schema if needed.
+// It migrates the schema to the latest version.
 func NewSQLiteStorage(dbPath string) (*SQLiteStorage, error) {
+	db, err := openDB(dbPath)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := migrate.Up(db, migrate.SQLite, migrations, 0); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("migrate: %w", err)
+	}
+
+	return &SQLiteStorage{db: db}, nil
+}
+
+// openDB opens and pings the database at dbPath.
+func openDB(dbPath string) (*sql.DB, error) {
 	db, err := sql.Open("sqlite3", dbPath+"?_foreign_keys=on&_journal_mode=WAL")
 	if err != nil {
 		return nil, fmt.Errorf("open database: %w", err)
@@ -31,21 +47,14 @@ func NewSQLiteStorage(dbPath string) (*SQLiteStorage, error) {
 		db.Close()
 		return nil, fmt.Errorf("ping database: %w", err)
 	}
-
-	s := &SQLiteStorage{db: db}
-
-	// Run migrations
-	if err := s.migrate(); err != nil {
-		db.Close()
-		return nil, fmt.Errorf("migrate: %w", err)
-	}
-
-	return s, nil
+	return db, nil
 }
 
-// migrate applies the database schema.
-func (s *SQLiteStorage) migrate() error {
-	schema := `
+// migrations is the session schema history. Append new migrations; never
+// edit or reorder applied ones. Migration 1 is idempotent because databases
+// created before schema versioning replay it.
+var migrations = []migrate.Migration{
+	{Version: 1, Name: "initial", Up: migrate.Exec(`
 		CREATE TABLE IF NOT EXISTS sessions (
 			id TEXT PRIMARY KEY,
 			workspace_id TEXT NOT NULL,
@@ -56,9 +65,29 @@ func (s *SQLiteStorage) migrate() error {
 		);
 		CREATE INDEX IF NOT EXISTS idx_sessions_workspace_id ON sessions(workspace_id);
 		CREATE INDEX IF NOT EXISTS idx_sessions_state ON sessions(state);
-	`
-	_, err := s.db.Exec(schema)
-	return err
+	`)},
+}
+
+// Migrate applies session migrations to the database at dbPath, up to version
+// target or the latest version if target is 0.
+func Migrate(dbPath string, target int) error {
+	db, err := openDB(dbPath)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	return migrate.Up(db, migrate.SQLite, migrations, target)
+}
+
+// MigrationStatus reports which session migrations the database at dbPath
+// has applied.
+func MigrationStatus(dbPath string) ([]migrate.Status, error) {
+	db, err := openDB(dbPath)
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+	return migrate.List(db, migrate.SQLite, migrations)
 }
 
 // Create creates a new session.
@@ -2,6 +2,7 @@ package session
 
 import (
 	"context"
+	"database/sql"
 	"os"
 	"path/filepath"
 	"testing"
@@ -426,3 +427,52 @@ func TestAddMessage(t *testing.T) {
 		t.Error("session.UpdatedAt should be within the test window")
 	}
 }
+
+func TestNewSQLiteStorage_LegacyDatabase(t *testing.T) {
+	dbPath := filepath.Join(t.TempDir(), "legacy.db")
+
+	// A database created before schema versioning
+	db, err := sql.Open("sqlite3", dbPath)
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	_, err = db.Exec(`
+		CREATE TABLE sessions (
+			id TEXT PRIMARY KEY,
+			workspace_id TEXT NOT NULL,
+			conversation TEXT NOT NULL,
+			state TEXT NOT NULL CHECK(state IN ('active', 'paused', 'archived')),
+			created_at INTEGER NOT NULL,
+			updated_at INTEGER NOT NULL
+		);
+		INSERT INTO sessions VALUES ('session-1', 'ws-1', '{}', 'paused', 1700000000, 1700000000);
+	`)
+	db.Close()
+	if err != nil {
+		t.Fatalf("create legacy schema: %v", err)
+	}
+
+	storage, err := NewSQLiteStorage(dbPath)
+	if err != nil {
+		t.Fatalf("NewSQLiteStorage: %v", err)
+	}
+	defer storage.Close()
+
+	session, err := storage.Get(context.Background(), "session-1")
+	if err != nil {
+		t.Fatalf("Get: %v", err)
+	}
+	if session.State != StatePaused {
+		t.Errorf("state = %q, want %q", session.State, StatePaused)
+	}
+
+	statuses, err := MigrationStatus(dbPath)
+	if err != nil {
+		t.Fatalf("MigrationStatus: %v", err)
+	}
+	for _, s := range statuses {
+		if !s.Applied() {
+			t.Errorf("migration %d not applied", s.Version)
+		}
+	}
+}
@@ -41,13 +41,12 @@ type Approval struct {
 
 // CreateApproval creates a new pending approval.
 func (s *Store) CreateApproval(runID, eventID string, approvalType ApprovalType, payload *string) (*Approval, error) {
-	s.mu.Lock()
-	defer s.mu.Unlock()
+	defer s.span("CreateApproval")()
 
 	id := uuid.New().String()
 	now := time.Now().Unix()
 
-	_, err := s.db.Exec(
+	_, err := s.w.Exec(
 		`INSERT INTO approvals (id, run_id, event_id, type, state, payload, created_at)
 		 VALUES (?, ?, ?, ?, ?, ?, ?)`,
 		id, runID, eventID, string(approvalType), string(ApprovalStatePending), payload, now,
@@ -69,8 +68,7 @@ func (s *Store) CreateApproval(runID, eventID string, approvalType ApprovalType,
 
 // GetApproval retrieves an approval by ID.
 func (s *Store) GetApproval(id string) (*Approval, error) {
-	s.mu.RLock()
-	defer s.mu.RUnlock()
+	defer s.span("GetApproval")()
 
 	var approval Approval
 	var approvalType, state string
@@ -104,8 +102,7 @@ func (s *Store) GetApproval(id string) (*Approval, error) {
 
 // ListApprovalsByRun retrieves all approvals for a run.
 func (s *Store) ListApprovalsByRun(runID string) ([]*Approval, error) {
-	s.mu.RLock()
-	defer s.mu.RUnlock()
+	defer s.span("ListApprovalsByRun")()
 
 	rows, err := s.db.Query(
 		`SELECT id, run_id, event_id, type, state, payload, rejection_reason, created_at, resolved_at
@@ -122,8 +119,7 @@ func (s *Store) ListApprovalsByRun(runID string) ([]*Approval, error) {
 
 // ListPendingApprovals retrieves all pending approvals.
 func (s *Store) ListPendingApprovals() ([]*Approval, error) {
-	s.mu.RLock()
-	defer s.mu.RUnlock()
+	defer s.span("ListPendingApprovals")()
 
 	rows, err := s.db.Query(
 		`SELECT id, run_id, event_id, type, state, payload, rejection_reason, created_at, resolved_at
@@ -140,8 +136,7 @@ func (s *Store) ListPendingApprovals() ([]*Approval, error) {
 
 // ListPendingApprovalsByRun retrieves pending approvals for a specific run.
 func (s *Store) ListPendingApprovalsByRun(runID string) ([]*Approval, error) {
-	s.mu.RLock()
-	defer s.mu.RUnlock()
+	defer s.span("ListPendingApprovalsByRun")()
 
 	rows, err := s.db.Query(
 		`SELECT id, run_id, event_id, type, state, payload, rejection_reason, created_at, resolved_at
@@ -158,21 +153,21 @@ func (s *Store) ListPendingApprovalsByRun(runID string) ([]*Approval, error) {
 
 // ApproveApproval marks an approval as approved.
 func (s *Store) ApproveApproval(id string) error {
+	defer s.span("ApproveApproval")()
 	return s.resolveApproval(id, ApprovalStateApproved, nil)
 }
 
 // RejectApproval marks an approval as rejected with a reason.
 func (s *Store) RejectApproval(id string, reason string) error {
+	defer s.span("RejectApproval")()
 	return s.resolveApproval(id, ApprovalStateRejected, &reason)
 }
 
 func (s *Store) resolveApproval(id string, state ApprovalState, reason *string) error {
-	s.mu.Lock()
-	defer s.mu.Unlock()
 
 	now := time.Now().Unix()
 
-	result, err := s.db.Exec(
+	result, err := s.w.Exec(
 		`UPDATE approvals SET state = ?, rejection_reason = ?, resolved_at = ?
 		 WHERE id = ? AND state = ?`,
 		string(state), reason, now, id, string(ApprovalStatePending),
@@ -194,10 +189,9 @@ func (s *Store) resolveApproval(id string, state ApprovalState, reason *string)
 
 // DeleteApprovalsByRun deletes all approvals for a run.
 func (s *Store) DeleteApprovalsByRun(runID string) error {
-	s.mu.Lock()
-	defer s.mu.Unlock()
+	defer s.span("DeleteApprovalsByRun")()
 
-	_, err := s.db.Exec("DELETE FROM approvals WHERE run_id = ?", runID)
+	_, err := s.w.Exec("DELETE FROM approvals WHERE run_id = ?", runID)
 	if err != nil {
 		return fmt.Errorf("delete approvals: %w", err)
 	}
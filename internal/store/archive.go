@@ -0,0 +1,325 @@
+package store
+
+import (
+	"bytes"
+	"compress/gzip"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io"
+	"slices"
+	"sort"
+	"time"
+)
+
+// archivedTypes are the event types ArchiveOutput compacts. Lifecycle, tool
+// and interaction events always stay in the events table.
+var archivedTypes = []string{"stdout", "stderr"}
+
+// ArchiveResult counts the work done by ArchiveOutput.
+type ArchiveResult struct {
+	Runs   int // Runs whose output was archived
+	Events int // Events moved into archives
+}
+
+// archivedEvent is an event as stored in an archive blob.
+type archivedEvent struct {
+	ID        string  `json:"id"`
+	Seq       int64   `json:"seq"`
+	Type      string  `json:"type"`
+	Data      *string `json:"data,omitempty"`
+	CreatedAt int64   `json:"created_at"`
+}
+
+// ArchiveOutput compacts the stdout and stderr events of runs that reached a
+// terminal state before cutoff into one gzip blob per run in event_archives,
+// and deletes them from events. Output archived earlier is merged into the
+// run's blob. Each run is archived in its own transaction.
+//
+// Event reads by run re-expand archived output, so replay is unaffected.
+func (s *Store) ArchiveOutput(cutoff time.Time) (ArchiveResult, error) {
+	defer s.span("ArchiveOutput")()
+
+	rows, err := s.db.Query(
+		`SELECT DISTINCT r.id FROM runs r JOIN events e ON e.run_id = r.id
+		 WHERE r.state IN ('completed', 'failed', 'cancelled') AND r.updated_at < ?
+		 AND e.type IN (?, ?)`,
+		cutoff.Unix(), archivedTypes[0], archivedTypes[1],
+	)
+	if err != nil {
+		return ArchiveResult{}, fmt.Errorf("query runs to archive: %w", err)
+	}
+	var runIDs []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return ArchiveResult{}, fmt.Errorf("scan run: %w", err)
+		}
+		runIDs = append(runIDs, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return ArchiveResult{}, fmt.Errorf("query runs to archive: %w", err)
+	}
+
+	var result ArchiveResult
+	for _, runID := range runIDs {
+		n, err := s.archiveRun(runID)
+		if err != nil {
+			return result, fmt.Errorf("archive run %s: %w", runID, err)
+		}
+		result.Runs++
+		result.Events += n
+	}
+	return result, nil
+}
+
+// archiveRun moves a run's output events into its archive and returns how
+// many were moved.
+func (s *Store) archiveRun(runID string) (int, error) {
+	var moved int
+	err := s.writeTx(func(tx *sql.Tx) error {
+		events, lastSeq, err := loadArchive(tx, runID)
+		if err != nil {
+			return err
+		}
+
+		rows, err := tx.Query(
+			`SELECT id, run_id, seq, type, data, created_at FROM events
+			 WHERE run_id = ? AND type IN (?, ?) ORDER BY seq`,
+			runID, archivedTypes[0], archivedTypes[1],
+		)
+		if err != nil {
+			return fmt.Errorf("query output: %w", err)
+		}
+		output, err := scanEvents(rows)
+		rows.Close()
+		if err != nil {
+			return err
+		}
+		if len(output) == 0 {
+			return nil
+		}
+		moved = len(output)
+
+		events = append(events, output...)
+		sortBySeq(events)
+		lastSeq = max(lastSeq, events[len(events)-1].Seq)
+
+		blob, err := encodeArchive(events)
+		if err != nil {
+			return err
+		}
+		if _, err := tx.Exec(
+			`INSERT INTO event_archives (run_id, data, event_count, last_seq, archived_at)
+			 VALUES (?, ?, ?, ?, ?)
+			 ON CONFLICT(run_id) DO UPDATE SET data = excluded.data, event_count = excluded.event_count,
+			 last_seq = excluded.last_seq, archived_at = excluded.archived_at`,
+			runID, blob, len(events), lastSeq, time.Now().Unix(),
+		); err != nil {
+			return fmt.Errorf("write archive: %w", err)
+		}
+
+		if _, err := tx.Exec(
+			"DELETE FROM events WHERE run_id = ? AND type IN (?, ?)",
+			runID, archivedTypes[0], archivedTypes[1],
+		); err != nil {
+			return fmt.Errorf("delete output: %w", err)
+		}
+		return nil
+	})
+	return moved, err
+}
+
+// loadArchive returns a run's archived events in seq order and the last seq
+// they cover, or no events if the run has no archive.
+func loadArchive(q queryer, runID string) ([]*Event, int64, error) {
+	var blob []byte
+	var lastSeq int64
+	err := q.QueryRow(
+		"SELECT data, last_seq FROM event_archives WHERE run_id = ?",
+		runID,
+	).Scan(&blob, &lastSeq)
+	if err == sql.ErrNoRows {
+		return nil, 0, nil
+	}
+	if err != nil {
+		return nil, 0, fmt.Errorf("query archive: %w", err)
+	}
+
+	events, err := decodeArchive(runID, blob)
+	if err != nil {
+		return nil, 0, err
+	}
+	return events, lastSeq, nil
+}
+
+// encodeArchive gzips events as JSON lines.
+func encodeArchive(events []*Event) ([]byte, error) {
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	enc := json.NewEncoder(zw)
+	for _, e := range events {
+		if err := enc.Encode(archivedEvent{
+			ID:        e.ID,
+			Seq:       e.Seq,
+			Type:      e.Type,
+			Data:      e.Data,
+			CreatedAt: e.CreatedAt.Unix(),
+		}); err != nil {
+			return nil, fmt.Errorf("encode archive: %w", err)
+		}
+	}
+	if err := zw.Close(); err != nil {
+		return nil, fmt.Errorf("compress archive: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+func decodeArchive(runID string, blob []byte) ([]*Event, error) {
+	zr, err := gzip.NewReader(bytes.NewReader(blob))
+	if err != nil {
+		return nil, fmt.Errorf("decompress archive: %w", err)
+	}
+	defer zr.Close()
+
+	var events []*Event
+	dec := json.NewDecoder(zr)
+	for {
+		var a archivedEvent
+		if err := dec.Decode(&a); err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, fmt.Errorf("decode archive: %w", err)
+		}
+		events = append(events, &Event{
+			ID:        a.ID,
+			RunID:     runID,
+			Seq:       a.Seq,
+			Type:      a.Type,
+			Data:      a.Data,
+			CreatedAt: time.Unix(a.CreatedAt, 0),
+		})
+	}
+	return events, nil
+}
+
+// indexArchives adds the archived output of every run to the search index,
+// skipping events that are already indexed.
+func indexArchives(tx *sql.Tx) error {
+	rows, err := tx.Query("SELECT run_id, data FROM event_archives")
+	if err != nil {
+		return fmt.Errorf("query archives: %w", err)
+	}
+	var events []*Event
+	for rows.Next() {
+		var runID string
+		var blob []byte
+		if err := rows.Scan(&runID, &blob); err != nil {
+			rows.Close()
+			return fmt.Errorf("scan archive: %w", err)
+		}
+		archived, err := decodeArchive(runID, blob)
+		if err != nil {
+			rows.Close()
+			return err
+		}
+		events = append(events, archived...)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("query archives: %w", err)
+	}
+
+	for _, e := range events {
+		var doc struct {
+			Text string `json:"text"`
+		}
+		if e.Data == nil || json.Unmarshal([]byte(*e.Data), &doc) != nil {
+			continue
+		}
+		if _, err := tx.Exec(
+			`INSERT INTO search_docs (ref_id, kind, run_id, seq, body, created_at)
+			 VALUES (?, 'output', ?, ?, ?, ?) ON CONFLICT (ref_id) DO NOTHING`,
+			e.ID, e.RunID, e.Seq, doc.Text, e.CreatedAt.Unix(),
+		); err != nil {
+			return fmt.Errorf("index archived event %s: %w", e.ID, err)
+		}
+	}
+	return nil
+}
+
+// withArchived merges a run's archived events that keep returns true for
+// into events and returns them in seq order.
+func (s *Store) withArchived(runID string, events []*Event, keep func(*Event) bool) ([]*Event, error) {
+	archived, _, err := loadArchive(s.db, runID)
+	if err != nil || len(archived) == 0 {
+		return events, err
+	}
+	for _, e := range archived {
+		if keep(e) {
+			events = append(events, e)
+		}
+	}
+	sortBySeq(events)
+	return events, nil
+}
+
+func sortBySeq(events []*Event) {
+	sort.Slice(events, func(i, j int) bool { return events[i].Seq < events[j].Seq })
+}
+
+// getArchivedEvent returns the archived event of a run with seq.
+func (s *Store) getArchivedEvent(runID string, seq int64) (*Event, error) {
+	archived, _, err := loadArchive(s.db, runID)
+	if err != nil {
+		return nil, err
+	}
+	for _, e := range archived {
+		if e.Seq == seq {
+			return e, nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+// pageArchived merges the archived events that belong on an events page into
+// the events selected for it, and trims them to the rows the query would
+// have selected had the archived events still been in the events table.
+func (s *Store) pageArchived(filter EventFilter, pq pageQuery, events []*Event) ([]*Event, error) {
+	if len(filter.Types) > 0 && !slices.ContainsFunc(filter.Types, func(t string) bool {
+		return slices.Contains(archivedTypes, t)
+	}) {
+		return events, nil
+	}
+
+	// The cursor was validated when the query was built.
+	var after *int64
+	if filter.Cursor != "" {
+		c, _ := decodeCursor(filter.Cursor)
+		seq, _ := c.Value.(int64)
+		after = &seq
+	}
+	archived, _, err := loadArchive(s.db, filter.RunID)
+	if err != nil || len(archived) == 0 {
+		return events, err
+	}
+	for _, e := range archived {
+		if len(filter.Types) > 0 && !slices.Contains(filter.Types, e.Type) {
+			continue
+		}
+		if after != nil && (pq.desc && e.Seq >= *after || !pq.desc && e.Seq <= *after) {
+			continue
+		}
+		events = append(events, e)
+	}
+	sortBySeq(events)
+	if pq.desc {
+		slices.Reverse(events)
+	}
+	if len(events) > pq.limit+1 {
+		events = events[:pq.limit+1]
+	}
+	return events, nil
+}
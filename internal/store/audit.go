@@ -0,0 +1,130 @@
+package store
+
+import (
+	"fmt"
+	"time"
+)
+
+// AuditEntry records an action taken through the API. Entries are append-only.
+type AuditEntry struct {
+	ID         int64
+	TokenID    *string // Token used; nil for the server API key
+	UserID     *string // User owning the token, if any
+	Actor      string  // Display name of the actor
+	Action     string  // e.g. "run.create", "approval.resolve"
+	TargetType string  // e.g. "run", "repo", "interaction"
+	TargetID   string
+	Method     string
+	Path       string
+	Status     int
+	RemoteAddr string
+	UserAgent  string
+	Details    *string // Action-specific JSON
+	CreatedAt  time.Time
+}
+
+// AuditFilter selects audit entries. Zero values match everything.
+type AuditFilter struct {
+	UserID     string
+	TokenID    string
+	Action     string
+	TargetType string
+	TargetID   string
+	Since      time.Time
+	Until      time.Time
+	Limit      int // Defaults to 100
+}
+
+// CreateAuditEntry appends an entry to the audit log. ID and CreatedAt are set
+// on the entry.
+func (s *Store) CreateAuditEntry(entry *AuditEntry) error {
+	defer s.span("CreateAuditEntry")()
+
+	now := time.Now().Unix()
+
+	var id int64
+	err := s.w.QueryRow(
+		`INSERT INTO audit_log (token_id, user_id, actor, action, target_type, target_id,
+		 method, path, status, remote_addr, user_agent, details, created_at)
+		 VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		 RETURNING id`,
+		entry.TokenID, entry.UserID, entry.Actor, entry.Action, entry.TargetType, entry.TargetID,
+		entry.Method, entry.Path, entry.Status, entry.RemoteAddr, entry.UserAgent, entry.Details, now,
+	).Scan(&id)
+	if err != nil {
+		return fmt.Errorf("insert audit entry: %w", err)
+	}
+
+	entry.ID = id
+	entry.CreatedAt = time.Unix(now, 0)
+	return nil
+}
+
+// ListAuditEntries retrieves audit entries matching the filter, newest first.
+func (s *Store) ListAuditEntries(filter AuditFilter) ([]*AuditEntry, error) {
+	defer s.span("ListAuditEntries")()
+
+	query := `SELECT id, token_id, user_id, actor, action, target_type, target_id,
+		 method, path, status, remote_addr, user_agent, details, created_at
+		 FROM audit_log WHERE 1=1`
+	args := []any{}
+
+	if filter.UserID != "" {
+		query += " AND user_id = ?"
+		args = append(args, filter.UserID)
+	}
+	if filter.TokenID != "" {
+		query += " AND token_id = ?"
+		args = append(args, filter.TokenID)
+	}
+	if filter.Action != "" {
+		query += " AND action = ?"
+		args = append(args, filter.Action)
+	}
+	if filter.TargetType != "" {
+		query += " AND target_type = ?"
+		args = append(args, filter.TargetType)
+	}
+	if filter.TargetID != "" {
+		query += " AND target_id = ?"
+		args = append(args, filter.TargetID)
+	}
+	if !filter.Since.IsZero() {
+		query += " AND created_at >= ?"
+		args = append(args, filter.Since.Unix())
+	}
+	if !filter.Until.IsZero() {
+		query += " AND created_at < ?"
+		args = append(args, filter.Until.Unix())
+	}
+
+	limit := filter.Limit
+	if limit <= 0 {
+		limit = 100
+	}
+	query += " ORDER BY id DESC LIMIT ?"
+	args = append(args, limit)
+
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("query audit log: %w", err)
+	}
+	defer rows.Close()
+
+	var entries []*AuditEntry
+	for rows.Next() {
+		var entry AuditEntry
+		var createdAt int64
+		if err := rows.Scan(
+			&entry.ID, &entry.TokenID, &entry.UserID, &entry.Actor, &entry.Action,
+			&entry.TargetType, &entry.TargetID, &entry.Method, &entry.Path, &entry.Status,
+			&entry.RemoteAddr, &entry.UserAgent, &entry.Details, &createdAt,
+		); err != nil {
+			return nil, fmt.Errorf("scan audit entry: %w", err)
+		}
+		entry.CreatedAt = time.Unix(createdAt, 0)
+		entries = append(entries, &entry)
+	}
+
+	return entries, rows.Err()
+}
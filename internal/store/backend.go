@@ -0,0 +1,134 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+// Backend is the persistence interface used by the API server. *Store
+// implements it for SQLite (New) and PostgreSQL (NewPostgres); storetest
+// holds the conformance suite every implementation must pass.
+//
+// Methods return ErrNotFound for missing records. The *Tx methods run inside
+// a transaction started by InTx.
+type Backend interface {
+	// Repos
+	CreateRepo(name string, gitURL *string) (*Repo, error)
+	GetRepo(id string) (*Repo, error)
+	GetRepoByName(name string) (*Repo, error)
+	ListRepos() ([]*Repo, error)
+	ListReposPage(filter RepoFilter) ([]*Repo, string, error)
+	UpdateRepo(repo *Repo) error
+	DeleteRepo(id string) error
+
+	// Runs
+	CreateRun(repoID, prompt, workspacePath string) (*Run, error)
+	CreateRunWithID(id, repoID, prompt, workspacePath string) (*Run, error)
+	GetRun(id string) (*Run, error)
+	GetRunTx(tx *sql.Tx, id string) (*Run, error)
+	ListRunsByRepo(repoID string) ([]*Run, error)
+	ListRunsPage(filter RunFilter) ([]*Run, string, error)
+	ListRunsByState(state RunState) ([]*Run, error)
+	CountRunsByState() (map[RunState]int, error)
+	GetActiveRunByRepo(repoID string) (*Run, error)
+	UpdateRunState(id string, state RunState) error
+	StartRun(id string, start RunStart) error
+	FinishRun(id string, end RunEnd) error
+	AddRunUsage(id string, usage RunUsage) error
+	DeleteRun(id string) error
+	ImportRun(run *Run, events []*Event, interactions []*Interaction) error
+
+	// Events
+	CreateEvent(runID, eventType string, data *string) (*Event, error)
+	GetEvent(id string) (*Event, error)
+	ListEventsByRun(runID string) ([]*Event, error)
+	ListEventsPage(filter EventFilter) ([]*Event, string, error)
+	ListEventsByRunSince(runID string, sinceSeq int64) ([]*Event, error)
+	GetEventByRunSeq(runID string, seq int64) (*Event, error)
+	GetLatestEventSeq(runID string) (int64, error)
+	DeleteEventsByRun(runID string) error
+	ArchiveOutput(cutoff time.Time) (ArchiveResult, error)
+
+	// Interactions
+	CreateInteraction(requestID, runID string, interactionType InteractionType, tool string, payload *string) (*Interaction, error)
+	GetInteraction(id string) (*Interaction, error)
+	GetInteractionByRequestID(requestID string) (*Interaction, error)
+	ListPendingInteractions() ([]*Interaction, error)
+	ListPendingInteractionsByRun(runID string) ([]*Interaction, error)
+	ResolveInteraction(id string, decision InteractionDecision, message, response *string) error
+	ResolveInteractionWithInput(id string, decision InteractionDecision, message, response, updatedInput *string) error
+	ListPendingInteractionsTx(tx *sql.Tx, interactionType InteractionType, runID, tool string) ([]*Interaction, error)
+	GetInteractionTx(tx *sql.Tx, id string) (*Interaction, error)
+	ResolveInteractionTx(tx *sql.Tx, id string, decision InteractionDecision, message, response *string) (*Interaction, error)
+	ListInteractions(runID string, state *InteractionState) ([]*Interaction, error)
+	ListInteractionsPage(filter InteractionFilter) ([]*Interaction, string, error)
+	DeleteInteractionsByRun(runID string) error
+
+	// Approvals
+	CreateApproval(runID, eventID string, approvalType ApprovalType, payload *string) (*Approval, error)
+	GetApproval(id string) (*Approval, error)
+	ListApprovalsByRun(runID string) ([]*Approval, error)
+	ListPendingApprovals() ([]*Approval, error)
+	ListPendingApprovalsByRun(runID string) ([]*Approval, error)
+	ApproveApproval(id string) error
+	RejectApproval(id string, reason string) error
+	DeleteApprovalsByRun(runID string) error
+
+	// Devices
+	CreateDevice(token string, platform Platform) (*Device, error)
+	GetDevice(token string) (*Device, error)
+	ListDevices() ([]*Device, error)
+	ListDevicesByPlatform(platform Platform) ([]*Device, error)
+	DeleteDevice(token string) error
+
+	// Users and tokens
+	CreateUser(name string) (*User, error)
+	GetUser(id string) (*User, error)
+	ListUsers() ([]*User, error)
+	DeleteUser(id string) error
+	CreateToken(userID, name string, scopes []Scope, expiresAt *time.Time) (*APIToken, string, error)
+	CreateHookToken(runID string, expiresAt time.Time) (*APIToken, string, error)
+	AuthenticateToken(plaintext string) (*APIToken, error)
+	GetToken(id string) (*APIToken, error)
+	ListTokens(userID string) ([]*APIToken, error)
+	RevokeToken(id string) error
+	RevokeRunTokens(runID string) error
+
+	// Repo membership and per-user views
+	SetRepoMember(repoID, userID string, role RepoRole) (*RepoMember, error)
+	GetRepoMember(repoID, userID string) (*RepoMember, error)
+	ListRepoMembers(repoID string) ([]*RepoMember, error)
+	RemoveRepoMember(repoID, userID string) error
+	ListRepoRolesForUser(userID string) (map[string]RepoRole, error)
+	ListReposForUser(userID string) ([]*Repo, error)
+	CountRunsByStateForUser(userID string) (map[RunState]int, error)
+	ListPendingInteractionsForUser(userID string) ([]*Interaction, error)
+	ListInteractionsForUser(userID, runID string, state *InteractionState) ([]*Interaction, error)
+
+	// Audit log
+	CreateAuditEntry(entry *AuditEntry) error
+	ListAuditEntries(filter AuditFilter) ([]*AuditEntry, error)
+
+	// Search
+	Search(filter SearchFilter) ([]*SearchResult, string, error)
+
+	// InTx runs fn in a transaction, committing if it returns nil.
+	InTx(fn func(*sql.Tx) error) error
+
+	// WithContext returns a Backend whose methods record spans as children
+	// of the span in ctx.
+	WithContext(ctx context.Context) Backend
+
+	// Check verifies that the database answers and accepts writes.
+	Check(ctx context.Context) error
+
+	// Backup writes a consistent copy of the database to a new file, or
+	// returns ErrBackupUnsupported.
+	Backup(dest string) error
+
+	// Close closes the database connection.
+	Close() error
+}
+
+var _ Backend = (*Store)(nil)
@@ -0,0 +1,70 @@
+package store_test
+
+import (
+	"database/sql"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/anthropics/m/internal/store"
+	"github.com/anthropics/m/internal/store/storetest"
+	"github.com/google/uuid"
+	_ "github.com/jackc/pgx/v5/stdlib"
+)
+
+func TestConformance_SQLite(t *testing.T) {
+	storetest.Run(t, func(t *testing.T) store.Backend {
+		s, err := store.New(filepath.Join(t.TempDir(), "test.db"))
+		if err != nil {
+			t.Fatalf("New: %v", err)
+		}
+		return s
+	})
+}
+
+// TestConformance_Postgres runs the suite against the PostgreSQL server at
+// M_TEST_POSTGRES_DSN, for example one started with
+//
+//	docker run --rm -p 5432:5432 -e POSTGRES_PASSWORD=m postgres:16
+//	M_TEST_POSTGRES_DSN=postgres://postgres:m@localhost:5432/postgres go test ./internal/store/
+//
+// CI runs it in the go-postgres job. Each test gets its own schema, dropped when it finishes.
+func TestConformance_Postgres(t *testing.T) {
+	dsn := os.Getenv("M_TEST_POSTGRES_DSN")
+	if dsn == "" {
+		t.Skip("M_TEST_POSTGRES_DSN not set")
+	}
+	admin, err := sql.Open("pgx", dsn)
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	t.Cleanup(func() { admin.Close() })
+
+	storetest.Run(t, func(t *testing.T) store.Backend {
+		schema := "m_test_" + strings.ReplaceAll(uuid.New().String(), "-", "")
+		if _, err := admin.Exec("CREATE SCHEMA " + schema); err != nil {
+			t.Fatalf("create schema: %v", err)
+		}
+		t.Cleanup(func() { admin.Exec("DROP SCHEMA " + schema + " CASCADE") })
+
+		s, err := store.NewPostgres(withSearchPath(dsn, schema))
+		if err != nil {
+			t.Fatalf("NewPostgres: %v", err)
+		}
+		return s
+	})
+}
+
+// withSearchPath adds a search_path parameter to a URL or key=value DSN.
+func withSearchPath(dsn, schema string) string {
+	if strings.HasPrefix(dsn, "postgres://") || strings.HasPrefix(dsn, "postgresql://") {
+		sep := "?"
+		if strings.Contains(dsn, "?") {
+			sep = "&"
+		}
+		return dsn + sep + "search_path=" + schema
+	}
+	return fmt.Sprintf("%s search_path=%s", dsn, schema)
+}
@@ -0,0 +1,259 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/anthropics/m/internal/migrate"
+	"github.com/mattn/go-sqlite3"
+)
+
+// ErrBackupUnsupported is returned by Backup for PostgreSQL, which is backed
+// up with its own tools such as pg_dump.
+var ErrBackupUnsupported = errors.New("backup is only supported for SQLite; back up PostgreSQL with pg_dump")
+
+// Backup writes a consistent copy of the database to dest, a path that must
+// not exist yet, while the store stays in use. It uses SQLite's online backup
+// API from a reader connection, so writes carry on during the copy. The
+// copy is checked for integrity before it is moved into place.
+func (s *Store) Backup(dest string) error {
+	defer s.span("Backup")()
+
+	if s.dialect == migrate.Postgres {
+		return ErrBackupUnsupported
+	}
+	return backup(s.db, dest)
+}
+
+// BackupFile backs up the SQLite database at dbPath to dest like
+// Store.Backup, without migrating it, so it can run while a server uses the
+// database.
+func BackupFile(dbPath, dest string) error {
+	if _, err := os.Stat(dbPath); err != nil {
+		return fmt.Errorf("backup: %w", err)
+	}
+	db, err := openDB(dbPath, sqliteReaderParams)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	return backup(db, dest)
+}
+
+// Restore replaces the SQLite database at dbPath with the backup at src,
+// after checking that the backup is intact and not from a newer version of
+// M. The database being replaced, with its WAL if any, is kept next to it
+// under the returned name ("" if there was none). Nothing may have the
+// database open: Restore holds an exclusive lock on it while replacing it,
+// and fails if another connection, such as a running server's, prevents
+// that.
+func Restore(src, dbPath string) (previous string, err error) {
+	if _, err := os.Stat(src); err != nil {
+		return "", fmt.Errorf("restore: %w", err)
+	}
+	if err := checkBackup(src); err != nil {
+		return "", fmt.Errorf("restore: %s: %w", src, err)
+	}
+	if _, err := os.Stat(dbPath); err == nil {
+		unlock, err := lockDatabase(dbPath)
+		if err != nil {
+			return "", fmt.Errorf("restore: %w", err)
+		}
+		defer unlock()
+	}
+
+	tmp := dbPath + ".restore"
+	if err := copyFile(src, tmp); err != nil {
+		os.Remove(tmp)
+		return "", fmt.Errorf("restore: %w", err)
+	}
+
+	if _, err := os.Stat(dbPath); err == nil {
+		previous = dbPath + ".before-restore"
+		// SQLite finds a database's WAL and shared memory by name, so they
+		// move with it.
+		for _, suffix := range []string{"", "-wal", "-shm"} {
+			os.Remove(previous + suffix)
+			if err := os.Rename(dbPath+suffix, previous+suffix); err != nil && !errors.Is(err, os.ErrNotExist) {
+				os.Remove(tmp)
+				return "", fmt.Errorf("restore: keep current database: %w", err)
+			}
+		}
+	}
+	if err := os.Rename(tmp, dbPath); err != nil {
+		return previous, fmt.Errorf("restore: %w", err)
+	}
+	return previous, nil
+}
+
+// lockDatabase takes an exclusive lock on the SQLite database at dbPath and
+// returns a function that releases it. In WAL mode an exclusive transaction
+// does not conflict with idle connections, so the lock is taken in exclusive
+// locking mode, which needs every other connection to be closed.
+func lockDatabase(dbPath string) (unlock func(), err error) {
+	db, err := sql.Open("sqlite3", "file:"+dbPath+"?_locking_mode=EXCLUSIVE&_busy_timeout=0")
+	if err != nil {
+		return nil, fmt.Errorf("open database: %w", err)
+	}
+	ctx := context.Background()
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("open database: %w", err)
+	}
+	if _, err := conn.ExecContext(ctx, "BEGIN EXCLUSIVE"); err != nil {
+		conn.Close()
+		db.Close()
+		return nil, fmt.Errorf("lock %s: %w; is the server still running?", dbPath, err)
+	}
+	return func() {
+		conn.ExecContext(ctx, "ROLLBACK")
+		conn.Close()
+		db.Close()
+	}, nil
+}
+
+// backup copies the SQLite database behind src to dest in one step of the
+// online backup API, which reads a single snapshot.
+func backup(src *sql.DB, dest string) error {
+	if _, err := os.Stat(dest); err == nil {
+		return fmt.Errorf("backup: %s already exists", dest)
+	}
+	tmp := dest + ".tmp"
+	os.Remove(tmp)
+
+	if err := copyDatabase(src, tmp); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("backup: %w", err)
+	}
+	if err := checkBackup(tmp); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("backup: check copy: %w", err)
+	}
+	if err := os.Rename(tmp, dest); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("backup: %w", err)
+	}
+	return nil
+}
+
+func copyDatabase(src *sql.DB, dest string) error {
+	ctx := context.Background()
+	srcConn, err := src.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer srcConn.Close()
+
+	destDB, err := sql.Open("sqlite3", dest)
+	if err != nil {
+		return err
+	}
+	defer destDB.Close()
+	destConn, err := destDB.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer destConn.Close()
+
+	err = destConn.Raw(func(destRaw any) error {
+		return srcConn.Raw(func(srcRaw any) error {
+			from := srcRaw.(*timedConn).SQLiteConn
+			b, err := destRaw.(*sqlite3.SQLiteConn).Backup("main", from, "main")
+			if err != nil {
+				return err
+			}
+			if _, err := b.Step(-1); err != nil {
+				b.Finish()
+				return err
+			}
+			return b.Finish()
+		})
+	})
+	if err != nil {
+		return err
+	}
+	// The copy inherits WAL mode from the source. Switch it back to a
+	// rollback journal so the backup is one self-contained file.
+	_, err = destConn.ExecContext(ctx, "PRAGMA journal_mode = DELETE")
+	return err
+}
+
+// checkBackup verifies that the SQLite database at path passes an integrity
+// check and is an M database this build can open.
+func checkBackup(path string) error {
+	// immutable keeps SQLite from creating a WAL or shared memory file
+	// next to the backup.
+	db, err := sql.Open("sqlite3", "file:"+path+"?mode=ro&immutable=1")
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	rows, err := db.Query("PRAGMA integrity_check")
+	if err != nil {
+		return fmt.Errorf("integrity check: %w", err)
+	}
+	var problems []string
+	for rows.Next() {
+		var line string
+		if err := rows.Scan(&line); err != nil {
+			rows.Close()
+			return fmt.Errorf("integrity check: %w", err)
+		}
+		if line != "ok" {
+			problems = append(problems, line)
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("integrity check: %w", err)
+	}
+	if len(problems) > 0 {
+		return fmt.Errorf("integrity check failed: %s", strings.Join(problems, "; "))
+	}
+
+	var n int
+	if err := db.QueryRow("SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = 'runs'").Scan(&n); err != nil {
+		return err
+	}
+	if n == 0 {
+		return errors.New("not an M database")
+	}
+	version, err := migrate.Version(db, migrate.SQLite)
+	if err != nil {
+		return err
+	}
+	if version > len(migrations) {
+		return fmt.Errorf("schema version %d is newer than this build supports (%d)", version, len(migrations))
+	}
+	return nil
+}
+
+// copyFile copies src to dest and syncs dest to disk.
+func copyFile(src, dest string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.OpenFile(dest, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	if err := out.Sync(); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
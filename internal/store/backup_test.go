@@ -0,0 +1,119 @@
+package store
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestBackupAndRestore(t *testing.T) {
+	dir := t.TempDir()
+	dbPath := filepath.Join(dir, "m.db")
+	s, err := New(dbPath)
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	kept, _ := s.CreateRepo("kept", nil)
+
+	backupPath := filepath.Join(dir, "backup.db")
+	if err := s.Backup(backupPath); err != nil {
+		t.Fatalf("Backup: %v", err)
+	}
+	if err := s.Backup(backupPath); err == nil || !strings.Contains(err.Error(), "already exists") {
+		t.Errorf("Backup over an existing file = %v, want error", err)
+	}
+	// A second process can back up the database while the store uses it.
+	if err := BackupFile(dbPath, filepath.Join(dir, "backup2.db")); err != nil {
+		t.Fatalf("BackupFile: %v", err)
+	}
+	s.CreateRepo("after-backup", nil)
+
+	// The database cannot be replaced while a store has it open.
+	if _, err := Restore(backupPath, dbPath); err == nil || !strings.Contains(err.Error(), "lock") {
+		t.Errorf("Restore while open = %v, want a lock error", err)
+	}
+	if _, err := os.Stat(dbPath + ".before-restore"); !os.IsNotExist(err) {
+		t.Errorf("failed restore moved the database aside: %v", err)
+	}
+	s.Close()
+
+	entries, _ := os.ReadDir(dir)
+	for _, e := range entries {
+		if strings.HasPrefix(e.Name(), "backup") && e.Name() != "backup.db" && e.Name() != "backup2.db" {
+			t.Errorf("backup left %s behind", e.Name())
+		}
+	}
+
+	previous, err := Restore(backupPath, dbPath)
+	if err != nil {
+		t.Fatalf("Restore: %v", err)
+	}
+	if previous != dbPath+".before-restore" {
+		t.Errorf("previous = %q", previous)
+	}
+
+	s, err = New(dbPath)
+	if err != nil {
+		t.Fatalf("New after restore: %v", err)
+	}
+	defer s.Close()
+	repos, err := s.ListRepos()
+	if err != nil || len(repos) != 1 || repos[0].ID != kept.ID {
+		t.Errorf("repos after restore = %v, %v; want only %q", repos, err, kept.Name)
+	}
+
+	old, err := New(previous)
+	if err != nil {
+		t.Fatalf("open previous database: %v", err)
+	}
+	defer old.Close()
+	if repos, _ := old.ListRepos(); len(repos) != 2 {
+		t.Errorf("previous database has %d repos, want 2", len(repos))
+	}
+}
+
+func TestRestore_RejectsBadBackups(t *testing.T) {
+	dir := t.TempDir()
+	dbPath := filepath.Join(dir, "m.db")
+	s, err := New(dbPath)
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	s.Close()
+
+	garbage := filepath.Join(dir, "garbage.db")
+	os.WriteFile(garbage, []byte(strings.Repeat("not a database ", 100)), 0644)
+
+	newer := filepath.Join(dir, "newer.db")
+	if err := BackupFile(dbPath, newer); err != nil {
+		t.Fatalf("BackupFile: %v", err)
+	}
+	db, err := openDB(newer, sqliteWriterParams)
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	if _, err := db.Exec("INSERT INTO schema_migrations (version, name, applied_at) VALUES (999, 'future', 0)"); err != nil {
+		t.Fatalf("insert: %v", err)
+	}
+	db.Close()
+
+	other := filepath.Join(dir, "other.db")
+	db, _ = openDB(other, sqliteWriterParams)
+	db.Exec("CREATE TABLE notes (text TEXT)")
+	db.Close()
+
+	for name, src := range map[string]string{
+		"missing": filepath.Join(dir, "missing.db"),
+		"garbage": garbage,
+		"newer":   newer,
+		"not M":   other,
+	} {
+		if _, err := Restore(src, dbPath); err == nil {
+			t.Errorf("%s: Restore succeeded", name)
+		}
+	}
+	if _, err := os.Stat(dbPath + ".before-restore"); !os.IsNotExist(err) {
+		t.Error("a rejected restore moved the database")
+	}
+}
@@ -22,15 +22,15 @@ type Device struct {
 
 // CreateDevice registers a new device token.
 func (s *Store) CreateDevice(token string, platform Platform) (*Device, error) {
-	s.mu.Lock()
-	defer s.mu.Unlock()
+	defer s.span("CreateDevice")()
 
 	now := time.Now().Unix()
 
-	// Use INSERT OR REPLACE to handle re-registration
-	_, err := s.db.Exec(
-		`INSERT OR REPLACE INTO devices (token, platform, created_at)
-		 VALUES (?, ?, ?)`,
+	// Upsert to handle re-registration
+	_, err := s.w.Exec(
+		`INSERT INTO devices (token, platform, created_at)
+		 VALUES (?, ?, ?)
+		 ON CONFLICT(token) DO UPDATE SET platform = excluded.platform, created_at = excluded.created_at`,
 		token, string(platform), now,
 	)
 	if err != nil {
@@ -46,8 +46,7 @@ func (s *Store) CreateDevice(token string, platform Platform) (*Device, error) {
 
 // GetDevice retrieves a device by token.
 func (s *Store) GetDevice(token string) (*Device, error) {
-	s.mu.RLock()
-	defer s.mu.RUnlock()
+	defer s.span("GetDevice")()
 
 	var device Device
 	var platform string
@@ -72,8 +71,7 @@ func (s *Store) GetDevice(token string) (*Device, error) {
 
 // ListDevices retrieves all registered devices.
 func (s *Store) ListDevices() ([]*Device, error) {
-	s.mu.RLock()
-	defer s.mu.RUnlock()
+	defer s.span("ListDevices")()
 
 	rows, err := s.db.Query("SELECT token, platform, created_at FROM devices ORDER BY created_at DESC")
 	if err != nil {
@@ -99,8 +97,7 @@ func (s *Store) ListDevices() ([]*Device, error) {
 
 // ListDevicesByPlatform retrieves devices for a specific platform.
 func (s *Store) ListDevicesByPlatform(platform Platform) ([]*Device, error) {
-	s.mu.RLock()
-	defer s.mu.RUnlock()
+	defer s.span("ListDevicesByPlatform")()
 
 	rows, err := s.db.Query(
 		"SELECT token, platform, created_at FROM devices WHERE platform = ? ORDER BY created_at DESC",
@@ -129,10 +126,9 @@ func (s *Store) ListDevicesByPlatform(platform Platform) ([]*Device, error) {
 
 // DeleteDevice removes a device by token.
 func (s *Store) DeleteDevice(token string) error {
-	s.mu.Lock()
-	defer s.mu.Unlock()
+	defer s.span("DeleteDevice")()
 
-	result, err := s.db.Exec("DELETE FROM devices WHERE token = ?", token)
+	result, err := s.w.Exec("DELETE FROM devices WHERE token = ?", token)
 	if err != nil {
 		return fmt.Errorf("delete device: %w", err)
 	}
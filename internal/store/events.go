@@ -3,6 +3,7 @@ package store
 import (
 	"database/sql"
 	"fmt"
+	"strings"
 	"time"
 
 	"github.com/google/uuid"
@@ -18,52 +19,28 @@ type Event struct {
 	CreatedAt time.Time
 }
 
-// CreateEvent creates a new event with the next sequence number.
+// CreateEvent creates a new event with the next sequence number. Events of
+// different runs are written concurrently and committed in batches; see
+// eventWriter.
 func (s *Store) CreateEvent(runID, eventType string, data *string) (*Event, error) {
-	s.mu.Lock()
-	defer s.mu.Unlock()
+	defer s.span("CreateEvent")()
 
-	// Get next sequence number
-	var maxSeq sql.NullInt64
-	err := s.db.QueryRow(
-		"SELECT MAX(seq) FROM events WHERE run_id = ?",
-		runID,
-	).Scan(&maxSeq)
-	if err != nil {
-		return nil, fmt.Errorf("get max seq: %w", err)
-	}
-
-	nextSeq := int64(1)
-	if maxSeq.Valid {
-		nextSeq = maxSeq.Int64 + 1
-	}
-
-	id := uuid.New().String()
-	now := time.Now().Unix()
-
-	_, err = s.db.Exec(
-		`INSERT INTO events (id, run_id, seq, type, data, created_at)
-		 VALUES (?, ?, ?, ?, ?, ?)`,
-		id, runID, nextSeq, eventType, data, now,
-	)
-	if err != nil {
-		return nil, fmt.Errorf("insert event: %w", err)
-	}
-
-	return &Event{
-		ID:        id,
+	event := &Event{
+		ID:        uuid.New().String(),
 		RunID:     runID,
-		Seq:       nextSeq,
 		Type:      eventType,
 		Data:      data,
-		CreatedAt: time.Unix(now, 0),
-	}, nil
+		CreatedAt: time.Unix(time.Now().Unix(), 0),
+	}
+	if err := s.events.write(event); err != nil {
+		return nil, err
+	}
+	return event, nil
 }
 
 // GetEvent retrieves an event by ID.
 func (s *Store) GetEvent(id string) (*Event, error) {
-	s.mu.RLock()
-	defer s.mu.RUnlock()
+	defer s.span("GetEvent")()
 
 	var event Event
 	var createdAt int64
@@ -87,8 +64,7 @@ func (s *Store) GetEvent(id string) (*Event, error) {
 
 // ListEventsByRun retrieves all events for a run, ordered by sequence.
 func (s *Store) ListEventsByRun(runID string) ([]*Event, error) {
-	s.mu.RLock()
-	defer s.mu.RUnlock()
+	defer s.span("ListEventsByRun")()
 
 	rows, err := s.db.Query(
 		`SELECT id, run_id, seq, type, data, created_at
@@ -100,14 +76,72 @@ func (s *Store) ListEventsByRun(runID string) ([]*Event, error) {
 	}
 	defer rows.Close()
 
-	return scanEvents(rows)
+	events, err := scanEvents(rows)
+	if err != nil {
+		return nil, err
+	}
+	return s.withArchived(runID, events, func(*Event) bool { return true })
+}
+
+// EventFilter selects events of one run. Zero values match everything.
+type EventFilter struct {
+	RunID string
+	Types []string // Any of these event types
+	Page           // Sort by seq, oldest first by default
+}
+
+var eventSort = listSort{
+	fields: map[string]sortField{
+		"seq": {column: "seq"},
+	},
+	defaultSort: "seq",
+	idColumn:    "id",
+}
+
+// ListEventsPage retrieves one page of a run's events matching the filter,
+// and the cursor of the next page.
+func (s *Store) ListEventsPage(filter EventFilter) ([]*Event, string, error) {
+	defer s.span("ListEventsPage")()
+
+	query := `SELECT id, run_id, seq, type, data, created_at
+		 FROM events WHERE run_id = ?`
+	args := []any{filter.RunID}
+
+	if len(filter.Types) > 0 {
+		query += " AND type IN (?" + strings.Repeat(", ?", len(filter.Types)-1) + ")"
+		for _, t := range filter.Types {
+			args = append(args, t)
+		}
+	}
+
+	query, args, pq, err := eventSort.apply(filter.Page, query, args)
+	if err != nil {
+		return nil, "", err
+	}
+
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, "", fmt.Errorf("query events: %w", err)
+	}
+	defer rows.Close()
+
+	events, err := scanEvents(rows)
+	if err != nil {
+		return nil, "", err
+	}
+	if events, err = s.pageArchived(filter, pq, events); err != nil {
+		return nil, "", err
+	}
+	events, next := finish(events, pq, func(e *Event, _ string) (any, string) {
+		return e.Seq, e.ID
+	})
+	return events, next, nil
 }
 
 // ListEventsByRunSince retrieves events for a run starting from a sequence number.
 // Used for replay and streaming.
 func (s *Store) ListEventsByRunSince(runID string, sinceSeq int64) ([]*Event, error) {
-	s.mu.RLock()
-	defer s.mu.RUnlock()
+	defer s.span("ListEventsByRunSince")()
 
 	rows, err := s.db.Query(
 		`SELECT id, run_id, seq, type, data, created_at
@@ -119,13 +153,16 @@ func (s *Store) ListEventsByRunSince(runID string, sinceSeq int64) ([]*Event, er
 	}
 	defer rows.Close()
 
-	return scanEvents(rows)
+	events, err := scanEvents(rows)
+	if err != nil {
+		return nil, err
+	}
+	return s.withArchived(runID, events, func(e *Event) bool { return e.Seq > sinceSeq })
 }
 
 // GetEventByRunSeq retrieves a specific event by run ID and sequence number.
 func (s *Store) GetEventByRunSeq(runID string, seq int64) (*Event, error) {
-	s.mu.RLock()
-	defer s.mu.RUnlock()
+	defer s.span("GetEventByRunSeq")()
 
 	var event Event
 	var createdAt int64
@@ -137,7 +174,7 @@ func (s *Store) GetEventByRunSeq(runID string, seq int64) (*Event, error) {
 	).Scan(&event.ID, &event.RunID, &event.Seq, &event.Type, &event.Data, &createdAt)
 
 	if err == sql.ErrNoRows {
-		return nil, ErrNotFound
+		return s.getArchivedEvent(runID, seq)
 	}
 	if err != nil {
 		return nil, fmt.Errorf("query event by seq: %w", err)
@@ -147,16 +184,20 @@ func (s *Store) GetEventByRunSeq(runID string, seq int64) (*Event, error) {
 	return &event, nil
 }
 
+// latestSeqQuery selects the latest seq of a run, including archived output,
+// or NULL if the run has no events. It takes the run ID twice.
+const latestSeqQuery = `SELECT MAX(seq) FROM (
+	SELECT MAX(seq) AS seq FROM events WHERE run_id = ?
+	UNION ALL
+	SELECT last_seq FROM event_archives WHERE run_id = ?
+) AS latest`
+
 // GetLatestEventSeq returns the latest sequence number for a run, or 0 if no events.
 func (s *Store) GetLatestEventSeq(runID string) (int64, error) {
-	s.mu.RLock()
-	defer s.mu.RUnlock()
+	defer s.span("GetLatestEventSeq")()
 
 	var maxSeq sql.NullInt64
-	err := s.db.QueryRow(
-		"SELECT MAX(seq) FROM events WHERE run_id = ?",
-		runID,
-	).Scan(&maxSeq)
+	err := s.db.QueryRow(latestSeqQuery, runID, runID).Scan(&maxSeq)
 	if err != nil {
 		return 0, fmt.Errorf("get max seq: %w", err)
 	}
@@ -167,15 +208,23 @@ func (s *Store) GetLatestEventSeq(runID string) (int64, error) {
 	return maxSeq.Int64, nil
 }
 
-// DeleteEventsByRun deletes all events for a run.
+// DeleteEventsByRun deletes all events for a run, including archived output.
 func (s *Store) DeleteEventsByRun(runID string) error {
-	s.mu.Lock()
-	defer s.mu.Unlock()
+	defer s.span("DeleteEventsByRun")()
 
-	_, err := s.db.Exec("DELETE FROM events WHERE run_id = ?", runID)
+	err := s.writeTx(func(tx *sql.Tx) error {
+		if _, err := tx.Exec("DELETE FROM events WHERE run_id = ?", runID); err != nil {
+			return fmt.Errorf("delete events: %w", err)
+		}
+		if _, err := tx.Exec("DELETE FROM event_archives WHERE run_id = ?", runID); err != nil {
+			return fmt.Errorf("delete event archive: %w", err)
+		}
+		return nil
+	})
 	if err != nil {
-		return fmt.Errorf("delete events: %w", err)
+		return err
 	}
+	s.events.forget(runID)
 
 	return nil
 }
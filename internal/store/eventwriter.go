@@ -0,0 +1,224 @@
+package store
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"runtime"
+	"sync"
+)
+
+// maxEventBatch caps the number of events committed in one transaction.
+const maxEventBatch = 256
+
+// errStoreClosed is returned by CreateEvent after Close.
+var errStoreClosed = errors.New("store is closed")
+
+// eventWriter assigns event sequence numbers per run and inserts events
+// through the writer connection. Inserts queued while a transaction commits
+// are committed together in the next one, so N chatty runs cost about one
+// commit per batch instead of one each.
+//
+// A run's sequence is held from allocation until its insert commits, which
+// keeps each run's events committed in seq order: a reader that has seen seq
+// n never later finds a smaller seq appear. Runs do not wait on each other.
+type eventWriter struct {
+	w      *sql.DB
+	insert *sql.Stmt
+	maxSeq *sql.Stmt
+
+	queue chan *pendingEvent
+	done  chan struct{}
+
+	mu      sync.Mutex // Guards seqs
+	seqs    map[string]*runSeq
+	closeMu sync.RWMutex // Held for reading while sending on queue
+	closed  bool
+}
+
+// runSeq is the sequence state of one run.
+type runSeq struct {
+	mu        sync.Mutex
+	next      int64 // Next seq to assign; 0 until loaded from the database
+	forgotten bool  // Removed from eventWriter.seqs; look the run up again
+}
+
+// pendingEvent is an event waiting in the queue for its batch to commit.
+type pendingEvent struct {
+	event *Event
+	err   chan error
+}
+
+// newEventWriter prepares the event statements on w and starts the batching
+// goroutine.
+func newEventWriter(w *sql.DB) (*eventWriter, error) {
+	insert, err := w.Prepare(
+		`INSERT INTO events (id, run_id, seq, type, data, created_at)
+		 VALUES (?, ?, ?, ?, ?, ?)`,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("prepare insert event: %w", err)
+	}
+	maxSeq, err := w.Prepare(latestSeqQuery)
+	if err != nil {
+		insert.Close()
+		return nil, fmt.Errorf("prepare max seq: %w", err)
+	}
+
+	ew := &eventWriter{
+		w:      w,
+		insert: insert,
+		maxSeq: maxSeq,
+		queue:  make(chan *pendingEvent, maxEventBatch),
+		done:   make(chan struct{}),
+		seqs:   make(map[string]*runSeq),
+	}
+	go ew.run()
+	return ew, nil
+}
+
+// write assigns event the next seq of its run and returns once it has been
+// committed.
+func (ew *eventWriter) write(event *Event) error {
+	seq := ew.lock(event.RunID)
+	defer seq.mu.Unlock()
+
+	if seq.next == 0 {
+		var maxSeq sql.NullInt64
+		if err := ew.maxSeq.QueryRow(event.RunID, event.RunID).Scan(&maxSeq); err != nil {
+			return fmt.Errorf("get max seq: %w", err)
+		}
+		seq.next = maxSeq.Int64 + 1
+	}
+	event.Seq = seq.next
+
+	if err := ew.enqueue(event); err != nil {
+		seq.next = 0 // Reload, in case another process wrote to the run
+		return err
+	}
+	seq.next++
+	return nil
+}
+
+// lock returns the locked sequence state of runID.
+func (ew *eventWriter) lock(runID string) *runSeq {
+	for {
+		ew.mu.Lock()
+		seq, ok := ew.seqs[runID]
+		if !ok {
+			seq = &runSeq{}
+			ew.seqs[runID] = seq
+		}
+		ew.mu.Unlock()
+
+		seq.mu.Lock()
+		if !seq.forgotten {
+			return seq
+		}
+		seq.mu.Unlock()
+	}
+}
+
+// forget drops the cached sequence of runID, after its events are deleted
+// or it finishes. It waits for an insert in flight for the run.
+func (ew *eventWriter) forget(runID string) {
+	ew.mu.Lock()
+	defer ew.mu.Unlock()
+
+	if seq, ok := ew.seqs[runID]; ok {
+		seq.mu.Lock()
+		seq.forgotten = true
+		seq.mu.Unlock()
+		delete(ew.seqs, runID)
+	}
+}
+
+// enqueue queues event for the next batch and waits for it to commit.
+func (ew *eventWriter) enqueue(event *Event) error {
+	p := &pendingEvent{event: event, err: make(chan error, 1)}
+
+	ew.closeMu.RLock()
+	if ew.closed {
+		ew.closeMu.RUnlock()
+		return errStoreClosed
+	}
+	ew.queue <- p
+	ew.closeMu.RUnlock()
+
+	return <-p.err
+}
+
+// run commits queued events until the queue is closed.
+func (ew *eventWriter) run() {
+	defer close(ew.done)
+
+	batch := make([]*pendingEvent, 0, maxEventBatch)
+	for p := range ew.queue {
+		batch = append(batch[:0], p)
+		// Let runs that are ready to write queue up behind the first event;
+		// otherwise, with few CPUs, each batch holds a single event.
+		runtime.Gosched()
+	fill:
+		for len(batch) < maxEventBatch {
+			select {
+			case p, ok := <-ew.queue:
+				if !ok {
+					break fill
+				}
+				batch = append(batch, p)
+			default:
+				break fill
+			}
+		}
+		ew.flush(batch)
+	}
+}
+
+// flush inserts batch in one transaction. If that fails, each event is
+// retried on its own so that one bad event does not fail the others.
+func (ew *eventWriter) flush(batch []*pendingEvent) {
+	err := ew.insertTx(batch)
+	if err == nil || len(batch) == 1 {
+		for _, p := range batch {
+			p.err <- err
+		}
+		return
+	}
+	for _, p := range batch {
+		p.err <- ew.insertTx([]*pendingEvent{p})
+	}
+}
+
+func (ew *eventWriter) insertTx(batch []*pendingEvent) error {
+	tx, err := ew.w.Begin()
+	if err != nil {
+		return fmt.Errorf("begin transaction: %w", err)
+	}
+	stmt := tx.Stmt(ew.insert)
+	for _, p := range batch {
+		e := p.event
+		if _, err := stmt.Exec(e.ID, e.RunID, e.Seq, e.Type, e.Data, e.CreatedAt.Unix()); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("insert event: %w", err)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("commit events: %w", err)
+	}
+	return nil
+}
+
+// close flushes queued events, stops the batching goroutine and closes the
+// prepared statements.
+func (ew *eventWriter) close() {
+	ew.closeMu.Lock()
+	if !ew.closed {
+		ew.closed = true
+		close(ew.queue)
+	}
+	ew.closeMu.Unlock()
+
+	<-ew.done
+	ew.insert.Close()
+	ew.maxSeq.Close()
+}
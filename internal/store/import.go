@@ -0,0 +1,72 @@
+package store
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ErrImportActiveRun is returned by ImportRun for a run in an active state,
+// which no agent on this server could continue.
+var ErrImportActiveRun = errors.New("imported runs must be finished")
+
+// ImportRun inserts a run copied from elsewhere together with its events and
+// interactions, in one transaction. Unlike CreateRun, CreateEvent and
+// CreateInteraction it keeps the IDs, states, seqs and timestamps it is
+// given, so the caller assigns IDs that are new to this database. The run's
+// repo must exist.
+func (s *Store) ImportRun(run *Run, events []*Event, interactions []*Interaction) error {
+	defer s.span("ImportRun")()
+
+	if run.IsActive() {
+		return ErrImportActiveRun
+	}
+
+	return s.writeTx(func(tx *sql.Tx) error {
+		_, err := tx.Exec(
+			`INSERT INTO runs (`+runColumns+`)
+			 VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+			run.ID, run.RepoID, run.Prompt, string(run.State), run.WorkspacePath,
+			run.CreatedAt.Unix(), run.UpdatedAt.Unix(), unixOrNil(run.StartedAt), unixOrNil(run.FinishedAt),
+			run.ExitCode, run.Error, run.Agent, run.Model, run.BaseSHA, run.FinalSHA,
+			run.Usage.InputTokens, run.Usage.OutputTokens, run.Usage.CostUSD,
+		)
+		if err != nil {
+			return fmt.Errorf("insert run: %w", err)
+		}
+
+		for _, e := range events {
+			_, err := tx.Exec(
+				`INSERT INTO events (id, run_id, seq, type, data, created_at)
+				 VALUES (?, ?, ?, ?, ?, ?)`,
+				e.ID, run.ID, e.Seq, e.Type, e.Data, e.CreatedAt.Unix(),
+			)
+			if err != nil {
+				return fmt.Errorf("insert event %d: %w", e.Seq, err)
+			}
+		}
+
+		for _, i := range interactions {
+			_, err := tx.Exec(
+				`INSERT INTO interactions (id, request_id, run_id, type, tool, payload, state, decision, message, response, updated_input, created_at, resolved_at)
+				 VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+				i.ID, i.RequestID, run.ID, string(i.Type), i.Tool, i.Payload, string(i.State),
+				i.Decision, i.Message, i.Response, i.UpdatedInput, i.CreatedAt.Unix(), unixOrNil(i.ResolvedAt),
+			)
+			if err != nil {
+				return fmt.Errorf("insert interaction: %w", err)
+			}
+		}
+		return nil
+	})
+}
+
+// unixOrNil returns t as Unix seconds, or nil for a NULL column.
+func unixOrNil(t *time.Time) *int64 {
+	if t == nil {
+		return nil
+	}
+	u := t.Unix()
+	return &u
+}
@@ -35,49 +35,65 @@ const (
 
 // Interaction represents an interaction request from a hook.
 type Interaction struct {
-	ID         string
-	RequestID  string // For idempotency
-	RunID      string
-	Type       InteractionType
-	Tool       string
-	Payload    *string
-	State      InteractionState
-	Decision   *string
-	Message    *string // Rejection message (for block)
-	Response   *string // User response (for input)
-	CreatedAt  time.Time
-	ResolvedAt *time.Time
+	ID        string
+	RequestID string // For idempotency
+	RunID     string
+	Type      InteractionType
+	Tool      string
+	Payload   *string
+	State     InteractionState
+	Decision  *string
+	Message   *string // Rejection message (for block)
+	Response  *string // User response (for input)
+	// UpdatedInput is the tool input as modified by the reviewer when an
+	// approval is allowed with changes. Payload keeps the original input.
+	UpdatedInput *string
+	CreatedAt    time.Time
+	ResolvedAt   *time.Time
 }
 
 // ErrDuplicateRequest is returned when a duplicate request_id is detected.
 var ErrDuplicateRequest = errors.New("duplicate request")
 
+// ErrNotPending is returned when resolving an interaction that is already resolved.
+var ErrNotPending = errors.New("interaction is not pending")
+
 // CreateInteraction creates a new pending interaction.
 // Returns the existing interaction if request_id already exists (idempotency).
 func (s *Store) CreateInteraction(requestID, runID string, interactionType InteractionType, tool string, payload *string) (*Interaction, error) {
-	s.mu.Lock()
-	defer s.mu.Unlock()
-
-	// Check for existing interaction with same request_id (idempotency)
-	existing, err := s.getInteractionByRequestIDLocked(requestID)
-	if err == nil {
-		// Found existing interaction - return it
-		return existing, ErrDuplicateRequest
-	}
-	if err != ErrNotFound {
-		return nil, fmt.Errorf("check existing interaction: %w", err)
-	}
+	defer s.span("CreateInteraction")()
 
 	id := uuid.New().String()
 	now := time.Now().Unix()
 
-	_, err = s.db.Exec(
-		`INSERT INTO interactions (id, request_id, run_id, type, tool, payload, state, created_at)
-		 VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
-		id, requestID, runID, string(interactionType), tool, payload, string(InteractionStatePending), now,
-	)
+	var existing *Interaction
+	err := s.writeTx(func(tx *sql.Tx) error {
+		// Check for existing interaction with same request_id (idempotency)
+		var err error
+		existing, err = s.getInteractionByRequestID(tx, requestID)
+		if err == nil {
+			return ErrDuplicateRequest
+		}
+		if err != ErrNotFound {
+			return fmt.Errorf("check existing interaction: %w", err)
+		}
+
+		_, err = tx.Exec(
+			`INSERT INTO interactions (id, request_id, run_id, type, tool, payload, state, created_at)
+			 VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+			id, requestID, runID, string(interactionType), tool, payload, string(InteractionStatePending), now,
+		)
+		if err != nil {
+			return fmt.Errorf("insert interaction: %w", err)
+		}
+		return nil
+	})
+	if err == ErrDuplicateRequest {
+		// Found existing interaction - return it
+		return existing, err
+	}
 	if err != nil {
-		return nil, fmt.Errorf("insert interaction: %w", err)
+		return nil, err
 	}
 
 	return &Interaction{
@@ -94,29 +110,27 @@ func (s *Store) CreateInteraction(requestID, runID string, interactionType Inter
 
 // GetInteraction retrieves an interaction by ID.
 func (s *Store) GetInteraction(id string) (*Interaction, error) {
-	s.mu.RLock()
-	defer s.mu.RUnlock()
-	return s.getInteractionByIDLocked(id)
+	defer s.span("GetInteraction")()
+	return s.getInteractionByID(s.db, id)
 }
 
 // GetInteractionByRequestID retrieves an interaction by request_id.
 func (s *Store) GetInteractionByRequestID(requestID string) (*Interaction, error) {
-	s.mu.RLock()
-	defer s.mu.RUnlock()
-	return s.getInteractionByRequestIDLocked(requestID)
+	defer s.span("GetInteractionByRequestID")()
+	return s.getInteractionByRequestID(s.db, requestID)
 }
 
-func (s *Store) getInteractionByIDLocked(id string) (*Interaction, error) {
-	return s.scanInteraction(s.db.QueryRow(
-		`SELECT id, request_id, run_id, type, tool, payload, state, decision, message, response, created_at, resolved_at
+func (s *Store) getInteractionByID(q queryer, id string) (*Interaction, error) {
+	return s.scanInteraction(q.QueryRow(
+		`SELECT id, request_id, run_id, type, tool, payload, state, decision, message, response, updated_input, created_at, resolved_at
 		 FROM interactions WHERE id = ?`,
 		id,
 	))
 }
 
-func (s *Store) getInteractionByRequestIDLocked(requestID string) (*Interaction, error) {
-	return s.scanInteraction(s.db.QueryRow(
-		`SELECT id, request_id, run_id, type, tool, payload, state, decision, message, response, created_at, resolved_at
+func (s *Store) getInteractionByRequestID(q queryer, requestID string) (*Interaction, error) {
+	return s.scanInteraction(q.QueryRow(
+		`SELECT id, request_id, run_id, type, tool, payload, state, decision, message, response, updated_input, created_at, resolved_at
 		 FROM interactions WHERE request_id = ?`,
 		requestID,
 	))
@@ -132,7 +146,7 @@ func (s *Store) scanInteraction(row *sql.Row) (*Interaction, error) {
 		&interaction.ID, &interaction.RequestID, &interaction.RunID,
 		&interactionType, &interaction.Tool, &interaction.Payload,
 		&state, &interaction.Decision, &interaction.Message, &interaction.Response,
-		&createdAt, &resolvedAt,
+		&interaction.UpdatedInput, &createdAt, &resolvedAt,
 	)
 	if err == sql.ErrNoRows {
 		return nil, ErrNotFound
@@ -154,11 +168,10 @@ func (s *Store) scanInteraction(row *sql.Row) (*Interaction, error) {
 
 // ListPendingInteractions retrieves all pending interactions.
 func (s *Store) ListPendingInteractions() ([]*Interaction, error) {
-	s.mu.RLock()
-	defer s.mu.RUnlock()
+	defer s.span("ListPendingInteractions")()
 
 	rows, err := s.db.Query(
-		`SELECT id, request_id, run_id, type, tool, payload, state, decision, message, response, created_at, resolved_at
+		`SELECT id, request_id, run_id, type, tool, payload, state, decision, message, response, updated_input, created_at, resolved_at
 		 FROM interactions WHERE state = ? ORDER BY created_at ASC`,
 		string(InteractionStatePending),
 	)
@@ -172,11 +185,10 @@ func (s *Store) ListPendingInteractions() ([]*Interaction, error) {
 
 // ListPendingInteractionsByRun retrieves pending interactions for a specific run.
 func (s *Store) ListPendingInteractionsByRun(runID string) ([]*Interaction, error) {
-	s.mu.RLock()
-	defer s.mu.RUnlock()
+	defer s.span("ListPendingInteractionsByRun")()
 
 	rows, err := s.db.Query(
-		`SELECT id, request_id, run_id, type, tool, payload, state, decision, message, response, created_at, resolved_at
+		`SELECT id, request_id, run_id, type, tool, payload, state, decision, message, response, updated_input, created_at, resolved_at
 		 FROM interactions WHERE run_id = ? AND state = ? ORDER BY created_at ASC`,
 		runID, string(InteractionStatePending),
 	)
@@ -190,15 +202,21 @@ func (s *Store) ListPendingInteractionsByRun(runID string) ([]*Interaction, erro
 
 // ResolveInteraction resolves an interaction with a decision.
 func (s *Store) ResolveInteraction(id string, decision InteractionDecision, message, response *string) error {
-	s.mu.Lock()
-	defer s.mu.Unlock()
+	defer s.span("ResolveInteraction")()
+	return s.ResolveInteractionWithInput(id, decision, message, response, nil)
+}
+
+// ResolveInteractionWithInput resolves an interaction with a decision and an
+// optional replacement for the tool input. The original payload is preserved.
+func (s *Store) ResolveInteractionWithInput(id string, decision InteractionDecision, message, response, updatedInput *string) error {
+	defer s.span("ResolveInteractionWithInput")()
 
 	now := time.Now().Unix()
 
-	result, err := s.db.Exec(
-		`UPDATE interactions SET state = ?, decision = ?, message = ?, response = ?, resolved_at = ?
+	result, err := s.w.Exec(
+		`UPDATE interactions SET state = ?, decision = ?, message = ?, response = ?, updated_input = ?, resolved_at = ?
 		 WHERE id = ? AND state = ?`,
-		string(InteractionStateResolved), string(decision), message, response, now,
+		string(InteractionStateResolved), string(decision), message, response, updatedInput, now,
 		id, string(InteractionStatePending),
 	)
 	if err != nil {
@@ -216,12 +234,82 @@ func (s *Store) ResolveInteraction(id string, decision InteractionDecision, mess
 	return nil
 }
 
+// ListPendingInteractionsTx retrieves pending interactions of the given type within
+// a transaction started by InTx. Empty runID or tool match any value.
+func (s *Store) ListPendingInteractionsTx(tx *sql.Tx, interactionType InteractionType, runID, tool string) ([]*Interaction, error) {
+	defer s.span("ListPendingInteractionsTx")()
+	query := `SELECT id, request_id, run_id, type, tool, payload, state, decision, message, response, updated_input, created_at, resolved_at
+		 FROM interactions WHERE state = ? AND type = ?`
+	args := []any{string(InteractionStatePending), string(interactionType)}
+
+	if runID != "" {
+		query += " AND run_id = ?"
+		args = append(args, runID)
+	}
+	if tool != "" {
+		query += " AND tool = ?"
+		args = append(args, tool)
+	}
+
+	query += " ORDER BY created_at ASC"
+
+	rows, err := tx.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("query pending interactions: %w", err)
+	}
+	defer rows.Close()
+
+	return scanInteractions(rows)
+}
+
+// GetInteractionTx retrieves an interaction by ID within a transaction started by InTx.
+func (s *Store) GetInteractionTx(tx *sql.Tx, id string) (*Interaction, error) {
+	defer s.span("GetInteractionTx")()
+	return s.scanInteraction(tx.QueryRow(
+		`SELECT id, request_id, run_id, type, tool, payload, state, decision, message, response, updated_input, created_at, resolved_at
+		 FROM interactions WHERE id = ?`,
+		id,
+	))
+}
+
+// ResolveInteractionTx resolves an interaction within a transaction started by
+// InTx and returns the resolved interaction. Returns ErrNotFound if the
+// interaction does not exist and ErrNotPending if it was already resolved.
+func (s *Store) ResolveInteractionTx(tx *sql.Tx, id string, decision InteractionDecision, message, response *string) (*Interaction, error) {
+	defer s.span("ResolveInteractionTx")()
+	interaction, err := s.GetInteractionTx(tx, id)
+	if err != nil {
+		return nil, err
+	}
+	if interaction.State != InteractionStatePending {
+		return nil, ErrNotPending
+	}
+
+	now := time.Now().Unix()
+
+	if _, err := tx.Exec(
+		`UPDATE interactions SET state = ?, decision = ?, message = ?, response = ?, resolved_at = ?
+		 WHERE id = ?`,
+		string(InteractionStateResolved), string(decision), message, response, now, id,
+	); err != nil {
+		return nil, fmt.Errorf("resolve interaction: %w", err)
+	}
+
+	d := string(decision)
+	resolvedAt := time.Unix(now, 0)
+	interaction.State = InteractionStateResolved
+	interaction.Decision = &d
+	interaction.Message = message
+	interaction.Response = response
+	interaction.ResolvedAt = &resolvedAt
+	return interaction, nil
+}
+
 // ListInteractions retrieves all interactions with optional filters.
 func (s *Store) ListInteractions(runID string, state *InteractionState) ([]*Interaction, error) {
-	s.mu.RLock()
-	defer s.mu.RUnlock()
+	defer s.span("ListInteractions")()
 
-	query := `SELECT id, request_id, run_id, type, tool, payload, state, decision, message, response, created_at, resolved_at
+	query := `SELECT id, request_id, run_id, type, tool, payload, state, decision, message, response, updated_input, created_at, resolved_at
 		 FROM interactions WHERE 1=1`
 	args := []any{}
 
@@ -245,12 +333,76 @@ func (s *Store) ListInteractions(runID string, state *InteractionState) ([]*Inte
 	return scanInteractions(rows)
 }
 
+// InteractionFilter selects interactions. Zero values match everything.
+type InteractionFilter struct {
+	UserID string // Only interactions on runs in repos the user is a member of
+	RunID  string
+	State  *InteractionState
+	Type   *InteractionType
+	Page   // Sort by created_at, newest first by default
+}
+
+var interactionSort = listSort{
+	fields: map[string]sortField{
+		"created_at": {column: "i.created_at", desc: true},
+	},
+	defaultSort: "created_at",
+	idColumn:    "i.id",
+}
+
+// ListInteractionsPage retrieves one page of interactions matching the
+// filter, and the cursor of the next page.
+func (s *Store) ListInteractionsPage(filter InteractionFilter) ([]*Interaction, string, error) {
+	defer s.span("ListInteractionsPage")()
+
+	query := `SELECT i.id, i.request_id, i.run_id, i.type, i.tool, i.payload, i.state, i.decision, i.message, i.response, i.updated_input, i.created_at, i.resolved_at
+		 FROM interactions i WHERE 1=1`
+	args := []any{}
+
+	if filter.UserID != "" {
+		query += ` AND i.run_id IN (SELECT r.id FROM runs r
+		 JOIN repo_members m ON m.repo_id = r.repo_id WHERE m.user_id = ?)`
+		args = append(args, filter.UserID)
+	}
+	if filter.RunID != "" {
+		query += " AND i.run_id = ?"
+		args = append(args, filter.RunID)
+	}
+	if filter.State != nil {
+		query += " AND i.state = ?"
+		args = append(args, string(*filter.State))
+	}
+	if filter.Type != nil {
+		query += " AND i.type = ?"
+		args = append(args, string(*filter.Type))
+	}
+
+	query, args, pq, err := interactionSort.apply(filter.Page, query, args)
+	if err != nil {
+		return nil, "", err
+	}
+
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, "", fmt.Errorf("query interactions: %w", err)
+	}
+	defer rows.Close()
+
+	interactions, err := scanInteractions(rows)
+	if err != nil {
+		return nil, "", err
+	}
+	interactions, next := finish(interactions, pq, func(i *Interaction, _ string) (any, string) {
+		return i.CreatedAt.Unix(), i.ID
+	})
+	return interactions, next, nil
+}
+
 // DeleteInteractionsByRun deletes all interactions for a run.
 func (s *Store) DeleteInteractionsByRun(runID string) error {
-	s.mu.Lock()
-	defer s.mu.Unlock()
+	defer s.span("DeleteInteractionsByRun")()
 
-	_, err := s.db.Exec("DELETE FROM interactions WHERE run_id = ?", runID)
+	_, err := s.w.Exec("DELETE FROM interactions WHERE run_id = ?", runID)
 	if err != nil {
 		return fmt.Errorf("delete interactions: %w", err)
 	}
@@ -270,7 +422,7 @@ func scanInteractions(rows *sql.Rows) ([]*Interaction, error) {
 			&interaction.ID, &interaction.RequestID, &interaction.RunID,
 			&interactionType, &interaction.Tool, &interaction.Payload,
 			&state, &interaction.Decision, &interaction.Message, &interaction.Response,
-			&createdAt, &resolvedAt,
+			&interaction.UpdatedInput, &createdAt, &resolvedAt,
 		); err != nil {
 			return nil, fmt.Errorf("scan interaction: %w", err)
 		}
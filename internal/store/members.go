@@ -0,0 +1,242 @@
+package store
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// RepoRole is a user's role on a repository. Roles are ordered; each role
+// includes the permissions of the roles before it.
+type RepoRole string
+
+const (
+	// RepoRoleViewer can see the repo, its runs, events and approvals.
+	RepoRoleViewer RepoRole = "viewer"
+	// RepoRoleOperator can also create and cancel runs and send input.
+	RepoRoleOperator RepoRole = "operator"
+	// RepoRoleApprover can also resolve approvals and input requests.
+	RepoRoleApprover RepoRole = "approver"
+	// RepoRoleOwner can also manage memberships and delete the repo.
+	RepoRoleOwner RepoRole = "owner"
+)
+
+// repoRoleRank orders roles from least to most privileged.
+var repoRoleRank = map[RepoRole]int{
+	RepoRoleViewer:   1,
+	RepoRoleOperator: 2,
+	RepoRoleApprover: 3,
+	RepoRoleOwner:    4,
+}
+
+// IsValid returns true if the role is a known role.
+func (r RepoRole) IsValid() bool {
+	_, ok := repoRoleRank[r]
+	return ok
+}
+
+// Allows returns true if the role includes the required role.
+func (r RepoRole) Allows(required RepoRole) bool {
+	return r.IsValid() && repoRoleRank[r] >= repoRoleRank[required]
+}
+
+// RepoMember is a user's membership in a repository.
+type RepoMember struct {
+	RepoID    string
+	UserID    string
+	Role      RepoRole
+	CreatedAt time.Time
+}
+
+// SetRepoMember adds a user to a repository or changes their role.
+func (s *Store) SetRepoMember(repoID, userID string, role RepoRole) (*RepoMember, error) {
+	defer s.span("SetRepoMember")()
+
+	now := time.Now().Unix()
+
+	var member *RepoMember
+	err := s.writeTx(func(tx *sql.Tx) error {
+		_, err := tx.Exec(
+			`INSERT INTO repo_members (repo_id, user_id, role, created_at) VALUES (?, ?, ?, ?)
+			 ON CONFLICT(repo_id, user_id) DO UPDATE SET role = excluded.role`,
+			repoID, userID, string(role), now,
+		)
+		if err != nil {
+			return fmt.Errorf("upsert repo member: %w", err)
+		}
+
+		member, err = s.getRepoMember(tx, repoID, userID)
+		return err
+	})
+	return member, err
+}
+
+// GetRepoMember retrieves a user's membership in a repository.
+func (s *Store) GetRepoMember(repoID, userID string) (*RepoMember, error) {
+	defer s.span("GetRepoMember")()
+
+	return s.getRepoMember(s.db, repoID, userID)
+}
+
+func (s *Store) getRepoMember(q queryer, repoID, userID string) (*RepoMember, error) {
+	var member RepoMember
+	var role string
+	var createdAt int64
+
+	err := q.QueryRow(
+		"SELECT repo_id, user_id, role, created_at FROM repo_members WHERE repo_id = ? AND user_id = ?",
+		repoID, userID,
+	).Scan(&member.RepoID, &member.UserID, &role, &createdAt)
+
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("query repo member: %w", err)
+	}
+
+	member.Role = RepoRole(role)
+	member.CreatedAt = time.Unix(createdAt, 0)
+	return &member, nil
+}
+
+// ListRepoMembers retrieves the members of a repository.
+func (s *Store) ListRepoMembers(repoID string) ([]*RepoMember, error) {
+	defer s.span("ListRepoMembers")()
+
+	rows, err := s.db.Query(
+		"SELECT repo_id, user_id, role, created_at FROM repo_members WHERE repo_id = ? ORDER BY created_at ASC",
+		repoID,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("query repo members: %w", err)
+	}
+	defer rows.Close()
+
+	var members []*RepoMember
+	for rows.Next() {
+		var member RepoMember
+		var role string
+		var createdAt int64
+		if err := rows.Scan(&member.RepoID, &member.UserID, &role, &createdAt); err != nil {
+			return nil, fmt.Errorf("scan repo member: %w", err)
+		}
+		member.Role = RepoRole(role)
+		member.CreatedAt = time.Unix(createdAt, 0)
+		members = append(members, &member)
+	}
+
+	return members, rows.Err()
+}
+
+// RemoveRepoMember removes a user from a repository.
+func (s *Store) RemoveRepoMember(repoID, userID string) error {
+	defer s.span("RemoveRepoMember")()
+
+	result, err := s.w.Exec("DELETE FROM repo_members WHERE repo_id = ? AND user_id = ?", repoID, userID)
+	if err != nil {
+		return fmt.Errorf("delete repo member: %w", err)
+	}
+
+	n, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("rows affected: %w", err)
+	}
+	if n == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+// ListRepoRolesForUser returns the user's role on each repository they are a
+// member of, keyed by repo ID.
+func (s *Store) ListRepoRolesForUser(userID string) (map[string]RepoRole, error) {
+	defer s.span("ListRepoRolesForUser")()
+
+	rows, err := s.db.Query("SELECT repo_id, role FROM repo_members WHERE user_id = ?", userID)
+	if err != nil {
+		return nil, fmt.Errorf("query repo roles: %w", err)
+	}
+	defer rows.Close()
+
+	roles := make(map[string]RepoRole)
+	for rows.Next() {
+		var repoID, role string
+		if err := rows.Scan(&repoID, &role); err != nil {
+			return nil, fmt.Errorf("scan repo role: %w", err)
+		}
+		roles[repoID] = RepoRole(role)
+	}
+
+	return roles, rows.Err()
+}
+
+// ListReposForUser retrieves the repositories a user is a member of.
+func (s *Store) ListReposForUser(userID string) ([]*Repo, error) {
+	defer s.span("ListReposForUser")()
+
+	rows, err := s.db.Query(
+		`SELECT `+repoColumns+`
+		 FROM repos r JOIN repo_members m ON m.repo_id = r.id
+		 WHERE m.user_id = ? ORDER BY r.created_at DESC`,
+		userID,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("query repos for user: %w", err)
+	}
+	defer rows.Close()
+
+	return scanRepoRows(rows)
+}
+
+// CountRunsByStateForUser returns the number of runs in each state across the
+// repositories a user is a member of. States without runs are omitted.
+func (s *Store) CountRunsByStateForUser(userID string) (map[RunState]int, error) {
+	defer s.span("CountRunsByStateForUser")()
+	return s.countRunsByState(userID)
+}
+
+// ListPendingInteractionsForUser retrieves pending interactions on runs in
+// repositories the user is a member of, oldest first.
+func (s *Store) ListPendingInteractionsForUser(userID string) ([]*Interaction, error) {
+	defer s.span("ListPendingInteractionsForUser")()
+	state := InteractionStatePending
+	return s.listInteractionsForUser(userID, "", &state, "ASC")
+}
+
+// ListInteractionsForUser retrieves interactions on runs in repositories the
+// user is a member of, with optional filters, newest first.
+func (s *Store) ListInteractionsForUser(userID, runID string, state *InteractionState) ([]*Interaction, error) {
+	defer s.span("ListInteractionsForUser")()
+	return s.listInteractionsForUser(userID, runID, state, "DESC")
+}
+
+func (s *Store) listInteractionsForUser(userID, runID string, state *InteractionState, order string) ([]*Interaction, error) {
+
+	query := `SELECT i.id, i.request_id, i.run_id, i.type, i.tool, i.payload, i.state, i.decision, i.message, i.response, i.updated_input, i.created_at, i.resolved_at
+		 FROM interactions i
+		 JOIN runs r ON r.id = i.run_id
+		 JOIN repo_members m ON m.repo_id = r.repo_id
+		 WHERE m.user_id = ?`
+	args := []any{userID}
+
+	if runID != "" {
+		query += " AND i.run_id = ?"
+		args = append(args, runID)
+	}
+	if state != nil {
+		query += " AND i.state = ?"
+		args = append(args, string(*state))
+	}
+
+	query += " ORDER BY i.created_at " + order
+
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("query interactions for user: %w", err)
+	}
+	defer rows.Close()
+
+	return scanInteractions(rows)
+}
@@ -0,0 +1,119 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"time"
+
+	"github.com/anthropics/m/internal/metrics"
+	"github.com/mattn/go-sqlite3"
+)
+
+// timedDriverName is the SQLite driver wrapped to record query latency.
+const timedDriverName = "sqlite3_timed"
+
+var queryDuration = metrics.NewHistogramVec(
+	"m_sqlite_query_duration_seconds",
+	"SQLite statement latency by operation (query includes reading all rows).",
+	[]float64{.0001, .0005, .001, .005, .01, .05, .1, .5, 1},
+	"op",
+)
+
+func init() {
+	sql.Register(timedDriverName, timedDriver{&sqlite3.SQLiteDriver{}})
+}
+
+func observeQuery(op string, start time.Time) {
+	queryDuration.Observe(time.Since(start).Seconds(), op)
+}
+
+// timedDriver wraps the SQLite driver so every connection records the time
+// spent in queries, execs and commits.
+type timedDriver struct {
+	driver.Driver
+}
+
+func (d timedDriver) Open(name string) (driver.Conn, error) {
+	conn, err := d.Driver.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	return &timedConn{conn.(*sqlite3.SQLiteConn)}, nil
+}
+
+type timedConn struct {
+	*sqlite3.SQLiteConn
+}
+
+func (c *timedConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	start := time.Now()
+	rows, err := c.SQLiteConn.QueryContext(ctx, query, args)
+	if err != nil {
+		observeQuery("query", start)
+		return nil, err
+	}
+	return &timedRows{Rows: rows, start: start}, nil
+}
+
+func (c *timedConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	defer observeQuery("exec", time.Now())
+	return c.SQLiteConn.ExecContext(ctx, query, args)
+}
+
+func (c *timedConn) PrepareContext(ctx context.Context, query string) (driver.Stmt, error) {
+	stmt, err := c.SQLiteConn.PrepareContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	return &timedStmt{stmt.(*sqlite3.SQLiteStmt)}, nil
+}
+
+func (c *timedConn) BeginTx(ctx context.Context, opts driver.TxOptions) (driver.Tx, error) {
+	tx, err := c.SQLiteConn.BeginTx(ctx, opts)
+	if err != nil {
+		return nil, err
+	}
+	return timedTx{tx}, nil
+}
+
+// timedRows observes the query when its rows are closed, since SQLite only
+// steps through the statement as rows are read.
+type timedRows struct {
+	driver.Rows
+	start time.Time
+}
+
+func (r *timedRows) Close() error {
+	observeQuery("query", r.start)
+	return r.Rows.Close()
+}
+
+// timedStmt times executions of prepared statements, such as event inserts.
+type timedStmt struct {
+	*sqlite3.SQLiteStmt
+}
+
+func (s *timedStmt) QueryContext(ctx context.Context, args []driver.NamedValue) (driver.Rows, error) {
+	start := time.Now()
+	rows, err := s.SQLiteStmt.QueryContext(ctx, args)
+	if err != nil {
+		observeQuery("query", start)
+		return nil, err
+	}
+	return &timedRows{Rows: rows, start: start}, nil
+}
+
+func (s *timedStmt) ExecContext(ctx context.Context, args []driver.NamedValue) (driver.Result, error) {
+	defer observeQuery("exec", time.Now())
+	return s.SQLiteStmt.ExecContext(ctx, args)
+}
+
+type timedTx struct {
+	driver.Tx
+}
+
+func (t timedTx) Commit() error {
+	defer observeQuery("commit", time.Now())
+	return t.Tx.Commit()
+}
@@ -0,0 +1,763 @@
+package store
+
+import (
+	"database/sql"
+	"fmt"
+
+	"github.com/anthropics/m/internal/migrate"
+)
+
+// migrations is the SQLite store schema history; postgresMigrations is the
+// PostgreSQL one. A schema change appends a migration to both; never edit or
+// reorder applied ones.
+//
+// Databases created before schema versioning have no schema_migrations table
+// and replay every migration from 1, so migrations 1-7, which describe the
+// schema those databases may already have, must be idempotent.
+var migrations = []migrate.Migration{
+	{Version: 1, Name: "initial", Up: migrate.Exec(`
+		CREATE TABLE IF NOT EXISTS repos (
+			id TEXT PRIMARY KEY,
+			name TEXT NOT NULL,
+			git_url TEXT,
+			created_at INTEGER NOT NULL
+		);
+
+		CREATE TABLE IF NOT EXISTS runs (
+			id TEXT PRIMARY KEY,
+			repo_id TEXT NOT NULL REFERENCES repos(id),
+			prompt TEXT NOT NULL,
+			state TEXT NOT NULL CHECK(state IN ('running', 'waiting_input', 'waiting_approval', 'completed', 'failed', 'cancelled')),
+			workspace_path TEXT NOT NULL,
+			created_at INTEGER NOT NULL,
+			updated_at INTEGER NOT NULL
+		);
+		CREATE INDEX IF NOT EXISTS idx_runs_repo_id ON runs(repo_id);
+		CREATE INDEX IF NOT EXISTS idx_runs_state ON runs(state);
+
+		CREATE TABLE IF NOT EXISTS events (
+			id TEXT PRIMARY KEY,
+			run_id TEXT NOT NULL REFERENCES runs(id),
+			seq INTEGER NOT NULL,
+			type TEXT NOT NULL,
+			data TEXT,
+			created_at INTEGER NOT NULL,
+			UNIQUE(run_id, seq)
+		);
+
+		CREATE TABLE IF NOT EXISTS approvals (
+			id TEXT PRIMARY KEY,
+			run_id TEXT NOT NULL REFERENCES runs(id),
+			event_id TEXT NOT NULL REFERENCES events(id),
+			type TEXT NOT NULL CHECK(type IN ('diff', 'command', 'generic')),
+			state TEXT NOT NULL CHECK(state IN ('pending', 'approved', 'rejected')),
+			payload TEXT,
+			rejection_reason TEXT,
+			created_at INTEGER NOT NULL,
+			resolved_at INTEGER
+		);
+		CREATE INDEX IF NOT EXISTS idx_approvals_run_id ON approvals(run_id);
+		CREATE INDEX IF NOT EXISTS idx_approvals_state ON approvals(state);
+
+		CREATE TABLE IF NOT EXISTS devices (
+			token TEXT PRIMARY KEY,
+			platform TEXT NOT NULL CHECK(platform IN ('ios')),
+			created_at INTEGER NOT NULL
+		);
+
+		CREATE TABLE IF NOT EXISTS interactions (
+			id TEXT PRIMARY KEY,
+			request_id TEXT UNIQUE NOT NULL,
+			run_id TEXT NOT NULL REFERENCES runs(id),
+			type TEXT NOT NULL CHECK(type IN ('approval', 'input')),
+			tool TEXT NOT NULL,
+			payload TEXT,
+			state TEXT NOT NULL CHECK(state IN ('pending', 'resolved')),
+			decision TEXT,
+			message TEXT,
+			response TEXT,
+			created_at INTEGER NOT NULL,
+			resolved_at INTEGER
+		);
+		CREATE INDEX IF NOT EXISTS idx_interactions_run_id ON interactions(run_id);
+		CREATE INDEX IF NOT EXISTS idx_interactions_request_id ON interactions(request_id);
+		CREATE INDEX IF NOT EXISTS idx_interactions_state ON interactions(state);
+	`)},
+
+	{Version: 2, Name: "interaction_updated_input", Up: func(tx *sql.Tx) error {
+		return addColumnIfMissing(tx, "interactions", "updated_input", "TEXT")
+	}},
+
+	{Version: 3, Name: "users_and_tokens", Up: migrate.Exec(`
+		CREATE TABLE IF NOT EXISTS users (
+			id TEXT PRIMARY KEY,
+			name TEXT UNIQUE NOT NULL,
+			created_at INTEGER NOT NULL
+		);
+
+		CREATE TABLE IF NOT EXISTS api_tokens (
+			id TEXT PRIMARY KEY,
+			user_id TEXT REFERENCES users(id) ON DELETE CASCADE,
+			run_id TEXT REFERENCES runs(id) ON DELETE CASCADE,
+			name TEXT NOT NULL,
+			token_hash TEXT UNIQUE NOT NULL,
+			prefix TEXT NOT NULL,
+			scopes TEXT NOT NULL,
+			created_at INTEGER NOT NULL,
+			expires_at INTEGER,
+			last_used_at INTEGER,
+			revoked_at INTEGER
+		);
+		CREATE INDEX IF NOT EXISTS idx_api_tokens_user_id ON api_tokens(user_id);
+		CREATE INDEX IF NOT EXISTS idx_api_tokens_run_id ON api_tokens(run_id);
+	`)},
+
+	{Version: 4, Name: "audit_log", Up: migrate.Exec(`
+		CREATE TABLE IF NOT EXISTS audit_log (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			token_id TEXT,
+			user_id TEXT,
+			actor TEXT NOT NULL,
+			action TEXT NOT NULL,
+			target_type TEXT NOT NULL,
+			target_id TEXT NOT NULL,
+			method TEXT NOT NULL,
+			path TEXT NOT NULL,
+			status INTEGER NOT NULL,
+			remote_addr TEXT NOT NULL,
+			user_agent TEXT NOT NULL,
+			details TEXT,
+			created_at INTEGER NOT NULL
+		);
+		CREATE INDEX IF NOT EXISTS idx_audit_log_user_id ON audit_log(user_id);
+		CREATE INDEX IF NOT EXISTS idx_audit_log_target ON audit_log(target_type, target_id);
+		CREATE INDEX IF NOT EXISTS idx_audit_log_created_at ON audit_log(created_at);
+
+		-- The audit log is append-only
+		CREATE TRIGGER IF NOT EXISTS audit_log_no_update BEFORE UPDATE ON audit_log
+		BEGIN SELECT RAISE(ABORT, 'audit log is append-only'); END;
+		CREATE TRIGGER IF NOT EXISTS audit_log_no_delete BEFORE DELETE ON audit_log
+		BEGIN SELECT RAISE(ABORT, 'audit log is append-only'); END;
+	`)},
+
+	{Version: 5, Name: "repo_members", Up: migrate.Exec(`
+		CREATE TABLE IF NOT EXISTS repo_members (
+			repo_id TEXT NOT NULL REFERENCES repos(id) ON DELETE CASCADE,
+			user_id TEXT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+			role TEXT NOT NULL CHECK(role IN ('viewer', 'operator', 'approver', 'owner')),
+			created_at INTEGER NOT NULL,
+			PRIMARY KEY (repo_id, user_id)
+		);
+		CREATE INDEX IF NOT EXISTS idx_repo_members_user_id ON repo_members(user_id);
+	`)},
+
+	{Version: 6, Name: "health", Up: migrate.Exec(`
+		-- Single row rewritten by readiness checks to prove writes succeed
+		CREATE TABLE IF NOT EXISTS health (
+			id INTEGER PRIMARY KEY CHECK(id = 1),
+			checked_at INTEGER NOT NULL
+		);
+	`)},
+
+	{Version: 7, Name: "list_indexes", Up: migrate.Exec(`
+		CREATE INDEX IF NOT EXISTS idx_runs_repo_created ON runs(repo_id, created_at, id);
+		CREATE INDEX IF NOT EXISTS idx_runs_created ON runs(created_at, id);
+		CREATE INDEX IF NOT EXISTS idx_interactions_created ON interactions(created_at, id);
+	`)},
+
+	{Version: 8, Name: "event_archives", Up: migrate.Exec(`
+		-- Output events of old runs, compacted by ArchiveOutput: a gzip of
+		-- one JSON event per line
+		CREATE TABLE event_archives (
+			run_id TEXT PRIMARY KEY REFERENCES runs(id) ON DELETE CASCADE,
+			data BLOB NOT NULL,
+			event_count INTEGER NOT NULL,
+			last_seq INTEGER NOT NULL,
+			archived_at INTEGER NOT NULL
+		);
+	`)},
+
+	{Version: 9, Name: "search_index", Up: migrate.Exec(`
+		-- One document per searchable text: a run's prompt, an output or
+		-- tool_call_start event, or an interaction. Triggers on the source
+		-- tables keep it current, and triggers on it keep the FTS index
+		-- current.
+		CREATE TABLE search_docs (
+			ref_id TEXT PRIMARY KEY,
+			kind TEXT NOT NULL CHECK(kind IN ('prompt', 'output', 'tool_call', 'interaction')),
+			run_id TEXT NOT NULL,
+			body TEXT NOT NULL,
+			created_at INTEGER NOT NULL
+		);
+		CREATE INDEX idx_search_docs_created ON search_docs(created_at, ref_id);
+
+		CREATE VIRTUAL TABLE search_fts USING fts4(content="search_docs", body, tokenize=unicode61);
+		CREATE TRIGGER search_docs_ai AFTER INSERT ON search_docs
+		BEGIN INSERT INTO search_fts(docid, body) VALUES (new.rowid, new.body); END;
+		CREATE TRIGGER search_docs_bu BEFORE UPDATE ON search_docs
+		BEGIN DELETE FROM search_fts WHERE docid = old.rowid; END;
+		CREATE TRIGGER search_docs_au AFTER UPDATE ON search_docs
+		BEGIN INSERT INTO search_fts(docid, body) VALUES (new.rowid, new.body); END;
+		CREATE TRIGGER search_docs_bd BEFORE DELETE ON search_docs
+		BEGIN DELETE FROM search_fts WHERE docid = old.rowid; END;
+
+		CREATE TRIGGER search_runs_ai AFTER INSERT ON runs
+		BEGIN
+			INSERT INTO search_docs (ref_id, kind, run_id, body, created_at)
+			VALUES (new.id, 'prompt', new.id, new.prompt, new.created_at);
+		END;
+		CREATE TRIGGER search_runs_ad AFTER DELETE ON runs
+		BEGIN DELETE FROM search_docs WHERE ref_id = old.id; END;
+
+		CREATE TRIGGER search_events_ai AFTER INSERT ON events
+		WHEN new.type IN ('stdout', 'stderr', 'tool_call_start') AND json_valid(new.data)
+		BEGIN
+			INSERT INTO search_docs (ref_id, kind, run_id, body, created_at)
+			VALUES (new.id,
+				CASE new.type WHEN 'tool_call_start' THEN 'tool_call' ELSE 'output' END,
+				new.run_id,
+				CASE new.type
+					WHEN 'tool_call_start' THEN COALESCE(json_extract(new.data, '$.tool'), '') || ' ' || COALESCE(json_extract(new.data, '$.input'), '')
+					ELSE COALESCE(json_extract(new.data, '$.text'), '')
+				END,
+				new.created_at);
+		END;
+		CREATE TRIGGER search_events_ad AFTER DELETE ON events
+		WHEN old.type IN ('stdout', 'stderr', 'tool_call_start')
+		BEGIN DELETE FROM search_docs WHERE ref_id = old.id; END;
+
+		CREATE TRIGGER search_interactions_ai AFTER INSERT ON interactions
+		BEGIN
+			INSERT INTO search_docs (ref_id, kind, run_id, body, created_at)
+			VALUES (new.id, 'interaction', new.run_id,
+				new.tool || ' ' || COALESCE(new.payload, '') || ' ' || COALESCE(new.message, '') || ' ' ||
+					COALESCE(new.response, '') || ' ' || COALESCE(new.updated_input, ''),
+				new.created_at);
+		END;
+		CREATE TRIGGER search_interactions_au AFTER UPDATE ON interactions
+		BEGIN
+			UPDATE search_docs SET body = new.tool || ' ' || COALESCE(new.payload, '') || ' ' ||
+				COALESCE(new.message, '') || ' ' || COALESCE(new.response, '') || ' ' || COALESCE(new.updated_input, '')
+			WHERE ref_id = new.id;
+		END;
+		CREATE TRIGGER search_interactions_ad AFTER DELETE ON interactions
+		BEGIN DELETE FROM search_docs WHERE ref_id = old.id; END;
+
+		-- Index what is already there
+		INSERT INTO search_docs (ref_id, kind, run_id, body, created_at)
+		SELECT id, 'prompt', id, prompt, created_at FROM runs;
+		INSERT INTO search_docs (ref_id, kind, run_id, body, created_at)
+		SELECT id,
+			CASE type WHEN 'tool_call_start' THEN 'tool_call' ELSE 'output' END,
+			run_id,
+			CASE type
+				WHEN 'tool_call_start' THEN COALESCE(json_extract(data, '$.tool'), '') || ' ' || COALESCE(json_extract(data, '$.input'), '')
+				ELSE COALESCE(json_extract(data, '$.text'), '')
+			END,
+			created_at
+		FROM events WHERE type IN ('stdout', 'stderr', 'tool_call_start') AND json_valid(data);
+		INSERT INTO search_docs (ref_id, kind, run_id, body, created_at)
+		SELECT id, 'interaction', run_id,
+			tool || ' ' || COALESCE(payload, '') || ' ' || COALESCE(message, '') || ' ' ||
+				COALESCE(response, '') || ' ' || COALESCE(updated_input, ''),
+			created_at
+		FROM interactions;
+	`)},
+
+	{Version: 10, Name: "run_metadata", Up: migrate.Exec(`
+		-- Filled in by the runner: timing, outcome, agent and model, the
+		-- workspace clone's commits, and token usage summed over the run
+		ALTER TABLE runs ADD COLUMN started_at INTEGER;
+		ALTER TABLE runs ADD COLUMN finished_at INTEGER;
+		ALTER TABLE runs ADD COLUMN exit_code INTEGER;
+		ALTER TABLE runs ADD COLUMN error TEXT;
+		ALTER TABLE runs ADD COLUMN agent TEXT;
+		ALTER TABLE runs ADD COLUMN model TEXT;
+		ALTER TABLE runs ADD COLUMN base_sha TEXT;
+		ALTER TABLE runs ADD COLUMN final_sha TEXT;
+		ALTER TABLE runs ADD COLUMN input_tokens INTEGER NOT NULL DEFAULT 0;
+		ALTER TABLE runs ADD COLUMN output_tokens INTEGER NOT NULL DEFAULT 0;
+		ALTER TABLE runs ADD COLUMN cost_usd REAL NOT NULL DEFAULT 0;
+	`)},
+	{Version: 11, Name: "repo_settings", Up: migrate.Exec(`
+		-- JSON document of per-repo overrides of the agent configuration
+		ALTER TABLE repos ADD COLUMN settings TEXT NOT NULL DEFAULT '{}';
+	`)},
+	{Version: 12, Name: "search_fts5", Up: func(tx *sql.Tx) error {
+		if err := migrate.Exec(`
+			-- Documents carry their event's seq, which archived output no
+			-- longer has an events row to provide
+			ALTER TABLE search_docs ADD COLUMN seq INTEGER NOT NULL DEFAULT 0;
+			UPDATE search_docs SET seq = (SELECT seq FROM events WHERE events.id = search_docs.ref_id)
+			WHERE kind IN ('output', 'tool_call');
+			CREATE INDEX idx_search_docs_run_id ON search_docs(run_id);
+
+			-- Output deleted by ArchiveOutput stays indexed until its run is
+			-- deleted
+			DROP TRIGGER search_runs_ad;
+			CREATE TRIGGER search_runs_ad AFTER DELETE ON runs
+			BEGIN DELETE FROM search_docs WHERE run_id = old.id; END;
+			DROP TRIGGER search_events_ai;
+			CREATE TRIGGER search_events_ai AFTER INSERT ON events
+			WHEN new.type IN ('stdout', 'stderr', 'tool_call_start') AND json_valid(new.data)
+			BEGIN
+				INSERT INTO search_docs (ref_id, kind, run_id, seq, body, created_at)
+				VALUES (new.id,
+					CASE new.type WHEN 'tool_call_start' THEN 'tool_call' ELSE 'output' END,
+					new.run_id,
+					new.seq,
+					CASE new.type
+						WHEN 'tool_call_start' THEN COALESCE(json_extract(new.data, '$.tool'), '') || ' ' || COALESCE(json_extract(new.data, '$.input'), '')
+						ELSE COALESCE(json_extract(new.data, '$.text'), '')
+					END,
+					new.created_at);
+			END;
+			DROP TRIGGER search_events_ad;
+			CREATE TRIGGER search_events_ad AFTER DELETE ON events
+			WHEN old.type IN ('stdout', 'stderr', 'tool_call_start')
+				AND NOT (old.type IN ('stdout', 'stderr') AND EXISTS (
+					SELECT 1 FROM event_archives WHERE run_id = old.run_id AND last_seq >= old.seq))
+			BEGIN DELETE FROM search_docs WHERE ref_id = old.id; END;
+			CREATE TRIGGER search_archives_ad AFTER DELETE ON event_archives
+			BEGIN
+				DELETE FROM search_docs WHERE run_id = old.run_id AND kind = 'output' AND seq <= old.last_seq;
+			END;
+		`)(tx); err != nil {
+			return err
+		}
+
+		// The full-text index moves from FTS4 to FTS5 when the driver was
+		// built with the sqlite_fts5 tag; otherwise the FTS4 index stays.
+		// The triggers keep their names, so both schemas list the same
+		// objects.
+		fts5, err := sqliteHasFTS5(tx)
+		if err != nil {
+			return err
+		}
+		if fts5 {
+			if err := migrate.Exec(`
+				DROP TRIGGER search_docs_ai;
+				DROP TRIGGER search_docs_bu;
+				DROP TRIGGER search_docs_au;
+				DROP TRIGGER search_docs_bd;
+				DROP TABLE search_fts;
+				CREATE VIRTUAL TABLE search_fts USING fts5(body, content='search_docs', tokenize='unicode61');
+				CREATE TRIGGER search_docs_ai AFTER INSERT ON search_docs
+				BEGIN INSERT INTO search_fts(rowid, body) VALUES (new.rowid, new.body); END;
+				CREATE TRIGGER search_docs_bu BEFORE UPDATE ON search_docs
+				BEGIN INSERT INTO search_fts(search_fts, rowid, body) VALUES ('delete', old.rowid, old.body); END;
+				CREATE TRIGGER search_docs_au AFTER UPDATE ON search_docs
+				BEGIN INSERT INTO search_fts(rowid, body) VALUES (new.rowid, new.body); END;
+				CREATE TRIGGER search_docs_bd BEFORE DELETE ON search_docs
+				BEGIN INSERT INTO search_fts(search_fts, rowid, body) VALUES ('delete', old.rowid, old.body); END;
+				INSERT INTO search_fts(search_fts) VALUES ('rebuild');
+			`)(tx); err != nil {
+				return err
+			}
+		}
+
+		// Output archived before this migration was dropped from the index
+		return indexArchives(tx)
+	}},
+}
+
+// postgresMigrations is the PostgreSQL store schema history. It starts from
+// the SQLite schema at version 7, with BIGINT Unix timestamps.
+var postgresMigrations = []migrate.Migration{
+	{Version: 1, Name: "initial", Up: migrate.Exec(`
+		CREATE TABLE repos (
+			id TEXT PRIMARY KEY,
+			name TEXT NOT NULL,
+			git_url TEXT,
+			created_at BIGINT NOT NULL
+		);
+
+		CREATE TABLE runs (
+			id TEXT PRIMARY KEY,
+			repo_id TEXT NOT NULL REFERENCES repos(id),
+			prompt TEXT NOT NULL,
+			state TEXT NOT NULL CHECK(state IN ('running', 'waiting_input', 'waiting_approval', 'completed', 'failed', 'cancelled')),
+			workspace_path TEXT NOT NULL,
+			created_at BIGINT NOT NULL,
+			updated_at BIGINT NOT NULL
+		);
+		CREATE INDEX idx_runs_repo_id ON runs(repo_id);
+		CREATE INDEX idx_runs_state ON runs(state);
+		CREATE INDEX idx_runs_repo_created ON runs(repo_id, created_at, id);
+		CREATE INDEX idx_runs_created ON runs(created_at, id);
+
+		CREATE TABLE events (
+			id TEXT PRIMARY KEY,
+			run_id TEXT NOT NULL REFERENCES runs(id),
+			seq BIGINT NOT NULL,
+			type TEXT NOT NULL,
+			data TEXT,
+			created_at BIGINT NOT NULL,
+			UNIQUE(run_id, seq)
+		);
+
+		CREATE TABLE approvals (
+			id TEXT PRIMARY KEY,
+			run_id TEXT NOT NULL REFERENCES runs(id),
+			event_id TEXT NOT NULL REFERENCES events(id),
+			type TEXT NOT NULL CHECK(type IN ('diff', 'command', 'generic')),
+			state TEXT NOT NULL CHECK(state IN ('pending', 'approved', 'rejected')),
+			payload TEXT,
+			rejection_reason TEXT,
+			created_at BIGINT NOT NULL,
+			resolved_at BIGINT
+		);
+		CREATE INDEX idx_approvals_run_id ON approvals(run_id);
+		CREATE INDEX idx_approvals_state ON approvals(state);
+
+		CREATE TABLE devices (
+			token TEXT PRIMARY KEY,
+			platform TEXT NOT NULL CHECK(platform IN ('ios')),
+			created_at BIGINT NOT NULL
+		);
+
+		CREATE TABLE interactions (
+			id TEXT PRIMARY KEY,
+			request_id TEXT UNIQUE NOT NULL,
+			run_id TEXT NOT NULL REFERENCES runs(id),
+			type TEXT NOT NULL CHECK(type IN ('approval', 'input')),
+			tool TEXT NOT NULL,
+			payload TEXT,
+			state TEXT NOT NULL CHECK(state IN ('pending', 'resolved')),
+			decision TEXT,
+			message TEXT,
+			response TEXT,
+			updated_input TEXT,
+			created_at BIGINT NOT NULL,
+			resolved_at BIGINT
+		);
+		CREATE INDEX idx_interactions_run_id ON interactions(run_id);
+		CREATE INDEX idx_interactions_state ON interactions(state);
+		CREATE INDEX idx_interactions_created ON interactions(created_at, id);
+
+		CREATE TABLE users (
+			id TEXT PRIMARY KEY,
+			name TEXT UNIQUE NOT NULL,
+			created_at BIGINT NOT NULL
+		);
+
+		CREATE TABLE api_tokens (
+			id TEXT PRIMARY KEY,
+			user_id TEXT REFERENCES users(id) ON DELETE CASCADE,
+			run_id TEXT REFERENCES runs(id) ON DELETE CASCADE,
+			name TEXT NOT NULL,
+			token_hash TEXT UNIQUE NOT NULL,
+			prefix TEXT NOT NULL,
+			scopes TEXT NOT NULL,
+			created_at BIGINT NOT NULL,
+			expires_at BIGINT,
+			last_used_at BIGINT,
+			revoked_at BIGINT
+		);
+		CREATE INDEX idx_api_tokens_user_id ON api_tokens(user_id);
+		CREATE INDEX idx_api_tokens_run_id ON api_tokens(run_id);
+
+		CREATE TABLE audit_log (
+			id BIGINT GENERATED ALWAYS AS IDENTITY PRIMARY KEY,
+			token_id TEXT,
+			user_id TEXT,
+			actor TEXT NOT NULL,
+			action TEXT NOT NULL,
+			target_type TEXT NOT NULL,
+			target_id TEXT NOT NULL,
+			method TEXT NOT NULL,
+			path TEXT NOT NULL,
+			status INTEGER NOT NULL,
+			remote_addr TEXT NOT NULL,
+			user_agent TEXT NOT NULL,
+			details TEXT,
+			created_at BIGINT NOT NULL
+		);
+		CREATE INDEX idx_audit_log_user_id ON audit_log(user_id);
+		CREATE INDEX idx_audit_log_target ON audit_log(target_type, target_id);
+		CREATE INDEX idx_audit_log_created_at ON audit_log(created_at);
+
+		-- The audit log is append-only
+		CREATE FUNCTION audit_log_append_only() RETURNS trigger AS $$
+		BEGIN
+			RAISE EXCEPTION 'audit log is append-only';
+		END;
+		$$ LANGUAGE plpgsql;
+		CREATE TRIGGER audit_log_no_update BEFORE UPDATE ON audit_log
+			FOR EACH ROW EXECUTE FUNCTION audit_log_append_only();
+		CREATE TRIGGER audit_log_no_delete BEFORE DELETE ON audit_log
+			FOR EACH ROW EXECUTE FUNCTION audit_log_append_only();
+
+		CREATE TABLE repo_members (
+			repo_id TEXT NOT NULL REFERENCES repos(id) ON DELETE CASCADE,
+			user_id TEXT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+			role TEXT NOT NULL CHECK(role IN ('viewer', 'operator', 'approver', 'owner')),
+			created_at BIGINT NOT NULL,
+			PRIMARY KEY (repo_id, user_id)
+		);
+		CREATE INDEX idx_repo_members_user_id ON repo_members(user_id);
+
+		-- Single row rewritten by readiness checks to prove writes succeed
+		CREATE TABLE health (
+			id INTEGER PRIMARY KEY CHECK(id = 1),
+			checked_at BIGINT NOT NULL
+		);
+	`)},
+
+	{Version: 2, Name: "event_archives", Up: migrate.Exec(`
+		-- Output events of old runs, compacted by ArchiveOutput: a gzip of
+		-- one JSON event per line
+		CREATE TABLE event_archives (
+			run_id TEXT PRIMARY KEY REFERENCES runs(id) ON DELETE CASCADE,
+			data BYTEA NOT NULL,
+			event_count INTEGER NOT NULL,
+			last_seq BIGINT NOT NULL,
+			archived_at BIGINT NOT NULL
+		);
+	`)},
+
+	{Version: 3, Name: "search_index", Up: migrate.Exec(`
+		-- One document per searchable text: a run's prompt, an output or
+		-- tool_call_start event, or an interaction, kept current by
+		-- triggers on the source tables
+		CREATE TABLE search_docs (
+			ref_id TEXT PRIMARY KEY,
+			kind TEXT NOT NULL CHECK(kind IN ('prompt', 'output', 'tool_call', 'interaction')),
+			run_id TEXT NOT NULL,
+			body TEXT NOT NULL,
+			created_at BIGINT NOT NULL,
+			tsv tsvector GENERATED ALWAYS AS (to_tsvector('simple', body)) STORED
+		);
+		CREATE INDEX idx_search_docs_tsv ON search_docs USING GIN (tsv);
+		CREATE INDEX idx_search_docs_created ON search_docs(created_at, ref_id);
+
+		-- search_event_body returns the searchable text of an event, or NULL
+		-- for events that are not indexed
+		CREATE FUNCTION search_event_body(event_type TEXT, event_data TEXT) RETURNS TEXT AS $$
+		DECLARE
+			doc jsonb;
+		BEGIN
+			IF event_type NOT IN ('stdout', 'stderr', 'tool_call_start') THEN
+				RETURN NULL;
+			END IF;
+			BEGIN
+				doc := event_data::jsonb;
+			EXCEPTION WHEN others THEN
+				RETURN NULL;
+			END;
+			IF event_type = 'tool_call_start' THEN
+				RETURN COALESCE(doc->>'tool', '') || ' ' || COALESCE(doc->>'input', '');
+			END IF;
+			RETURN COALESCE(doc->>'text', '');
+		END;
+		$$ LANGUAGE plpgsql IMMUTABLE;
+
+		CREATE FUNCTION search_index_run() RETURNS trigger AS $$
+		BEGIN
+			IF TG_OP = 'DELETE' THEN
+				DELETE FROM search_docs WHERE ref_id = OLD.id;
+				RETURN OLD;
+			END IF;
+			INSERT INTO search_docs (ref_id, kind, run_id, body, created_at)
+			VALUES (NEW.id, 'prompt', NEW.id, NEW.prompt, NEW.created_at);
+			RETURN NEW;
+		END;
+		$$ LANGUAGE plpgsql;
+		CREATE TRIGGER search_runs AFTER INSERT OR DELETE ON runs
+			FOR EACH ROW EXECUTE FUNCTION search_index_run();
+
+		CREATE FUNCTION search_index_event() RETURNS trigger AS $$
+		DECLARE
+			doc_body TEXT;
+		BEGIN
+			IF TG_OP = 'DELETE' THEN
+				DELETE FROM search_docs WHERE ref_id = OLD.id;
+				RETURN OLD;
+			END IF;
+			doc_body := search_event_body(NEW.type, NEW.data);
+			IF doc_body IS NOT NULL THEN
+				INSERT INTO search_docs (ref_id, kind, run_id, body, created_at)
+				VALUES (NEW.id, CASE NEW.type WHEN 'tool_call_start' THEN 'tool_call' ELSE 'output' END,
+					NEW.run_id, doc_body, NEW.created_at);
+			END IF;
+			RETURN NEW;
+		END;
+		$$ LANGUAGE plpgsql;
+		CREATE TRIGGER search_events AFTER INSERT OR DELETE ON events
+			FOR EACH ROW EXECUTE FUNCTION search_index_event();
+
+		CREATE FUNCTION search_index_interaction() RETURNS trigger AS $$
+		BEGIN
+			IF TG_OP = 'DELETE' THEN
+				DELETE FROM search_docs WHERE ref_id = OLD.id;
+				RETURN OLD;
+			END IF;
+			INSERT INTO search_docs (ref_id, kind, run_id, body, created_at)
+			VALUES (NEW.id, 'interaction', NEW.run_id,
+				NEW.tool || ' ' || COALESCE(NEW.payload, '') || ' ' || COALESCE(NEW.message, '') || ' ' ||
+					COALESCE(NEW.response, '') || ' ' || COALESCE(NEW.updated_input, ''),
+				NEW.created_at)
+			ON CONFLICT (ref_id) DO UPDATE SET body = excluded.body;
+			RETURN NEW;
+		END;
+		$$ LANGUAGE plpgsql;
+		CREATE TRIGGER search_interactions AFTER INSERT OR UPDATE OR DELETE ON interactions
+			FOR EACH ROW EXECUTE FUNCTION search_index_interaction();
+
+		-- Index what is already there
+		INSERT INTO search_docs (ref_id, kind, run_id, body, created_at)
+		SELECT id, 'prompt', id, prompt, created_at FROM runs;
+		INSERT INTO search_docs (ref_id, kind, run_id, body, created_at)
+		SELECT id, CASE type WHEN 'tool_call_start' THEN 'tool_call' ELSE 'output' END,
+			run_id, search_event_body(type, data), created_at
+		FROM events WHERE search_event_body(type, data) IS NOT NULL;
+		INSERT INTO search_docs (ref_id, kind, run_id, body, created_at)
+		SELECT id, 'interaction', run_id,
+			tool || ' ' || COALESCE(payload, '') || ' ' || COALESCE(message, '') || ' ' ||
+				COALESCE(response, '') || ' ' || COALESCE(updated_input, ''),
+			created_at
+		FROM interactions;
+	`)},
+
+	{Version: 4, Name: "run_metadata", Up: migrate.Exec(`
+		-- Filled in by the runner: timing, outcome, agent and model, the
+		-- workspace clone's commits, and token usage summed over the run
+		ALTER TABLE runs
+			ADD COLUMN started_at BIGINT,
+			ADD COLUMN finished_at BIGINT,
+			ADD COLUMN exit_code INTEGER,
+			ADD COLUMN error TEXT,
+			ADD COLUMN agent TEXT,
+			ADD COLUMN model TEXT,
+			ADD COLUMN base_sha TEXT,
+			ADD COLUMN final_sha TEXT,
+			ADD COLUMN input_tokens BIGINT NOT NULL DEFAULT 0,
+			ADD COLUMN output_tokens BIGINT NOT NULL DEFAULT 0,
+			ADD COLUMN cost_usd DOUBLE PRECISION NOT NULL DEFAULT 0;
+	`)},
+	{Version: 5, Name: "repo_settings", Up: migrate.Exec(`
+		-- JSON document of per-repo overrides of the agent configuration
+		ALTER TABLE repos ADD COLUMN settings TEXT NOT NULL DEFAULT '{}';
+	`)},
+	{Version: 6, Name: "search_archives", Up: func(tx *sql.Tx) error {
+		if err := migrate.Exec(`
+			-- Documents carry their event's seq, which archived output no
+			-- longer has an events row to provide
+			ALTER TABLE search_docs ADD COLUMN seq BIGINT NOT NULL DEFAULT 0;
+			UPDATE search_docs d SET seq = e.seq FROM events e WHERE e.id = d.ref_id;
+			CREATE INDEX idx_search_docs_run_id ON search_docs(run_id);
+
+			-- Output deleted by ArchiveOutput stays indexed until its run is
+			-- deleted
+			CREATE OR REPLACE FUNCTION search_index_run() RETURNS trigger AS $$
+			BEGIN
+				IF TG_OP = 'DELETE' THEN
+					DELETE FROM search_docs WHERE run_id = OLD.id;
+					RETURN OLD;
+				END IF;
+				INSERT INTO search_docs (ref_id, kind, run_id, body, created_at)
+				VALUES (NEW.id, 'prompt', NEW.id, NEW.prompt, NEW.created_at);
+				RETURN NEW;
+			END;
+			$$ LANGUAGE plpgsql;
+
+			CREATE OR REPLACE FUNCTION search_index_event() RETURNS trigger AS $$
+			DECLARE
+				doc_body TEXT;
+			BEGIN
+				IF TG_OP = 'DELETE' THEN
+					IF OLD.type IN ('stdout', 'stderr') AND EXISTS (
+						SELECT 1 FROM event_archives WHERE run_id = OLD.run_id AND last_seq >= OLD.seq) THEN
+						RETURN OLD;
+					END IF;
+					DELETE FROM search_docs WHERE ref_id = OLD.id;
+					RETURN OLD;
+				END IF;
+				doc_body := search_event_body(NEW.type, NEW.data);
+				IF doc_body IS NOT NULL THEN
+					INSERT INTO search_docs (ref_id, kind, run_id, seq, body, created_at)
+					VALUES (NEW.id, CASE NEW.type WHEN 'tool_call_start' THEN 'tool_call' ELSE 'output' END,
+						NEW.run_id, NEW.seq, doc_body, NEW.created_at);
+				END IF;
+				RETURN NEW;
+			END;
+			$$ LANGUAGE plpgsql;
+
+			CREATE FUNCTION search_index_archive() RETURNS trigger AS $$
+			BEGIN
+				DELETE FROM search_docs WHERE run_id = OLD.run_id AND kind = 'output' AND seq <= OLD.last_seq;
+				RETURN OLD;
+			END;
+			$$ LANGUAGE plpgsql;
+			CREATE TRIGGER search_archives AFTER DELETE ON event_archives
+				FOR EACH ROW EXECUTE FUNCTION search_index_archive();
+		`)(tx); err != nil {
+			return err
+		}
+		// Output archived before this migration was dropped from the index
+		return indexArchives(tx)
+	}},
+}
+
+// migrationsFor returns the schema history for a dialect.
+func migrationsFor(dialect migrate.Dialect) []migrate.Migration {
+	if dialect == migrate.Postgres {
+		return postgresMigrations
+	}
+	return migrations
+}
+
+// Migrate applies store migrations to a database, up to version target or
+// the latest version if target is 0. driver and source are as for Open.
+func Migrate(driver, source string, target int) error {
+	db, dialect, err := openDriver(driver, source)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	return migrate.Up(db, dialect, migrationsFor(dialect), target)
+}
+
+// MigrationStatus reports which store migrations a database has applied.
+func MigrationStatus(driver, source string) ([]migrate.Status, error) {
+	db, dialect, err := openDriver(driver, source)
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+	return migrate.List(db, dialect, migrationsFor(dialect))
+}
+
+// addColumnIfMissing adds a column to an existing table unless it is already present.
+func addColumnIfMissing(tx *sql.Tx, table, column, definition string) error {
+	rows, err := tx.Query(fmt.Sprintf("PRAGMA table_info(%s)", table))
+	if err != nil {
+		return fmt.Errorf("table info %s: %w", table, err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var (
+			cid        int
+			name, typ  string
+			notNull    int
+			defaultVal sql.NullString
+			pk         int
+		)
+		if err := rows.Scan(&cid, &name, &typ, &notNull, &defaultVal, &pk); err != nil {
+			return fmt.Errorf("scan table info %s: %w", table, err)
+		}
+		if name == column {
+			return nil
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	rows.Close()
+
+	if _, err := tx.Exec(fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", table, column, definition)); err != nil {
+		return fmt.Errorf("add column %s.%s: %w", table, column, err)
+	}
+	return nil
+}
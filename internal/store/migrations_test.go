@@ -0,0 +1,223 @@
+package store
+
+import (
+	"database/sql"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/anthropics/m/internal/migrate"
+)
+
+// loadFixture creates a database at dbPath from testdata SQL files, as a
+// build at the fixture's schema version would have left it.
+func loadFixture(t *testing.T, dbPath string, files ...string) {
+	t.Helper()
+	db, err := sql.Open("sqlite3", dbPath)
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	defer db.Close()
+	for _, file := range files {
+		data, err := os.ReadFile(filepath.Join("testdata", file))
+		if err != nil {
+			t.Fatalf("read fixture: %v", err)
+		}
+		if _, err := db.Exec(string(data)); err != nil {
+			t.Fatalf("load %s: %v", file, err)
+		}
+	}
+}
+
+// schemaOf describes a database's tables, columns, indexes and triggers.
+// Column order is ignored: databases that gained a column through ALTER
+// TABLE have it last, and queries always name their columns. FTS shadow
+// tables are left out, so FTS4 and FTS5 search indexes compare equal.
+func schemaOf(t *testing.T, db *sql.DB) map[string][]string {
+	t.Helper()
+	rows, err := db.Query(`SELECT type, name FROM sqlite_master
+		WHERE name NOT LIKE 'sqlite_%' AND name NOT LIKE 'search_fts_%' ORDER BY type, name`)
+	if err != nil {
+		t.Fatalf("query sqlite_master: %v", err)
+	}
+	schema := make(map[string][]string)
+	var tables []string
+	for rows.Next() {
+		var typ, name string
+		if err := rows.Scan(&typ, &name); err != nil {
+			t.Fatalf("scan sqlite_master: %v", err)
+		}
+		schema[typ] = append(schema[typ], name)
+		if typ == "table" {
+			tables = append(tables, name)
+		}
+	}
+	rows.Close()
+
+	for _, table := range tables {
+		rows, err := db.Query(fmt.Sprintf("PRAGMA table_info(%s)", table))
+		if err != nil {
+			t.Fatalf("table info %s: %v", table, err)
+		}
+		for rows.Next() {
+			var (
+				cid        int
+				name, typ  string
+				notNull    int
+				defaultVal sql.NullString
+				pk         int
+			)
+			if err := rows.Scan(&cid, &name, &typ, &notNull, &defaultVal, &pk); err != nil {
+				t.Fatalf("scan table info %s: %v", table, err)
+			}
+			schema["column"] = append(schema["column"],
+				fmt.Sprintf("%s.%s %s notnull=%d pk=%d", table, name, typ, notNull, pk))
+		}
+		rows.Close()
+	}
+	sort.Strings(schema["column"])
+	return schema
+}
+
+func TestMigrate_FromLegacyVersions(t *testing.T) {
+	dir := t.TempDir()
+	fresh, err := New(filepath.Join(dir, "fresh.db"))
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	want := schemaOf(t, fresh.db)
+	fresh.Close()
+
+	// Every version before the latest has a testdata/schema_vN.sql, added
+	// with the migration that introduced it.
+	for v := 1; v < len(migrations); v++ {
+		t.Run(fmt.Sprintf("v%d", v), func(t *testing.T) {
+			dbPath := filepath.Join(dir, fmt.Sprintf("legacy_v%d.db", v))
+			loadFixture(t, dbPath, fmt.Sprintf("schema_v%d.sql", v), "data.sql")
+
+			s, err := New(dbPath)
+			if err != nil {
+				t.Fatalf("New: %v", err)
+			}
+			defer s.Close()
+
+			version, err := migrate.Version(s.db, migrate.SQLite)
+			if err != nil {
+				t.Fatalf("Version: %v", err)
+			}
+			if version != len(migrations) {
+				t.Errorf("version = %d, want %d", version, len(migrations))
+			}
+			if got := schemaOf(t, s.db); !reflect.DeepEqual(got, want) {
+				t.Errorf("schema differs from a fresh database:\ngot  %v\nwant %v", got, want)
+			}
+
+			run, err := s.GetRun("run-1")
+			if err != nil {
+				t.Fatalf("GetRun: %v", err)
+			}
+			if run.Prompt != "fix the tests" || run.State != RunStateCompleted {
+				t.Errorf("run = %+v, want fixture run", run)
+			}
+			interaction, err := s.GetInteractionByRequestID("request-1")
+			if err != nil {
+				t.Fatalf("GetInteractionByRequestID: %v", err)
+			}
+			if interaction.Decision == nil || *interaction.Decision != "allow" {
+				t.Errorf("decision = %v, want allow", interaction.Decision)
+			}
+			events, err := s.ListEventsByRun("run-1")
+			if err != nil {
+				t.Fatalf("ListEventsByRun: %v", err)
+			}
+			if len(events) != 1 {
+				t.Errorf("got %d events, want 1", len(events))
+			}
+			for query, ref := range map[string]string{"tests": "run-1", "ls": "interaction-1"} {
+				results, _, err := s.Search(SearchFilter{Query: query})
+				if err != nil || len(results) != 1 || results[0].RefID != ref {
+					t.Errorf("Search(%q) = %v, %v; want %s indexed", query, results, err, ref)
+				}
+			}
+		})
+	}
+}
+
+func TestMigrate_Target(t *testing.T) {
+	dbPath := filepath.Join(t.TempDir(), "test.db")
+	loadFixture(t, dbPath, "schema_v1.sql", "data.sql")
+
+	if err := Migrate(DriverSQLite, dbPath, 3); err != nil {
+		t.Fatalf("Migrate to 3: %v", err)
+	}
+	statuses, err := MigrationStatus(DriverSQLite, dbPath)
+	if err != nil {
+		t.Fatalf("MigrationStatus: %v", err)
+	}
+	if len(statuses) != len(migrations) {
+		t.Fatalf("got %d statuses, want %d", len(statuses), len(migrations))
+	}
+	for _, st := range statuses {
+		if want := st.Version <= 3; st.Applied() != want {
+			t.Errorf("migration %d applied = %v, want %v", st.Version, st.Applied(), want)
+		}
+	}
+
+	if err := Migrate(DriverSQLite, dbPath, 2); err == nil {
+		t.Error("expected error migrating down")
+	}
+	if err := Migrate(DriverSQLite, dbPath, 0); err != nil {
+		t.Fatalf("Migrate to latest: %v", err)
+	}
+	statuses, err = MigrationStatus(DriverSQLite, dbPath)
+	if err != nil {
+		t.Fatalf("MigrationStatus: %v", err)
+	}
+	for _, st := range statuses {
+		if !st.Applied() {
+			t.Errorf("migration %d not applied", st.Version)
+		}
+	}
+}
+
+func TestMigrate_IndexesArchivedOutput(t *testing.T) {
+	dbPath := filepath.Join(t.TempDir(), "test.db")
+	loadFixture(t, dbPath, "schema_v11.sql", "data.sql")
+
+	// Output archived before migration 12 was dropped from the index.
+	data := `{"text":"archived greeting"}`
+	blob, err := encodeArchive([]*Event{{
+		ID:        "event-0",
+		Seq:       0,
+		Type:      "stdout",
+		Data:      &data,
+		CreatedAt: time.Unix(1700000140, 0),
+	}})
+	if err != nil {
+		t.Fatalf("encodeArchive: %v", err)
+	}
+	db, err := sql.Open("sqlite3", dbPath)
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	_, err = db.Exec(`INSERT INTO event_archives (run_id, data, event_count, last_seq, archived_at)
+		VALUES ('run-1', ?, 1, 0, 1700000500)`, blob)
+	db.Close()
+	if err != nil {
+		t.Fatalf("insert archive: %v", err)
+	}
+
+	s, err := New(dbPath)
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	defer s.Close()
+	results, _, err := s.Search(SearchFilter{Query: "greeting"})
+	if err != nil || len(results) != 1 || results[0].RefID != "event-0" || results[0].Kind != SearchKindOutput {
+		t.Errorf("Search(greeting) = %v, %v; want the archived event", results, err)
+	}
+}
@@ -0,0 +1,167 @@
+package store
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Page size limits for paginated lists.
+const (
+	DefaultPageLimit = 50
+	MaxPageLimit     = 500
+)
+
+// Sort orders accepted in Page.Order.
+const (
+	OrderAsc  = "asc"
+	OrderDesc = "desc"
+)
+
+var (
+	// ErrInvalidCursor is returned for a cursor that is malformed or was
+	// issued for a different sort.
+	ErrInvalidCursor = errors.New("invalid cursor")
+
+	// ErrInvalidSort is returned for an unknown sort field or order.
+	ErrInvalidSort = errors.New("invalid sort")
+)
+
+// Page selects one page of a list. Lists are ordered by a sort field with
+// the row ID breaking ties, and a cursor resumes after the last row of the
+// previous page, so pages stay stable while rows are added.
+type Page struct {
+	Limit  int    // Defaults to DefaultPageLimit, capped at MaxPageLimit
+	Cursor string // Next cursor of the previous page; empty for the first page
+	Sort   string // Sort field; empty uses the list's default
+	Order  string // OrderAsc or OrderDesc; empty uses the sort field's default
+}
+
+// sortField is a column a list can be sorted by.
+type sortField struct {
+	column string // SQL expression
+	desc   bool   // Default order
+}
+
+// listSort describes how one list can be sorted.
+type listSort struct {
+	fields      map[string]sortField
+	defaultSort string
+	idColumn    string // Tiebreaker; must be unique within the list
+}
+
+// cursor is the position after the last row of a page.
+type cursor struct {
+	Sort  string `json:"s"`
+	Desc  bool   `json:"d"`
+	Value any    `json:"v"`
+	ID    string `json:"i"`
+}
+
+// pageQuery is a Page resolved against a listSort.
+type pageQuery struct {
+	sort  string
+	desc  bool
+	limit int
+}
+
+// apply appends the cursor condition, ORDER BY and LIMIT for p to a query
+// whose WHERE clause is already open. One row more than the limit is
+// selected so that finish can tell whether another page follows.
+func (ls listSort) apply(p Page, query string, args []any) (string, []any, pageQuery, error) {
+	pq := pageQuery{sort: p.Sort, limit: p.Limit}
+	if pq.sort == "" {
+		pq.sort = ls.defaultSort
+	}
+	field, ok := ls.fields[pq.sort]
+	if !ok {
+		return "", nil, pq, fmt.Errorf("%w: unknown sort field %q", ErrInvalidSort, p.Sort)
+	}
+	switch p.Order {
+	case "":
+		pq.desc = field.desc
+	case OrderAsc, OrderDesc:
+		pq.desc = p.Order == OrderDesc
+	default:
+		return "", nil, pq, fmt.Errorf("%w: order must be %q or %q", ErrInvalidSort, OrderAsc, OrderDesc)
+	}
+	if pq.limit <= 0 {
+		pq.limit = DefaultPageLimit
+	}
+	pq.limit = min(pq.limit, MaxPageLimit)
+
+	cmp, dir := ">", "ASC"
+	if pq.desc {
+		cmp, dir = "<", "DESC"
+	}
+
+	if p.Cursor != "" {
+		c, err := decodeCursor(p.Cursor)
+		if err != nil {
+			return "", nil, pq, err
+		}
+		if c.Sort != pq.sort || c.Desc != pq.desc {
+			return "", nil, pq, fmt.Errorf("%w: cursor was issued for a different sort", ErrInvalidCursor)
+		}
+		query += fmt.Sprintf(" AND (%[1]s %[2]s ? OR (%[1]s = ? AND %[3]s %[2]s ?))", field.column, cmp, ls.idColumn)
+		args = append(args, c.Value, c.Value, c.ID)
+	}
+
+	query += fmt.Sprintf(" ORDER BY %s %s, %s %s LIMIT ?", field.column, dir, ls.idColumn, dir)
+	args = append(args, pq.limit+1)
+	return query, args, pq, nil
+}
+
+// finish trims items selected by apply to the page and returns the cursor of
+// the next page, or "" if this is the last page. key returns an item's sort
+// value for the resolved sort field, and its ID.
+func finish[T any](items []T, pq pageQuery, key func(item T, sort string) (any, string)) ([]T, string) {
+	if len(items) <= pq.limit {
+		return items, ""
+	}
+	items = items[:pq.limit]
+	value, id := key(items[len(items)-1], pq.sort)
+	return items, encodeCursor(cursor{Sort: pq.sort, Desc: pq.desc, Value: value, ID: id})
+}
+
+func encodeCursor(c cursor) string {
+	b, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func decodeCursor(s string) (cursor, error) {
+	var c cursor
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return c, ErrInvalidCursor
+	}
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.UseNumber()
+	if err := dec.Decode(&c); err != nil {
+		return c, ErrInvalidCursor
+	}
+	// Sort values are integers or strings; keep integers exact.
+	switch v := c.Value.(type) {
+	case json.Number:
+		n, err := v.Int64()
+		if err != nil {
+			return c, ErrInvalidCursor
+		}
+		c.Value = n
+	case string:
+	default:
+		return c, ErrInvalidCursor
+	}
+	return c, nil
+}
+
+// likeEscaper escapes LIKE wildcards for patterns using ESCAPE '\'.
+var likeEscaper = strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`)
+
+// likeContains returns a LIKE pattern matching s anywhere.
+func likeContains(s string) string {
+	return "%" + likeEscaper.Replace(s) + "%"
+}
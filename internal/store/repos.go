@@ -2,6 +2,7 @@ package store
 
 import (
 	"database/sql"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"time"
@@ -14,21 +15,82 @@ type Repo struct {
 	ID        string
 	Name      string
 	GitURL    *string
+	Settings  RepoSettings
 	CreatedAt time.Time
 }
 
+// RepoSettings configures the runs of one repository over the server's agent
+// configuration. It is stored as a JSON document; zero values defer to the
+// server.
+type RepoSettings struct {
+	DefaultBranch string `json:"default_branch,omitempty"` // Branch cloned into workspaces
+	AgentType     string `json:"agent_type,omitempty"`
+
+	// ApprovalTools and InputTools replace the server's lists when non-nil;
+	// an empty list means no tool needs approval or input.
+	ApprovalTools []string `json:"approval_tools"`
+	InputTools    []string `json:"input_tools"`
+
+	SystemPrompt string            `json:"system_prompt,omitempty"` // Appended to the agent's system prompt
+	Env          map[string]string `json:"env,omitempty"`           // Environment variables set for the agent
+	Secrets      map[string]string `json:"secrets,omitempty"`       // Agent variable -> server environment variable holding its value
+	Limits       RepoLimits        `json:"limits"`
+}
+
+// RepoLimits bounds the resources of a repository's runs. Zero means no
+// limit.
+type RepoLimits struct {
+	TimeoutSeconds int     `json:"timeout_seconds,omitempty"`
+	MaxCostUSD     float64 `json:"max_cost_usd,omitempty"`
+}
+
+// repoColumns lists the columns scanned by scanRepo, for queries aliasing
+// repos as r.
+const repoColumns = "r.id, r.name, r.git_url, r.settings, r.created_at"
+
+// scanRepo scans a row selected with repoColumns.
+func scanRepo(row rowScanner) (*Repo, error) {
+	var repo Repo
+	var settings string
+	var createdAt int64
+	if err := row.Scan(&repo.ID, &repo.Name, &repo.GitURL, &settings, &createdAt); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal([]byte(settings), &repo.Settings); err != nil {
+		return nil, fmt.Errorf("decode settings of repo %s: %w", repo.ID, err)
+	}
+	repo.CreatedAt = time.Unix(createdAt, 0)
+	return &repo, nil
+}
+
+// scanRepoRows scans every row selected with repoColumns.
+func scanRepoRows(rows *sql.Rows) ([]*Repo, error) {
+	var repos []*Repo
+	for rows.Next() {
+		repo, err := scanRepo(rows)
+		if err != nil {
+			return nil, fmt.Errorf("scan repo: %w", err)
+		}
+		repos = append(repos, repo)
+	}
+	return repos, rows.Err()
+}
+
 // ErrNotFound is returned when an entity is not found.
 var ErrNotFound = errors.New("not found")
 
+// ErrAmbiguousName is returned by GetRepoByName when more than one repo has
+// the name.
+var ErrAmbiguousName = errors.New("more than one repo has this name")
+
 // CreateRepo creates a new repository.
 func (s *Store) CreateRepo(name string, gitURL *string) (*Repo, error) {
-	s.mu.Lock()
-	defer s.mu.Unlock()
+	defer s.span("CreateRepo")()
 
 	id := uuid.New().String()
 	now := time.Now().Unix()
 
-	_, err := s.db.Exec(
+	_, err := s.w.Exec(
 		"INSERT INTO repos (id, name, git_url, created_at) VALUES (?, ?, ?, ?)",
 		id, name, gitURL, now,
 	)
@@ -46,16 +108,12 @@ func (s *Store) CreateRepo(name string, gitURL *string) (*Repo, error) {
 
 // GetRepo retrieves a repository by ID.
 func (s *Store) GetRepo(id string) (*Repo, error) {
-	s.mu.RLock()
-	defer s.mu.RUnlock()
-
-	var repo Repo
-	var createdAt int64
+	defer s.span("GetRepo")()
 
-	err := s.db.QueryRow(
-		"SELECT id, name, git_url, created_at FROM repos WHERE id = ?",
+	repo, err := scanRepo(s.db.QueryRow(
+		"SELECT "+repoColumns+" FROM repos r WHERE r.id = ?",
 		id,
-	).Scan(&repo.ID, &repo.Name, &repo.GitURL, &createdAt)
+	))
 
 	if err == sql.ErrNoRows {
 		return nil, ErrNotFound
@@ -64,67 +122,116 @@ func (s *Store) GetRepo(id string) (*Repo, error) {
 		return nil, fmt.Errorf("query repo: %w", err)
 	}
 
-	repo.CreatedAt = time.Unix(createdAt, 0)
-	return &repo, nil
+	return repo, nil
 }
 
-// GetRepoByName retrieves a repository by name.
+// GetRepoByName retrieves a repository by name. Names are unique for repos
+// created or renamed through the API, but older databases may hold several
+// repos with one name, which returns ErrAmbiguousName.
 func (s *Store) GetRepoByName(name string) (*Repo, error) {
-	s.mu.RLock()
-	defer s.mu.RUnlock()
-
-	var repo Repo
-	var createdAt int64
+	defer s.span("GetRepoByName")()
 
-	err := s.db.QueryRow(
-		"SELECT id, name, git_url, created_at FROM repos WHERE name = ?",
+	rows, err := s.db.Query(
+		"SELECT "+repoColumns+" FROM repos r WHERE r.name = ? LIMIT 2",
 		name,
-	).Scan(&repo.ID, &repo.Name, &repo.GitURL, &createdAt)
-
-	if err == sql.ErrNoRows {
-		return nil, ErrNotFound
-	}
+	)
 	if err != nil {
 		return nil, fmt.Errorf("query repo by name: %w", err)
 	}
+	defer rows.Close()
 
-	repo.CreatedAt = time.Unix(createdAt, 0)
-	return &repo, nil
+	repos, err := scanRepoRows(rows)
+	if err != nil {
+		return nil, err
+	}
+	switch len(repos) {
+	case 0:
+		return nil, ErrNotFound
+	case 1:
+		return repos[0], nil
+	default:
+		return nil, ErrAmbiguousName
+	}
 }
 
 // ListRepos retrieves all repositories.
 func (s *Store) ListRepos() ([]*Repo, error) {
-	s.mu.RLock()
-	defer s.mu.RUnlock()
+	defer s.span("ListRepos")()
 
-	rows, err := s.db.Query("SELECT id, name, git_url, created_at FROM repos ORDER BY created_at DESC")
+	rows, err := s.db.Query("SELECT " + repoColumns + " FROM repos r ORDER BY r.created_at DESC")
 	if err != nil {
 		return nil, fmt.Errorf("query repos: %w", err)
 	}
 	defer rows.Close()
 
-	var repos []*Repo
-	for rows.Next() {
-		var repo Repo
-		var createdAt int64
-		if err := rows.Scan(&repo.ID, &repo.Name, &repo.GitURL, &createdAt); err != nil {
-			return nil, fmt.Errorf("scan repo: %w", err)
-		}
-		repo.CreatedAt = time.Unix(createdAt, 0)
-		repos = append(repos, &repo)
+	return scanRepoRows(rows)
+}
+
+// RepoFilter selects repositories. Zero values match everything.
+type RepoFilter struct {
+	UserID string // Only repos the user is a member of
+	Page          // Sort by created_at (default, newest first) or name
+}
+
+var repoSort = listSort{
+	fields: map[string]sortField{
+		"created_at": {column: "r.created_at", desc: true},
+		"name":       {column: "r.name"},
+	},
+	defaultSort: "created_at",
+	idColumn:    "r.id",
+}
+
+// ListReposPage retrieves one page of repositories matching the filter, and
+// the cursor of the next page.
+func (s *Store) ListReposPage(filter RepoFilter) ([]*Repo, string, error) {
+	defer s.span("ListReposPage")()
+
+	query := "SELECT " + repoColumns + " FROM repos r WHERE 1=1"
+	args := []any{}
+
+	if filter.UserID != "" {
+		query += " AND r.id IN (SELECT repo_id FROM repo_members WHERE user_id = ?)"
+		args = append(args, filter.UserID)
 	}
 
-	return repos, rows.Err()
+	query, args, pq, err := repoSort.apply(filter.Page, query, args)
+	if err != nil {
+		return nil, "", err
+	}
+
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, "", fmt.Errorf("query repos: %w", err)
+	}
+	defer rows.Close()
+
+	repos, err := scanRepoRows(rows)
+	if err != nil {
+		return nil, "", err
+	}
+
+	repos, next := finish(repos, pq, func(r *Repo, sort string) (any, string) {
+		if sort == "name" {
+			return r.Name, r.ID
+		}
+		return r.CreatedAt.Unix(), r.ID
+	})
+	return repos, next, nil
 }
 
-// UpdateRepo updates a repository's name and git URL.
-func (s *Store) UpdateRepo(id, name string, gitURL *string) error {
-	s.mu.Lock()
-	defer s.mu.Unlock()
+// UpdateRepo updates a repository's name, git URL and settings.
+func (s *Store) UpdateRepo(repo *Repo) error {
+	defer s.span("UpdateRepo")()
+
+	settings, err := json.Marshal(repo.Settings)
+	if err != nil {
+		return fmt.Errorf("encode settings: %w", err)
+	}
 
-	result, err := s.db.Exec(
-		"UPDATE repos SET name = ?, git_url = ? WHERE id = ?",
-		name, gitURL, id,
+	result, err := s.w.Exec(
+		"UPDATE repos SET name = ?, git_url = ?, settings = ? WHERE id = ?",
+		repo.Name, repo.GitURL, string(settings), repo.ID,
 	)
 	if err != nil {
 		return fmt.Errorf("update repo: %w", err)
@@ -143,10 +250,9 @@ func (s *Store) UpdateRepo(id, name string, gitURL *string) error {
 
 // DeleteRepo deletes a repository by ID.
 func (s *Store) DeleteRepo(id string) error {
-	s.mu.Lock()
-	defer s.mu.Unlock()
+	defer s.span("DeleteRepo")()
 
-	result, err := s.db.Exec("DELETE FROM repos WHERE id = ?", id)
+	result, err := s.w.Exec("DELETE FROM repos WHERE id = ?", id)
 	if err != nil {
 		return fmt.Errorf("delete repo: %w", err)
 	}
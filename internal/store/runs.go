@@ -4,6 +4,8 @@ import (
 	"database/sql"
 	"errors"
 	"fmt"
+	"slices"
+	"strings"
 	"time"
 
 	"github.com/google/uuid"
@@ -21,6 +23,17 @@ const (
 	RunStateCancelled       RunState = "cancelled"
 )
 
+// RunStates lists every run state, active states first.
+var RunStates = []RunState{
+	RunStateRunning, RunStateWaitingInput, RunStateWaitingApproval,
+	RunStateCompleted, RunStateFailed, RunStateCancelled,
+}
+
+// IsValid returns true if the state is a known run state.
+func (s RunState) IsValid() bool {
+	return slices.Contains(RunStates, s)
+}
+
 // Run represents an agent run.
 type Run struct {
 	ID            string
@@ -30,8 +43,31 @@ type Run struct {
 	WorkspacePath string
 	CreatedAt     time.Time
 	UpdatedAt     time.Time
+
+	// Set by the runner as the run progresses; nil until known.
+	StartedAt  *time.Time // When the agent started
+	FinishedAt *time.Time // When the run reached a terminal state
+	ExitCode   *int       // Agent exit code, if the agent exited by itself
+	Error      *string    // Why the run failed, in one line
+	Agent      *string    // Agent type, such as "claude-code"
+	Model      *string    // Model the agent ran with
+	BaseSHA    *string    // Workspace HEAD commit when the agent started
+	FinalSHA   *string    // Workspace HEAD commit when the run finished
+	Usage      RunUsage   // Summed over the run
 }
 
+// RunUsage is the token usage and cost of a run's model calls.
+type RunUsage struct {
+	InputTokens  int64
+	OutputTokens int64
+	CostUSD      float64
+}
+
+// runColumns are the columns scanRun reads, in order.
+const runColumns = `id, repo_id, prompt, state, workspace_path, created_at, updated_at,
+	started_at, finished_at, exit_code, error, agent, model, base_sha, final_sha,
+	input_tokens, output_tokens, cost_usd`
+
 // IsActive returns true if the run is in an active state.
 func (r *Run) IsActive() bool {
 	return r.State == RunStateRunning ||
@@ -46,74 +82,50 @@ var ErrActiveRunExists = errors.New("active run already exists for this repo")
 // CreateRun creates a new run. Returns ErrActiveRunExists if the repo
 // already has an active run.
 func (s *Store) CreateRun(repoID, prompt, workspacePath string) (*Run, error) {
-	s.mu.Lock()
-	defer s.mu.Unlock()
-
-	// Check for existing active run
-	var exists int
-	err := s.db.QueryRow(
-		`SELECT 1 FROM runs WHERE repo_id = ? AND state IN ('running', 'waiting_input', 'waiting_approval') LIMIT 1`,
-		repoID,
-	).Scan(&exists)
-	if err != nil && err != sql.ErrNoRows {
-		return nil, fmt.Errorf("check active run: %w", err)
-	}
-	if err == nil {
-		return nil, ErrActiveRunExists
-	}
-
-	id := uuid.New().String()
-	now := time.Now().Unix()
-
-	_, err = s.db.Exec(
-		`INSERT INTO runs (id, repo_id, prompt, state, workspace_path, created_at, updated_at)
-		 VALUES (?, ?, ?, ?, ?, ?, ?)`,
-		id, repoID, prompt, RunStateRunning, workspacePath, now, now,
-	)
-	if err != nil {
-		return nil, fmt.Errorf("insert run: %w", err)
-	}
+	defer s.span("CreateRun")()
 
-	return &Run{
-		ID:            id,
-		RepoID:        repoID,
-		Prompt:        prompt,
-		State:         RunStateRunning,
-		WorkspacePath: workspacePath,
-		CreatedAt:     time.Unix(now, 0),
-		UpdatedAt:     time.Unix(now, 0),
-	}, nil
+	return s.createRun(uuid.New().String(), repoID, prompt, workspacePath)
 }
 
 // CreateRunWithID creates a new run with a specific ID. Returns ErrActiveRunExists if the repo
 // already has an active run. This is used when the workspace has already been created with
 // the run ID.
 func (s *Store) CreateRunWithID(id, repoID, prompt, workspacePath string) (*Run, error) {
-	s.mu.Lock()
-	defer s.mu.Unlock()
+	defer s.span("CreateRunWithID")()
 
-	// Check for existing active run
-	var exists int
-	err := s.db.QueryRow(
-		`SELECT 1 FROM runs WHERE repo_id = ? AND state IN ('running', 'waiting_input', 'waiting_approval') LIMIT 1`,
-		repoID,
-	).Scan(&exists)
-	if err != nil && err != sql.ErrNoRows {
-		return nil, fmt.Errorf("check active run: %w", err)
-	}
-	if err == nil {
-		return nil, ErrActiveRunExists
-	}
+	return s.createRun(id, repoID, prompt, workspacePath)
+}
 
+// createRun checks for an active run and inserts the new one in a single
+// write transaction, so two requests cannot both start a run for a repo.
+func (s *Store) createRun(id, repoID, prompt, workspacePath string) (*Run, error) {
 	now := time.Now().Unix()
 
-	_, err = s.db.Exec(
-		`INSERT INTO runs (id, repo_id, prompt, state, workspace_path, created_at, updated_at)
-		 VALUES (?, ?, ?, ?, ?, ?, ?)`,
-		id, repoID, prompt, RunStateRunning, workspacePath, now, now,
-	)
+	err := s.writeTx(func(tx *sql.Tx) error {
+		var exists int
+		err := tx.QueryRow(
+			`SELECT 1 FROM runs WHERE repo_id = ? AND state IN ('running', 'waiting_input', 'waiting_approval') LIMIT 1`,
+			repoID,
+		).Scan(&exists)
+		if err != nil && err != sql.ErrNoRows {
+			return fmt.Errorf("check active run: %w", err)
+		}
+		if err == nil {
+			return ErrActiveRunExists
+		}
+
+		_, err = tx.Exec(
+			`INSERT INTO runs (id, repo_id, prompt, state, workspace_path, created_at, updated_at)
+			 VALUES (?, ?, ?, ?, ?, ?, ?)`,
+			id, repoID, prompt, RunStateRunning, workspacePath, now, now,
+		)
+		if err != nil {
+			return fmt.Errorf("insert run: %w", err)
+		}
+		return nil
+	})
 	if err != nil {
-		return nil, fmt.Errorf("insert run: %w", err)
+		return nil, err
 	}
 
 	return &Run{
@@ -129,18 +141,34 @@ func (s *Store) CreateRunWithID(id, repoID, prompt, workspacePath string) (*Run,
 
 // GetRun retrieves a run by ID.
 func (s *Store) GetRun(id string) (*Run, error) {
-	s.mu.RLock()
-	defer s.mu.RUnlock()
+	defer s.span("GetRun")()
 
+	return scanRun(s.db.QueryRow(
+		`SELECT `+runColumns+`
+		 FROM runs WHERE id = ?`,
+		id,
+	))
+}
+
+// GetRunTx retrieves a run by ID within a transaction started by InTx.
+func (s *Store) GetRunTx(tx *sql.Tx, id string) (*Run, error) {
+	defer s.span("GetRunTx")()
+	return scanRun(tx.QueryRow(
+		`SELECT `+runColumns+`
+		 FROM runs WHERE id = ?`,
+		id,
+	))
+}
+
+func scanRun(row rowScanner) (*Run, error) {
 	var run Run
 	var state string
 	var createdAt, updatedAt int64
+	var startedAt, finishedAt, exitCode sql.NullInt64
 
-	err := s.db.QueryRow(
-		`SELECT id, repo_id, prompt, state, workspace_path, created_at, updated_at
-		 FROM runs WHERE id = ?`,
-		id,
-	).Scan(&run.ID, &run.RepoID, &run.Prompt, &state, &run.WorkspacePath, &createdAt, &updatedAt)
+	err := row.Scan(&run.ID, &run.RepoID, &run.Prompt, &state, &run.WorkspacePath, &createdAt, &updatedAt,
+		&startedAt, &finishedAt, &exitCode, &run.Error, &run.Agent, &run.Model, &run.BaseSHA, &run.FinalSHA,
+		&run.Usage.InputTokens, &run.Usage.OutputTokens, &run.Usage.CostUSD)
 
 	if err == sql.ErrNoRows {
 		return nil, ErrNotFound
@@ -152,16 +180,27 @@ func (s *Store) GetRun(id string) (*Run, error) {
 	run.State = RunState(state)
 	run.CreatedAt = time.Unix(createdAt, 0)
 	run.UpdatedAt = time.Unix(updatedAt, 0)
+	if startedAt.Valid {
+		t := time.Unix(startedAt.Int64, 0)
+		run.StartedAt = &t
+	}
+	if finishedAt.Valid {
+		t := time.Unix(finishedAt.Int64, 0)
+		run.FinishedAt = &t
+	}
+	if exitCode.Valid {
+		code := int(exitCode.Int64)
+		run.ExitCode = &code
+	}
 	return &run, nil
 }
 
 // ListRunsByRepo retrieves all runs for a repository.
 func (s *Store) ListRunsByRepo(repoID string) ([]*Run, error) {
-	s.mu.RLock()
-	defer s.mu.RUnlock()
+	defer s.span("ListRunsByRepo")()
 
 	rows, err := s.db.Query(
-		`SELECT id, repo_id, prompt, state, workspace_path, created_at, updated_at
+		`SELECT `+runColumns+`
 		 FROM runs WHERE repo_id = ? ORDER BY created_at DESC`,
 		repoID,
 	)
@@ -173,13 +212,92 @@ func (s *Store) ListRunsByRepo(repoID string) ([]*Run, error) {
 	return scanRuns(rows)
 }
 
+// RunFilter selects runs. Zero values match everything.
+type RunFilter struct {
+	UserID         string // Only runs in repos the user is a member of
+	RepoID         string
+	States         []RunState // Any of these states
+	CreatedAfter   time.Time  // Inclusive
+	CreatedBefore  time.Time  // Exclusive
+	PromptContains string     // Case-insensitive substring of the prompt
+	Page                      // Sort by created_at (default) or updated_at, newest first by default
+}
+
+var runSort = listSort{
+	fields: map[string]sortField{
+		"created_at": {column: "created_at", desc: true},
+		"updated_at": {column: "updated_at", desc: true},
+	},
+	defaultSort: "created_at",
+	idColumn:    "id",
+}
+
+// ListRunsPage retrieves one page of runs matching the filter, and the cursor
+// of the next page.
+func (s *Store) ListRunsPage(filter RunFilter) ([]*Run, string, error) {
+	defer s.span("ListRunsPage")()
+
+	query := `SELECT ` + runColumns + `
+		 FROM runs WHERE 1=1`
+	args := []any{}
+
+	if filter.UserID != "" {
+		query += " AND repo_id IN (SELECT repo_id FROM repo_members WHERE user_id = ?)"
+		args = append(args, filter.UserID)
+	}
+	if filter.RepoID != "" {
+		query += " AND repo_id = ?"
+		args = append(args, filter.RepoID)
+	}
+	if len(filter.States) > 0 {
+		query += " AND state IN (?" + strings.Repeat(", ?", len(filter.States)-1) + ")"
+		for _, state := range filter.States {
+			args = append(args, string(state))
+		}
+	}
+	if !filter.CreatedAfter.IsZero() {
+		query += " AND created_at >= ?"
+		args = append(args, filter.CreatedAfter.Unix())
+	}
+	if !filter.CreatedBefore.IsZero() {
+		query += " AND created_at < ?"
+		args = append(args, filter.CreatedBefore.Unix())
+	}
+	if filter.PromptContains != "" {
+		query += ` AND LOWER(prompt) LIKE LOWER(CAST(? AS TEXT)) ESCAPE '\'`
+		args = append(args, likeContains(filter.PromptContains))
+	}
+
+	query, args, pq, err := runSort.apply(filter.Page, query, args)
+	if err != nil {
+		return nil, "", err
+	}
+
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, "", fmt.Errorf("query runs: %w", err)
+	}
+	defer rows.Close()
+
+	runs, err := scanRuns(rows)
+	if err != nil {
+		return nil, "", err
+	}
+	runs, next := finish(runs, pq, func(r *Run, sort string) (any, string) {
+		if sort == "updated_at" {
+			return r.UpdatedAt.Unix(), r.ID
+		}
+		return r.CreatedAt.Unix(), r.ID
+	})
+	return runs, next, nil
+}
+
 // ListRunsByState retrieves all runs with a given state.
 func (s *Store) ListRunsByState(state RunState) ([]*Run, error) {
-	s.mu.RLock()
-	defer s.mu.RUnlock()
+	defer s.span("ListRunsByState")()
 
 	rows, err := s.db.Query(
-		`SELECT id, repo_id, prompt, state, workspace_path, created_at, updated_at
+		`SELECT `+runColumns+`
 		 FROM runs WHERE state = ? ORDER BY created_at DESC`,
 		string(state),
 	)
@@ -191,51 +309,154 @@ func (s *Store) ListRunsByState(state RunState) ([]*Run, error) {
 	return scanRuns(rows)
 }
 
+// CountRunsByState returns the number of runs in each state. States without
+// runs are omitted.
+func (s *Store) CountRunsByState() (map[RunState]int, error) {
+	defer s.span("CountRunsByState")()
+	return s.countRunsByState("")
+}
+
+func (s *Store) countRunsByState(userID string) (map[RunState]int, error) {
+
+	query := `SELECT state, COUNT(*) FROM runs`
+	args := []any{}
+	if userID != "" {
+		query += " WHERE repo_id IN (SELECT repo_id FROM repo_members WHERE user_id = ?)"
+		args = append(args, userID)
+	}
+	query += " GROUP BY state"
+
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("count runs by state: %w", err)
+	}
+	defer rows.Close()
+
+	counts := make(map[RunState]int)
+	for rows.Next() {
+		var state string
+		var n int
+		if err := rows.Scan(&state, &n); err != nil {
+			return nil, fmt.Errorf("scan run count: %w", err)
+		}
+		counts[RunState(state)] = n
+	}
+	return counts, rows.Err()
+}
+
 // GetActiveRunByRepo retrieves the active run for a repository, if any.
 func (s *Store) GetActiveRunByRepo(repoID string) (*Run, error) {
-	s.mu.RLock()
-	defer s.mu.RUnlock()
-
-	var run Run
-	var state string
-	var createdAt, updatedAt int64
+	defer s.span("GetActiveRunByRepo")()
 
-	err := s.db.QueryRow(
-		`SELECT id, repo_id, prompt, state, workspace_path, created_at, updated_at
+	return scanRun(s.db.QueryRow(
+		`SELECT `+runColumns+`
 		 FROM runs
 		 WHERE repo_id = ? AND state IN ('running', 'waiting_input', 'waiting_approval')
 		 LIMIT 1`,
 		repoID,
-	).Scan(&run.ID, &run.RepoID, &run.Prompt, &state, &run.WorkspacePath, &createdAt, &updatedAt)
+	))
+}
 
-	if err == sql.ErrNoRows {
-		return nil, ErrNotFound
+// UpdateRunState updates the state of a run. Moving to a terminal state
+// also sets the run's finished time, unless it was already set.
+func (s *Store) UpdateRunState(id string, state RunState) error {
+	defer s.span("UpdateRunState")()
+
+	now := time.Now().Unix()
+	var finishedAt *int64
+	if run := (Run{State: state}); !run.IsActive() {
+		finishedAt = &now
 	}
+
+	result, err := s.w.Exec(
+		"UPDATE runs SET state = ?, updated_at = ?, finished_at = COALESCE(finished_at, ?) WHERE id = ?",
+		string(state), now, finishedAt, id,
+	)
 	if err != nil {
-		return nil, fmt.Errorf("query active run: %w", err)
+		return fmt.Errorf("update run state: %w", err)
 	}
 
-	run.State = RunState(state)
-	run.CreatedAt = time.Unix(createdAt, 0)
-	run.UpdatedAt = time.Unix(updatedAt, 0)
-	return &run, nil
+	n, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("rows affected: %w", err)
+	}
+	if n == 0 {
+		return ErrNotFound
+	}
+
+	// A finished run rarely gets more events; stop caching its seq.
+	if run := (Run{State: state}); !run.IsActive() {
+		s.events.forget(id)
+	}
+
+	return nil
 }
 
-// UpdateRunState updates the state of a run.
-func (s *Store) UpdateRunState(id string, state RunState) error {
-	s.mu.Lock()
-	defer s.mu.Unlock()
+// RunStart describes the agent started for a run. Empty fields are unknown.
+type RunStart struct {
+	Agent   string
+	Model   string
+	BaseSHA string
+}
+
+// StartRun records that the run's agent started now.
+func (s *Store) StartRun(id string, start RunStart) error {
+	defer s.span("StartRun")()
 
 	now := time.Now().Unix()
+	return s.updateRun(
+		"UPDATE runs SET started_at = ?, agent = ?, model = ?, base_sha = ?, updated_at = ? WHERE id = ?",
+		now, nullIfEmpty(start.Agent), nullIfEmpty(start.Model), nullIfEmpty(start.BaseSHA), now, id,
+	)
+}
+
+// RunEnd describes how a run ended. ExitCode is nil if the agent did not exit
+// by itself, and empty strings are unknown.
+type RunEnd struct {
+	State    RunState // A terminal state
+	ExitCode *int
+	Error    string
+	FinalSHA string
+}
 
-	result, err := s.db.Exec(
-		"UPDATE runs SET state = ?, updated_at = ? WHERE id = ?",
-		string(state), now, id,
+// FinishRun moves the run to a terminal state and records how it ended.
+func (s *Store) FinishRun(id string, end RunEnd) error {
+	defer s.span("FinishRun")()
+
+	if run := (Run{State: end.State}); !end.State.IsValid() || run.IsActive() {
+		return fmt.Errorf("finish run: %q is not a terminal state", end.State)
+	}
+	now := time.Now().Unix()
+	err := s.updateRun(
+		`UPDATE runs SET state = ?, finished_at = ?, exit_code = ?, error = ?, final_sha = ?, updated_at = ?
+		 WHERE id = ?`,
+		string(end.State), now, end.ExitCode, nullIfEmpty(end.Error), nullIfEmpty(end.FinalSHA), now, id,
 	)
 	if err != nil {
-		return fmt.Errorf("update run state: %w", err)
+		return err
 	}
+	s.events.forget(id)
+	return nil
+}
+
+// AddRunUsage adds the tokens and cost of model calls to the run's totals.
+func (s *Store) AddRunUsage(id string, usage RunUsage) error {
+	defer s.span("AddRunUsage")()
 
+	return s.updateRun(
+		`UPDATE runs SET input_tokens = input_tokens + ?, output_tokens = output_tokens + ?,
+		 cost_usd = cost_usd + ? WHERE id = ?`,
+		usage.InputTokens, usage.OutputTokens, usage.CostUSD, id,
+	)
+}
+
+// updateRun runs an UPDATE of one run, returning ErrNotFound if it matched
+// nothing.
+func (s *Store) updateRun(query string, args ...any) error {
+	result, err := s.w.Exec(query, args...)
+	if err != nil {
+		return fmt.Errorf("update run: %w", err)
+	}
 	n, err := result.RowsAffected()
 	if err != nil {
 		return fmt.Errorf("rows affected: %w", err)
@@ -243,16 +464,21 @@ func (s *Store) UpdateRunState(id string, state RunState) error {
 	if n == 0 {
 		return ErrNotFound
 	}
-
 	return nil
 }
 
+func nullIfEmpty(s string) *string {
+	if s == "" {
+		return nil
+	}
+	return &s
+}
+
 // DeleteRun deletes a run by ID.
 func (s *Store) DeleteRun(id string) error {
-	s.mu.Lock()
-	defer s.mu.Unlock()
+	defer s.span("DeleteRun")()
 
-	result, err := s.db.Exec("DELETE FROM runs WHERE id = ?", id)
+	result, err := s.w.Exec("DELETE FROM runs WHERE id = ?", id)
 	if err != nil {
 		return fmt.Errorf("delete run: %w", err)
 	}
@@ -264,6 +490,7 @@ func (s *Store) DeleteRun(id string) error {
 	if n == 0 {
 		return ErrNotFound
 	}
+	s.events.forget(id)
 
 	return nil
 }
@@ -271,16 +498,11 @@ func (s *Store) DeleteRun(id string) error {
 func scanRuns(rows *sql.Rows) ([]*Run, error) {
 	var runs []*Run
 	for rows.Next() {
-		var run Run
-		var state string
-		var createdAt, updatedAt int64
-		if err := rows.Scan(&run.ID, &run.RepoID, &run.Prompt, &state, &run.WorkspacePath, &createdAt, &updatedAt); err != nil {
-			return nil, fmt.Errorf("scan run: %w", err)
+		run, err := scanRun(rows)
+		if err != nil {
+			return nil, err
 		}
-		run.State = RunState(state)
-		run.CreatedAt = time.Unix(createdAt, 0)
-		run.UpdatedAt = time.Unix(updatedAt, 0)
-		runs = append(runs, &run)
+		runs = append(runs, run)
 	}
 	return runs, rows.Err()
 }
@@ -0,0 +1,241 @@
+package store
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/anthropics/m/internal/migrate"
+)
+
+// SearchKind is the kind of text a search result matched.
+type SearchKind string
+
+const (
+	SearchKindPrompt      SearchKind = "prompt"      // A run's prompt
+	SearchKindOutput      SearchKind = "output"      // A stdout or stderr event
+	SearchKindToolCall    SearchKind = "tool_call"   // A tool_call_start event's tool and input
+	SearchKindInteraction SearchKind = "interaction" // An approval or input request and its resolution
+)
+
+// SearchKinds lists every search result kind.
+var SearchKinds = []SearchKind{SearchKindPrompt, SearchKindOutput, SearchKindToolCall, SearchKindInteraction}
+
+// SearchFilter selects search results.
+type SearchFilter struct {
+	Query  string       // Words that must all appear, in any order
+	UserID string       // Only runs in repos the user is a member of
+	RepoID string       // Only runs in this repo
+	Kinds  []SearchKind // Any of these kinds
+	Page                // Sort by created_at, newest first
+}
+
+var searchSort = listSort{
+	fields: map[string]sortField{
+		"created_at": {column: "d.created_at", desc: true},
+	},
+	defaultSort: "created_at",
+	idColumn:    "d.ref_id",
+}
+
+// SearchResult is one document matching a search, with the run it belongs to.
+type SearchResult struct {
+	Kind      SearchKind
+	RefID     string // ID of the run, event or interaction that matched
+	Seq       int64  // Event seq for output and tool_call results, else 0
+	Run       *Run
+	RepoName  string
+	Snippet   []SnippetPart // Text around the matches
+	CreatedAt time.Time
+}
+
+// SnippetPart is a piece of a result snippet; Match marks the words that
+// matched the query.
+type SnippetPart struct {
+	Text  string
+	Match bool
+}
+
+// Markers the databases put around matched words in snippets. They are
+// control characters so they cannot be confused with indexed text.
+const (
+	snippetStart = "\x02"
+	snippetEnd   = "\x03"
+)
+
+// Search returns one page of the documents matching the filter's query, newest
+// first, and the cursor of the next page. The index covers run prompts,
+// stdout and stderr text, tool call inputs, and interaction payloads and
+// responses. A query without any words matches nothing.
+func (s *Store) Search(filter SearchFilter) ([]*SearchResult, string, error) {
+	defer s.span("Search")()
+
+	terms := searchTerms(filter.Query)
+	if len(terms) == 0 {
+		return nil, "", nil
+	}
+
+	var query string
+	var args []any
+	if s.dialect == migrate.Postgres {
+		words := strings.Join(terms, " ")
+		query = `SELECT d.kind, d.ref_id, d.seq, d.created_at,
+			ts_headline('simple', d.body, plainto_tsquery('simple', ?), ?),
+			r.id, r.repo_id, r.prompt, r.state, r.workspace_path, r.created_at, r.updated_at, p.name
+			FROM search_docs d
+			JOIN runs r ON r.id = d.run_id
+			JOIN repos p ON p.id = r.repo_id
+			WHERE d.tsv @@ plainto_tsquery('simple', ?)`
+		args = []any{words, fmt.Sprintf("StartSel=%s, StopSel=%s, MaxWords=24, MinWords=8", snippetStart, snippetEnd), words}
+	} else {
+		// FTS5 and FTS4 differ in snippet arguments and rowid column
+		snippet, rowid := "snippet(search_fts, ?, ?, '…', -1, 24)", "docid"
+		if s.fts5 {
+			snippet, rowid = "snippet(search_fts, 0, ?, ?, '…', 24)", "rowid"
+		}
+		query = `SELECT d.kind, d.ref_id, d.seq, d.created_at,
+			` + snippet + `,
+			r.id, r.repo_id, r.prompt, r.state, r.workspace_path, r.created_at, r.updated_at, p.name
+			FROM search_fts
+			JOIN search_docs d ON d.rowid = search_fts.` + rowid + `
+			JOIN runs r ON r.id = d.run_id
+			JOIN repos p ON p.id = r.repo_id
+			WHERE search_fts MATCH ?`
+		phrases := make([]string, len(terms))
+		for i, t := range terms {
+			phrases[i] = `"` + t + `"`
+		}
+		args = []any{snippetStart, snippetEnd, strings.Join(phrases, " ")}
+	}
+
+	if filter.UserID != "" {
+		query += " AND r.repo_id IN (SELECT repo_id FROM repo_members WHERE user_id = ?)"
+		args = append(args, filter.UserID)
+	}
+	if filter.RepoID != "" {
+		query += " AND r.repo_id = ?"
+		args = append(args, filter.RepoID)
+	}
+	if len(filter.Kinds) > 0 {
+		query += " AND d.kind IN (?" + strings.Repeat(", ?", len(filter.Kinds)-1) + ")"
+		for _, k := range filter.Kinds {
+			args = append(args, string(k))
+		}
+	}
+
+	query, args, pq, err := searchSort.apply(filter.Page, query, args)
+	if err != nil {
+		return nil, "", err
+	}
+
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, "", fmt.Errorf("search: %w", err)
+	}
+	defer rows.Close()
+
+	var results []*SearchResult
+	for rows.Next() {
+		var res SearchResult
+		var run Run
+		var createdAt, runCreatedAt, runUpdatedAt int64
+		var snippet string
+		if err := rows.Scan(&res.Kind, &res.RefID, &res.Seq, &createdAt, &snippet,
+			&run.ID, &run.RepoID, &run.Prompt, &run.State, &run.WorkspacePath, &runCreatedAt, &runUpdatedAt,
+			&res.RepoName); err != nil {
+			return nil, "", fmt.Errorf("scan search result: %w", err)
+		}
+		run.CreatedAt = time.Unix(runCreatedAt, 0)
+		run.UpdatedAt = time.Unix(runUpdatedAt, 0)
+		res.Run = &run
+		res.CreatedAt = time.Unix(createdAt, 0)
+		res.Snippet = parseSnippet(snippet)
+		results = append(results, &res)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, "", fmt.Errorf("search: %w", err)
+	}
+
+	results, next := finish(results, pq, func(r *SearchResult, _ string) (any, string) {
+		return r.CreatedAt.Unix(), r.RefID
+	})
+	return results, next, nil
+}
+
+// searchTerms splits a query into words, dropping characters that the
+// full-text query syntax would interpret and words without any letter or
+// digit.
+func searchTerms(query string) []string {
+	var terms []string
+	for _, f := range strings.Fields(query) {
+		f = strings.Map(func(r rune) rune {
+			if r == '"' || unicode.IsControl(r) {
+				return -1
+			}
+			return r
+		}, f)
+		if strings.IndexFunc(f, func(r rune) bool { return unicode.IsLetter(r) || unicode.IsDigit(r) }) >= 0 {
+			terms = append(terms, f)
+		}
+	}
+	return terms
+}
+
+// parseSnippet splits a snippet marked with snippetStart and snippetEnd into
+// parts.
+func parseSnippet(snippet string) []SnippetPart {
+	var parts []SnippetPart
+	for snippet != "" {
+		start := strings.Index(snippet, snippetStart)
+		if start < 0 {
+			parts = append(parts, SnippetPart{Text: snippet})
+			break
+		}
+		if start > 0 {
+			parts = append(parts, SnippetPart{Text: snippet[:start]})
+		}
+		snippet = snippet[start+len(snippetStart):]
+		end := strings.Index(snippet, snippetEnd)
+		if end < 0 {
+			end = len(snippet)
+		}
+		if end > 0 {
+			parts = append(parts, SnippetPart{Text: snippet[:end], Match: true})
+		}
+		snippet = strings.TrimPrefix(snippet[end:], snippetEnd)
+	}
+	return parts
+}
+
+// sqliteHasFTS5 reports whether the SQLite driver was built with FTS5, which
+// takes the sqlite_fts5 build tag.
+func sqliteHasFTS5(q queryer) (bool, error) {
+	var fts5 bool
+	if err := q.QueryRow("SELECT sqlite_compileoption_used('ENABLE_FTS5')").Scan(&fts5); err != nil {
+		return false, fmt.Errorf("check for FTS5: %w", err)
+	}
+	return fts5, nil
+}
+
+// searchIndexFTS5 reports whether a SQLite database's search index is an FTS5
+// table, which migration 12 creates when the driver has FTS5. A binary built
+// without FTS5 cannot write to such a database, so that is an error.
+func searchIndexFTS5(q queryer) (bool, error) {
+	var ddl string
+	if err := q.QueryRow("SELECT sql FROM sqlite_master WHERE name = 'search_fts'").Scan(&ddl); err != nil {
+		return false, fmt.Errorf("inspect search index: %w", err)
+	}
+	if !strings.Contains(strings.ToLower(ddl), "using fts5") {
+		return false, nil
+	}
+	has, err := sqliteHasFTS5(q)
+	if err != nil {
+		return false, err
+	}
+	if !has {
+		return false, errors.New("the database's search index uses FTS5; build with -tags sqlite_fts5 to open it")
+	}
+	return true, nil
+}
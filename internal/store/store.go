@@ -1,136 +1,184 @@
-// Package store provides SQLite persistence for M server.
+// Package store provides persistence for M server, in SQLite by default or
+// in PostgreSQL.
 package store
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
-	"sync"
+	"time"
 
-	_ "github.com/mattn/go-sqlite3"
+	"github.com/anthropics/m/internal/migrate"
 )
 
-// Store provides thread-safe SQLite operations.
+// Store provides thread-safe SQL operations. It implements Backend.
+//
+// Reads use a connection pool and run concurrently with writes, relying on
+// SQLite's WAL mode (or PostgreSQL's MVCC). Writes go through a single
+// writer connection, so a read-then-write transaction never races another
+// write and SQLite never returns SQLITE_BUSY within the process. Events are
+// written by an eventWriter that commits concurrent inserts together.
 type Store struct {
-	db *sql.DB
-	mu sync.RWMutex
+	db      *sql.DB // Readers
+	w       *sql.DB // Single writer connection
+	events  *eventWriter
+	dialect migrate.Dialect
+	fts5    bool            // SQLite search index is FTS5 rather than FTS4
+	ctx     context.Context // Parent of method spans; see WithContext
+}
+
+// Database drivers accepted by Open.
+const (
+	DriverSQLite   = "sqlite"
+	DriverPostgres = "postgres"
+)
+
+// Open opens a Store with the named driver. source is a file path for SQLite
+// and a connection string for PostgreSQL.
+func Open(driver, source string) (*Store, error) {
+	switch driver {
+	case DriverSQLite, "":
+		return New(source)
+	case DriverPostgres:
+		return NewPostgres(source)
+	default:
+		return nil, fmt.Errorf("unknown database driver %q", driver)
+	}
+}
+
+// openDriver opens a single database handle for a driver accepted by Open,
+// for maintenance commands that do not need a Store.
+func openDriver(driver, source string) (*sql.DB, migrate.Dialect, error) {
+	switch driver {
+	case DriverSQLite, "":
+		db, err := openDB(source, sqliteWriterParams)
+		return db, migrate.SQLite, err
+	case DriverPostgres:
+		db, err := openPostgres(source)
+		return db, migrate.Postgres, err
+	default:
+		return nil, 0, fmt.Errorf("unknown database driver %q", driver)
+	}
 }
 
 // New creates a new Store with the given database path.
-// It initializes the schema if needed.
+// It migrates the schema to the latest version.
 func New(dbPath string) (*Store, error) {
-	db, err := sql.Open("sqlite3", dbPath+"?_foreign_keys=on&_journal_mode=WAL")
+	// The writer goes first: it creates the file and switches it to WAL.
+	w, err := openDB(dbPath, sqliteWriterParams)
 	if err != nil {
-		return nil, fmt.Errorf("open database: %w", err)
+		return nil, err
+	}
+	db, err := openDB(dbPath, sqliteReaderParams)
+	if err != nil {
+		w.Close()
+		return nil, err
 	}
+	return newStore(w, db, migrate.SQLite)
+}
 
-	// Verify connection
-	if err := db.Ping(); err != nil {
+// newStore migrates the database to the latest version and wraps the
+// writer w and reader pool db in a Store. It closes both on failure.
+func newStore(w, db *sql.DB, dialect migrate.Dialect) (*Store, error) {
+	w.SetMaxOpenConns(1)
+
+	if err := migrate.Up(w, dialect, migrationsFor(dialect), 0); err != nil {
+		w.Close()
 		db.Close()
-		return nil, fmt.Errorf("ping database: %w", err)
+		return nil, fmt.Errorf("migrate: %w", err)
 	}
 
-	s := &Store{db: db}
+	var fts5 bool
+	if dialect == migrate.SQLite {
+		var err error
+		if fts5, err = searchIndexFTS5(w); err != nil {
+			w.Close()
+			db.Close()
+			return nil, err
+		}
+	}
 
-	// Run migrations
-	if err := s.migrate(); err != nil {
+	events, err := newEventWriter(w)
+	if err != nil {
+		w.Close()
 		db.Close()
-		return nil, fmt.Errorf("migrate: %w", err)
+		return nil, err
 	}
 
-	return s, nil
+	return &Store{db: db, w: w, events: events, dialect: dialect, fts5: fts5}, nil
 }
 
-// Close closes the database connection.
+// SQLite connection parameters. The writer begins transactions with BEGIN
+// IMMEDIATE so that read-then-write transactions take the write lock up
+// front. Readers are query-only, so a write sent to the wrong pool fails
+// instead of contending with the writer.
+const (
+	sqliteWriterParams = "_foreign_keys=on&_journal_mode=WAL&_txlock=immediate"
+	sqliteReaderParams = "_foreign_keys=on&_query_only=on"
+)
+
+// openDB opens and pings the database at dbPath with connection params.
+func openDB(dbPath, params string) (*sql.DB, error) {
+	db, err := sql.Open(timedDriverName, dbPath+"?"+params)
+	if err != nil {
+		return nil, fmt.Errorf("open database: %w", err)
+	}
+
+	// Verify connection
+	if err := db.Ping(); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("ping database: %w", err)
+	}
+	return db, nil
+}
+
+// Close waits for queued events to be written and closes the database
+// connections.
 func (s *Store) Close() error {
-	return s.db.Close()
+	s.events.close()
+	werr := s.w.Close()
+	if err := s.db.Close(); err != nil {
+		return err
+	}
+	return werr
 }
 
-// DB returns the underlying database connection for advanced operations.
-func (s *Store) DB() *sql.DB {
-	return s.db
+// Check verifies that the database answers and accepts writes, for readiness
+// probes. A locked database or a full disk makes the write fail.
+func (s *Store) Check(ctx context.Context) error {
+	defer s.span("Check")()
+
+	if err := s.db.PingContext(ctx); err != nil {
+		return fmt.Errorf("ping: %w", err)
+	}
+	if _, err := s.w.ExecContext(ctx,
+		`INSERT INTO health (id, checked_at) VALUES (1, ?)
+		 ON CONFLICT(id) DO UPDATE SET checked_at = excluded.checked_at`,
+		time.Now().Unix(),
+	); err != nil {
+		return fmt.Errorf("write: %w", err)
+	}
+	return nil
 }
 
-// migrate applies the database schema.
-func (s *Store) migrate() error {
-	schema := `
-		CREATE TABLE IF NOT EXISTS repos (
-			id TEXT PRIMARY KEY,
-			name TEXT NOT NULL,
-			git_url TEXT,
-			created_at INTEGER NOT NULL
-		);
-
-		CREATE TABLE IF NOT EXISTS runs (
-			id TEXT PRIMARY KEY,
-			repo_id TEXT NOT NULL REFERENCES repos(id),
-			prompt TEXT NOT NULL,
-			state TEXT NOT NULL CHECK(state IN ('running', 'waiting_input', 'waiting_approval', 'completed', 'failed', 'cancelled')),
-			workspace_path TEXT NOT NULL,
-			created_at INTEGER NOT NULL,
-			updated_at INTEGER NOT NULL
-		);
-		CREATE INDEX IF NOT EXISTS idx_runs_repo_id ON runs(repo_id);
-		CREATE INDEX IF NOT EXISTS idx_runs_state ON runs(state);
-
-		CREATE TABLE IF NOT EXISTS events (
-			id TEXT PRIMARY KEY,
-			run_id TEXT NOT NULL REFERENCES runs(id),
-			seq INTEGER NOT NULL,
-			type TEXT NOT NULL,
-			data TEXT,
-			created_at INTEGER NOT NULL,
-			UNIQUE(run_id, seq)
-		);
-
-		CREATE TABLE IF NOT EXISTS approvals (
-			id TEXT PRIMARY KEY,
-			run_id TEXT NOT NULL REFERENCES runs(id),
-			event_id TEXT NOT NULL REFERENCES events(id),
-			type TEXT NOT NULL CHECK(type IN ('diff', 'command', 'generic')),
-			state TEXT NOT NULL CHECK(state IN ('pending', 'approved', 'rejected')),
-			payload TEXT,
-			rejection_reason TEXT,
-			created_at INTEGER NOT NULL,
-			resolved_at INTEGER
-		);
-		CREATE INDEX IF NOT EXISTS idx_approvals_run_id ON approvals(run_id);
-		CREATE INDEX IF NOT EXISTS idx_approvals_state ON approvals(state);
-
-		CREATE TABLE IF NOT EXISTS devices (
-			token TEXT PRIMARY KEY,
-			platform TEXT NOT NULL CHECK(platform IN ('ios')),
-			created_at INTEGER NOT NULL
-		);
-
-		CREATE TABLE IF NOT EXISTS interactions (
-			id TEXT PRIMARY KEY,
-			request_id TEXT UNIQUE NOT NULL,
-			run_id TEXT NOT NULL REFERENCES runs(id),
-			type TEXT NOT NULL CHECK(type IN ('approval', 'input')),
-			tool TEXT NOT NULL,
-			payload TEXT,
-			state TEXT NOT NULL CHECK(state IN ('pending', 'resolved')),
-			decision TEXT,
-			message TEXT,
-			response TEXT,
-			created_at INTEGER NOT NULL,
-			resolved_at INTEGER
-		);
-		CREATE INDEX IF NOT EXISTS idx_interactions_run_id ON interactions(run_id);
-		CREATE INDEX IF NOT EXISTS idx_interactions_request_id ON interactions(request_id);
-		CREATE INDEX IF NOT EXISTS idx_interactions_state ON interactions(state);
-	`
-
-	_, err := s.db.Exec(schema)
-	return err
+// DB returns the writer connection for advanced operations. It allows one
+// connection at a time, so callers must not hold it across store calls.
+func (s *Store) DB() *sql.DB {
+	return s.w
 }
 
-// InTx executes a function within a transaction.
+// InTx executes a function within a transaction on the writer connection.
+// fn must not call Store methods other than the *Tx ones, since the writer
+// is busy until fn returns.
 func (s *Store) InTx(fn func(*sql.Tx) error) error {
-	s.mu.Lock()
-	defer s.mu.Unlock()
+	defer s.span("InTx")()
+	return s.writeTx(fn)
+}
 
-	tx, err := s.db.Begin()
+// writeTx runs fn in a transaction on the writer connection, committing if
+// it returns nil. No other write can interleave with fn.
+func (s *Store) writeTx(fn func(*sql.Tx) error) error {
+	tx, err := s.w.Begin()
 	if err != nil {
 		return fmt.Errorf("begin transaction: %w", err)
 	}
@@ -142,3 +190,11 @@ func (s *Store) InTx(fn func(*sql.Tx) error) error {
 
 	return tx.Commit()
 }
+
+// queryer is satisfied by *sql.DB and *sql.Tx, for helpers that run either
+// on the reader pool or inside a write transaction.
+type queryer interface {
+	QueryRow(query string, args ...any) *sql.Row
+	Query(query string, args ...any) (*sql.Rows, error)
+	Exec(query string, args ...any) (sql.Result, error)
+}
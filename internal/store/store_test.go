@@ -1,10 +1,16 @@
 package store
 
 import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
 	"os"
 	"path/filepath"
+	"strings"
 	"sync"
 	"testing"
+	"time"
 )
 
 func TestNew(t *testing.T) {
@@ -83,7 +89,7 @@ func TestRepos_CRUD(t *testing.T) {
 
 	// Update
 	gitURL := "https://github.com/test/repo"
-	err = s.UpdateRepo(repo.ID, "updated-repo", &gitURL)
+	err = s.UpdateRepo(&Repo{ID: repo.ID, Name: "updated-repo", GitURL: &gitURL})
 	if err != nil {
 		t.Fatalf("UpdateRepo: %v", err)
 	}
@@ -485,6 +491,284 @@ func TestConcurrentAccess(t *testing.T) {
 	}
 }
 
+func TestInteractions_ResolveWithUpdatedInput(t *testing.T) {
+	s := newTestStore(t)
+	defer s.Close()
+
+	repo, _ := s.CreateRepo("test-repo", nil)
+	run, _ := s.CreateRun(repo.ID, "prompt", "/workspace")
+
+	payload := `{"command":"rm -rf /"}`
+	interaction, err := s.CreateInteraction("req-1", run.ID, InteractionTypeApproval, "Bash", &payload)
+	if err != nil {
+		t.Fatalf("CreateInteraction: %v", err)
+	}
+
+	updated := `{"command":"rm -rf ./build"}`
+	if err := s.ResolveInteractionWithInput(interaction.ID, InteractionDecisionAllow, nil, nil, &updated); err != nil {
+		t.Fatalf("ResolveInteractionWithInput: %v", err)
+	}
+
+	got, err := s.GetInteraction(interaction.ID)
+	if err != nil {
+		t.Fatalf("GetInteraction: %v", err)
+	}
+	if got.Payload == nil || *got.Payload != payload {
+		t.Errorf("payload = %v, want %q", got.Payload, payload)
+	}
+	if got.UpdatedInput == nil || *got.UpdatedInput != updated {
+		t.Errorf("updated_input = %v, want %q", got.UpdatedInput, updated)
+	}
+
+	// Resolving again fails
+	if err := s.ResolveInteractionWithInput(interaction.ID, InteractionDecisionAllow, nil, nil, &updated); err != ErrNotFound {
+		t.Errorf("err = %v, want ErrNotFound", err)
+	}
+}
+
+func TestNew_AddsMissingColumns(t *testing.T) {
+	dir := t.TempDir()
+	dbPath := filepath.Join(dir, "test.db")
+
+	// Simulate a database created before updated_input existed
+	db, err := sql.Open("sqlite3", dbPath)
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	_, err = db.Exec(`CREATE TABLE interactions (
+		id TEXT PRIMARY KEY,
+		request_id TEXT UNIQUE NOT NULL,
+		run_id TEXT NOT NULL,
+		type TEXT NOT NULL,
+		tool TEXT NOT NULL,
+		payload TEXT,
+		state TEXT NOT NULL,
+		decision TEXT,
+		message TEXT,
+		response TEXT,
+		created_at INTEGER NOT NULL,
+		resolved_at INTEGER
+	)`)
+	db.Close()
+	if err != nil {
+		t.Fatalf("create legacy table: %v", err)
+	}
+
+	s, err := New(dbPath)
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	defer s.Close()
+
+	if _, err := s.db.Exec("SELECT updated_input FROM interactions"); err != nil {
+		t.Errorf("updated_input column not added: %v", err)
+	}
+}
+
+func TestTokens_CreateAuthenticateRevoke(t *testing.T) {
+	s := newTestStore(t)
+	defer s.Close()
+
+	user, err := s.CreateUser("alice")
+	if err != nil {
+		t.Fatalf("CreateUser: %v", err)
+	}
+	if _, err := s.CreateUser("alice"); err != ErrUserExists {
+		t.Errorf("duplicate user err = %v, want ErrUserExists", err)
+	}
+
+	token, plaintext, err := s.CreateToken(user.ID, "laptop", []Scope{ScopeRead, ScopeApprove}, nil)
+	if err != nil {
+		t.Fatalf("CreateToken: %v", err)
+	}
+
+	// Only the hash is stored
+	var stored string
+	if err := s.db.QueryRow("SELECT token_hash FROM api_tokens WHERE id = ?", token.ID).Scan(&stored); err != nil {
+		t.Fatalf("query token: %v", err)
+	}
+	if stored == plaintext {
+		t.Error("token stored in plaintext")
+	}
+
+	got, err := s.AuthenticateToken(plaintext)
+	if err != nil {
+		t.Fatalf("AuthenticateToken: %v", err)
+	}
+	if got.ID != token.ID || !got.HasScope(ScopeApprove) || got.HasScope(ScopeSteer) {
+		t.Errorf("authenticated token = %+v", got)
+	}
+	if got.LastUsedAt == nil {
+		t.Error("last_used_at not set")
+	}
+
+	if _, err := s.AuthenticateToken("m_unknown"); err != ErrInvalidToken {
+		t.Errorf("unknown token err = %v, want ErrInvalidToken", err)
+	}
+
+	if err := s.RevokeToken(token.ID); err != nil {
+		t.Fatalf("RevokeToken: %v", err)
+	}
+	if _, err := s.AuthenticateToken(plaintext); err != ErrInvalidToken {
+		t.Errorf("revoked token err = %v, want ErrInvalidToken", err)
+	}
+
+	// Expired tokens are rejected
+	past := time.Now().Add(-time.Minute)
+	_, expired, err := s.CreateToken(user.ID, "old", []Scope{ScopeRead}, &past)
+	if err != nil {
+		t.Fatalf("CreateToken: %v", err)
+	}
+	if _, err := s.AuthenticateToken(expired); err != ErrInvalidToken {
+		t.Errorf("expired token err = %v, want ErrInvalidToken", err)
+	}
+
+	// Deleting the user removes their tokens
+	if err := s.DeleteUser(user.ID); err != nil {
+		t.Fatalf("DeleteUser: %v", err)
+	}
+	tokens, err := s.ListTokens("")
+	if err != nil {
+		t.Fatalf("ListTokens: %v", err)
+	}
+	if len(tokens) != 0 {
+		t.Errorf("got %d tokens after user deletion, want 0", len(tokens))
+	}
+}
+
+func TestTokens_HookTokenRequiresActiveRun(t *testing.T) {
+	s := newTestStore(t)
+	defer s.Close()
+
+	repo, _ := s.CreateRepo("test-repo", nil)
+	run, _ := s.CreateRun(repo.ID, "prompt", "/workspace")
+
+	token, plaintext, err := s.CreateHookToken(run.ID, time.Now().Add(time.Hour))
+	if err != nil {
+		t.Fatalf("CreateHookToken: %v", err)
+	}
+	if token.RunID == nil || *token.RunID != run.ID {
+		t.Errorf("run_id = %v, want %s", token.RunID, run.ID)
+	}
+
+	got, err := s.AuthenticateToken(plaintext)
+	if err != nil {
+		t.Fatalf("AuthenticateToken: %v", err)
+	}
+	if !got.HasScope(ScopeHook) || got.HasScope(ScopeRead) {
+		t.Errorf("hook token scopes = %v", got.Scopes)
+	}
+
+	// Hook tokens are not listed with user tokens
+	tokens, _ := s.ListTokens("")
+	if len(tokens) != 0 {
+		t.Errorf("got %d listed tokens, want 0", len(tokens))
+	}
+
+	if err := s.UpdateRunState(run.ID, RunStateCompleted); err != nil {
+		t.Fatalf("UpdateRunState: %v", err)
+	}
+	if _, err := s.AuthenticateToken(plaintext); err != ErrInvalidToken {
+		t.Errorf("finished run token err = %v, want ErrInvalidToken", err)
+	}
+}
+
+func TestAuditLog_AppendOnly(t *testing.T) {
+	s := newTestStore(t)
+	defer s.Close()
+
+	userID := "user-1"
+	for _, action := range []string{"run.create", "approval.resolve", "run.cancel"} {
+		entry := &AuditEntry{
+			UserID:     &userID,
+			Actor:      "alice",
+			Action:     action,
+			TargetType: "run",
+			TargetID:   "run-1",
+			Method:     "POST",
+			Path:       "/api/runs/run-1",
+			Status:     200,
+		}
+		if err := s.CreateAuditEntry(entry); err != nil {
+			t.Fatalf("CreateAuditEntry: %v", err)
+		}
+		if entry.ID == 0 {
+			t.Error("entry ID not set")
+		}
+	}
+
+	entries, err := s.ListAuditEntries(AuditFilter{Action: "approval.resolve"})
+	if err != nil {
+		t.Fatalf("ListAuditEntries: %v", err)
+	}
+	if len(entries) != 1 || entries[0].Actor != "alice" {
+		t.Errorf("filtered entries = %+v", entries)
+	}
+
+	entries, _ = s.ListAuditEntries(AuditFilter{UserID: userID, Limit: 2})
+	if len(entries) != 2 || entries[0].Action != "run.cancel" {
+		t.Errorf("expected newest 2 entries, got %+v", entries)
+	}
+
+	if _, err := s.w.Exec("UPDATE audit_log SET actor = 'mallory'"); err == nil {
+		t.Error("expected update to fail")
+	}
+	if _, err := s.w.Exec("DELETE FROM audit_log"); err == nil {
+		t.Error("expected delete to fail")
+	}
+}
+
+func TestRepoMembers(t *testing.T) {
+	s := newTestStore(t)
+	defer s.Close()
+
+	user, _ := s.CreateUser("alice")
+	visible, _ := s.CreateRepo("visible", nil)
+	hidden, _ := s.CreateRepo("hidden", nil)
+
+	if _, err := s.SetRepoMember(visible.ID, user.ID, RepoRoleViewer); err != nil {
+		t.Fatalf("SetRepoMember: %v", err)
+	}
+	member, err := s.SetRepoMember(visible.ID, user.ID, RepoRoleApprover)
+	if err != nil {
+		t.Fatalf("SetRepoMember update: %v", err)
+	}
+	if member.Role != RepoRoleApprover {
+		t.Errorf("role = %s, want approver", member.Role)
+	}
+	if !member.Role.Allows(RepoRoleOperator) || member.Role.Allows(RepoRoleOwner) {
+		t.Error("approver role ordering is wrong")
+	}
+
+	repos, err := s.ListReposForUser(user.ID)
+	if err != nil {
+		t.Fatalf("ListReposForUser: %v", err)
+	}
+	if len(repos) != 1 || repos[0].ID != visible.ID {
+		t.Errorf("visible repos = %v", repos)
+	}
+
+	visibleRun, _ := s.CreateRun(visible.ID, "prompt", "/workspace")
+	hiddenRun, _ := s.CreateRun(hidden.ID, "prompt", "/workspace")
+	s.CreateInteraction("req-1", visibleRun.ID, InteractionTypeApproval, "Bash", nil)
+	s.CreateInteraction("req-2", hiddenRun.ID, InteractionTypeApproval, "Bash", nil)
+
+	pending, err := s.ListPendingInteractionsForUser(user.ID)
+	if err != nil {
+		t.Fatalf("ListPendingInteractionsForUser: %v", err)
+	}
+	if len(pending) != 1 || pending[0].RunID != visibleRun.ID {
+		t.Errorf("visible pending = %v", pending)
+	}
+
+	if err := s.RemoveRepoMember(visible.ID, user.ID); err != nil {
+		t.Fatalf("RemoveRepoMember: %v", err)
+	}
+	if _, err := s.GetRepoMember(visible.ID, user.ID); err != ErrNotFound {
+		t.Errorf("err = %v, want ErrNotFound", err)
+	}
+}
+
 func newTestStore(t *testing.T) *Store {
 	t.Helper()
 	dir := t.TempDir()
@@ -501,3 +785,328 @@ func newTestStore(t *testing.T) *Store {
 func TestMain(m *testing.M) {
 	os.Exit(m.Run())
 }
+
+func TestCheck(t *testing.T) {
+	s, err := New(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+
+	if err := s.Check(context.Background()); err != nil {
+		t.Fatalf("Check: %v", err)
+	}
+	// The health row is upserted, so repeated checks succeed.
+	if err := s.Check(context.Background()); err != nil {
+		t.Fatalf("second Check: %v", err)
+	}
+
+	s.Close()
+	if err := s.Check(context.Background()); err == nil {
+		t.Error("expected error after Close")
+	}
+}
+
+// createRunsAt creates completed runs in repo, one per creation time.
+func createRunsAt(t *testing.T, s *Store, repoID string, prompts []string, createdAt []int64) []*Run {
+	t.Helper()
+	runs := make([]*Run, len(prompts))
+	for i, prompt := range prompts {
+		run, err := s.CreateRun(repoID, prompt, "/workspace")
+		if err != nil {
+			t.Fatalf("CreateRun: %v", err)
+		}
+		if err := s.UpdateRunState(run.ID, RunStateCompleted); err != nil {
+			t.Fatalf("UpdateRunState: %v", err)
+		}
+		if _, err := s.w.Exec("UPDATE runs SET created_at = ? WHERE id = ?", createdAt[i], run.ID); err != nil {
+			t.Fatalf("set created_at: %v", err)
+		}
+		runs[i] = run
+	}
+	return runs
+}
+
+func TestListRunsPage(t *testing.T) {
+	s := newTestStore(t)
+	defer s.Close()
+
+	repo, _ := s.CreateRepo("test-repo", nil)
+	other, _ := s.CreateRepo("other-repo", nil)
+	// Two runs share a creation time, so pages must break ties by ID.
+	runs := createRunsAt(t, s, repo.ID,
+		[]string{"fix bug", "add feature", "fix 100% of tests", "refactor", "Fix typo"},
+		[]int64{1000, 2000, 2000, 3000, 4000})
+	createRunsAt(t, s, other.ID, []string{"fix elsewhere"}, []int64{5000})
+	s.UpdateRunState(runs[3].ID, RunStateFailed)
+
+	// Page through newest first, two at a time.
+	var got []string
+	page := Page{Limit: 2}
+	for {
+		batch, next, err := s.ListRunsPage(RunFilter{RepoID: repo.ID, Page: page})
+		if err != nil {
+			t.Fatalf("ListRunsPage: %v", err)
+		}
+		if len(batch) > 2 {
+			t.Fatalf("page has %d runs, want at most 2", len(batch))
+		}
+		for _, r := range batch {
+			got = append(got, r.ID)
+		}
+		if next == "" {
+			break
+		}
+		page.Cursor = next
+	}
+	if len(got) != len(runs) {
+		t.Fatalf("paged %d runs, want %d", len(got), len(runs))
+	}
+	seen := make(map[string]bool)
+	for _, id := range got {
+		if seen[id] {
+			t.Errorf("run %s returned twice", id)
+		}
+		seen[id] = true
+	}
+	if got[0] != runs[4].ID || got[4] != runs[0].ID {
+		t.Errorf("order = %v, want newest first", got)
+	}
+
+	tests := []struct {
+		name   string
+		filter RunFilter
+		want   []*Run
+	}{
+		{"state", RunFilter{States: []RunState{RunStateFailed}}, []*Run{runs[3]}},
+		{"created range", RunFilter{CreatedAfter: time.Unix(3000, 0), CreatedBefore: time.Unix(4000, 0)}, []*Run{runs[3]}},
+		{"prompt", RunFilter{PromptContains: "fix"}, []*Run{runs[4], runs[2], runs[0]}},
+		{"prompt wildcard escaped", RunFilter{PromptContains: "100%"}, []*Run{runs[2]}},
+		{"ascending", RunFilter{Page: Page{Order: OrderAsc, Limit: 1}}, []*Run{runs[0]}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.filter.RepoID = repo.ID
+			got, _, err := s.ListRunsPage(tt.filter)
+			if err != nil {
+				t.Fatalf("ListRunsPage: %v", err)
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("got %d runs, want %d", len(got), len(tt.want))
+			}
+			for i := range got {
+				if got[i].ID != tt.want[i].ID {
+					t.Errorf("run %d = %q, want %q", i, got[i].Prompt, tt.want[i].Prompt)
+				}
+			}
+		})
+	}
+}
+
+func TestListPage_InvalidParams(t *testing.T) {
+	s := newTestStore(t)
+	defer s.Close()
+
+	repo, _ := s.CreateRepo("test-repo", nil)
+	createRunsAt(t, s, repo.ID, []string{"a", "b"}, []int64{1000, 2000})
+
+	_, next, err := s.ListRunsPage(RunFilter{Page: Page{Limit: 1}})
+	if err != nil || next == "" {
+		t.Fatalf("ListRunsPage: next = %q, err = %v", next, err)
+	}
+
+	tests := []struct {
+		name string
+		page Page
+		want error
+	}{
+		{"unknown sort", Page{Sort: "prompt"}, ErrInvalidSort},
+		{"unknown order", Page{Order: "sideways"}, ErrInvalidSort},
+		{"malformed cursor", Page{Cursor: "not a cursor"}, ErrInvalidCursor},
+		{"cursor for other sort", Page{Cursor: next, Sort: "updated_at"}, ErrInvalidCursor},
+		{"cursor for other order", Page{Cursor: next, Order: OrderAsc}, ErrInvalidCursor},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, _, err := s.ListRunsPage(RunFilter{Page: tt.page}); !errors.Is(err, tt.want) {
+				t.Errorf("err = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestListReposPage(t *testing.T) {
+	s := newTestStore(t)
+	defer s.Close()
+
+	for _, name := range []string{"charlie", "alpha", "bravo"} {
+		if _, err := s.CreateRepo(name, nil); err != nil {
+			t.Fatalf("CreateRepo: %v", err)
+		}
+	}
+
+	first, next, err := s.ListReposPage(RepoFilter{Page: Page{Sort: "name", Limit: 2}})
+	if err != nil {
+		t.Fatalf("ListReposPage: %v", err)
+	}
+	rest, last, err := s.ListReposPage(RepoFilter{Page: Page{Sort: "name", Limit: 2, Cursor: next}})
+	if err != nil {
+		t.Fatalf("ListReposPage: %v", err)
+	}
+	if last != "" {
+		t.Errorf("expected no cursor after the last page, got %q", last)
+	}
+	var names []string
+	for _, r := range append(first, rest...) {
+		names = append(names, r.Name)
+	}
+	if strings.Join(names, ",") != "alpha,bravo,charlie" {
+		t.Errorf("names = %v, want alpha,bravo,charlie", names)
+	}
+}
+
+func TestListEventsPage(t *testing.T) {
+	s := newTestStore(t)
+	defer s.Close()
+
+	repo, _ := s.CreateRepo("test-repo", nil)
+	run, _ := s.CreateRun(repo.ID, "prompt", "/workspace")
+	for _, typ := range []string{"stdout", "tool_use", "stdout", "stderr", "stdout"} {
+		if _, err := s.CreateEvent(run.ID, typ, nil); err != nil {
+			t.Fatalf("CreateEvent: %v", err)
+		}
+	}
+
+	events, next, err := s.ListEventsPage(EventFilter{RunID: run.ID, Types: []string{"stdout"}, Page: Page{Limit: 2}})
+	if err != nil {
+		t.Fatalf("ListEventsPage: %v", err)
+	}
+	if len(events) != 2 || events[0].Seq != 1 || events[1].Seq != 3 {
+		t.Fatalf("first page = %v, want seqs 1 and 3", events)
+	}
+	events, next, err = s.ListEventsPage(EventFilter{RunID: run.ID, Types: []string{"stdout"}, Page: Page{Limit: 2, Cursor: next}})
+	if err != nil {
+		t.Fatalf("ListEventsPage: %v", err)
+	}
+	if len(events) != 1 || events[0].Seq != 5 || next != "" {
+		t.Errorf("second page = %v (next %q), want seq 5 and no cursor", events, next)
+	}
+}
+
+func TestOpen_UnknownDriver(t *testing.T) {
+	if _, err := Open("mysql", "m.db"); err == nil {
+		t.Error("expected error for unknown driver")
+	}
+}
+
+func TestRebind(t *testing.T) {
+	tests := []struct {
+		query, want string
+	}{
+		{"SELECT 1", "SELECT 1"},
+		{"SELECT * FROM runs WHERE id = ? AND state = ?", "SELECT * FROM runs WHERE id = $1 AND state = $2"},
+		{`SELECT * FROM runs WHERE prompt LIKE ? ESCAPE '\' LIMIT ?`, `SELECT * FROM runs WHERE prompt LIKE $1 ESCAPE '\' LIMIT $2`},
+		{"SELECT '?', 'it''s ?', \"odd?\" FROM t WHERE a = ?", "SELECT '?', 'it''s ?', \"odd?\" FROM t WHERE a = $1"},
+		{"-- what?\nSELECT ?", "-- what?\nSELECT $1"},
+		{"VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)", "VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)"},
+		{"SELECT * FROM t WHERE a = '' AND b = ?", "SELECT * FROM t WHERE a = '' AND b = $1"},
+		{"SELECT * FROM t WHERE a = '?''' AND b = ?", "SELECT * FROM t WHERE a = '?''' AND b = $1"},
+		{"SELECT * FROM t WHERE data->>'text' = ?", "SELECT * FROM t WHERE data->>'text' = $1"},
+		{"SELECT ? -- last?", "SELECT $1 -- last?"},
+		{"SELECT ?, 'open ?", "SELECT $1, 'open ?"},
+	}
+	for _, tt := range tests {
+		if got := rebind(tt.query); got != tt.want {
+			t.Errorf("rebind(%q) = %q, want %q", tt.query, got, tt.want)
+		}
+	}
+}
+
+func TestReadsDoNotWaitForWriter(t *testing.T) {
+	s := newTestStore(t)
+	defer s.Close()
+
+	repo, _ := s.CreateRepo("test-repo", nil)
+	run, _ := s.CreateRun(repo.ID, "prompt", "/workspace")
+
+	// Hold the writer connection in a transaction while reading.
+	inTx := make(chan struct{})
+	release := make(chan struct{})
+	done := make(chan error, 1)
+	go func() {
+		done <- s.InTx(func(tx *sql.Tx) error {
+			if _, err := tx.Exec("UPDATE runs SET prompt = 'changed' WHERE id = ?", run.ID); err != nil {
+				return err
+			}
+			close(inTx)
+			<-release
+			return nil
+		})
+	}()
+	<-inTx
+
+	got, err := s.GetRun(run.ID)
+	if err != nil {
+		t.Fatalf("GetRun during write: %v", err)
+	}
+	if got.Prompt != "prompt" {
+		t.Errorf("prompt = %q, want the committed %q", got.Prompt, "prompt")
+	}
+	close(release)
+	if err := <-done; err != nil {
+		t.Fatalf("InTx: %v", err)
+	}
+
+	if got, _ := s.GetRun(run.ID); got.Prompt != "changed" {
+		t.Errorf("prompt after commit = %q, want %q", got.Prompt, "changed")
+	}
+}
+
+// BenchmarkCreateEvent measures event ingestion with N runs each writing
+// events sequentially, as a run's output reader does.
+func BenchmarkCreateEvent(b *testing.B) {
+	for _, runs := range []int{1, 4, 16, 64} {
+		b.Run(fmt.Sprintf("runs=%d", runs), func(b *testing.B) {
+			s, err := New(filepath.Join(b.TempDir(), "bench.db"))
+			if err != nil {
+				b.Fatalf("New: %v", err)
+			}
+			defer s.Close()
+
+			ids := make([]string, runs)
+			for i := range ids {
+				repo, err := s.CreateRepo(fmt.Sprintf("repo-%d", i), nil)
+				if err != nil {
+					b.Fatalf("CreateRepo: %v", err)
+				}
+				run, err := s.CreateRun(repo.ID, "bench", "/workspace")
+				if err != nil {
+					b.Fatalf("CreateRun: %v", err)
+				}
+				ids[i] = run.ID
+			}
+			data := `{"stream":"stdout","line":"some output from the agent"}`
+
+			b.ResetTimer()
+			var wg sync.WaitGroup
+			for i, id := range ids {
+				// Spread b.N events over the runs.
+				n := b.N / runs
+				if i < b.N%runs {
+					n++
+				}
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					for j := 0; j < n; j++ {
+						if _, err := s.CreateEvent(id, "stdout", &data); err != nil {
+							b.Error(err)
+							return
+						}
+					}
+				}()
+			}
+			wg.Wait()
+			b.ReportMetric(float64(b.N)/b.Elapsed().Seconds(), "events/s")
+		})
+	}
+}
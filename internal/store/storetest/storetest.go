@@ -0,0 +1,1230 @@
+// Package storetest is the conformance suite for store.Backend
+// implementations. Every backend must pass Run so the API behaves the same on
+// each of them.
+package storetest
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/anthropics/m/internal/store"
+)
+
+// Run runs the conformance suite. open must return an empty, migrated
+// backend for each call; the suite closes it.
+func Run(t *testing.T, open func(t *testing.T) store.Backend) {
+	tests := []struct {
+		name string
+		fn   func(t *testing.T, b store.Backend)
+	}{
+		{"Repos", testRepos},
+		{"Runs", testRuns},
+		{"RunsPage", testRunsPage},
+		{"RunMetadata", testRunMetadata},
+		{"Events", testEvents},
+		{"ConcurrentWrites", testConcurrentWrites},
+		{"Archive", testArchive},
+		{"ImportRun", testImportRun},
+		{"Interactions", testInteractions},
+		{"InteractionsTx", testInteractionsTx},
+		{"Approvals", testApprovals},
+		{"Devices", testDevices},
+		{"UsersAndTokens", testUsersAndTokens},
+		{"Members", testMembers},
+		{"Audit", testAudit},
+		{"Search", testSearch},
+		{"Check", testCheck},
+		{"Backup", testBackup},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := open(t)
+			t.Cleanup(func() { b.Close() })
+			tt.fn(t, b)
+		})
+	}
+}
+
+func ptr(s string) *string { return &s }
+
+func mustRepo(t *testing.T, b store.Backend, name string) *store.Repo {
+	t.Helper()
+	repo, err := b.CreateRepo(name, nil)
+	if err != nil {
+		t.Fatalf("CreateRepo(%s): %v", name, err)
+	}
+	return repo
+}
+
+func mustRun(t *testing.T, b store.Backend, repoID, prompt string) *store.Run {
+	t.Helper()
+	run, err := b.CreateRun(repoID, prompt, "/tmp/ws")
+	if err != nil {
+		t.Fatalf("CreateRun: %v", err)
+	}
+	return run
+}
+
+// mustFinishedRun creates a run and moves it to a terminal state, so that
+// another run can start in the same repo.
+func mustFinishedRun(t *testing.T, b store.Backend, repoID, prompt string, state store.RunState) *store.Run {
+	t.Helper()
+	run := mustRun(t, b, repoID, prompt)
+	if err := b.UpdateRunState(run.ID, state); err != nil {
+		t.Fatalf("UpdateRunState: %v", err)
+	}
+	run.State = state
+	return run
+}
+
+func testRepos(t *testing.T, b store.Backend) {
+	repo, err := b.CreateRepo("alpha", ptr("https://example.com/alpha.git"))
+	if err != nil {
+		t.Fatalf("CreateRepo: %v", err)
+	}
+
+	got, err := b.GetRepo(repo.ID)
+	if err != nil {
+		t.Fatalf("GetRepo: %v", err)
+	}
+	if got.Name != "alpha" || got.GitURL == nil || *got.GitURL != "https://example.com/alpha.git" {
+		t.Errorf("GetRepo = %+v", got)
+	}
+	if got.CreatedAt.Unix() != repo.CreatedAt.Unix() {
+		t.Errorf("CreatedAt = %v, want %v", got.CreatedAt, repo.CreatedAt)
+	}
+
+	byName, err := b.GetRepoByName("alpha")
+	if err != nil || byName.ID != repo.ID {
+		t.Errorf("GetRepoByName = %v, %v", byName, err)
+	}
+	if _, err := b.GetRepoByName("missing"); !errors.Is(err, store.ErrNotFound) {
+		t.Errorf("GetRepoByName(missing) err = %v, want ErrNotFound", err)
+	}
+	if _, err := b.GetRepo("missing"); !errors.Is(err, store.ErrNotFound) {
+		t.Errorf("GetRepo(missing) err = %v, want ErrNotFound", err)
+	}
+
+	if got.Settings.ApprovalTools != nil || got.Settings.Limits != (store.RepoLimits{}) {
+		t.Errorf("new repo settings = %+v, want zero", got.Settings)
+	}
+
+	settings := store.RepoSettings{
+		DefaultBranch: "main",
+		AgentType:     "claude",
+		ApprovalTools: []string{},
+		InputTools:    []string{"AskUserQuestion"},
+		SystemPrompt:  "Run go vet before finishing.",
+		Env:           map[string]string{"GOFLAGS": "-mod=mod"},
+		Secrets:       map[string]string{"GITHUB_TOKEN": "M_ALPHA_GITHUB_TOKEN"},
+		Limits:        store.RepoLimits{TimeoutSeconds: 600, MaxCostUSD: 2.5},
+	}
+	if err := b.UpdateRepo(&store.Repo{ID: repo.ID, Name: "beta", Settings: settings}); err != nil {
+		t.Fatalf("UpdateRepo: %v", err)
+	}
+	got, err = b.GetRepo(repo.ID)
+	if err != nil {
+		t.Fatalf("GetRepo: %v", err)
+	}
+	if got.Name != "beta" || got.GitURL != nil || !reflect.DeepEqual(got.Settings, settings) {
+		t.Errorf("after update = %+v", got)
+	}
+	if got.Settings.ApprovalTools == nil {
+		t.Error("empty approval tool list read back as nil")
+	}
+	if err := b.UpdateRepo(&store.Repo{ID: "missing", Name: "x"}); !errors.Is(err, store.ErrNotFound) {
+		t.Errorf("UpdateRepo(missing) err = %v, want ErrNotFound", err)
+	}
+
+	mustRepo(t, b, "gamma")
+	repos, err := b.ListRepos()
+	if err != nil {
+		t.Fatalf("ListRepos: %v", err)
+	}
+	if len(repos) != 2 {
+		t.Errorf("ListRepos = %d repos, want 2", len(repos))
+	}
+
+	page, next, err := b.ListReposPage(store.RepoFilter{Page: store.Page{Sort: "name", Order: store.OrderAsc, Limit: 1}})
+	if err != nil {
+		t.Fatalf("ListReposPage: %v", err)
+	}
+	if len(page) != 1 || page[0].Name != "beta" || next == "" {
+		t.Fatalf("first page = %v, next %q", page, next)
+	}
+	page, next, err = b.ListReposPage(store.RepoFilter{Page: store.Page{Sort: "name", Order: store.OrderAsc, Limit: 1, Cursor: next}})
+	if err != nil {
+		t.Fatalf("ListReposPage: %v", err)
+	}
+	if len(page) != 1 || page[0].Name != "gamma" || next != "" {
+		t.Errorf("second page = %v, next %q", page, next)
+	}
+
+	// The store does not keep names unique; lookups by a shared name fail
+	mustRepo(t, b, "gamma")
+	if _, err := b.GetRepoByName("gamma"); !errors.Is(err, store.ErrAmbiguousName) {
+		t.Errorf("GetRepoByName(shared name) err = %v, want ErrAmbiguousName", err)
+	}
+
+	if err := b.DeleteRepo(repo.ID); err != nil {
+		t.Fatalf("DeleteRepo: %v", err)
+	}
+	if err := b.DeleteRepo(repo.ID); !errors.Is(err, store.ErrNotFound) {
+		t.Errorf("DeleteRepo twice err = %v, want ErrNotFound", err)
+	}
+}
+
+func testRuns(t *testing.T, b store.Backend) {
+	repo := mustRepo(t, b, "repo")
+
+	run := mustRun(t, b, repo.ID, "first")
+	if run.State != store.RunStateRunning {
+		t.Errorf("new run state = %s, want running", run.State)
+	}
+	if _, err := b.CreateRun(repo.ID, "second", "/tmp/ws"); !errors.Is(err, store.ErrActiveRunExists) {
+		t.Errorf("second active run err = %v, want ErrActiveRunExists", err)
+	}
+
+	active, err := b.GetActiveRunByRepo(repo.ID)
+	if err != nil || active.ID != run.ID {
+		t.Errorf("GetActiveRunByRepo = %v, %v", active, err)
+	}
+
+	if err := b.UpdateRunState(run.ID, store.RunStateCompleted); err != nil {
+		t.Fatalf("UpdateRunState: %v", err)
+	}
+	if _, err := b.GetActiveRunByRepo(repo.ID); !errors.Is(err, store.ErrNotFound) {
+		t.Errorf("GetActiveRunByRepo after completion err = %v, want ErrNotFound", err)
+	}
+	if err := b.UpdateRunState("missing", store.RunStateFailed); !errors.Is(err, store.ErrNotFound) {
+		t.Errorf("UpdateRunState(missing) err = %v, want ErrNotFound", err)
+	}
+
+	withID, err := b.CreateRunWithID("run-fixed-id", repo.ID, "second", "/tmp/ws2")
+	if err != nil {
+		t.Fatalf("CreateRunWithID: %v", err)
+	}
+	got, err := b.GetRun("run-fixed-id")
+	if err != nil {
+		t.Fatalf("GetRun: %v", err)
+	}
+	if got.ID != withID.ID || got.Prompt != "second" || got.WorkspacePath != "/tmp/ws2" || got.RepoID != repo.ID {
+		t.Errorf("GetRun = %+v", got)
+	}
+
+	byRepo, err := b.ListRunsByRepo(repo.ID)
+	if err != nil || len(byRepo) != 2 {
+		t.Errorf("ListRunsByRepo = %d runs, %v; want 2", len(byRepo), err)
+	}
+	running, err := b.ListRunsByState(store.RunStateRunning)
+	if err != nil || len(running) != 1 || running[0].ID != withID.ID {
+		t.Errorf("ListRunsByState(running) = %v, %v", running, err)
+	}
+
+	counts, err := b.CountRunsByState()
+	if err != nil {
+		t.Fatalf("CountRunsByState: %v", err)
+	}
+	if counts[store.RunStateRunning] != 1 || counts[store.RunStateCompleted] != 1 {
+		t.Errorf("CountRunsByState = %v", counts)
+	}
+
+	err = b.InTx(func(tx *sql.Tx) error {
+		got, err := b.GetRunTx(tx, run.ID)
+		if err != nil {
+			return err
+		}
+		if got.State != store.RunStateCompleted {
+			t.Errorf("GetRunTx state = %s, want completed", got.State)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("InTx: %v", err)
+	}
+
+	if err := b.DeleteRun(run.ID); err != nil {
+		t.Fatalf("DeleteRun: %v", err)
+	}
+	if _, err := b.GetRun(run.ID); !errors.Is(err, store.ErrNotFound) {
+		t.Errorf("GetRun after delete err = %v, want ErrNotFound", err)
+	}
+}
+
+func testRunsPage(t *testing.T, b store.Backend) {
+	repoA := mustRepo(t, b, "a")
+	repoB := mustRepo(t, b, "b")
+	mustFinishedRun(t, b, repoA.ID, "Fix the LOGIN page", store.RunStateCompleted)
+	mustFinishedRun(t, b, repoA.ID, "add 100% coverage", store.RunStateFailed)
+	mustFinishedRun(t, b, repoA.ID, "refactor", store.RunStateCompleted)
+	mustRun(t, b, repoB.ID, "login flow")
+
+	var all []*store.Run
+	cursor := ""
+	for {
+		page, next, err := b.ListRunsPage(store.RunFilter{Page: store.Page{Limit: 3, Cursor: cursor}})
+		if err != nil {
+			t.Fatalf("ListRunsPage: %v", err)
+		}
+		all = append(all, page...)
+		if next == "" {
+			break
+		}
+		cursor = next
+	}
+	if len(all) != 4 {
+		t.Fatalf("paged through %d runs, want 4", len(all))
+	}
+	seen := make(map[string]bool)
+	for _, run := range all {
+		if seen[run.ID] {
+			t.Errorf("run %s listed twice", run.ID)
+		}
+		seen[run.ID] = true
+	}
+
+	tests := []struct {
+		name   string
+		filter store.RunFilter
+		want   int
+	}{
+		{"repo", store.RunFilter{RepoID: repoA.ID}, 3},
+		{"states", store.RunFilter{States: []store.RunState{store.RunStateCompleted, store.RunStateRunning}}, 3},
+		{"prompt case-insensitive", store.RunFilter{PromptContains: "login"}, 2},
+		{"prompt wildcard literal", store.RunFilter{PromptContains: "100%"}, 1},
+		{"repo and state", store.RunFilter{RepoID: repoA.ID, States: []store.RunState{store.RunStateFailed}}, 1},
+	}
+	for _, tt := range tests {
+		runs, _, err := b.ListRunsPage(tt.filter)
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if len(runs) != tt.want {
+			t.Errorf("%s: got %d runs, want %d", tt.name, len(runs), tt.want)
+		}
+	}
+
+	if _, _, err := b.ListRunsPage(store.RunFilter{Page: store.Page{Sort: "bogus"}}); !errors.Is(err, store.ErrInvalidSort) {
+		t.Errorf("bad sort err = %v, want ErrInvalidSort", err)
+	}
+	if _, _, err := b.ListRunsPage(store.RunFilter{Page: store.Page{Cursor: "!!"}}); !errors.Is(err, store.ErrInvalidCursor) {
+		t.Errorf("bad cursor err = %v, want ErrInvalidCursor", err)
+	}
+}
+
+func testRunMetadata(t *testing.T, b store.Backend) {
+	repo := mustRepo(t, b, "repo")
+	run := mustRun(t, b, repo.ID, "fix the tests")
+	got, err := b.GetRun(run.ID)
+	if err != nil {
+		t.Fatalf("GetRun: %v", err)
+	}
+	if got.StartedAt != nil || got.FinishedAt != nil || got.ExitCode != nil || got.Agent != nil || got.Usage != (store.RunUsage{}) {
+		t.Errorf("new run has metadata: %+v", got)
+	}
+
+	if err := b.StartRun(run.ID, store.RunStart{Agent: "claude-code", Model: "opus", BaseSHA: "abc123"}); err != nil {
+		t.Fatalf("StartRun: %v", err)
+	}
+	for _, u := range []store.RunUsage{{InputTokens: 100, OutputTokens: 20, CostUSD: 0.25}, {InputTokens: 50, OutputTokens: 5, CostUSD: 0.5}} {
+		if err := b.AddRunUsage(run.ID, u); err != nil {
+			t.Fatalf("AddRunUsage: %v", err)
+		}
+	}
+	code := 2
+	if err := b.FinishRun(run.ID, store.RunEnd{State: store.RunStateFailed, ExitCode: &code, Error: "tests failed", FinalSHA: "def456"}); err != nil {
+		t.Fatalf("FinishRun: %v", err)
+	}
+
+	got, err = b.GetRun(run.ID)
+	if err != nil {
+		t.Fatalf("GetRun: %v", err)
+	}
+	if got.State != store.RunStateFailed || got.StartedAt == nil || got.FinishedAt == nil ||
+		got.ExitCode == nil || *got.ExitCode != 2 || got.Error == nil || *got.Error != "tests failed" {
+		t.Errorf("finished run = %+v", got)
+	}
+	if got.Agent == nil || *got.Agent != "claude-code" || got.Model == nil || *got.Model != "opus" ||
+		got.BaseSHA == nil || *got.BaseSHA != "abc123" || got.FinalSHA == nil || *got.FinalSHA != "def456" {
+		t.Errorf("agent and commits = %v %v %v %v", got.Agent, got.Model, got.BaseSHA, got.FinalSHA)
+	}
+	if want := (store.RunUsage{InputTokens: 150, OutputTokens: 25, CostUSD: 0.75}); got.Usage != want {
+		t.Errorf("usage = %+v, want %+v", got.Usage, want)
+	}
+	runs, _, err := b.ListRunsPage(store.RunFilter{RepoID: repo.ID})
+	if err != nil || len(runs) != 1 || runs[0].Usage != got.Usage || runs[0].FinishedAt == nil {
+		t.Errorf("ListRunsPage = %+v, %v", runs, err)
+	}
+
+	// Any move to a terminal state sets the finished time.
+	cancelled := mustFinishedRun(t, b, repo.ID, "second", store.RunStateCancelled)
+	if got, _ := b.GetRun(cancelled.ID); got.FinishedAt == nil || got.ExitCode != nil {
+		t.Errorf("cancelled run = %+v", got)
+	}
+
+	if err := b.FinishRun(run.ID, store.RunEnd{State: store.RunStateRunning}); err == nil {
+		t.Error("FinishRun with an active state succeeded")
+	}
+	if err := b.StartRun("missing", store.RunStart{}); !errors.Is(err, store.ErrNotFound) {
+		t.Errorf("StartRun(missing) err = %v, want ErrNotFound", err)
+	}
+	if err := b.AddRunUsage("missing", store.RunUsage{}); !errors.Is(err, store.ErrNotFound) {
+		t.Errorf("AddRunUsage(missing) err = %v, want ErrNotFound", err)
+	}
+}
+
+func testEvents(t *testing.T, b store.Backend) {
+	repo := mustRepo(t, b, "repo")
+	run := mustRun(t, b, repo.ID, "prompt")
+	other := mustRun(t, b, mustRepo(t, b, "other").ID, "prompt")
+
+	if seq, err := b.GetLatestEventSeq(run.ID); err != nil || seq != 0 {
+		t.Errorf("GetLatestEventSeq on empty run = %d, %v; want 0", seq, err)
+	}
+
+	for i := 1; i <= 5; i++ {
+		event, err := b.CreateEvent(run.ID, "stdout", ptr(`{"data":"line"}`))
+		if err != nil {
+			t.Fatalf("CreateEvent: %v", err)
+		}
+		if event.Seq != int64(i) {
+			t.Errorf("event seq = %d, want %d", event.Seq, i)
+		}
+	}
+	if event, err := b.CreateEvent(other.ID, "state", nil); err != nil || event.Seq != 1 {
+		t.Errorf("other run first event = %v, %v; want seq 1", event, err)
+	}
+
+	events, err := b.ListEventsByRun(run.ID)
+	if err != nil || len(events) != 5 {
+		t.Fatalf("ListEventsByRun = %d events, %v; want 5", len(events), err)
+	}
+	got, err := b.GetEvent(events[0].ID)
+	if err != nil || got.Data == nil || *got.Data != `{"data":"line"}` {
+		t.Errorf("GetEvent = %v, %v", got, err)
+	}
+
+	since, err := b.ListEventsByRunSince(run.ID, 3)
+	if err != nil || len(since) != 2 || since[0].Seq != 4 {
+		t.Errorf("ListEventsByRunSince(3) = %v, %v", since, err)
+	}
+	bySeq, err := b.GetEventByRunSeq(run.ID, 2)
+	if err != nil || bySeq.ID != events[1].ID {
+		t.Errorf("GetEventByRunSeq = %v, %v", bySeq, err)
+	}
+	if _, err := b.GetEventByRunSeq(run.ID, 99); !errors.Is(err, store.ErrNotFound) {
+		t.Errorf("GetEventByRunSeq(99) err = %v, want ErrNotFound", err)
+	}
+	if seq, err := b.GetLatestEventSeq(run.ID); err != nil || seq != 5 {
+		t.Errorf("GetLatestEventSeq = %d, %v; want 5", seq, err)
+	}
+
+	page, next, err := b.ListEventsPage(store.EventFilter{RunID: run.ID, Page: store.Page{Limit: 2, Order: store.OrderDesc}})
+	if err != nil {
+		t.Fatalf("ListEventsPage: %v", err)
+	}
+	if len(page) != 2 || page[0].Seq != 5 || next == "" {
+		t.Errorf("ListEventsPage desc = %v, next %q", page, next)
+	}
+
+	if err := b.DeleteEventsByRun(run.ID); err != nil {
+		t.Fatalf("DeleteEventsByRun: %v", err)
+	}
+	if events, err := b.ListEventsByRun(run.ID); err != nil || len(events) != 0 {
+		t.Errorf("events after delete = %d, %v", len(events), err)
+	}
+	if event, err := b.CreateEvent(run.ID, "stdout", nil); err != nil || event.Seq != 1 {
+		t.Errorf("event after delete = %v, %v; want seq 1", event, err)
+	}
+}
+
+func testArchive(t *testing.T, b store.Backend) {
+	run := mustRun(t, b, mustRepo(t, b, "repo").ID, "prompt")
+	active := mustRun(t, b, mustRepo(t, b, "active").ID, "prompt")
+
+	for _, typ := range []string{"run_started", "stdout", "tool_call_start", "stderr", "stdout", "run_completed"} {
+		if _, err := b.CreateEvent(run.ID, typ, ptr(`{"text":"`+typ+`"}`)); err != nil {
+			t.Fatalf("CreateEvent: %v", err)
+		}
+	}
+	if _, err := b.CreateEvent(active.ID, "stdout", nil); err != nil {
+		t.Fatalf("CreateEvent: %v", err)
+	}
+	before, err := b.ListEventsByRun(run.ID)
+	if err != nil {
+		t.Fatalf("ListEventsByRun: %v", err)
+	}
+	if err := b.UpdateRunState(run.ID, store.RunStateCompleted); err != nil {
+		t.Fatalf("UpdateRunState: %v", err)
+	}
+
+	// Runs that finished after the cutoff are left alone.
+	if res, err := b.ArchiveOutput(time.Now().Add(-time.Hour)); err != nil || res.Runs != 0 {
+		t.Errorf("ArchiveOutput(past) = %+v, %v; want nothing archived", res, err)
+	}
+	res, err := b.ArchiveOutput(time.Now().Add(time.Minute))
+	if err != nil {
+		t.Fatalf("ArchiveOutput: %v", err)
+	}
+	if res.Runs != 1 || res.Events != 3 {
+		t.Errorf("ArchiveOutput = %+v, want 1 run and 3 events", res)
+	}
+	if page, _, err := b.ListEventsPage(store.EventFilter{RunID: active.ID}); err != nil || len(page) != 1 {
+		t.Errorf("active run events = %d, %v; want 1", len(page), err)
+	}
+
+	// Reads re-expand the archive.
+	after, err := b.ListEventsByRun(run.ID)
+	if err != nil || len(after) != len(before) {
+		t.Fatalf("ListEventsByRun after archive = %d events, %v; want %d", len(after), err, len(before))
+	}
+	for i := range before {
+		if after[i].ID != before[i].ID || after[i].Seq != before[i].Seq || after[i].Type != before[i].Type ||
+			*after[i].Data != *before[i].Data || !after[i].CreatedAt.Equal(before[i].CreatedAt) {
+			t.Errorf("event %d after archive = %+v, want %+v", i, after[i], before[i])
+		}
+	}
+	since, err := b.ListEventsByRunSince(run.ID, 3)
+	if err != nil || len(since) != 3 || since[0].Type != "stderr" || since[1].Type != "stdout" {
+		t.Errorf("ListEventsByRunSince(3) = %v, %v", since, err)
+	}
+	if e, err := b.GetEventByRunSeq(run.ID, 2); err != nil || e.Type != "stdout" {
+		t.Errorf("GetEventByRunSeq(2) = %v, %v", e, err)
+	}
+
+	page, next, err := b.ListEventsPage(store.EventFilter{RunID: run.ID, Page: store.Page{Limit: 4, Order: store.OrderDesc}})
+	if err != nil || len(page) != 4 || page[0].Seq != 6 || page[3].Seq != 3 || next == "" {
+		t.Fatalf("ListEventsPage desc = %v, next %q, %v", page, next, err)
+	}
+	page, next, err = b.ListEventsPage(store.EventFilter{RunID: run.ID, Page: store.Page{Limit: 4, Order: store.OrderDesc, Cursor: next}})
+	if err != nil || len(page) != 2 || page[0].Seq != 2 || page[1].Seq != 1 || next != "" {
+		t.Errorf("ListEventsPage desc page 2 = %v, next %q, %v", page, next, err)
+	}
+	page, _, err = b.ListEventsPage(store.EventFilter{RunID: run.ID, Types: []string{"stdout"}})
+	if err != nil || len(page) != 2 || page[0].Seq != 2 || page[1].Seq != 5 {
+		t.Errorf("ListEventsPage(stdout) = %v, %v", page, err)
+	}
+
+	// New events continue the sequence, and later output joins the archive.
+	if seq, err := b.GetLatestEventSeq(run.ID); err != nil || seq != 6 {
+		t.Errorf("GetLatestEventSeq = %d, %v; want 6", seq, err)
+	}
+	e, err := b.CreateEvent(run.ID, "stdout", ptr(`{"text":"late"}`))
+	if err != nil || e.Seq != 7 {
+		t.Fatalf("CreateEvent after archive = %v, %v; want seq 7", e, err)
+	}
+	if res, err := b.ArchiveOutput(time.Now().Add(time.Minute)); err != nil || res.Runs != 1 || res.Events != 1 {
+		t.Errorf("second ArchiveOutput = %+v, %v; want 1 run and 1 event", res, err)
+	}
+	all, err := b.ListEventsByRun(run.ID)
+	if err != nil || len(all) != 7 || all[6].Seq != 7 || all[6].Type != "stdout" {
+		t.Errorf("ListEventsByRun after second archive = %v, %v", all, err)
+	}
+
+	// Deleting a run's events also deletes its archive.
+	if err := b.DeleteEventsByRun(run.ID); err != nil {
+		t.Fatalf("DeleteEventsByRun: %v", err)
+	}
+	if all, err := b.ListEventsByRun(run.ID); err != nil || len(all) != 0 {
+		t.Errorf("ListEventsByRun after delete = %v, %v; want none", all, err)
+	}
+}
+
+func testImportRun(t *testing.T, b store.Backend) {
+	repo := mustRepo(t, b, "repo")
+	created := time.Unix(1700000000, 0)
+	resolved := created.Add(time.Minute)
+	run := &store.Run{
+		ID: "imported", RepoID: repo.ID, Prompt: "fix the tests", State: store.RunStateCompleted,
+		WorkspacePath: "/tmp/ws", CreatedAt: created, UpdatedAt: resolved,
+	}
+	events := []*store.Event{
+		{ID: "imported-e1", Seq: 1, Type: "run_started", CreatedAt: created},
+		{ID: "imported-e2", Seq: 2, Type: "stdout", Data: ptr(`{"text":"ok"}`), CreatedAt: resolved},
+	}
+	interactions := []*store.Interaction{{
+		ID: "imported-i1", RequestID: "imported-r1", Type: store.InteractionTypeApproval, Tool: "Bash",
+		Payload: ptr(`{"command":"ls"}`), State: store.InteractionStateResolved, Decision: ptr("allow"),
+		CreatedAt: created, ResolvedAt: &resolved,
+	}}
+	if err := b.ImportRun(run, events, interactions); err != nil {
+		t.Fatalf("ImportRun: %v", err)
+	}
+
+	got, err := b.GetRun("imported")
+	if err != nil {
+		t.Fatalf("GetRun: %v", err)
+	}
+	if got.State != store.RunStateCompleted || !got.CreatedAt.Equal(created) || !got.UpdatedAt.Equal(resolved) {
+		t.Errorf("imported run = %+v", got)
+	}
+	gotEvents, err := b.ListEventsByRun("imported")
+	if err != nil || len(gotEvents) != 2 || gotEvents[1].Seq != 2 || *gotEvents[1].Data != `{"text":"ok"}` {
+		t.Fatalf("imported events = %v, %v", gotEvents, err)
+	}
+	// New events continue the imported seqs.
+	next, err := b.CreateEvent("imported", "note", nil)
+	if err != nil || next.Seq != 3 {
+		t.Errorf("CreateEvent after import = %v, %v; want seq 3", next, err)
+	}
+	i, err := b.GetInteraction("imported-i1")
+	if err != nil || i.RunID != "imported" || i.ResolvedAt == nil || !i.ResolvedAt.Equal(resolved) {
+		t.Errorf("imported interaction = %+v, %v", i, err)
+	}
+
+	// The whole import is rolled back when any record is rejected.
+	dup := &store.Run{ID: "dup", RepoID: repo.ID, State: store.RunStateFailed, CreatedAt: created, UpdatedAt: created}
+	if err := b.ImportRun(dup, events, nil); err == nil {
+		t.Error("ImportRun with duplicate event IDs succeeded")
+	}
+	if _, err := b.GetRun("dup"); !errors.Is(err, store.ErrNotFound) {
+		t.Errorf("GetRun after failed import err = %v, want ErrNotFound", err)
+	}
+
+	active := &store.Run{ID: "active", RepoID: repo.ID, State: store.RunStateRunning, CreatedAt: created, UpdatedAt: created}
+	if err := b.ImportRun(active, nil, nil); !errors.Is(err, store.ErrImportActiveRun) {
+		t.Errorf("ImportRun(active) err = %v, want ErrImportActiveRun", err)
+	}
+}
+
+func testConcurrentWrites(t *testing.T, b store.Backend) {
+	const runs, perRun = 4, 25
+
+	// Each run gets events from several goroutines at once; seqs must still
+	// be 1..n per run, whatever the interleaving across runs.
+	ids := make([]string, runs)
+	for i := range ids {
+		ids[i] = mustRun(t, b, mustRepo(t, b, fmt.Sprintf("repo-%d", i)).ID, "prompt").ID
+	}
+
+	var wg sync.WaitGroup
+	errs := make(chan error, runs*perRun+1)
+	for _, id := range ids {
+		for i := 0; i < perRun; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				if _, err := b.CreateEvent(id, "stdout", nil); err != nil {
+					errs <- err
+				}
+			}()
+		}
+	}
+	// An event for a missing run fails without failing the others.
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		if _, err := b.CreateEvent("missing", "stdout", nil); err == nil {
+			errs <- errors.New("CreateEvent(missing run) succeeded")
+		}
+	}()
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Errorf("CreateEvent: %v", err)
+	}
+
+	for _, id := range ids {
+		events, err := b.ListEventsByRun(id)
+		if err != nil || len(events) != perRun {
+			t.Fatalf("ListEventsByRun = %d events, %v; want %d", len(events), err, perRun)
+		}
+		for i, event := range events {
+			if event.Seq != int64(i+1) {
+				t.Fatalf("run %s event %d seq = %d, want %d", id, i, event.Seq, i+1)
+			}
+		}
+	}
+
+	// Only one of several concurrent CreateRun calls for a repo wins.
+	repo := mustRepo(t, b, "contended")
+	var created sync.WaitGroup
+	results := make(chan error, 8)
+	for i := 0; i < 8; i++ {
+		created.Add(1)
+		go func() {
+			defer created.Done()
+			_, err := b.CreateRun(repo.ID, "prompt", "/tmp/ws")
+			results <- err
+		}()
+	}
+	created.Wait()
+	close(results)
+	wins := 0
+	for err := range results {
+		switch {
+		case err == nil:
+			wins++
+		case !errors.Is(err, store.ErrActiveRunExists):
+			t.Errorf("CreateRun: %v", err)
+		}
+	}
+	if wins != 1 {
+		t.Errorf("concurrent CreateRun succeeded %d times, want 1", wins)
+	}
+}
+
+func testInteractions(t *testing.T, b store.Backend) {
+	run := mustRun(t, b, mustRepo(t, b, "repo").ID, "prompt")
+
+	approval, err := b.CreateInteraction("req-1", run.ID, store.InteractionTypeApproval, "Bash", ptr(`{"command":"ls"}`))
+	if err != nil {
+		t.Fatalf("CreateInteraction: %v", err)
+	}
+	if approval.State != store.InteractionStatePending {
+		t.Errorf("state = %s, want pending", approval.State)
+	}
+	dup, err := b.CreateInteraction("req-1", run.ID, store.InteractionTypeApproval, "Bash", nil)
+	if !errors.Is(err, store.ErrDuplicateRequest) || dup == nil || dup.ID != approval.ID {
+		t.Errorf("duplicate request = %v, %v; want existing and ErrDuplicateRequest", dup, err)
+	}
+	input, err := b.CreateInteraction("req-2", run.ID, store.InteractionTypeInput, "AskUserQuestion", nil)
+	if err != nil {
+		t.Fatalf("CreateInteraction: %v", err)
+	}
+
+	pending, err := b.ListPendingInteractions()
+	if err != nil || len(pending) != 2 {
+		t.Errorf("ListPendingInteractions = %d, %v; want 2", len(pending), err)
+	}
+	byRun, err := b.ListPendingInteractionsByRun(run.ID)
+	if err != nil || len(byRun) != 2 {
+		t.Errorf("ListPendingInteractionsByRun = %d, %v; want 2", len(byRun), err)
+	}
+
+	if err := b.ResolveInteractionWithInput(approval.ID, store.InteractionDecisionAllow, nil, nil, ptr(`{"command":"ls -la"}`)); err != nil {
+		t.Fatalf("ResolveInteractionWithInput: %v", err)
+	}
+	got, err := b.GetInteractionByRequestID("req-1")
+	if err != nil {
+		t.Fatalf("GetInteractionByRequestID: %v", err)
+	}
+	if got.State != store.InteractionStateResolved || got.Decision == nil || *got.Decision != "allow" ||
+		got.UpdatedInput == nil || *got.UpdatedInput != `{"command":"ls -la"}` || got.ResolvedAt == nil {
+		t.Errorf("resolved interaction = %+v", got)
+	}
+	if err := b.ResolveInteraction(approval.ID, store.InteractionDecisionBlock, nil, nil); err == nil {
+		t.Error("resolving twice succeeded")
+	}
+
+	if err := b.ResolveInteraction(input.ID, store.InteractionDecisionAllow, nil, ptr("yes")); err != nil {
+		t.Fatalf("ResolveInteraction: %v", err)
+	}
+	got, err = b.GetInteraction(input.ID)
+	if err != nil || got.Response == nil || *got.Response != "yes" {
+		t.Errorf("GetInteraction = %v, %v", got, err)
+	}
+
+	resolved := store.InteractionStateResolved
+	list, err := b.ListInteractions(run.ID, &resolved)
+	if err != nil || len(list) != 2 {
+		t.Errorf("ListInteractions(resolved) = %d, %v; want 2", len(list), err)
+	}
+	inputType := store.InteractionTypeInput
+	page, _, err := b.ListInteractionsPage(store.InteractionFilter{RunID: run.ID, Type: &inputType})
+	if err != nil || len(page) != 1 || page[0].ID != input.ID {
+		t.Errorf("ListInteractionsPage(input) = %v, %v", page, err)
+	}
+
+	if err := b.DeleteInteractionsByRun(run.ID); err != nil {
+		t.Fatalf("DeleteInteractionsByRun: %v", err)
+	}
+	if _, err := b.GetInteraction(input.ID); !errors.Is(err, store.ErrNotFound) {
+		t.Errorf("GetInteraction after delete err = %v, want ErrNotFound", err)
+	}
+}
+
+func testInteractionsTx(t *testing.T, b store.Backend) {
+	run := mustRun(t, b, mustRepo(t, b, "repo").ID, "prompt")
+	first, err := b.CreateInteraction("req-1", run.ID, store.InteractionTypeApproval, "Bash", nil)
+	if err != nil {
+		t.Fatalf("CreateInteraction: %v", err)
+	}
+	if _, err := b.CreateInteraction("req-2", run.ID, store.InteractionTypeApproval, "Edit", nil); err != nil {
+		t.Fatalf("CreateInteraction: %v", err)
+	}
+
+	err = b.InTx(func(tx *sql.Tx) error {
+		pending, err := b.ListPendingInteractionsTx(tx, store.InteractionTypeApproval, run.ID, "Bash")
+		if err != nil {
+			return err
+		}
+		if len(pending) != 1 || pending[0].ID != first.ID {
+			t.Errorf("ListPendingInteractionsTx = %v", pending)
+		}
+		resolved, err := b.ResolveInteractionTx(tx, first.ID, store.InteractionDecisionBlock, ptr("no"), nil)
+		if err != nil {
+			return err
+		}
+		if resolved.State != store.InteractionStateResolved {
+			t.Errorf("ResolveInteractionTx state = %s", resolved.State)
+		}
+		_, err = b.ResolveInteractionTx(tx, first.ID, store.InteractionDecisionBlock, nil, nil)
+		if !errors.Is(err, store.ErrNotPending) {
+			t.Errorf("second ResolveInteractionTx err = %v, want ErrNotPending", err)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("InTx: %v", err)
+	}
+
+	// A failed transaction rolls back.
+	errRollback := errors.New("rollback")
+	err = b.InTx(func(tx *sql.Tx) error {
+		pending, err := b.ListPendingInteractionsTx(tx, store.InteractionTypeApproval, "", "")
+		if err != nil {
+			return err
+		}
+		for _, interaction := range pending {
+			if _, err := b.ResolveInteractionTx(tx, interaction.ID, store.InteractionDecisionAllow, nil, nil); err != nil {
+				return err
+			}
+		}
+		return errRollback
+	})
+	if !errors.Is(err, errRollback) {
+		t.Fatalf("InTx err = %v, want rollback", err)
+	}
+	pending, err := b.ListPendingInteractions()
+	if err != nil || len(pending) != 1 {
+		t.Errorf("pending after rollback = %d, %v; want 1", len(pending), err)
+	}
+}
+
+func testApprovals(t *testing.T, b store.Backend) {
+	run := mustRun(t, b, mustRepo(t, b, "repo").ID, "prompt")
+	event, err := b.CreateEvent(run.ID, "approval_requested", nil)
+	if err != nil {
+		t.Fatalf("CreateEvent: %v", err)
+	}
+
+	first, err := b.CreateApproval(run.ID, event.ID, store.ApprovalTypeCommand, ptr(`{"command":"rm"}`))
+	if err != nil {
+		t.Fatalf("CreateApproval: %v", err)
+	}
+	second, err := b.CreateApproval(run.ID, event.ID, store.ApprovalTypeDiff, nil)
+	if err != nil {
+		t.Fatalf("CreateApproval: %v", err)
+	}
+
+	if pending, err := b.ListPendingApprovals(); err != nil || len(pending) != 2 {
+		t.Errorf("ListPendingApprovals = %d, %v; want 2", len(pending), err)
+	}
+	if err := b.ApproveApproval(first.ID); err != nil {
+		t.Fatalf("ApproveApproval: %v", err)
+	}
+	if err := b.RejectApproval(second.ID, "too risky"); err != nil {
+		t.Fatalf("RejectApproval: %v", err)
+	}
+	if err := b.ApproveApproval(second.ID); !errors.Is(err, store.ErrNotFound) {
+		t.Errorf("approving a resolved approval err = %v, want ErrNotFound", err)
+	}
+
+	got, err := b.GetApproval(second.ID)
+	if err != nil || got.State != store.ApprovalStateRejected || got.RejectionReason == nil || *got.RejectionReason != "too risky" {
+		t.Errorf("GetApproval = %+v, %v", got, err)
+	}
+	if pending, err := b.ListPendingApprovalsByRun(run.ID); err != nil || len(pending) != 0 {
+		t.Errorf("ListPendingApprovalsByRun = %d, %v; want 0", len(pending), err)
+	}
+	if all, err := b.ListApprovalsByRun(run.ID); err != nil || len(all) != 2 {
+		t.Errorf("ListApprovalsByRun = %d, %v; want 2", len(all), err)
+	}
+
+	if err := b.DeleteApprovalsByRun(run.ID); err != nil {
+		t.Fatalf("DeleteApprovalsByRun: %v", err)
+	}
+	if _, err := b.GetApproval(first.ID); !errors.Is(err, store.ErrNotFound) {
+		t.Errorf("GetApproval after delete err = %v, want ErrNotFound", err)
+	}
+}
+
+func testDevices(t *testing.T, b store.Backend) {
+	if _, err := b.CreateDevice("token-1", store.PlatformIOS); err != nil {
+		t.Fatalf("CreateDevice: %v", err)
+	}
+	// Registering again replaces the device rather than failing.
+	if _, err := b.CreateDevice("token-1", store.PlatformIOS); err != nil {
+		t.Fatalf("CreateDevice again: %v", err)
+	}
+	if _, err := b.CreateDevice("token-2", store.PlatformIOS); err != nil {
+		t.Fatalf("CreateDevice: %v", err)
+	}
+
+	devices, err := b.ListDevices()
+	if err != nil || len(devices) != 2 {
+		t.Errorf("ListDevices = %d, %v; want 2", len(devices), err)
+	}
+	ios, err := b.ListDevicesByPlatform(store.PlatformIOS)
+	if err != nil || len(ios) != 2 {
+		t.Errorf("ListDevicesByPlatform = %d, %v; want 2", len(ios), err)
+	}
+	if got, err := b.GetDevice("token-1"); err != nil || got.Platform != store.PlatformIOS {
+		t.Errorf("GetDevice = %v, %v", got, err)
+	}
+
+	if err := b.DeleteDevice("token-1"); err != nil {
+		t.Fatalf("DeleteDevice: %v", err)
+	}
+	if _, err := b.GetDevice("token-1"); !errors.Is(err, store.ErrNotFound) {
+		t.Errorf("GetDevice after delete err = %v, want ErrNotFound", err)
+	}
+	if err := b.DeleteDevice("token-1"); !errors.Is(err, store.ErrNotFound) {
+		t.Errorf("DeleteDevice twice err = %v, want ErrNotFound", err)
+	}
+}
+
+func testUsersAndTokens(t *testing.T, b store.Backend) {
+	user, err := b.CreateUser("alice")
+	if err != nil {
+		t.Fatalf("CreateUser: %v", err)
+	}
+	if _, err := b.CreateUser("alice"); !errors.Is(err, store.ErrUserExists) {
+		t.Errorf("duplicate user err = %v, want ErrUserExists", err)
+	}
+	if got, err := b.GetUser(user.ID); err != nil || got.Name != "alice" {
+		t.Errorf("GetUser = %v, %v", got, err)
+	}
+	if users, err := b.ListUsers(); err != nil || len(users) != 1 {
+		t.Errorf("ListUsers = %d, %v; want 1", len(users), err)
+	}
+
+	expires := time.Now().Add(time.Hour)
+	token, plaintext, err := b.CreateToken(user.ID, "laptop", []store.Scope{store.ScopeRead, store.ScopeApprove}, &expires)
+	if err != nil {
+		t.Fatalf("CreateToken: %v", err)
+	}
+	authed, err := b.AuthenticateToken(plaintext)
+	if err != nil {
+		t.Fatalf("AuthenticateToken: %v", err)
+	}
+	if authed.ID != token.ID || len(authed.Scopes) != 2 || authed.UserID == nil || *authed.UserID != user.ID {
+		t.Errorf("AuthenticateToken = %+v", authed)
+	}
+	if _, err := b.AuthenticateToken(plaintext + "x"); !errors.Is(err, store.ErrInvalidToken) {
+		t.Errorf("wrong token err = %v, want ErrInvalidToken", err)
+	}
+
+	past := time.Now().Add(-time.Hour)
+	_, expired, err := b.CreateToken(user.ID, "old", []store.Scope{store.ScopeRead}, &past)
+	if err != nil {
+		t.Fatalf("CreateToken: %v", err)
+	}
+	if _, err := b.AuthenticateToken(expired); !errors.Is(err, store.ErrInvalidToken) {
+		t.Errorf("expired token err = %v, want ErrInvalidToken", err)
+	}
+
+	if tokens, err := b.ListTokens(user.ID); err != nil || len(tokens) != 2 {
+		t.Errorf("ListTokens = %d, %v; want 2", len(tokens), err)
+	}
+	if err := b.RevokeToken(token.ID); err != nil {
+		t.Fatalf("RevokeToken: %v", err)
+	}
+	if _, err := b.AuthenticateToken(plaintext); !errors.Is(err, store.ErrInvalidToken) {
+		t.Errorf("revoked token err = %v, want ErrInvalidToken", err)
+	}
+	if got, err := b.GetToken(token.ID); err != nil || got.RevokedAt == nil {
+		t.Errorf("GetToken = %v, %v; want revoked", got, err)
+	}
+
+	run := mustRun(t, b, mustRepo(t, b, "repo").ID, "prompt")
+	hook, hookPlaintext, err := b.CreateHookToken(run.ID, time.Now().Add(time.Hour))
+	if err != nil {
+		t.Fatalf("CreateHookToken: %v", err)
+	}
+	if hook.RunID == nil || *hook.RunID != run.ID {
+		t.Errorf("hook token run = %v", hook.RunID)
+	}
+	if err := b.RevokeRunTokens(run.ID); err != nil {
+		t.Fatalf("RevokeRunTokens: %v", err)
+	}
+	if _, err := b.AuthenticateToken(hookPlaintext); !errors.Is(err, store.ErrInvalidToken) {
+		t.Errorf("revoked hook token err = %v, want ErrInvalidToken", err)
+	}
+
+	if err := b.DeleteUser(user.ID); err != nil {
+		t.Fatalf("DeleteUser: %v", err)
+	}
+	if _, err := b.GetUser(user.ID); !errors.Is(err, store.ErrNotFound) {
+		t.Errorf("GetUser after delete err = %v, want ErrNotFound", err)
+	}
+}
+
+func testMembers(t *testing.T, b store.Backend) {
+	user, err := b.CreateUser("bob")
+	if err != nil {
+		t.Fatalf("CreateUser: %v", err)
+	}
+	visible := mustRepo(t, b, "visible")
+	hidden := mustRepo(t, b, "hidden")
+
+	if _, err := b.SetRepoMember(visible.ID, user.ID, store.RepoRoleViewer); err != nil {
+		t.Fatalf("SetRepoMember: %v", err)
+	}
+	// Setting again changes the role.
+	if _, err := b.SetRepoMember(visible.ID, user.ID, store.RepoRoleApprover); err != nil {
+		t.Fatalf("SetRepoMember again: %v", err)
+	}
+	member, err := b.GetRepoMember(visible.ID, user.ID)
+	if err != nil || member.Role != store.RepoRoleApprover {
+		t.Errorf("GetRepoMember = %v, %v; want approver", member, err)
+	}
+	if members, err := b.ListRepoMembers(visible.ID); err != nil || len(members) != 1 {
+		t.Errorf("ListRepoMembers = %d, %v; want 1", len(members), err)
+	}
+	roles, err := b.ListRepoRolesForUser(user.ID)
+	if err != nil || len(roles) != 1 || roles[visible.ID] != store.RepoRoleApprover {
+		t.Errorf("ListRepoRolesForUser = %v, %v", roles, err)
+	}
+
+	mustFinishedRun(t, b, visible.ID, "mine", store.RunStateCompleted)
+	mustRun(t, b, hidden.ID, "theirs")
+	if _, err := b.CreateInteraction("req-visible", mustRun(t, b, visible.ID, "active").ID, store.InteractionTypeApproval, "Bash", nil); err != nil {
+		t.Fatalf("CreateInteraction: %v", err)
+	}
+	hiddenRuns, err := b.ListRunsByRepo(hidden.ID)
+	if err != nil {
+		t.Fatalf("ListRunsByRepo: %v", err)
+	}
+	if _, err := b.CreateInteraction("req-hidden", hiddenRuns[0].ID, store.InteractionTypeApproval, "Bash", nil); err != nil {
+		t.Fatalf("CreateInteraction: %v", err)
+	}
+
+	repos, err := b.ListReposForUser(user.ID)
+	if err != nil || len(repos) != 1 || repos[0].ID != visible.ID {
+		t.Errorf("ListReposForUser = %v, %v", repos, err)
+	}
+	counts, err := b.CountRunsByStateForUser(user.ID)
+	if err != nil || counts[store.RunStateCompleted] != 1 || counts[store.RunStateRunning] != 1 {
+		t.Errorf("CountRunsByStateForUser = %v, %v", counts, err)
+	}
+	pending, err := b.ListPendingInteractionsForUser(user.ID)
+	if err != nil || len(pending) != 1 || pending[0].RequestID != "req-visible" {
+		t.Errorf("ListPendingInteractionsForUser = %v, %v", pending, err)
+	}
+	if list, err := b.ListInteractionsForUser(user.ID, "", nil); err != nil || len(list) != 1 {
+		t.Errorf("ListInteractionsForUser = %d, %v; want 1", len(list), err)
+	}
+	runs, _, err := b.ListRunsPage(store.RunFilter{UserID: user.ID})
+	if err != nil || len(runs) != 2 {
+		t.Errorf("ListRunsPage for user = %d, %v; want 2", len(runs), err)
+	}
+	for _, r := range runs {
+		if r.RepoID != visible.ID {
+			t.Errorf("run %s from repo %s visible to user", r.ID, r.RepoID)
+		}
+	}
+	if err := b.RemoveRepoMember(visible.ID, user.ID); err != nil {
+		t.Fatalf("RemoveRepoMember: %v", err)
+	}
+	if _, err := b.GetRepoMember(visible.ID, user.ID); !errors.Is(err, store.ErrNotFound) {
+		t.Errorf("GetRepoMember after remove err = %v, want ErrNotFound", err)
+	}
+	if err := b.RemoveRepoMember(visible.ID, user.ID); !errors.Is(err, store.ErrNotFound) {
+		t.Errorf("RemoveRepoMember twice err = %v, want ErrNotFound", err)
+	}
+}
+
+func testAudit(t *testing.T, b store.Backend) {
+	var ids []int64
+	for _, action := range []string{"run.create", "approval.resolve", "run.create"} {
+		entry := &store.AuditEntry{
+			Actor: "admin", Action: action, TargetType: "run", TargetID: "run-1",
+			Method: "POST", Path: "/api/runs", Status: 201, RemoteAddr: "127.0.0.1", UserAgent: "test",
+		}
+		if err := b.CreateAuditEntry(entry); err != nil {
+			t.Fatalf("CreateAuditEntry: %v", err)
+		}
+		if entry.ID == 0 || entry.CreatedAt.IsZero() {
+			t.Errorf("entry ID or CreatedAt not set: %+v", entry)
+		}
+		ids = append(ids, entry.ID)
+	}
+	if !(ids[0] < ids[1] && ids[1] < ids[2]) {
+		t.Errorf("audit IDs not increasing: %v", ids)
+	}
+
+	entries, err := b.ListAuditEntries(store.AuditFilter{Action: "run.create"})
+	if err != nil {
+		t.Fatalf("ListAuditEntries: %v", err)
+	}
+	if len(entries) != 2 || entries[0].ID != ids[2] {
+		t.Errorf("ListAuditEntries = %v; want newest first", entries)
+	}
+	if entries, err := b.ListAuditEntries(store.AuditFilter{Limit: 1}); err != nil || len(entries) != 1 {
+		t.Errorf("ListAuditEntries limit 1 = %d, %v", len(entries), err)
+	}
+}
+
+func testSearch(t *testing.T, b store.Backend) {
+	billing := mustRepo(t, b, "billing")
+	other := mustRepo(t, b, "other")
+	refactor := mustRun(t, b, billing.ID, "Refactor the billing module")
+	fix := mustFinishedRun(t, b, other.ID, "Fix login", store.RunStateCompleted)
+
+	output, err := b.CreateEvent(fix.ID, "stdout", ptr(`{"text":"updated billing totals"}`))
+	if err != nil {
+		t.Fatalf("CreateEvent: %v", err)
+	}
+	for typ, data := range map[string]string{
+		"tool_call_start": `{"call_id":"c1","tool":"Bash","input":{"command":"make migrate"}}`,
+		"stderr":          "not json",
+		"run_completed":   `{"text":"billing"}`,
+	} {
+		if _, err := b.CreateEvent(fix.ID, typ, ptr(data)); err != nil {
+			t.Fatalf("CreateEvent(%s): %v", typ, err)
+		}
+	}
+	approval, err := b.CreateInteraction("req-1", refactor.ID, store.InteractionTypeApproval, "Bash", ptr(`{"command":"drop table invoices"}`))
+	if err != nil {
+		t.Fatalf("CreateInteraction: %v", err)
+	}
+	input, err := b.CreateInteraction("req-2", refactor.ID, store.InteractionTypeInput, "AskUserQuestion", ptr(`{"question":"Which database?"}`))
+	if err != nil {
+		t.Fatalf("CreateInteraction: %v", err)
+	}
+	if err := b.ResolveInteraction(input.ID, store.InteractionDecisionAllow, nil, ptr("use staging")); err != nil {
+		t.Fatalf("ResolveInteraction: %v", err)
+	}
+
+	search := func(filter store.SearchFilter) []*store.SearchResult {
+		t.Helper()
+		results, _, err := b.Search(filter)
+		if err != nil {
+			t.Fatalf("Search(%+v): %v", filter, err)
+		}
+		return results
+	}
+	refs := func(results []*store.SearchResult) map[string]store.SearchKind {
+		got := make(map[string]store.SearchKind)
+		for _, r := range results {
+			got[r.RefID] = r.Kind
+		}
+		return got
+	}
+
+	results := search(store.SearchFilter{Query: "billing"})
+	if got := refs(results); len(got) != 2 || got[refactor.ID] != store.SearchKindPrompt || got[output.ID] != store.SearchKindOutput {
+		t.Errorf("Search(billing) = %v, want the prompt and the stdout event", got)
+	}
+	for _, r := range results {
+		var matched string
+		for _, p := range r.Snippet {
+			if p.Match {
+				matched += p.Text
+			}
+		}
+		if matched != "billing" {
+			t.Errorf("%s snippet = %+v, want billing marked", r.Kind, r.Snippet)
+		}
+		if r.Kind == store.SearchKindOutput && (r.Seq != output.Seq || r.Run.ID != fix.ID || r.RepoName != "other") {
+			t.Errorf("output result = %+v", r)
+		}
+	}
+
+	for _, tc := range []struct {
+		filter store.SearchFilter
+		want   []string
+	}{
+		{store.SearchFilter{Query: "BILLING  module"}, []string{refactor.ID}},
+		{store.SearchFilter{Query: "billing", RepoID: other.ID}, []string{output.ID}},
+		{store.SearchFilter{Query: "billing", Kinds: []store.SearchKind{store.SearchKindPrompt}}, []string{refactor.ID}},
+		{store.SearchFilter{Query: "billing login"}, nil},
+		{store.SearchFilter{Query: "invoices"}, []string{approval.ID}},
+		{store.SearchFilter{Query: "staging"}, []string{input.ID}},
+		{store.SearchFilter{Query: `" * "`}, nil},
+	} {
+		got := refs(search(tc.filter))
+		if len(got) != len(tc.want) {
+			t.Errorf("Search(%+v) = %v, want %v", tc.filter, got, tc.want)
+			continue
+		}
+		for _, id := range tc.want {
+			if _, ok := got[id]; !ok {
+				t.Errorf("Search(%+v) = %v, want %v", tc.filter, got, tc.want)
+			}
+		}
+	}
+	if got := search(store.SearchFilter{Query: "make"}); len(got) != 1 || got[0].Kind != store.SearchKindToolCall {
+		t.Errorf("Search(make) = %v, want the tool call", refs(got))
+	}
+
+	// Paging
+	first, next, err := b.Search(store.SearchFilter{Query: "billing", Page: store.Page{Limit: 1}})
+	if err != nil || len(first) != 1 || next == "" {
+		t.Fatalf("Search page 1 = %d results, next %q, %v", len(first), next, err)
+	}
+	second, next, err := b.Search(store.SearchFilter{Query: "billing", Page: store.Page{Limit: 1, Cursor: next}})
+	if err != nil || len(second) != 1 || next != "" || second[0].RefID == first[0].RefID {
+		t.Errorf("Search page 2 = %v, next %q, %v", refs(second), next, err)
+	}
+
+	// Members only see their repos.
+	user, err := b.CreateUser("carol")
+	if err != nil {
+		t.Fatalf("CreateUser: %v", err)
+	}
+	if _, err := b.SetRepoMember(billing.ID, user.ID, store.RepoRoleViewer); err != nil {
+		t.Fatalf("SetRepoMember: %v", err)
+	}
+	if got := refs(search(store.SearchFilter{Query: "billing", UserID: user.ID})); len(got) != 1 || got[refactor.ID] == "" {
+		t.Errorf("Search(billing) as member = %v, want only the billing repo's prompt", got)
+	}
+
+	// Archived output stays in the index.
+	if res, err := b.ArchiveOutput(time.Now().Add(time.Minute)); err != nil || res.Events != 2 {
+		t.Fatalf("ArchiveOutput = %+v, %v; want 2 events archived", res, err)
+	}
+	if got := search(store.SearchFilter{Query: "totals"}); len(got) != 1 || got[0].RefID != output.ID || got[0].Seq != output.Seq {
+		t.Errorf("Search(totals) after archiving = %v, want the archived stdout event", refs(got))
+	}
+
+	// Deleted events leave the index.
+	if err := b.DeleteEventsByRun(fix.ID); err != nil {
+		t.Fatalf("DeleteEventsByRun: %v", err)
+	}
+	if got := search(store.SearchFilter{Query: "totals"}); len(got) != 0 {
+		t.Errorf("Search(totals) after delete = %v, want none", refs(got))
+	}
+}
+
+func testCheck(t *testing.T, b store.Backend) {
+	for i := 0; i < 2; i++ {
+		if err := b.Check(context.Background()); err != nil {
+			t.Fatalf("Check: %v", err)
+		}
+	}
+	if err := b.WithContext(context.Background()).Check(context.Background()); err != nil {
+		t.Fatalf("Check with context: %v", err)
+	}
+}
+
+func testBackup(t *testing.T, b store.Backend) {
+	repo := mustRepo(t, b, "repo")
+	dest := filepath.Join(t.TempDir(), "backup.db")
+	err := b.Backup(dest)
+	if errors.Is(err, store.ErrBackupUnsupported) {
+		t.Skip("backend has no online backup")
+	}
+	if err != nil {
+		t.Fatalf("Backup: %v", err)
+	}
+
+	copied, err := store.New(dest)
+	if err != nil {
+		t.Fatalf("open backup: %v", err)
+	}
+	defer copied.Close()
+	if got, err := copied.GetRepo(repo.ID); err != nil || got.Name != repo.Name {
+		t.Errorf("backup repo = %v, %v; want %q", got, err, repo.Name)
+	}
+}
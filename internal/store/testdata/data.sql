@@ -0,0 +1,13 @@
+-- Sample rows valid for every historical schema version, used to check that
+-- upgrades preserve data.
+
+INSERT INTO repos (id, name, git_url, created_at) VALUES ('repo-1', 'fixture', 'https://example.com/fixture.git', 1700000000);
+INSERT INTO runs (id, repo_id, prompt, state, workspace_path, created_at, updated_at)
+	VALUES ('run-1', 'repo-1', 'fix the tests', 'completed', '/tmp/ws/run-1', 1700000100, 1700000200);
+INSERT INTO events (id, run_id, seq, type, data, created_at)
+	VALUES ('event-1', 'run-1', 1, 'stdout', '{"data":"hello"}', 1700000150);
+INSERT INTO approvals (id, run_id, event_id, type, state, payload, created_at)
+	VALUES ('approval-1', 'run-1', 'event-1', 'command', 'approved', '{}', 1700000160);
+INSERT INTO interactions (id, request_id, run_id, type, tool, payload, state, decision, created_at, resolved_at)
+	VALUES ('interaction-1', 'request-1', 'run-1', 'approval', 'Bash', '{"command":"ls"}', 'resolved', 'allow', 1700000170, 1700000180);
+INSERT INTO devices (token, platform, created_at) VALUES ('device-1', 'ios', 1700000000);
@@ -0,0 +1,70 @@
+-- Store schema as created by builds before versioned migrations, at
+-- what is now schema version 2.
+
+CREATE TABLE IF NOT EXISTS repos (
+	id TEXT PRIMARY KEY,
+	name TEXT NOT NULL,
+	git_url TEXT,
+	created_at INTEGER NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS runs (
+	id TEXT PRIMARY KEY,
+	repo_id TEXT NOT NULL REFERENCES repos(id),
+	prompt TEXT NOT NULL,
+	state TEXT NOT NULL CHECK(state IN ('running', 'waiting_input', 'waiting_approval', 'completed', 'failed', 'cancelled')),
+	workspace_path TEXT NOT NULL,
+	created_at INTEGER NOT NULL,
+	updated_at INTEGER NOT NULL
+);
+CREATE INDEX IF NOT EXISTS idx_runs_repo_id ON runs(repo_id);
+CREATE INDEX IF NOT EXISTS idx_runs_state ON runs(state);
+
+CREATE TABLE IF NOT EXISTS events (
+	id TEXT PRIMARY KEY,
+	run_id TEXT NOT NULL REFERENCES runs(id),
+	seq INTEGER NOT NULL,
+	type TEXT NOT NULL,
+	data TEXT,
+	created_at INTEGER NOT NULL,
+	UNIQUE(run_id, seq)
+);
+
+CREATE TABLE IF NOT EXISTS approvals (
+	id TEXT PRIMARY KEY,
+	run_id TEXT NOT NULL REFERENCES runs(id),
+	event_id TEXT NOT NULL REFERENCES events(id),
+	type TEXT NOT NULL CHECK(type IN ('diff', 'command', 'generic')),
+	state TEXT NOT NULL CHECK(state IN ('pending', 'approved', 'rejected')),
+	payload TEXT,
+	rejection_reason TEXT,
+	created_at INTEGER NOT NULL,
+	resolved_at INTEGER
+);
+CREATE INDEX IF NOT EXISTS idx_approvals_run_id ON approvals(run_id);
+CREATE INDEX IF NOT EXISTS idx_approvals_state ON approvals(state);
+
+CREATE TABLE IF NOT EXISTS devices (
+	token TEXT PRIMARY KEY,
+	platform TEXT NOT NULL CHECK(platform IN ('ios')),
+	created_at INTEGER NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS interactions (
+	id TEXT PRIMARY KEY,
+	request_id TEXT UNIQUE NOT NULL,
+	run_id TEXT NOT NULL REFERENCES runs(id),
+	type TEXT NOT NULL CHECK(type IN ('approval', 'input')),
+	tool TEXT NOT NULL,
+	payload TEXT,
+	state TEXT NOT NULL CHECK(state IN ('pending', 'resolved')),
+	decision TEXT,
+	message TEXT,
+	response TEXT,
+	updated_input TEXT,
+	created_at INTEGER NOT NULL,
+	resolved_at INTEGER
+);
+CREATE INDEX IF NOT EXISTS idx_interactions_run_id ON interactions(run_id);
+CREATE INDEX IF NOT EXISTS idx_interactions_request_id ON interactions(request_id);
+CREATE INDEX IF NOT EXISTS idx_interactions_state ON interactions(state);
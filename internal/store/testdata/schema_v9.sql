@@ -0,0 +1,227 @@
+-- Store schema at version 9, as recorded by builds with versioned
+-- migrations.
+
+CREATE TABLE IF NOT EXISTS repos (
+	id TEXT PRIMARY KEY,
+	name TEXT NOT NULL,
+	git_url TEXT,
+	created_at INTEGER NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS runs (
+	id TEXT PRIMARY KEY,
+	repo_id TEXT NOT NULL REFERENCES repos(id),
+	prompt TEXT NOT NULL,
+	state TEXT NOT NULL CHECK(state IN ('running', 'waiting_input', 'waiting_approval', 'completed', 'failed', 'cancelled')),
+	workspace_path TEXT NOT NULL,
+	created_at INTEGER NOT NULL,
+	updated_at INTEGER NOT NULL
+);
+CREATE INDEX IF NOT EXISTS idx_runs_repo_id ON runs(repo_id);
+CREATE INDEX IF NOT EXISTS idx_runs_state ON runs(state);
+CREATE INDEX IF NOT EXISTS idx_runs_repo_created ON runs(repo_id, created_at, id);
+CREATE INDEX IF NOT EXISTS idx_runs_created ON runs(created_at, id);
+
+CREATE TABLE IF NOT EXISTS events (
+	id TEXT PRIMARY KEY,
+	run_id TEXT NOT NULL REFERENCES runs(id),
+	seq INTEGER NOT NULL,
+	type TEXT NOT NULL,
+	data TEXT,
+	created_at INTEGER NOT NULL,
+	UNIQUE(run_id, seq)
+);
+
+CREATE TABLE IF NOT EXISTS approvals (
+	id TEXT PRIMARY KEY,
+	run_id TEXT NOT NULL REFERENCES runs(id),
+	event_id TEXT NOT NULL REFERENCES events(id),
+	type TEXT NOT NULL CHECK(type IN ('diff', 'command', 'generic')),
+	state TEXT NOT NULL CHECK(state IN ('pending', 'approved', 'rejected')),
+	payload TEXT,
+	rejection_reason TEXT,
+	created_at INTEGER NOT NULL,
+	resolved_at INTEGER
+);
+CREATE INDEX IF NOT EXISTS idx_approvals_run_id ON approvals(run_id);
+CREATE INDEX IF NOT EXISTS idx_approvals_state ON approvals(state);
+
+CREATE TABLE IF NOT EXISTS devices (
+	token TEXT PRIMARY KEY,
+	platform TEXT NOT NULL CHECK(platform IN ('ios')),
+	created_at INTEGER NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS interactions (
+	id TEXT PRIMARY KEY,
+	request_id TEXT UNIQUE NOT NULL,
+	run_id TEXT NOT NULL REFERENCES runs(id),
+	type TEXT NOT NULL CHECK(type IN ('approval', 'input')),
+	tool TEXT NOT NULL,
+	payload TEXT,
+	state TEXT NOT NULL CHECK(state IN ('pending', 'resolved')),
+	decision TEXT,
+	message TEXT,
+	response TEXT,
+	updated_input TEXT,
+	created_at INTEGER NOT NULL,
+	resolved_at INTEGER
+);
+CREATE INDEX IF NOT EXISTS idx_interactions_run_id ON interactions(run_id);
+CREATE INDEX IF NOT EXISTS idx_interactions_request_id ON interactions(request_id);
+CREATE INDEX IF NOT EXISTS idx_interactions_state ON interactions(state);
+CREATE INDEX IF NOT EXISTS idx_interactions_created ON interactions(created_at, id);
+
+CREATE TABLE IF NOT EXISTS users (
+	id TEXT PRIMARY KEY,
+	name TEXT UNIQUE NOT NULL,
+	created_at INTEGER NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS api_tokens (
+	id TEXT PRIMARY KEY,
+	user_id TEXT REFERENCES users(id) ON DELETE CASCADE,
+	run_id TEXT REFERENCES runs(id) ON DELETE CASCADE,
+	name TEXT NOT NULL,
+	token_hash TEXT UNIQUE NOT NULL,
+	prefix TEXT NOT NULL,
+	scopes TEXT NOT NULL,
+	created_at INTEGER NOT NULL,
+	expires_at INTEGER,
+	last_used_at INTEGER,
+	revoked_at INTEGER
+);
+CREATE INDEX IF NOT EXISTS idx_api_tokens_user_id ON api_tokens(user_id);
+CREATE INDEX IF NOT EXISTS idx_api_tokens_run_id ON api_tokens(run_id);
+
+CREATE TABLE IF NOT EXISTS repo_members (
+	repo_id TEXT NOT NULL REFERENCES repos(id) ON DELETE CASCADE,
+	user_id TEXT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+	role TEXT NOT NULL CHECK(role IN ('viewer', 'operator', 'approver', 'owner')),
+	created_at INTEGER NOT NULL,
+	PRIMARY KEY (repo_id, user_id)
+);
+CREATE INDEX IF NOT EXISTS idx_repo_members_user_id ON repo_members(user_id);
+
+CREATE TABLE IF NOT EXISTS audit_log (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	token_id TEXT,
+	user_id TEXT,
+	actor TEXT NOT NULL,
+	action TEXT NOT NULL,
+	target_type TEXT NOT NULL,
+	target_id TEXT NOT NULL,
+	method TEXT NOT NULL,
+	path TEXT NOT NULL,
+	status INTEGER NOT NULL,
+	remote_addr TEXT NOT NULL,
+	user_agent TEXT NOT NULL,
+	details TEXT,
+	created_at INTEGER NOT NULL
+);
+CREATE INDEX IF NOT EXISTS idx_audit_log_user_id ON audit_log(user_id);
+CREATE INDEX IF NOT EXISTS idx_audit_log_target ON audit_log(target_type, target_id);
+CREATE INDEX IF NOT EXISTS idx_audit_log_created_at ON audit_log(created_at);
+
+-- The audit log is append-only
+CREATE TRIGGER IF NOT EXISTS audit_log_no_update BEFORE UPDATE ON audit_log
+BEGIN SELECT RAISE(ABORT, 'audit log is append-only'); END;
+CREATE TRIGGER IF NOT EXISTS audit_log_no_delete BEFORE DELETE ON audit_log
+BEGIN SELECT RAISE(ABORT, 'audit log is append-only'); END;
+
+-- Single row rewritten by readiness checks to prove writes succeed
+CREATE TABLE IF NOT EXISTS health (
+	id INTEGER PRIMARY KEY CHECK(id = 1),
+	checked_at INTEGER NOT NULL
+);
+
+CREATE TABLE schema_migrations (
+	version INTEGER PRIMARY KEY,
+	name TEXT NOT NULL,
+	applied_at INTEGER NOT NULL
+);
+INSERT INTO schema_migrations (version, name, applied_at) VALUES
+	(1, 'initial', 1700000000),
+	(2, 'interaction_updated_input', 1700000000),
+	(3, 'users_and_tokens', 1700000000),
+	(4, 'audit_log', 1700000000),
+	(5, 'repo_members', 1700000000),
+	(6, 'health', 1700000000),
+	(7, 'list_indexes', 1700000000),
+	(8, 'event_archives', 1700000000),
+	(9, 'search_index', 1700000000);
+
+-- Output events of old runs, compacted by ArchiveOutput: a gzip of
+-- one JSON event per line
+CREATE TABLE event_archives (
+	run_id TEXT PRIMARY KEY REFERENCES runs(id) ON DELETE CASCADE,
+	data BLOB NOT NULL,
+	event_count INTEGER NOT NULL,
+	last_seq INTEGER NOT NULL,
+	archived_at INTEGER NOT NULL
+);
+
+-- One document per searchable text: a run's prompt, an output or
+-- tool_call_start event, or an interaction. Triggers on the source
+-- tables keep it current, and triggers on it keep the FTS index
+-- current.
+CREATE TABLE search_docs (
+	ref_id TEXT PRIMARY KEY,
+	kind TEXT NOT NULL CHECK(kind IN ('prompt', 'output', 'tool_call', 'interaction')),
+	run_id TEXT NOT NULL,
+	body TEXT NOT NULL,
+	created_at INTEGER NOT NULL
+);
+CREATE INDEX idx_search_docs_created ON search_docs(created_at, ref_id);
+
+CREATE VIRTUAL TABLE search_fts USING fts4(content="search_docs", body, tokenize=unicode61);
+CREATE TRIGGER search_docs_ai AFTER INSERT ON search_docs
+BEGIN INSERT INTO search_fts(docid, body) VALUES (new.rowid, new.body); END;
+CREATE TRIGGER search_docs_bu BEFORE UPDATE ON search_docs
+BEGIN DELETE FROM search_fts WHERE docid = old.rowid; END;
+CREATE TRIGGER search_docs_au AFTER UPDATE ON search_docs
+BEGIN INSERT INTO search_fts(docid, body) VALUES (new.rowid, new.body); END;
+CREATE TRIGGER search_docs_bd BEFORE DELETE ON search_docs
+BEGIN DELETE FROM search_fts WHERE docid = old.rowid; END;
+
+CREATE TRIGGER search_runs_ai AFTER INSERT ON runs
+BEGIN
+	INSERT INTO search_docs (ref_id, kind, run_id, body, created_at)
+	VALUES (new.id, 'prompt', new.id, new.prompt, new.created_at);
+END;
+CREATE TRIGGER search_runs_ad AFTER DELETE ON runs
+BEGIN DELETE FROM search_docs WHERE ref_id = old.id; END;
+
+CREATE TRIGGER search_events_ai AFTER INSERT ON events
+WHEN new.type IN ('stdout', 'stderr', 'tool_call_start') AND json_valid(new.data)
+BEGIN
+	INSERT INTO search_docs (ref_id, kind, run_id, body, created_at)
+	VALUES (new.id,
+		CASE new.type WHEN 'tool_call_start' THEN 'tool_call' ELSE 'output' END,
+		new.run_id,
+		CASE new.type
+			WHEN 'tool_call_start' THEN COALESCE(json_extract(new.data, '$.tool'), '') || ' ' || COALESCE(json_extract(new.data, '$.input'), '')
+			ELSE COALESCE(json_extract(new.data, '$.text'), '')
+		END,
+		new.created_at);
+END;
+CREATE TRIGGER search_events_ad AFTER DELETE ON events
+WHEN old.type IN ('stdout', 'stderr', 'tool_call_start')
+BEGIN DELETE FROM search_docs WHERE ref_id = old.id; END;
+
+CREATE TRIGGER search_interactions_ai AFTER INSERT ON interactions
+BEGIN
+	INSERT INTO search_docs (ref_id, kind, run_id, body, created_at)
+	VALUES (new.id, 'interaction', new.run_id,
+		new.tool || ' ' || COALESCE(new.payload, '') || ' ' || COALESCE(new.message, '') || ' ' ||
+			COALESCE(new.response, '') || ' ' || COALESCE(new.updated_input, ''),
+		new.created_at);
+END;
+CREATE TRIGGER search_interactions_au AFTER UPDATE ON interactions
+BEGIN
+	UPDATE search_docs SET body = new.tool || ' ' || COALESCE(new.payload, '') || ' ' ||
+		COALESCE(new.message, '') || ' ' || COALESCE(new.response, '') || ' ' || COALESCE(new.updated_input, '')
+	WHERE ref_id = new.id;
+END;
+CREATE TRIGGER search_interactions_ad AFTER DELETE ON interactions
+BEGIN DELETE FROM search_docs WHERE ref_id = old.id; END;
@@ -0,0 +1,41 @@
+package store
+
+import (
+	"context"
+
+	"github.com/anthropics/m/internal/migrate"
+	"github.com/anthropics/m/internal/tracing"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+var tracer = tracing.Tracer("github.com/anthropics/m/internal/store")
+
+// WithContext returns a Store sharing this one's connections whose
+// methods record spans as children of the span in ctx.
+func (s *Store) WithContext(ctx context.Context) Backend {
+	c := *s
+	c.ctx = ctx
+	return &c
+}
+
+// span starts a span for a store method and returns the function ending it.
+// Calls without a parent span, such as background polling, are not traced.
+func (s *Store) span(method string) func() {
+	if s.ctx == nil || !trace.SpanContextFromContext(s.ctx).IsValid() {
+		return func() {}
+	}
+	_, span := tracer.Start(s.ctx, "store."+method,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(attribute.String("db.system", s.dbSystem())),
+	)
+	return func() { span.End() }
+}
+
+// dbSystem names the database for the db.system span attribute.
+func (s *Store) dbSystem() string {
+	if s.dialect == migrate.Postgres {
+		return "postgresql"
+	}
+	return "sqlite"
+}
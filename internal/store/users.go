@@ -0,0 +1,449 @@
+package store
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Scope is a permission granted to an API token.
+type Scope string
+
+const (
+	// ScopeRead allows listing and viewing repos, runs, events and approvals.
+	ScopeRead Scope = "read"
+	// ScopeSteer allows creating and cancelling runs and sending input.
+	ScopeSteer Scope = "steer"
+	// ScopeApprove allows resolving approvals and input requests.
+	ScopeApprove Scope = "approve"
+	// ScopeAdmin allows everything, including managing users and tokens.
+	ScopeAdmin Scope = "admin"
+	// ScopeHook allows calling the internal hook endpoint only.
+	ScopeHook Scope = "hook"
+)
+
+// ValidScopes contains all valid token scopes.
+var ValidScopes = []Scope{ScopeRead, ScopeSteer, ScopeApprove, ScopeAdmin, ScopeHook}
+
+// IsValid returns true if the scope is a known scope.
+func (s Scope) IsValid() bool {
+	for _, valid := range ValidScopes {
+		if s == valid {
+			return true
+		}
+	}
+	return false
+}
+
+// User represents a person with access to the server.
+type User struct {
+	ID        string
+	Name      string
+	CreatedAt time.Time
+}
+
+// APIToken represents a bearer token. Only a hash of the token is stored.
+type APIToken struct {
+	ID         string
+	UserID     *string // Owning user; nil for per-run hook tokens
+	RunID      *string // Run a hook token is bound to
+	Name       string
+	Prefix     string // First characters of the token, for display
+	Scopes     []Scope
+	CreatedAt  time.Time
+	ExpiresAt  *time.Time
+	LastUsedAt *time.Time
+	RevokedAt  *time.Time
+}
+
+// HasScope returns true if the token grants the scope. Admin grants every scope.
+func (t *APIToken) HasScope(scope Scope) bool {
+	for _, s := range t.Scopes {
+		if s == scope || s == ScopeAdmin {
+			return true
+		}
+	}
+	return false
+}
+
+var (
+	// ErrUserExists is returned when creating a user with a name already in use.
+	ErrUserExists = errors.New("user already exists")
+	// ErrInvalidToken is returned when a token is unknown, revoked or expired.
+	ErrInvalidToken = errors.New("invalid token")
+)
+
+// tokenPrefix marks M API tokens so they are recognizable in config and logs.
+const tokenPrefix = "m_"
+
+// lastUsedResolution limits how often last_used_at is written for a token.
+const lastUsedResolution = time.Minute
+
+// CreateUser creates a new user.
+func (s *Store) CreateUser(name string) (*User, error) {
+	defer s.span("CreateUser")()
+
+	id := uuid.New().String()
+	now := time.Now().Unix()
+
+	err := s.writeTx(func(tx *sql.Tx) error {
+		var exists int
+		err := tx.QueryRow("SELECT 1 FROM users WHERE name = ?", name).Scan(&exists)
+		if err != nil && err != sql.ErrNoRows {
+			return fmt.Errorf("check user: %w", err)
+		}
+		if err == nil {
+			return ErrUserExists
+		}
+
+		_, err = tx.Exec(
+			"INSERT INTO users (id, name, created_at) VALUES (?, ?, ?)",
+			id, name, now,
+		)
+		if err != nil {
+			return fmt.Errorf("insert user: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &User{
+		ID:        id,
+		Name:      name,
+		CreatedAt: time.Unix(now, 0),
+	}, nil
+}
+
+// GetUser retrieves a user by ID.
+func (s *Store) GetUser(id string) (*User, error) {
+	defer s.span("GetUser")()
+
+	var user User
+	var createdAt int64
+
+	err := s.db.QueryRow(
+		"SELECT id, name, created_at FROM users WHERE id = ?",
+		id,
+	).Scan(&user.ID, &user.Name, &createdAt)
+
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("query user: %w", err)
+	}
+
+	user.CreatedAt = time.Unix(createdAt, 0)
+	return &user, nil
+}
+
+// ListUsers retrieves all users.
+func (s *Store) ListUsers() ([]*User, error) {
+	defer s.span("ListUsers")()
+
+	rows, err := s.db.Query("SELECT id, name, created_at FROM users ORDER BY created_at ASC")
+	if err != nil {
+		return nil, fmt.Errorf("query users: %w", err)
+	}
+	defer rows.Close()
+
+	var users []*User
+	for rows.Next() {
+		var user User
+		var createdAt int64
+		if err := rows.Scan(&user.ID, &user.Name, &createdAt); err != nil {
+			return nil, fmt.Errorf("scan user: %w", err)
+		}
+		user.CreatedAt = time.Unix(createdAt, 0)
+		users = append(users, &user)
+	}
+
+	return users, rows.Err()
+}
+
+// DeleteUser deletes a user and all of their tokens.
+func (s *Store) DeleteUser(id string) error {
+	defer s.span("DeleteUser")()
+
+	result, err := s.w.Exec("DELETE FROM users WHERE id = ?", id)
+	if err != nil {
+		return fmt.Errorf("delete user: %w", err)
+	}
+
+	n, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("rows affected: %w", err)
+	}
+	if n == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+// CreateToken creates a token for a user with the given scopes. The plaintext
+// token is returned once and never stored.
+func (s *Store) CreateToken(userID, name string, scopes []Scope, expiresAt *time.Time) (*APIToken, string, error) {
+	defer s.span("CreateToken")()
+	return s.createToken(&userID, nil, name, scopes, expiresAt)
+}
+
+// CreateHookToken creates a hook-scoped token bound to a single run. It is only
+// accepted while the run is active and until expiresAt.
+func (s *Store) CreateHookToken(runID string, expiresAt time.Time) (*APIToken, string, error) {
+	defer s.span("CreateHookToken")()
+	return s.createToken(nil, &runID, "hook:"+runID, []Scope{ScopeHook}, &expiresAt)
+}
+
+func (s *Store) createToken(userID, runID *string, name string, scopes []Scope, expiresAt *time.Time) (*APIToken, string, error) {
+	plaintext, err := generateToken()
+	if err != nil {
+		return nil, "", err
+	}
+
+	id := uuid.New().String()
+	now := time.Now().Unix()
+	prefix := plaintext[:len(tokenPrefix)+6]
+
+	var expires *int64
+	if expiresAt != nil {
+		e := expiresAt.Unix()
+		expires = &e
+	}
+
+	_, err = s.w.Exec(
+		`INSERT INTO api_tokens (id, user_id, run_id, name, token_hash, prefix, scopes, created_at, expires_at)
+		 VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		id, userID, runID, name, hashToken(plaintext), prefix, joinScopes(scopes), now, expires,
+	)
+	if err != nil {
+		return nil, "", fmt.Errorf("insert token: %w", err)
+	}
+
+	token := &APIToken{
+		ID:        id,
+		UserID:    userID,
+		RunID:     runID,
+		Name:      name,
+		Prefix:    prefix,
+		Scopes:    scopes,
+		CreatedAt: time.Unix(now, 0),
+	}
+	if expires != nil {
+		t := time.Unix(*expires, 0)
+		token.ExpiresAt = &t
+	}
+	return token, plaintext, nil
+}
+
+// AuthenticateToken looks up a plaintext token and returns it if it is valid.
+// Returns ErrInvalidToken if the token is unknown, revoked, expired, or bound
+// to a run that is no longer active.
+func (s *Store) AuthenticateToken(plaintext string) (*APIToken, error) {
+	defer s.span("AuthenticateToken")()
+	if !strings.HasPrefix(plaintext, tokenPrefix) {
+		return nil, ErrInvalidToken
+	}
+
+	token, err := s.scanToken(s.db.QueryRow(
+		`SELECT id, user_id, run_id, name, prefix, scopes, created_at, expires_at, last_used_at, revoked_at
+		 FROM api_tokens WHERE token_hash = ?`,
+		hashToken(plaintext),
+	))
+	if err == nil && token.RunID != nil {
+		var state string
+		err = s.db.QueryRow("SELECT state FROM runs WHERE id = ?", *token.RunID).Scan(&state)
+		if err == nil {
+			run := Run{State: RunState(state)}
+			if !run.IsActive() {
+				err = ErrInvalidToken
+			}
+		}
+	}
+
+	if err == ErrNotFound || err == sql.ErrNoRows {
+		return nil, ErrInvalidToken
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	if token.RevokedAt != nil || (token.ExpiresAt != nil && !now.Before(*token.ExpiresAt)) {
+		return nil, ErrInvalidToken
+	}
+
+	if token.LastUsedAt == nil || now.Sub(*token.LastUsedAt) >= lastUsedResolution {
+		_, err := s.w.Exec("UPDATE api_tokens SET last_used_at = ? WHERE id = ?", now.Unix(), token.ID)
+		if err != nil {
+			return nil, fmt.Errorf("update token last used: %w", err)
+		}
+		t := time.Unix(now.Unix(), 0)
+		token.LastUsedAt = &t
+	}
+
+	return token, nil
+}
+
+// GetToken retrieves a token by ID.
+func (s *Store) GetToken(id string) (*APIToken, error) {
+	defer s.span("GetToken")()
+
+	return s.scanToken(s.db.QueryRow(
+		`SELECT id, user_id, run_id, name, prefix, scopes, created_at, expires_at, last_used_at, revoked_at
+		 FROM api_tokens WHERE id = ?`,
+		id,
+	))
+}
+
+// ListTokens retrieves user tokens, optionally filtered by user. Per-run hook
+// tokens are not included.
+func (s *Store) ListTokens(userID string) ([]*APIToken, error) {
+	defer s.span("ListTokens")()
+
+	query := `SELECT id, user_id, run_id, name, prefix, scopes, created_at, expires_at, last_used_at, revoked_at
+		 FROM api_tokens WHERE run_id IS NULL`
+	args := []any{}
+
+	if userID != "" {
+		query += " AND user_id = ?"
+		args = append(args, userID)
+	}
+
+	query += " ORDER BY created_at ASC"
+
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("query tokens: %w", err)
+	}
+	defer rows.Close()
+
+	var tokens []*APIToken
+	for rows.Next() {
+		token, err := s.scanToken(rows)
+		if err != nil {
+			return nil, err
+		}
+		tokens = append(tokens, token)
+	}
+	return tokens, rows.Err()
+}
+
+// RevokeToken revokes a token. Revoked tokens are kept for reference.
+func (s *Store) RevokeToken(id string) error {
+	defer s.span("RevokeToken")()
+
+	result, err := s.w.Exec(
+		"UPDATE api_tokens SET revoked_at = ? WHERE id = ? AND revoked_at IS NULL",
+		time.Now().Unix(), id,
+	)
+	if err != nil {
+		return fmt.Errorf("revoke token: %w", err)
+	}
+
+	n, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("rows affected: %w", err)
+	}
+	if n == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+// RevokeRunTokens revokes all hook tokens bound to a run.
+func (s *Store) RevokeRunTokens(runID string) error {
+	defer s.span("RevokeRunTokens")()
+
+	_, err := s.w.Exec(
+		"UPDATE api_tokens SET revoked_at = ? WHERE run_id = ? AND revoked_at IS NULL",
+		time.Now().Unix(), runID,
+	)
+	if err != nil {
+		return fmt.Errorf("revoke run tokens: %w", err)
+	}
+
+	return nil
+}
+
+// rowScanner is implemented by *sql.Row and *sql.Rows.
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+func (s *Store) scanToken(row rowScanner) (*APIToken, error) {
+	var token APIToken
+	var scopes string
+	var createdAt int64
+	var expiresAt, lastUsedAt, revokedAt sql.NullInt64
+
+	err := row.Scan(
+		&token.ID, &token.UserID, &token.RunID, &token.Name, &token.Prefix, &scopes,
+		&createdAt, &expiresAt, &lastUsedAt, &revokedAt,
+	)
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("scan token: %w", err)
+	}
+
+	token.Scopes = splitScopes(scopes)
+	token.CreatedAt = time.Unix(createdAt, 0)
+	token.ExpiresAt = nullTime(expiresAt)
+	token.LastUsedAt = nullTime(lastUsedAt)
+	token.RevokedAt = nullTime(revokedAt)
+	return &token, nil
+}
+
+func nullTime(v sql.NullInt64) *time.Time {
+	if !v.Valid {
+		return nil
+	}
+	t := time.Unix(v.Int64, 0)
+	return &t
+}
+
+func joinScopes(scopes []Scope) string {
+	parts := make([]string, len(scopes))
+	for i, s := range scopes {
+		parts[i] = string(s)
+	}
+	return strings.Join(parts, " ")
+}
+
+func splitScopes(s string) []Scope {
+	fields := strings.Fields(s)
+	scopes := make([]Scope, len(fields))
+	for i, f := range fields {
+		scopes[i] = Scope(f)
+	}
+	return scopes
+}
+
+// generateToken returns a new random plaintext token.
+func generateToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("generate token: %w", err)
+	}
+	return tokenPrefix + base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// hashToken returns the hex-encoded SHA-256 of a token. Tokens are random and
+// high-entropy, so a fast hash is sufficient.
+func hashToken(plaintext string) string {
+	sum := sha256.Sum256([]byte(plaintext))
+	return hex.EncodeToString(sum[:])
+}
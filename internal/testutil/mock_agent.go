@@ -5,8 +5,12 @@ import (
 	"encoding/json"
 	"sync"
 	"time"
+
+	"github.com/anthropics/m/internal/run"
 )
 
+var _ run.Agent = (*MockAgent)(nil)
+
 // MockAgent simulates a Claude Code agent subprocess for testing.
 // It emits scripted events and can block for approval/input requests.
 type MockAgent struct {
@@ -22,16 +26,26 @@ type MockAgent struct {
 	// Output for stdout/stderr simulation
 	stdoutCh chan string
 	stderrCh chan string
+	usageCh  chan UsageData
 
 	// Lifecycle
 	running  bool
 	cancelFn context.CancelFunc
+	exit     *ExitData // Set by an exit event
+
+	// ModelName is the model the agent reports running with.
+	ModelName string
+
+	// SystemPrompt and Env are what the agent was started with: text
+	// appended to its system prompt and KEY=value environment variables.
+	SystemPrompt string
+	Env          []string
 }
 
 // MockEvent represents a scripted event that the mock agent will emit.
 type MockEvent struct {
 	// Type of event: "stdout", "stderr", "tool_start", "tool_end",
-	// "request_approval", "request_input", "exit"
+	// "request_approval", "request_input", "usage", "exit"
 	Type string
 
 	// Delay before emitting this event
@@ -69,19 +83,15 @@ type InputRequestData struct {
 	Question string
 }
 
+// UsageData contains data for usage events: the tokens and cost of one
+// model call.
+type UsageData = run.Usage
+
 // ExitData contains data for exit events.
-type ExitData struct {
-	Code  int
-	Error string
-}
+type ExitData = run.Exit
 
 // ApprovalRequest is sent when the mock agent needs approval.
-type ApprovalRequest struct {
-	ID      string
-	Type    string
-	Tool    string
-	Payload map[string]interface{}
-}
+type ApprovalRequest = run.ApprovalRequest
 
 // InputRequest is sent when the mock agent needs user input.
 type InputRequest struct {
@@ -90,10 +100,7 @@ type InputRequest struct {
 }
 
 // InteractionResponse is the response to an approval or input request.
-type InteractionResponse struct {
-	Approved bool   // For approvals
-	Reason   string // Rejection reason or input text
-}
+type InteractionResponse = run.InteractionResponse
 
 // NewMockAgent creates a new mock agent with the given scripted events.
 func NewMockAgent(events []MockEvent) *MockAgent {
@@ -104,21 +111,28 @@ func NewMockAgent(events []MockEvent) *MockAgent {
 		responseCh: make(chan InteractionResponse, 1),
 		stdoutCh:   make(chan string, 100),
 		stderrCh:   make(chan string, 100),
+		usageCh:    make(chan UsageData, 100),
 	}
 }
 
 // Start begins the mock agent execution.
-func (m *MockAgent) Start(ctx context.Context) error {
+func (m *MockAgent) Start(ctx context.Context, opts run.StartOptions) error {
 	ctx, cancel := context.WithCancel(ctx)
 	m.mu.Lock()
 	m.running = true
 	m.cancelFn = cancel
+	m.Env, m.SystemPrompt = opts.Env, opts.SystemPrompt
 	m.mu.Unlock()
 
 	go m.run(ctx)
 	return nil
 }
 
+// Model returns ModelName.
+func (m *MockAgent) Model() string {
+	return m.ModelName
+}
+
 // Stdout returns a channel that receives stdout output.
 func (m *MockAgent) Stdout() <-chan string {
 	return m.stdoutCh
@@ -129,6 +143,23 @@ func (m *MockAgent) Stderr() <-chan string {
 	return m.stderrCh
 }
 
+// Usage returns a channel of the agent's model call usage. Usage reported
+// before the agent exits is buffered until read.
+func (m *MockAgent) Usage() <-chan UsageData {
+	return m.usageCh
+}
+
+// Exit returns the status of an agent that exited by itself. ok is false
+// while the agent runs, and if it was cancelled or stopped on a rejection.
+func (m *MockAgent) Exit() (exit ExitData, ok bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.exit == nil {
+		return ExitData{}, false
+	}
+	return *m.exit, true
+}
+
 // ApprovalRequests returns a channel that receives approval requests.
 func (m *MockAgent) ApprovalRequests() <-chan ApprovalRequest {
 	return m.approvalCh
@@ -292,6 +323,16 @@ func (m *MockAgent) run(ctx context.Context) {
 				}
 			}
 
+		case "usage":
+			data, ok := event.Data.(UsageData)
+			if ok {
+				select {
+				case m.usageCh <- data:
+				case <-ctx.Done():
+					return
+				}
+			}
+
 		case "exit":
 			data, ok := event.Data.(ExitData)
 			if ok && data.Error != "" {
@@ -300,6 +341,9 @@ func (m *MockAgent) run(ctx context.Context) {
 				case <-ctx.Done():
 				}
 			}
+			m.mu.Lock()
+			m.exit = &data
+			m.mu.Unlock()
 			return
 		}
 	}
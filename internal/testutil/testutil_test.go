@@ -8,6 +8,7 @@ import (
 	"testing"
 	"time"
 
+	"github.com/anthropics/m/internal/run"
 	"github.com/anthropics/m/internal/store"
 )
 
@@ -93,7 +94,7 @@ func TestMockAgent_SimpleRun(t *testing.T) {
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
-	err := agent.Start(ctx)
+	err := agent.Start(ctx, run.StartOptions{})
 	if err != nil {
 		t.Fatalf("Start: %v", err)
 	}
@@ -122,7 +123,7 @@ func TestMockAgent_ApprovalFlow(t *testing.T) {
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
-	err := agent.Start(ctx)
+	err := agent.Start(ctx, run.StartOptions{})
 	if err != nil {
 		t.Fatalf("Start: %v", err)
 	}
@@ -162,7 +163,7 @@ func TestMockAgent_ApprovalRejection(t *testing.T) {
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
-	err := agent.Start(ctx)
+	err := agent.Start(ctx, run.StartOptions{})
 	if err != nil {
 		t.Fatalf("Start: %v", err)
 	}
@@ -190,7 +191,7 @@ func TestMockAgent_InputFlow(t *testing.T) {
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
-	err := agent.Start(ctx)
+	err := agent.Start(ctx, run.StartOptions{})
 	if err != nil {
 		t.Fatalf("Start: %v", err)
 	}
@@ -226,7 +227,7 @@ func TestMockAgent_Cancel(t *testing.T) {
 
 	ctx := context.Background()
 
-	err := agent.Start(ctx)
+	err := agent.Start(ctx, run.StartOptions{})
 	if err != nil {
 		t.Fatalf("Start: %v", err)
 	}
@@ -0,0 +1,188 @@
+// Package tracing configures OpenTelemetry tracing and tracks the long-lived
+// span of each run.
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sync"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Exporters accepted in Config.Exporter.
+const (
+	ExporterNone = "none"
+	ExporterOTLP = "otlp"
+	ExporterFile = "file"
+)
+
+// Config selects where spans are exported.
+type Config struct {
+	Exporter    string  // none, otlp or file
+	Endpoint    string  // OTLP/HTTP host:port; empty uses OTEL_EXPORTER_OTLP_ENDPOINT or localhost:4318
+	Insecure    bool    // Use plain HTTP for OTLP
+	File        string  // JSON lines output for the file exporter
+	SampleRatio float64 // Fraction of new traces sampled; children follow their parent
+	ServiceName string
+}
+
+// Tracer returns the named tracer from the global provider.
+func Tracer(name string) trace.Tracer {
+	return otel.Tracer(name)
+}
+
+// Setup installs the global tracer provider and W3C trace context propagation.
+// The returned function flushes and stops the exporter. With no exporter,
+// tracing stays disabled and spans are no-ops.
+func Setup(ctx context.Context, cfg Config) (func(context.Context) error, error) {
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+
+	var exporter sdktrace.SpanExporter
+	var closeFile func() error
+	switch cfg.Exporter {
+	case ExporterNone, "":
+		return func(context.Context) error { return nil }, nil
+	case ExporterOTLP:
+		var opts []otlptracehttp.Option
+		if cfg.Endpoint != "" {
+			opts = append(opts, otlptracehttp.WithEndpoint(cfg.Endpoint))
+		}
+		if cfg.Insecure {
+			opts = append(opts, otlptracehttp.WithInsecure())
+		}
+		exp, err := otlptracehttp.New(ctx, opts...)
+		if err != nil {
+			return nil, fmt.Errorf("create otlp exporter: %w", err)
+		}
+		exporter = exp
+	case ExporterFile:
+		if cfg.File == "" {
+			return nil, fmt.Errorf("tracing file exporter requires a file")
+		}
+		f, err := os.OpenFile(cfg.File, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+		if err != nil {
+			return nil, fmt.Errorf("open trace file: %w", err)
+		}
+		exp, err := stdouttrace.New(stdouttrace.WithWriter(f))
+		if err != nil {
+			f.Close()
+			return nil, fmt.Errorf("create file exporter: %w", err)
+		}
+		exporter, closeFile = exp, f.Close
+	default:
+		return nil, fmt.Errorf("unknown tracing exporter %q", cfg.Exporter)
+	}
+
+	serviceName := cfg.ServiceName
+	if serviceName == "" {
+		serviceName = "m"
+	}
+	ratio := cfg.SampleRatio
+	if ratio <= 0 {
+		ratio = 1
+	}
+
+	tp := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(resource.NewSchemaless(attribute.String("service.name", serviceName))),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(ratio))),
+	)
+	otel.SetTracerProvider(tp)
+
+	return func(ctx context.Context) error {
+		err := tp.Shutdown(ctx)
+		if closeFile != nil {
+			if cerr := closeFile(); err == nil {
+				err = cerr
+			}
+		}
+		return err
+	}, nil
+}
+
+// Runs holds the root span of each active run, so work done for a run across
+// many requests and goroutines lands in one trace.
+type Runs struct {
+	tracer trace.Tracer
+	mu     sync.Mutex
+	spans  map[string]trace.Span
+}
+
+// NewRuns creates an empty run span registry.
+func NewRuns() *Runs {
+	return &Runs{
+		tracer: Tracer("github.com/anthropics/m/internal/tracing"),
+		spans:  make(map[string]trace.Span),
+	}
+}
+
+// Start begins the root span of a run's trace, linked to the span in ctx that
+// created the run.
+func (r *Runs) Start(ctx context.Context, runID, repoID string) context.Context {
+	ctx, span := r.tracer.Start(ctx, "run",
+		trace.WithNewRoot(),
+		trace.WithLinks(trace.LinkFromContext(ctx)),
+		trace.WithAttributes(attribute.String("run.id", runID), attribute.String("repo.id", repoID)),
+	)
+	r.mu.Lock()
+	r.spans[runID] = span
+	r.mu.Unlock()
+	return ctx
+}
+
+// Context returns a context carrying the run's span, for starting its child
+// spans. Runs started before the server did have no span and get ctx
+// unchanged.
+func (r *Runs) Context(ctx context.Context, runID string) context.Context {
+	r.mu.Lock()
+	span, ok := r.spans[runID]
+	r.mu.Unlock()
+	if !ok {
+		return ctx
+	}
+	return trace.ContextWithSpan(ctx, span)
+}
+
+// Discard ends the span of a run that failed to be created.
+func (r *Runs) Discard(runID, reason string) {
+	r.mu.Lock()
+	span, ok := r.spans[runID]
+	delete(r.spans, runID)
+	r.mu.Unlock()
+	if ok {
+		span.SetStatus(codes.Error, reason)
+		span.End()
+	}
+}
+
+// State records a run state change. Terminal states end the run's span.
+func (r *Runs) State(runID, state string, terminal bool) {
+	r.mu.Lock()
+	span, ok := r.spans[runID]
+	if ok && terminal {
+		delete(r.spans, runID)
+	}
+	r.mu.Unlock()
+	if !ok {
+		return
+	}
+
+	span.AddEvent("state", trace.WithAttributes(attribute.String("run.state", state)))
+	if terminal {
+		span.SetAttributes(attribute.String("run.state", state))
+		if state == "failed" {
+			span.SetStatus(codes.Error, "run failed")
+		}
+		span.End()
+	}
+}
@@ -0,0 +1,114 @@
+package tracing
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// useRecorder installs a tracer provider recording ended spans for the test.
+func useRecorder(t *testing.T) *tracetest.SpanRecorder {
+	t.Helper()
+	rec := tracetest.NewSpanRecorder()
+	prev := otel.GetTracerProvider()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(rec)))
+	t.Cleanup(func() { otel.SetTracerProvider(prev) })
+	return rec
+}
+
+func TestSetup_FileExporter(t *testing.T) {
+	prev := otel.GetTracerProvider()
+	t.Cleanup(func() { otel.SetTracerProvider(prev) })
+
+	path := filepath.Join(t.TempDir(), "traces.jsonl")
+	shutdown, err := Setup(context.Background(), Config{Exporter: ExporterFile, File: path})
+	if err != nil {
+		t.Fatalf("Setup: %v", err)
+	}
+
+	_, span := Tracer("test").Start(context.Background(), "file-span")
+	span.End()
+	if err := shutdown(context.Background()); err != nil {
+		t.Fatalf("shutdown: %v", err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("read trace file: %v", err)
+	}
+	if !strings.Contains(string(data), `"Name":"file-span"`) {
+		t.Errorf("trace file does not contain the span: %s", data)
+	}
+}
+
+func TestSetup_Invalid(t *testing.T) {
+	if _, err := Setup(context.Background(), Config{Exporter: "zipkin"}); err == nil {
+		t.Error("expected error for unknown exporter")
+	}
+	if _, err := Setup(context.Background(), Config{Exporter: ExporterFile}); err == nil {
+		t.Error("expected error for file exporter without a file")
+	}
+	if _, err := Setup(context.Background(), Config{Exporter: ExporterNone}); err != nil {
+		t.Errorf("none exporter: %v", err)
+	}
+}
+
+func TestRuns(t *testing.T) {
+	rec := useRecorder(t)
+	runs := NewRuns()
+
+	reqCtx, req := Tracer("test").Start(context.Background(), "create-request")
+	ctx := runs.Start(reqCtx, "run-1", "repo-1")
+	req.End()
+
+	// Children share the run's trace, not the creating request's
+	_, child := Tracer("test").Start(runs.Context(context.Background(), "run-1"), "child")
+	child.End()
+
+	runs.State("run-1", "waiting_approval", false)
+	if len(rec.Ended()) != 2 {
+		t.Fatalf("run span ended before a terminal state")
+	}
+	runs.State("run-1", "failed", true)
+
+	spans := rec.Ended()
+	if len(spans) != 3 {
+		t.Fatalf("got %d ended spans, want 3", len(spans))
+	}
+	childSpan, runSpan := spans[1], spans[2]
+	if runSpan.Name() != "run" {
+		t.Fatalf("last span = %q, want run", runSpan.Name())
+	}
+	if runSpan.SpanContext().TraceID() == req.SpanContext().TraceID() {
+		t.Error("run span should start a new trace")
+	}
+	if len(runSpan.Links()) != 1 || runSpan.Links()[0].SpanContext.SpanID() != req.SpanContext().SpanID() {
+		t.Errorf("run span links = %v, want the creating request", runSpan.Links())
+	}
+	if childSpan.Parent().SpanID() != runSpan.SpanContext().SpanID() {
+		t.Error("child span is not parented to the run span")
+	}
+	if !trace.SpanContextFromContext(ctx).Equal(runSpan.SpanContext()) {
+		t.Error("Start did not return the run span's context")
+	}
+	if runSpan.Status().Code != codes.Error {
+		t.Errorf("failed run status = %v, want Error", runSpan.Status().Code)
+	}
+	if len(runSpan.Events()) != 2 {
+		t.Errorf("got %d state events, want 2", len(runSpan.Events()))
+	}
+
+	// Unknown or finished runs leave the context unchanged
+	base := context.Background()
+	if runs.Context(base, "run-1") != base {
+		t.Error("finished run still has a span")
+	}
+}